@@ -1,31 +1,56 @@
 package client
 
 import (
+	"errors"
 	"fmt"
 	"io"
+	"math"
 	"net"
+	"strings"
 	"time"
 
 	"github.com/Barberrrry/jcache/protocol"
 	"gopkg.in/fatih/pool.v2"
 )
 
+var (
+	// VersionMismatchError is returned by CompareAndSwap if key was changed by somebody else in all attempts
+	VersionMismatchError = errors.New("Key version does not match")
+	// WaitTimeoutError is returned by blocking pops if nothing was pushed before timeout
+	WaitTimeoutError = errors.New("Timeout expired while waiting for value")
+)
+
+// listEmptyMessage is an error message of server which means that blocking pop timeout expired
+const listEmptyMessage = "List is empty"
+
 // Client is a client for jcache server
 type Client struct {
 	addr     string
 	timeout  time.Duration
 	user     string
 	password string
+	framed   bool
 	connPool pool.Pool
 }
 
 // New creates new client instance
 func New(addr, user, password string, timeout time.Duration, maxConnections int) (*Client, error) {
+	return newClient(addr, user, password, timeout, maxConnections, false)
+}
+
+// NewFramed creates new client instance which uses length-prefixed framing mode.
+// This mode allows keys, fields and credentials to contain any bytes.
+func NewFramed(addr, user, password string, timeout time.Duration, maxConnections int) (*Client, error) {
+	return newClient(addr, user, password, timeout, maxConnections, true)
+}
+
+func newClient(addr, user, password string, timeout time.Duration, maxConnections int, framed bool) (*Client, error) {
 	client := &Client{
 		addr:     addr,
 		user:     user,
 		password: password,
 		timeout:  timeout,
+		framed:   framed,
 	}
 
 	if connPool, err := pool.NewChannelPool(0, maxConnections, client.connFactory); err == nil {
@@ -60,6 +85,96 @@ func (c *Client) Expire(key string, ttl uint64) error {
 	return response.Error
 }
 
+// PExpire updates key ttl specified in milliseconds
+func (c *Client) PExpire(key string, ttl uint64) error {
+	request := protocol.NewPExpireRequest()
+	request.Key = key
+	request.TTL = ttl
+	response := protocol.NewPExpireResponse()
+	if err := c.call(request, response); err != nil {
+		return err
+	}
+
+	return response.Error
+}
+
+// ExpireAt makes key expire at specified time with millisecond precision.
+// Key expires immediately if time is in the past.
+func (c *Client) ExpireAt(key string, expireTime time.Time) error {
+	request := protocol.NewPExpireAtRequest()
+	request.Key = key
+	if timestamp := expireTime.UnixNano() / int64(time.Millisecond); timestamp > 0 {
+		request.Timestamp = uint64(timestamp)
+	}
+	response := protocol.NewPExpireAtResponse()
+	if err := c.call(request, response); err != nil {
+		return err
+	}
+
+	return response.Error
+}
+
+// Touch extends expiration of sliding key, it fails if key doesn't exist
+func (c *Client) Touch(key string) error {
+	request := protocol.NewTouchRequest()
+	request.Key = key
+	response := protocol.NewTouchResponse()
+	if err := c.call(request, response); err != nil {
+		return err
+	}
+
+	return response.Error
+}
+
+// Persist removes key ttl, so key exists forever
+func (c *Client) Persist(key string) error {
+	request := protocol.NewPersistRequest()
+	request.Key = key
+	response := protocol.NewPersistResponse()
+	if err := c.call(request, response); err != nil {
+		return err
+	}
+
+	return response.Error
+}
+
+// Type returns type of key value: string, hash, list, set, zset or protocol.TypeNone if key doesn't exist
+func (c *Client) Type(key string) (string, error) {
+	request := protocol.NewTypeRequest()
+	request.Key = key
+	response := protocol.NewTypeResponse()
+	if err := c.call(request, response); err != nil {
+		return "", err
+	}
+
+	return response.Value, response.Error
+}
+
+// TTL returns remaining key ttl in seconds.
+// It returns protocol.TTLNoExpire if key exists forever and protocol.TTLNotExists if key doesn't exist.
+func (c *Client) TTL(key string) (int64, error) {
+	request := protocol.NewTTLRequest()
+	request.Key = key
+	response := protocol.NewTTLResponse()
+	if err := c.call(request, response); err != nil {
+		return 0, err
+	}
+
+	return response.Value, response.Error
+}
+
+// PTTL is like TTL but returns remaining key ttl in milliseconds
+func (c *Client) PTTL(key string) (int64, error) {
+	request := protocol.NewPTTLRequest()
+	request.Key = key
+	response := protocol.NewPTTLResponse()
+	if err := c.call(request, response); err != nil {
+		return 0, err
+	}
+
+	return response.Value, response.Error
+}
+
 // Get returns value by key
 func (c *Client) Get(key string) (string, error) {
 	request := protocol.NewGetRequest()
@@ -72,6 +187,52 @@ func (c *Client) Get(key string) (string, error) {
 	return response.Value, response.Error
 }
 
+// GetWithVersion returns value and version by key. Version is changed on every key change.
+func (c *Client) GetWithVersion(key string) (string, uint64, error) {
+	request := protocol.NewGetsRequest()
+	request.Key = key
+	response := protocol.NewGetsResponse()
+	if err := c.call(request, response); err != nil {
+		return "", 0, err
+	}
+
+	return response.Value, response.Version, response.Error
+}
+
+// Cas updates existing key only if its version is equal to passed one
+func (c *Client) Cas(key, value string, version uint64) error {
+	request := protocol.NewCasRequest()
+	request.Key = key
+	request.Value = value
+	request.Version = version
+	response := protocol.NewCasResponse()
+	if err := c.call(request, response); err != nil {
+		return err
+	}
+
+	return response.Error
+}
+
+// CompareAndSwap reads key value, modifies it by modify function and stores it back if key wasn't changed meanwhile.
+// Whole cycle is retried if key was changed by somebody else, VersionMismatchError is returned after attempts are exhausted.
+func (c *Client) CompareAndSwap(key string, attempts int, modify func(value string) (string, error)) error {
+	for i := 0; i < attempts; i++ {
+		value, version, err := c.GetWithVersion(key)
+		if err != nil {
+			return err
+		}
+		value, err = modify(value)
+		if err != nil {
+			return err
+		}
+		err = c.Cas(key, value, version)
+		if err == nil || !isVersionMismatch(err) {
+			return err
+		}
+	}
+	return VersionMismatchError
+}
+
 // Set sets new key value
 func (c *Client) Set(key, value string, ttl uint64) error {
 	request := protocol.NewSetRequest()
@@ -86,6 +247,120 @@ func (c *Client) Set(key, value string, ttl uint64) error {
 	return response.Error
 }
 
+// GetMulti returns values of several keys within one request.
+// Keys which values couldn't be returned are put into error map.
+func (c *Client) GetMulti(keys []string) (map[string]string, map[string]error, error) {
+	request := protocol.NewMGetRequest()
+	request.Keys = keys
+	response := protocol.NewMGetResponse()
+	if err := c.call(request, response); err != nil {
+		return nil, nil, err
+	}
+	if response.Error != nil {
+		return nil, nil, response.Error
+	}
+
+	values := make(map[string]string)
+	errs := make(map[string]error)
+	for i, key := range keys {
+		if i >= len(response.Values) {
+			break
+		}
+		if response.Errors[i] != nil {
+			errs[key] = response.Errors[i]
+		} else {
+			values[key] = response.Values[i]
+		}
+	}
+	return values, errs, nil
+}
+
+// SetMulti sets several keys with the same ttl within one request. Existing keys are overwritten.
+// Keys which couldn't be set are put into error map.
+func (c *Client) SetMulti(values map[string]string, ttl uint64) (map[string]error, error) {
+	request := protocol.NewMSetRequest()
+	request.TTL = ttl
+	for key, value := range values {
+		request.Keys = append(request.Keys, key)
+		request.Values = append(request.Values, value)
+	}
+	response := protocol.NewMSetResponse()
+	if err := c.call(request, response); err != nil {
+		return nil, err
+	}
+	if response.Error != nil {
+		return nil, response.Error
+	}
+	return keyErrors(request.Keys, response.Errors), nil
+}
+
+// DeleteMulti deletes several keys within one request. Keys which couldn't be deleted are put into error map.
+func (c *Client) DeleteMulti(keys []string) (map[string]error, error) {
+	request := protocol.NewMDelRequest()
+	request.Keys = keys
+	response := protocol.NewMDelResponse()
+	if err := c.call(request, response); err != nil {
+		return nil, err
+	}
+	if response.Error != nil {
+		return nil, response.Error
+	}
+	return keyErrors(keys, response.Errors), nil
+}
+
+// keyErrors maps failed keys to their errors
+func keyErrors(keys []string, errors []error) map[string]error {
+	errs := make(map[string]error)
+	for i, err := range errors {
+		if err != nil && i < len(keys) {
+			errs[keys[i]] = err
+		}
+	}
+	return errs
+}
+
+// SetOptions change behaviour of SetWithOptions
+type SetOptions struct {
+	// Condition is one of protocol.SetOptionNX (default), protocol.SetOptionXX or protocol.SetOptionUpsert
+	Condition string
+	// KeepTTL keeps ttl of existing key, ttl argument is used only for new key
+	KeepTTL bool
+	// Get makes previous value of key returned, it fails if existing key type is not string
+	Get bool
+	// Milliseconds makes ttl argument measured in milliseconds instead of seconds
+	Milliseconds bool
+	// Sliding makes key expire after ttl since the last access instead of fixed time
+	Sliding bool
+}
+
+// SetWithOptions sets key value according to options.
+// Previous value is returned only if Get option is used and key existed.
+func (c *Client) SetWithOptions(key, value string, ttl uint64, options SetOptions) (old string, existed bool, err error) {
+	request := protocol.NewSetRequest()
+	if options.Milliseconds {
+		request = protocol.NewPSetExRequest()
+	}
+	request.Key = key
+	request.Value = value
+	request.TTL = ttl
+	request.Condition = options.Condition
+	request.KeepTTL = options.KeepTTL
+	request.Get = options.Get
+	request.Sliding = options.Sliding
+	response := protocol.NewSetResponse()
+	if err := c.call(request, response); err != nil {
+		return "", false, err
+	}
+
+	return response.Value, response.Exists, response.Error
+}
+
+// Upsert sets key value and ttl regardless of key existence
+func (c *Client) Upsert(key, value string, ttl uint64) error {
+	_, _, err := c.SetWithOptions(key, value, ttl, SetOptions{Condition: protocol.SetOptionUpsert})
+	return err
+}
+
 // Update updates existing key
 func (c *Client) Update(key, value string) error {
 	request := protocol.NewUpdRequest()
@@ -99,6 +374,64 @@ func (c *Client) Update(key, value string) error {
 	return response.Error
 }
 
+// Increment increments integer value of key by one and returns the new value.
+// Missing key is created with zero value and ttl.
+func (c *Client) Increment(key string, ttl uint64) (int64, error) {
+	request := protocol.NewIncrRequest()
+	request.Key = key
+	request.TTL = ttl
+	response := protocol.NewIncrResponse()
+	if err := c.call(request, response); err != nil {
+		return 0, err
+	}
+
+	return response.Value, response.Error
+}
+
+// Decrement decrements integer value of key by one and returns the new value.
+// Missing key is created with zero value and ttl.
+func (c *Client) Decrement(key string, ttl uint64) (int64, error) {
+	request := protocol.NewDecrRequest()
+	request.Key = key
+	request.TTL = ttl
+	response := protocol.NewDecrResponse()
+	if err := c.call(request, response); err != nil {
+		return 0, err
+	}
+
+	return response.Value, response.Error
+}
+
+// IncrementBy increments integer value of key by delta and returns the new value.
+// Missing key is created with zero value and ttl.
+func (c *Client) IncrementBy(key string, delta int64, ttl uint64) (int64, error) {
+	request := protocol.NewIncrByRequest()
+	request.Key = key
+	request.Delta = delta
+	request.TTL = ttl
+	response := protocol.NewIncrByResponse()
+	if err := c.call(request, response); err != nil {
+		return 0, err
+	}
+
+	return response.Value, response.Error
+}
+
+// DecrementBy decrements integer value of key by delta and returns the new value.
+// Missing key is created with zero value and ttl.
+func (c *Client) DecrementBy(key string, delta int64, ttl uint64) (int64, error) {
+	request := protocol.NewDecrByRequest()
+	request.Key = key
+	request.Delta = delta
+	request.TTL = ttl
+	response := protocol.NewDecrByResponse()
+	if err := c.call(request, response); err != nil {
+		return 0, err
+	}
+
+	return response.Value, response.Error
+}
+
 // Delete deletes value by key
 func (c *Client) Delete(key string) error {
 	request := protocol.NewDelRequest()
@@ -113,9 +446,19 @@ func (c *Client) Delete(key string) error {
 
 // HashCreate creates new hash with ttl
 func (c *Client) HashCreate(key string, ttl uint64) error {
+	return c.hashCreate(key, ttl, false)
+}
+
+// HashCreateSliding creates new hash which expires after ttl since the last access
+func (c *Client) HashCreateSliding(key string, ttl uint64) error {
+	return c.hashCreate(key, ttl, true)
+}
+
+func (c *Client) hashCreate(key string, ttl uint64, sliding bool) error {
 	request := protocol.NewHashCreateRequest()
 	request.Key = key
 	request.TTL = ttl
+	request.Sliding = sliding
 	response := protocol.NewHashCreateResponse()
 	if err := c.call(request, response); err != nil {
 		return err
@@ -200,11 +543,143 @@ func (c *Client) HashLength(key string) (int, error) {
 	return response.Len, response.Error
 }
 
+// HashGetMulti returns values of several hash fields within one request.
+// Fields which values couldn't be returned are put into error map.
+func (c *Client) HashGetMulti(key string, fields []string) (map[string]string, map[string]error, error) {
+	request := protocol.NewHashGetMultiRequest()
+	request.Key = key
+	request.Fields = fields
+	response := protocol.NewHashGetMultiResponse()
+	if err := c.call(request, response); err != nil {
+		return nil, nil, err
+	}
+	if response.Error != nil {
+		return nil, nil, response.Error
+	}
+
+	values := make(map[string]string)
+	for i, field := range fields {
+		if i < len(response.Values) && response.Errors[i] == nil {
+			values[field] = response.Values[i]
+		}
+	}
+	return values, keyErrors(fields, response.Errors), nil
+}
+
+// HashSetMulti sets several hash fields within one request. Hash is created if it doesn't exist.
+func (c *Client) HashSetMulti(key string, values map[string]string) error {
+	request := protocol.NewHashSetMultiRequest()
+	request.Key = key
+	for field, value := range values {
+		request.Fields = append(request.Fields, field)
+		request.Values = append(request.Values, value)
+	}
+	response := protocol.NewHashSetMultiResponse()
+	if err := c.call(request, response); err != nil {
+		return err
+	}
+
+	return response.Error
+}
+
+// HashIncrementBy atomically adds delta to integer value of hash field and returns the new value.
+// Missing hash and field are created with zero value.
+func (c *Client) HashIncrementBy(key, field string, delta int64) (int64, error) {
+	request := protocol.NewHashIncrementByRequest()
+	request.Key = key
+	request.Field = field
+	request.Delta = delta
+	response := protocol.NewHashIncrementByResponse()
+	if err := c.call(request, response); err != nil {
+		return 0, err
+	}
+
+	return response.Value, response.Error
+}
+
+// HashSetIfNotExists sets hash field only if it doesn't exist and reports whether it was set
+func (c *Client) HashSetIfNotExists(key, field, value string) (bool, error) {
+	request := protocol.NewHashSetIfNotExistsRequest()
+	request.Key = key
+	request.Field = field
+	request.Value = value
+	response := protocol.NewHashSetIfNotExistsResponse()
+	if err := c.call(request, response); err != nil {
+		return false, err
+	}
+
+	return response.Value == 1, response.Error
+}
+
+// HashExists reports whether hash field exists
+func (c *Client) HashExists(key, field string) (bool, error) {
+	request := protocol.NewHashExistsRequest()
+	request.Key = key
+	request.Field = field
+	response := protocol.NewHashExistsResponse()
+	if err := c.call(request, response); err != nil {
+		return false, err
+	}
+
+	return response.Value == 1, response.Error
+}
+
+// HashExpire updates ttl of hash field, zero ttl makes field exist forever
+func (c *Client) HashExpire(key, field string, ttl uint64) error {
+	request := protocol.NewHashExpireRequest()
+	request.Key = key
+	request.Field = field
+	request.TTL = ttl
+	response := protocol.NewHashExpireResponse()
+	if err := c.call(request, response); err != nil {
+		return err
+	}
+
+	return response.Error
+}
+
+// HashTTL returns remaining ttl of hash field in seconds.
+// It returns protocol.TTLNoExpire if field exists forever and protocol.TTLNotExists if key or field doesn't exist.
+func (c *Client) HashTTL(key, field string) (int64, error) {
+	request := protocol.NewHashTTLRequest()
+	request.Key = key
+	request.Field = field
+	response := protocol.NewHashTTLResponse()
+	if err := c.call(request, response); err != nil {
+		return 0, err
+	}
+
+	return response.Value, response.Error
+}
+
+// HashPersist removes ttl of hash field, so field exists forever
+func (c *Client) HashPersist(key, field string) error {
+	request := protocol.NewHashPersistRequest()
+	request.Key = key
+	request.Field = field
+	response := protocol.NewHashPersistResponse()
+	if err := c.call(request, response); err != nil {
+		return err
+	}
+
+	return response.Error
+}
+
 // ListCreate creates new list with ttl
 func (c *Client) ListCreate(key string, ttl uint64) error {
+	return c.listCreate(key, ttl, false)
+}
+
+// ListCreateSliding creates new list which expires after ttl since the last access
+func (c *Client) ListCreateSliding(key string, ttl uint64) error {
+	return c.listCreate(key, ttl, true)
+}
+
+func (c *Client) listCreate(key string, ttl uint64, sliding bool) error {
 	request := protocol.NewListCreateRequest()
 	request.Key = key
 	request.TTL = ttl
+	request.Sliding = sliding
 	response := protocol.NewListCreateResponse()
 	if err := c.call(request, response); err != nil {
 		return err
@@ -251,6 +726,67 @@ func (c *Client) ListRightPop(key string) (string, error) {
 	return response.Value, response.Error
 }
 
+// ListBlockingLeftPop returns and removes the value from the beginning of the first non-empty list of keys.
+// If all lists are empty, it waits until value is pushed into any of them or timeout in seconds expires,
+// zero timeout means waiting forever. Key of the list is returned with value.
+// Waiting clients are served in order of their arrival, WaitTimeoutError is returned if timeout expires.
+func (c *Client) ListBlockingLeftPop(timeout uint64, keys ...string) (string, string, error) {
+	request := protocol.NewListBlockingLeftPopRequest()
+	request.Keys = keys
+	request.Timeout = timeout
+	response := protocol.NewListBlockingLeftPopResponse()
+	if err := c.callWithin(request, response, c.waitTimeout(timeout)); err != nil {
+		return "", "", err
+	}
+
+	return response.Key, response.Value, waitError(response.Error)
+}
+
+// ListBlockingRightPop returns and removes the value from the ending of the first non-empty list of keys.
+// If all lists are empty, it waits until value is pushed into any of them or timeout in seconds expires,
+// zero timeout means waiting forever. Key of the list is returned with value.
+// Waiting clients are served in order of their arrival, WaitTimeoutError is returned if timeout expires.
+func (c *Client) ListBlockingRightPop(timeout uint64, keys ...string) (string, string, error) {
+	request := protocol.NewListBlockingRightPopRequest()
+	request.Keys = keys
+	request.Timeout = timeout
+	response := protocol.NewListBlockingRightPopResponse()
+	if err := c.callWithin(request, response, c.waitTimeout(timeout)); err != nil {
+		return "", "", err
+	}
+
+	return response.Key, response.Value, waitError(response.Error)
+}
+
+// ListMove atomically pops value from the source list and pushes it into the destination list.
+// Ends are protocol.ListLeft or protocol.ListRight. It allows to keep value in progress list while it is processed.
+func (c *Client) ListMove(source, destination, from, to string) (string, error) {
+	request := protocol.NewListMoveRequest()
+	request.Source, request.Destination = source, destination
+	request.From, request.To = from, to
+	response := protocol.NewListMoveResponse()
+	if err := c.call(request, response); err != nil {
+		return "", err
+	}
+
+	return response.Value, response.Error
+}
+
+// ListBlockingMove is ListMove which waits until value is pushed into the source list or timeout in seconds expires,
+// zero timeout means waiting forever. WaitTimeoutError is returned if timeout expires.
+func (c *Client) ListBlockingMove(source, destination, from, to string, timeout uint64) (string, error) {
+	request := protocol.NewListBlockingMoveRequest()
+	request.Source, request.Destination = source, destination
+	request.From, request.To = from, to
+	request.Timeout = timeout
+	response := protocol.NewListBlockingMoveResponse()
+	if err := c.callWithin(request, response, c.waitTimeout(timeout)); err != nil {
+		return "", err
+	}
+
+	return response.Value, waitError(response.Error)
+}
+
 // ListLeftPop returns and removes the value from the list beginning
 func (c *Client) ListLeftPop(key string) (string, error) {
 	request := protocol.NewListLeftPopRequest()
@@ -275,7 +811,8 @@ func (c *Client) ListLength(key string) (int, error) {
 	return response.Len, response.Error
 }
 
-// ListRange returns all list values from start to stop
+// ListRange returns all list values from start to stop inclusive.
+// Negative indexes are counted from the list ending, so 0 and -1 mean the whole list.
 func (c *Client) ListRange(key string, start, stop int) ([]string, error) {
 	request := protocol.NewListRangeRequest()
 	request.Key = key
@@ -289,18 +826,351 @@ func (c *Client) ListRange(key string, start, stop int) ([]string, error) {
 	return response.Values, response.Error
 }
 
+// ListIndex returns list value by index, negative index is counted from the list ending
+func (c *Client) ListIndex(key string, index int) (string, error) {
+	request := protocol.NewListIndexRequest()
+	request.Key = key
+	request.Index = index
+	response := protocol.NewListIndexResponse()
+	if err := c.call(request, response); err != nil {
+		return "", err
+	}
+
+	return response.Value, response.Error
+}
+
+// ListSet replaces list value by index, negative index is counted from the list ending
+func (c *Client) ListSet(key string, index int, value string) error {
+	request := protocol.NewListSetRequest()
+	request.Key = key
+	request.Index = index
+	request.Value = value
+	response := protocol.NewListSetResponse()
+	if err := c.call(request, response); err != nil {
+		return err
+	}
+
+	return response.Error
+}
+
+// ListInsert inserts value before or after the first value equal to pivot and returns new length of the list.
+// Position is protocol.ListBefore or protocol.ListAfter.
+func (c *Client) ListInsert(key, position, pivot, value string) (int, error) {
+	request := protocol.NewListInsertRequest()
+	request.Key = key
+	request.Position = position
+	request.Pivot = pivot
+	request.Value = value
+	response := protocol.NewListInsertResponse()
+	if err := c.call(request, response); err != nil {
+		return 0, err
+	}
+
+	return response.Len, response.Error
+}
+
+// ListRemove removes up to count values equal to value and returns number of removed values.
+// Negative count removes values from the list ending, zero count removes all of them.
+func (c *Client) ListRemove(key string, count int, value string) (int64, error) {
+	request := protocol.NewListRemoveRequest()
+	request.Key = key
+	request.Count = count
+	request.Value = value
+	response := protocol.NewListRemoveResponse()
+	if err := c.call(request, response); err != nil {
+		return 0, err
+	}
+
+	return response.Value, response.Error
+}
+
+// ListTrim keeps only list values from start to stop inclusive, negative indexes are counted from the list ending.
+// Push followed by ListTrim(key, -n, -1) keeps list capped to the last n values.
+func (c *Client) ListTrim(key string, start, stop int) error {
+	request := protocol.NewListTrimRequest()
+	request.Key = key
+	request.Start = start
+	request.Stop = stop
+	response := protocol.NewListTrimResponse()
+	if err := c.call(request, response); err != nil {
+		return err
+	}
+
+	return response.Error
+}
+
+// SetAdd adds members to set and returns number of new members. Set is created if key doesn't exist.
+func (c *Client) SetAdd(key string, members ...string) (int64, error) {
+	request := protocol.NewSetAddRequest()
+	request.Key = key
+	request.Members = members
+	response := protocol.NewSetAddResponse()
+	if err := c.call(request, response); err != nil {
+		return 0, err
+	}
+
+	return response.Value, response.Error
+}
+
+// SetRemove removes members from set and returns number of removed members
+func (c *Client) SetRemove(key string, members ...string) (int64, error) {
+	request := protocol.NewSetRemoveRequest()
+	request.Key = key
+	request.Members = members
+	response := protocol.NewSetRemoveResponse()
+	if err := c.call(request, response); err != nil {
+		return 0, err
+	}
+
+	return response.Value, response.Error
+}
+
+// SetIsMember reports whether member is in set
+func (c *Client) SetIsMember(key, member string) (bool, error) {
+	request := protocol.NewSetIsMemberRequest()
+	request.Key = key
+	request.Member = member
+	response := protocol.NewSetIsMemberResponse()
+	if err := c.call(request, response); err != nil {
+		return false, err
+	}
+
+	return response.Value == 1, response.Error
+}
+
+// SetMembers returns sorted set members
+func (c *Client) SetMembers(key string) ([]string, error) {
+	request := protocol.NewSetMembersRequest()
+	request.Key = key
+	response := protocol.NewSetMembersResponse()
+	if err := c.call(request, response); err != nil {
+		return nil, err
+	}
+
+	return response.Values, response.Error
+}
+
+// SetLength returns count of set members
+func (c *Client) SetLength(key string) (int, error) {
+	request := protocol.NewSetLenRequest()
+	request.Key = key
+	response := protocol.NewSetLenResponse()
+	if err := c.call(request, response); err != nil {
+		return 0, err
+	}
+
+	return response.Len, response.Error
+}
+
+// SetIntersect returns sorted members which are in all sets. Missing keys are treated as empty sets.
+func (c *Client) SetIntersect(keys ...string) ([]string, error) {
+	request := protocol.NewSetIntersectRequest()
+	request.Keys = keys
+	response := protocol.NewSetIntersectResponse()
+	if err := c.call(request, response); err != nil {
+		return nil, err
+	}
+
+	return response.Values, response.Error
+}
+
+// SetUnion returns sorted members which are in any of sets. Missing keys are treated as empty sets.
+func (c *Client) SetUnion(keys ...string) ([]string, error) {
+	request := protocol.NewSetUnionRequest()
+	request.Keys = keys
+	response := protocol.NewSetUnionResponse()
+	if err := c.call(request, response); err != nil {
+		return nil, err
+	}
+
+	return response.Values, response.Error
+}
+
+// SetDiff returns sorted members of the first set which are not in other sets. Missing keys are treated as empty sets.
+func (c *Client) SetDiff(keys ...string) ([]string, error) {
+	request := protocol.NewSetDiffRequest()
+	request.Keys = keys
+	response := protocol.NewSetDiffResponse()
+	if err := c.call(request, response); err != nil {
+		return nil, err
+	}
+
+	return response.Values, response.Error
+}
+
+// ScoredMember is a member of sorted set with its score
+type ScoredMember struct {
+	Member string
+	Score  float64
+}
+
+// SortedSetAdd adds members or updates their scores and returns number of new members.
+// Sorted set is created if key doesn't exist.
+func (c *Client) SortedSetAdd(key string, members ...ScoredMember) (int64, error) {
+	request := protocol.NewSortedSetAddRequest()
+	request.Key = key
+	for _, m := range members {
+		request.Members = append(request.Members, m.Member)
+		request.Scores = append(request.Scores, m.Score)
+	}
+	response := protocol.NewSortedSetAddResponse()
+	if err := c.call(request, response); err != nil {
+		return 0, err
+	}
+
+	return response.Value, response.Error
+}
+
+// SortedSetRemove removes members from sorted set and returns number of removed members
+func (c *Client) SortedSetRemove(key string, members ...string) (int64, error) {
+	request := protocol.NewSortedSetRemoveRequest()
+	request.Key = key
+	request.Members = members
+	response := protocol.NewSortedSetRemoveResponse()
+	if err := c.call(request, response); err != nil {
+		return 0, err
+	}
+
+	return response.Value, response.Error
+}
+
+// SortedSetScore returns score of member
+func (c *Client) SortedSetScore(key, member string) (float64, error) {
+	request := protocol.NewSortedSetScoreRequest()
+	request.Key = key
+	request.Member = member
+	response := protocol.NewSortedSetScoreResponse()
+	if err := c.call(request, response); err != nil {
+		return 0, err
+	}
+
+	return response.Score, response.Error
+}
+
+// SortedSetIncrementBy adds delta to score of member and returns new score. Missing key and member are created.
+func (c *Client) SortedSetIncrementBy(key, member string, delta float64) (float64, error) {
+	request := protocol.NewSortedSetIncrementByRequest()
+	request.Key = key
+	request.Member = member
+	request.Delta = delta
+	response := protocol.NewSortedSetIncrementByResponse()
+	if err := c.call(request, response); err != nil {
+		return 0, err
+	}
+
+	return response.Score, response.Error
+}
+
+// SortedSetRange returns members from start to stop rank in ascending order of scores.
+// Negative ranks are counted from the end, -1 is the last member.
+func (c *Client) SortedSetRange(key string, start, stop int) ([]ScoredMember, error) {
+	request := protocol.NewSortedSetRangeRequest()
+	request.Key = key
+	request.Start = start
+	request.Stop = stop
+	response := protocol.NewSortedSetRangeResponse()
+	if err := c.call(request, response); err != nil {
+		return nil, err
+	}
+
+	return scoredMembers(response.Members, response.Scores), response.Error
+}
+
+// SortedSetReverseRange is like SortedSetRange but members are in descending order of scores
+func (c *Client) SortedSetReverseRange(key string, start, stop int) ([]ScoredMember, error) {
+	request := protocol.NewSortedSetReverseRangeRequest()
+	request.Key = key
+	request.Start = start
+	request.Stop = stop
+	response := protocol.NewSortedSetReverseRangeResponse()
+	if err := c.call(request, response); err != nil {
+		return nil, err
+	}
+
+	return scoredMembers(response.Members, response.Scores), response.Error
+}
+
+// SortedSetRangeByScore returns members with min <= score <= max in ascending order.
+// First offset members are skipped, count 0 means all following members.
+func (c *Client) SortedSetRangeByScore(key string, min, max float64, offset, count int) ([]ScoredMember, error) {
+	request := protocol.NewSortedSetRangeByScoreRequest()
+	request.Key = key
+	request.Min = min
+	request.Max = max
+	request.Offset = offset
+	request.Count = count
+	response := protocol.NewSortedSetRangeByScoreResponse()
+	if err := c.call(request, response); err != nil {
+		return nil, err
+	}
+
+	return scoredMembers(response.Members, response.Scores), response.Error
+}
+
+// SortedSetRank returns 0-based rank of member in ascending order of scores
+func (c *Client) SortedSetRank(key, member string) (int64, error) {
+	request := protocol.NewSortedSetRankRequest()
+	request.Key = key
+	request.Member = member
+	response := protocol.NewSortedSetRankResponse()
+	if err := c.call(request, response); err != nil {
+		return 0, err
+	}
+
+	return response.Value, response.Error
+}
+
+// SortedSetLength returns count of sorted set members
+func (c *Client) SortedSetLength(key string) (int, error) {
+	request := protocol.NewSortedSetLenRequest()
+	request.Key = key
+	response := protocol.NewSortedSetLenResponse()
+	if err := c.call(request, response); err != nil {
+		return 0, err
+	}
+
+	return response.Len, response.Error
+}
+
+func scoredMembers(members []string, scores []float64) []ScoredMember {
+	var scored []ScoredMember
+	for i, member := range members {
+		scored = append(scored, ScoredMember{Member: member, Score: scores[i]})
+	}
+	return scored
+}
+
 func (c *Client) connFactory() (net.Conn, error) {
 	conn, err := net.DialTimeout("tcp", c.addr, c.timeout)
 	if err != nil {
 		return nil, fmt.Errorf("Cannot connect: %s", err)
 	}
+	// Handshake must be finished within timeout too, deadline is reset by every call
+	if c.timeout > 0 {
+		conn.SetDeadline(time.Now().Add(c.timeout))
+	}
+
+	if c.framed {
+		request := protocol.NewModeRequest()
+		request.Mode = protocol.ModeFramed
+		response := protocol.NewModeResponse()
+
+		err = c.callRW(conn, request, response)
+		if err == nil {
+			err = response.Error
+		}
+		if err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("Cannot switch mode: %s", err)
+		}
+	}
 
 	request := protocol.NewAuthRequest()
 	request.User = c.user
 	request.Password = c.password
 	response := protocol.NewAuthResponse()
 
-	err = c.callRW(conn, request, response)
+	err = c.callRW(c.wrap(conn), request, response)
 	if err != nil {
 		return nil, err
 	}
@@ -312,13 +1182,47 @@ func (c *Client) connFactory() (net.Conn, error) {
 }
 
 func (c *Client) call(request protocol.Encoder, response protocol.Decoder) error {
+	return c.callWithin(request, response, c.timeout)
+}
+
+// callWithin fails if response isn't received within timeout, zero timeout means no limit.
+// Connection is not returned to pool after failure because the rest of response would break the following calls.
+func (c *Client) callWithin(request protocol.Encoder, response protocol.Decoder, timeout time.Duration) error {
 	conn, err := c.connPool.Get()
 	if err != nil {
 		return err
 	}
 	defer conn.Close()
 
-	return c.callRW(conn, request, response)
+	var deadline time.Time
+	if timeout > 0 {
+		deadline = time.Now().Add(timeout)
+	}
+	err = conn.SetDeadline(deadline)
+	if err == nil {
+		err = c.callRW(c.wrap(conn), request, response)
+	}
+	if err != nil {
+		markUnusable(conn)
+		return err
+	}
+	return nil
+}
+
+// waitTimeout returns call timeout of request which server holds up to seconds, zero means no limit
+func (c *Client) waitTimeout(seconds uint64) time.Duration {
+	if seconds == 0 || c.timeout == 0 || seconds > uint64((math.MaxInt64-c.timeout)/time.Second) {
+		return 0
+	}
+	return c.timeout + time.Duration(seconds)*time.Second
+}
+
+// wrap sets up framing mode of connection
+func (c *Client) wrap(rw io.ReadWriter) io.ReadWriter {
+	if c.framed {
+		return protocol.NewFramedReadWriter(rw)
+	}
+	return rw
 }
 
 func (c *Client) callRW(rw io.ReadWriter, request protocol.Encoder, response protocol.Decoder) error {
@@ -332,3 +1236,16 @@ func (c *Client) callRW(rw io.ReadWriter, request protocol.Encoder, response pro
 	}
 	return nil
 }
+
+// waitError replaces error of expired blocking pop with WaitTimeoutError
+func waitError(err error) error {
+	if err != nil && strings.HasSuffix(err.Error(), listEmptyMessage) {
+		return WaitTimeoutError
+	}
+	return err
+}
+
+// isVersionMismatch checks if error of CAS response is caused by changed key version
+func isVersionMismatch(err error) bool {
+	return strings.HasSuffix(err.Error(), VersionMismatchError.Error())
+}
@@ -0,0 +1,85 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"time"
+
+	"github.com/Barberrrry/jcache/protocol"
+	"gopkg.in/fatih/pool.v2"
+)
+
+// Pipeline queues requests and sends them to server within one connection write.
+// Responses are read in the same order as requests were added.
+type Pipeline struct {
+	client    *Client
+	requests  []protocol.Encoder
+	responses []protocol.Decoder
+}
+
+// Pipeline creates new empty pipeline
+func (c *Client) Pipeline() *Pipeline {
+	return &Pipeline{client: c}
+}
+
+// Add queues request. Response will be decoded into response argument on Exec.
+func (p *Pipeline) Add(request protocol.Encoder, response protocol.Decoder) {
+	p.requests = append(p.requests, request)
+	p.responses = append(p.responses, response)
+}
+
+// Len returns number of queued requests
+func (p *Pipeline) Len() int {
+	return len(p.requests)
+}
+
+// Exec sends all queued requests and decodes all responses. Queue is cleared after execution.
+// Returned error is related to encoding or connection, command errors are stored in responses.
+func (p *Pipeline) Exec() error {
+	requests, responses := p.requests, p.responses
+	p.requests, p.responses = nil, nil
+
+	if len(requests) == 0 {
+		return nil
+	}
+
+	data := &bytes.Buffer{}
+	writer := p.client.wrap(data)
+	for _, request := range requests {
+		if err := request.Encode(writer); err != nil {
+			return err
+		}
+	}
+
+	conn, err := p.client.connPool.Get()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// Duration of pipeline depends on number of requests, so deadline of the previous call is removed
+	if err := conn.SetDeadline(time.Time{}); err != nil {
+		markUnusable(conn)
+		return err
+	}
+	if _, err := data.WriteTo(conn); err != nil {
+		markUnusable(conn)
+		return err
+	}
+
+	reader := p.client.wrap(bufio.NewReadWriter(bufio.NewReader(conn), nil))
+	for _, response := range responses {
+		if err := response.Decode(reader); err != nil {
+			markUnusable(conn)
+			return err
+		}
+	}
+	return nil
+}
+
+// markUnusable prevents returning of broken connection back to the pool
+func markUnusable(conn interface{}) {
+	if pc, ok := conn.(*pool.PoolConn); ok {
+		pc.MarkUnusable()
+	}
+}
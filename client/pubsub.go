@@ -0,0 +1,154 @@
+package client
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/Barberrrry/jcache/protocol"
+)
+
+// subscriptionBufferSize is a number of received messages which may wait in Subscription.C
+const subscriptionBufferSize = 100
+
+// Message is received by subscription. Pattern is set if message is received by pattern subscription.
+type Message struct {
+	Pattern string
+	Channel string
+	Payload string
+}
+
+// Subscription receives messages published to its channels or patterns.
+// It uses its own connection which is not shared with other calls of client.
+type Subscription struct {
+	// C delivers received messages. It is closed when subscription is closed or connection fails.
+	C <-chan Message
+
+	conn   net.Conn
+	done   chan struct{}
+	mu     sync.Mutex
+	closed bool
+	err    error
+}
+
+// Publish sends message to subscribers of channel and returns number of subscribers which received it
+func (c *Client) Publish(channel, message string) (int, error) {
+	request := protocol.NewPublishRequest()
+	request.Channel = channel
+	request.Message = message
+	response := protocol.NewPublishResponse()
+	if err := c.call(request, response); err != nil {
+		return 0, err
+	}
+
+	return int(response.Value), response.Error
+}
+
+// Subscribe creates subscription to channels. Messages published after return of Subscribe are received in order.
+// If subscription reads messages slower than they are published, server drops messages or closes connection.
+func (c *Client) Subscribe(channels ...string) (*Subscription, error) {
+	return c.subscribe(channels, false)
+}
+
+// PSubscribe creates subscription to channels which match glob-style patterns
+func (c *Client) PSubscribe(patterns ...string) (*Subscription, error) {
+	return c.subscribe(patterns, true)
+}
+
+func (c *Client) subscribe(channels []string, isPattern bool) (*Subscription, error) {
+	request := protocol.NewSubscribeRequest()
+	if isPattern {
+		request = protocol.NewPSubscribeRequest()
+	}
+	request.Channels = channels
+	response := protocol.NewSubscribeResponse()
+
+	// Connection isn't taken from pool because it stays in subscriber mode until subscription is closed
+	conn, err := c.connFactory()
+	if err != nil {
+		return nil, err
+	}
+
+	reader := c.wrap(bufio.NewReadWriter(bufio.NewReader(conn), nil))
+	var deadline time.Time
+	if c.timeout > 0 {
+		deadline = time.Now().Add(c.timeout)
+	}
+	err = conn.SetDeadline(deadline)
+	if err == nil {
+		err = request.Encode(c.wrap(conn))
+	}
+	if err == nil {
+		err = response.Decode(reader)
+	}
+	if err == nil {
+		err = response.Error
+	}
+	// Messages may be published rarely, so reading them has no deadline
+	if err == nil {
+		err = conn.SetDeadline(time.Time{})
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	messages := make(chan Message, subscriptionBufferSize)
+	s := &Subscription{
+		C:    messages,
+		conn: conn,
+		done: make(chan struct{}),
+	}
+	go s.receive(reader, messages)
+	return s, nil
+}
+
+// Close closes connection of subscription, server unsubscribes it from all channels and patterns
+func (s *Subscription) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	close(s.done)
+	return s.conn.Close()
+}
+
+// Err returns error which stopped receiving of messages. It is nil if subscription is closed by Close.
+func (s *Subscription) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// receive reads messages from connection until it fails or subscription is closed
+func (s *Subscription) receive(reader io.Reader, messages chan<- Message) {
+	defer close(messages)
+
+	for {
+		response := protocol.NewMessageResponse()
+		err := response.Decode(reader)
+		if err == nil {
+			err = response.Error
+		}
+		if err != nil {
+			s.mu.Lock()
+			if !s.closed {
+				s.err = err
+			}
+			s.mu.Unlock()
+			s.conn.Close()
+			return
+		}
+
+		select {
+		case messages <- Message{Pattern: response.Pattern, Channel: response.Channel, Payload: response.Message}:
+		case <-s.done:
+			return
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package client
+
+import (
+	"github.com/Barberrrry/jcache/protocol"
+)
+
+// ScanOptions filter keys returned by SCAN. Empty option is not applied.
+type ScanOptions struct {
+	// Match is glob-style pattern of keys
+	Match string
+	// Count is a hint of how many keys server examines per page
+	Count int
+	// Type is a type of keys: string, hash or list
+	Type string
+}
+
+// ScanPage returns one page of keys starting from cursor and cursor of the next page.
+// Iteration starts and finishes with protocol.ScanStart cursor.
+func (c *Client) ScanPage(cursor string, options ScanOptions) (string, []string, error) {
+	request := protocol.NewScanRequest()
+	request.Cursor = cursor
+	request.Match = options.Match
+	request.Count = options.Count
+	request.Type = options.Type
+	response := protocol.NewScanResponse()
+	if err := c.call(request, response); err != nil {
+		return "", nil, err
+	}
+
+	return response.Cursor, response.Keys, response.Error
+}
+
+// HashScanPage returns one page of hash fields with values starting from cursor and cursor of the next page.
+// Iteration starts and finishes with protocol.ScanStart cursor. options.Type must be empty.
+func (c *Client) HashScanPage(key, cursor string, options ScanOptions) (string, map[string]string, error) {
+	request := protocol.NewHashScanRequest()
+	request.Key = key
+	request.Cursor = cursor
+	request.Match = options.Match
+	request.Count = options.Count
+	request.Type = options.Type
+	response := protocol.NewHashScanResponse()
+	if err := c.call(request, response); err != nil {
+		return "", nil, err
+	}
+
+	return response.Cursor, response.Fields, response.Error
+}
+
+// Scanner iterates over keys page by page without blocking server.
+// Every key which exists during the whole iteration is returned, but some keys may be returned more than once.
+type Scanner struct {
+	client  *Client
+	options ScanOptions
+	cursor  string
+	keys    []string
+	key     string
+	done    bool
+	err     error
+}
+
+// Scan creates scanner which iterates over all keys matching options
+func (c *Client) Scan(options ScanOptions) *Scanner {
+	return &Scanner{client: c, options: options, cursor: protocol.ScanStart}
+}
+
+// Next advances scanner to the next key. It returns false when iteration is finished or failed.
+func (s *Scanner) Next() bool {
+	for len(s.keys) == 0 {
+		if s.done || s.err != nil {
+			return false
+		}
+		s.cursor, s.keys, s.err = s.client.ScanPage(s.cursor, s.options)
+		if s.err != nil {
+			return false
+		}
+		s.done = s.cursor == protocol.ScanStart
+	}
+	s.key, s.keys = s.keys[0], s.keys[1:]
+	return true
+}
+
+// Key returns current key
+func (s *Scanner) Key() string {
+	return s.key
+}
+
+// Err returns error which stopped iteration
+func (s *Scanner) Err() error {
+	return s.err
+}
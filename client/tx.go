@@ -0,0 +1,64 @@
+package client
+
+import (
+	"github.com/Barberrrry/jcache/protocol"
+)
+
+// Tx queues requests which are executed by server atomically between MULTI and EXEC.
+// If any request fails, changes of all requests are rolled back.
+type Tx struct {
+	client    *Client
+	requests  []protocol.Encoder
+	responses []protocol.Decoder
+}
+
+// Tx creates new empty transaction
+func (c *Client) Tx() *Tx {
+	return &Tx{client: c}
+}
+
+// Add queues request. Response will be decoded into response argument on successful Exec.
+func (t *Tx) Add(request protocol.Encoder, response protocol.Decoder) {
+	t.requests = append(t.requests, request)
+	t.responses = append(t.responses, response)
+}
+
+// Len returns number of queued requests
+func (t *Tx) Len() int {
+	return len(t.requests)
+}
+
+// Exec sends transaction to server within one connection write. Queue is cleared after execution.
+// Returned error is related to connection or transaction failure, responses are decoded only if transaction succeeded.
+func (t *Tx) Exec() error {
+	requests, responses := t.requests, t.responses
+	t.requests, t.responses = nil, nil
+
+	p := t.client.Pipeline()
+
+	multi := protocol.NewMultiResponse()
+	p.Add(protocol.NewMultiRequest(), multi)
+
+	var queueErrors []func() error
+	for _, request := range requests {
+		queued := protocol.NewQueuedResponse()
+		p.Add(request, queued)
+		queueErrors = append(queueErrors, func() error { return queued.Error })
+	}
+
+	exec := protocol.NewExecResponse(responses...)
+	p.Add(protocol.NewExecRequest(), exec)
+
+	if err := p.Exec(); err != nil {
+		return err
+	}
+	if multi.Error != nil {
+		return multi.Error
+	}
+	for _, queueError := range queueErrors {
+		if err := queueError(); err != nil {
+			return err
+		}
+	}
+	return exec.Error
+}
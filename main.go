@@ -16,31 +16,48 @@ import (
 
 func main() {
 	storageType := server.StorageType(server.StorageMemory)
+	slowSubscriberPolicy := server.SlowSubscriberPolicy(server.SlowSubscriberDrop)
+	aofFsync := memory.FsyncPolicy(memory.FsyncEverySecond)
+	var keyspaceEvents server.KeyspaceEvents
 
 	htpasswdPath := flag.String("htpasswd", "", "Path to .htpasswd file for authentication. Leave blank to disable authentication.")
 	listen := flag.String("listen", ":9999", "Host and port to listen connection")
+	listenHTTP := flag.String("listen_http", "", "Host and port to listen HTTP requests to REST gateway. Leave blank to disable.")
+	listenMemcache := flag.String("listen_memcache", "", "Host and port to listen connection using memcached text protocol. Leave blank to disable.")
+	listenRESP := flag.String("listen_resp", "", "Host and port to listen connection using Redis protocol (RESP2). Leave blank to disable.")
 	flag.Var(&storageType, "storage_type", fmt.Sprintf("Type of storage (%s, %s, %s)", server.StorageMemory, server.StorageMultiMemory, server.StorageBolt))
 	storageMemorySize := flag.Uint("storage_memory_size", 10000, "Max number of stored elements")
 	storageMultiMemoryCount := flag.Uint("storage_multi_memory_count", 1, "Number of storages inside multi memory storage")
 	storageBoltPath := flag.String("storage_bolt_path", "", "Path to Bolt file")
 	storageGCInterval := flag.Duration("storage_gc_interval", time.Minute, "Storage GC interval")
+	storageAOFPath := flag.String("storage_aof_path", "", "Path to append-only file of memory storage, index of inner storage is appended to it for multi memory storage. Leave blank to disable persistence.")
+	flag.Var(&aofFsync, "storage_aof_fsync", fmt.Sprintf("How often append-only file is synced to disk (%s, %s, %s)", memory.FsyncAlways, memory.FsyncEverySecond, memory.FsyncNever))
+	pubSubQueueSize := flag.Int("pubsub_queue_size", server.DefaultSubscriberQueueSize, "Max number of messages waiting for delivery to one subscriber")
+	flag.Var(&slowSubscriberPolicy, "pubsub_slow_policy", fmt.Sprintf("What happens when queue of subscriber is full (%s, %s)", server.SlowSubscriberDrop, server.SlowSubscriberDisconnect))
+	flag.Var(&keyspaceEvents, "notify_keyspace_events", "Comma-separated keyspace events which are published to subscribers (set, del, expired, evicted, hash, list or all). Leave blank to disable.")
 	flag.Parse()
 
 	var storage storage.Storage
+	logger := log.New(os.Stdout, "", log.LstdFlags)
+	aofOptions := memory.AOFOptions{Path: *storageAOFPath, Fsync: aofFsync, Logger: logger}
 
 	log.Printf(`storage type is "%s"`, storageType)
 
 	switch storageType {
 	case server.StorageMemory:
 		var err error
-		storage, err = memory.NewStorage(int(*storageMemorySize), *storageGCInterval)
+		storage, err = newMemoryStorage(*storageMemorySize, *storageGCInterval, aofOptions)
 		if err != nil {
 			log.Fatalln(err)
 		}
 	case server.StorageMultiMemory:
 		ms := multi.NewStorage()
 		for i := uint(0); i < *storageMultiMemoryCount; i++ {
-			s, err := memory.NewStorage(int(*storageMemorySize), *storageGCInterval)
+			options := aofOptions
+			if options.Path != "" {
+				options.Path = fmt.Sprintf("%s.%d", options.Path, i)
+			}
+			s, err := newMemoryStorage(*storageMemorySize, *storageGCInterval, options)
 			if err != nil {
 				log.Fatalln(err)
 			}
@@ -56,6 +73,27 @@ func main() {
 		}
 	}
 
-	s := server.New(storage, *htpasswdPath, log.New(os.Stdout, "", log.LstdFlags))
+	s := server.New(storage, *htpasswdPath, logger)
+	s.SetSubscriberQueue(*pubSubQueueSize, slowSubscriberPolicy)
+	if err := s.SetKeyspaceEvents(keyspaceEvents); err != nil {
+		log.Fatalln(err)
+	}
+	if *listenRESP != "" {
+		go s.ListenAndServeRESP(*listenRESP)
+	}
+	if *listenHTTP != "" {
+		go s.ListenAndServeHTTP(*listenHTTP)
+	}
+	if *listenMemcache != "" {
+		go s.ListenAndServeMemcache(*listenMemcache)
+	}
 	s.ListenAndServe(*listen)
 }
+
+// newMemoryStorage creates memory storage which is persisted into append-only file if its path is set
+func newMemoryStorage(size uint, gcInterval time.Duration, options memory.AOFOptions) (storage.Storage, error) {
+	if options.Path == "" {
+		return memory.NewStorage(int(size), gcInterval)
+	}
+	return memory.NewStorageWithAOF(int(size), gcInterval, options)
+}
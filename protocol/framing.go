@@ -0,0 +1,116 @@
+package protocol
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+const (
+	// ModeText is a default human-readable mode, arguments are separated by spaces
+	ModeText = "TEXT"
+	// ModeFramed is a binary-safe mode, every argument is prefixed by its length
+	ModeFramed = "FRAMED"
+	// maxFramedArgs limits count of arguments of framed request
+	maxFramedArgs = 1024 * 1024
+)
+
+var (
+	invalidModeError = errors.New("Mode is not valid")
+)
+
+// FramedReadWriter wraps connection which uses length-prefixed framing mode.
+// Requests and responses encoded to or decoded from it use framed format instead of text one.
+type FramedReadWriter struct {
+	io.ReadWriter
+}
+
+// NewFramedReadWriter wraps rw to use length-prefixed framing mode
+func NewFramedReadWriter(rw io.ReadWriter) *FramedReadWriter {
+	return &FramedReadWriter{ReadWriter: rw}
+}
+
+func isFramed(v interface{}) bool {
+	_, ok := v.(*FramedReadWriter)
+	return ok
+}
+
+// encodeFramed writes request in format:
+// <command> <args_count>\r\n[<arg_length>\r\n<arg>\r\n...]
+func encodeFramed(writer io.Writer, command string, args ...interface{}) (err error) {
+	data := []byte(fmt.Sprintf("%s %d\r\n", command, len(args)))
+	for _, arg := range args {
+		value := fmt.Sprint(arg)
+		data = append(data, []byte(fmt.Sprintf("%d\r\n%s\r\n", len(value), value))...)
+	}
+	_, err = writer.Write(data)
+	return
+}
+
+// decodeFramed reads all request arguments and puts them into targets.
+// Targets may be pointers to string, int, int64, uint64 or float64.
+func decodeFramed(reader io.Reader, targets ...interface{}) error {
+	args, err := readFramedArgs(reader)
+	if err != nil {
+		return err
+	}
+	if len(args) != len(targets) {
+		return invalidRequestFormatError
+	}
+
+	for i, target := range targets {
+		switch t := target.(type) {
+		case *string:
+			*t = args[i]
+		case *int:
+			*t, err = strconv.Atoi(args[i])
+		case *int64:
+			*t, err = strconv.ParseInt(args[i], 10, 64)
+		case *uint64:
+			*t, err = strconv.ParseUint(args[i], 10, 64)
+		case *float64:
+			*t, err = parseScore(args[i])
+		default:
+			err = fmt.Errorf("Unsupported argument type %T", target)
+		}
+		if err != nil {
+			return invalidRequestFormatError
+		}
+	}
+	return nil
+}
+
+func readFramedArgs(reader io.Reader) ([]string, error) {
+	buf := newReader(reader)
+
+	var count int
+	_, err := fmt.Fscanf(buf, "%d\r\n", &count)
+	if err != nil || count < 0 || count > maxFramedArgs {
+		return nil, invalidRequestFormatError
+	}
+
+	args := make([]string, 0, count)
+	for i := 0; i < count; i++ {
+		arg, err := readFramedArg(buf)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+	}
+	return args, nil
+}
+
+func readFramedArg(buf *bufio.Reader) (string, error) {
+	var length int
+	_, err := fmt.Fscanf(buf, "%d\r\n", &length)
+	if err != nil {
+		return "", invalidRequestFormatError
+	}
+	value, err := readRequestValue(buf, length)
+	if err != nil {
+		return "", err
+	}
+	return string(value), nil
+}
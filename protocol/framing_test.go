@@ -0,0 +1,340 @@
+package protocol
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+
+	. "gopkg.in/check.v1"
+)
+
+type FramingTestSuite struct{}
+
+var _ = Suite(&FramingTestSuite{})
+
+func (s *FramingTestSuite) TestRequestEncode(c *C) {
+	request := newRequest("CMD")
+	data := &bytes.Buffer{}
+	err := request.Encode(NewFramedReadWriter(data))
+	c.Assert(err, IsNil)
+	c.Assert(data.Bytes(), DeepEquals, []byte("CMD 0\r\n"))
+}
+
+func (s *FramingTestSuite) TestRequestDecode(c *C) {
+	request := newRequest("CMD")
+	err := request.Decode(NewFramedReadWriter(bytes.NewBufferString(" 0\r\n")))
+	c.Assert(err, IsNil)
+}
+
+func (s *FramingTestSuite) TestSetEncode(c *C) {
+	request := NewSetRequest()
+	request.Key = "key with spaces:1"
+	request.Value = "value"
+	request.TTL = 60
+	data := &bytes.Buffer{}
+	err := request.Encode(NewFramedReadWriter(data))
+	c.Assert(err, IsNil)
+	c.Assert(data.String(), Equals, "SET 3\r\n17\r\nkey with spaces:1\r\n2\r\n60\r\n5\r\nvalue\r\n")
+}
+
+func (s *FramingTestSuite) TestSetEncodeError(c *C) {
+	request := NewSetRequest()
+	data := &bytes.Buffer{}
+	err := request.Encode(NewFramedReadWriter(data))
+	c.Assert(err, ErrorMatches, "Key is not valid")
+}
+
+func (s *FramingTestSuite) TestSetDecode(c *C) {
+	request := NewSetRequest()
+	err := request.Decode(NewFramedReadWriter(bytes.NewBufferString(" 3\r\n6\r\nkey\r\n1\r\n2\r\n60\r\n5\r\nvalue\r\n")))
+	c.Assert(err, IsNil)
+	c.Assert(request.Key, Equals, "key\r\n1")
+	c.Assert(request.TTL, Equals, uint64(60))
+	c.Assert(request.Value, Equals, "value")
+}
+
+func (s *FramingTestSuite) TestSetDecodeError(c *C) {
+	for _, str := range []string{
+		"\r\n",
+		" 2\r\n3\r\nkey\r\n2\r\n60\r\n",
+		" 3\r\n3\r\nkey\r\n3\r\nttl\r\n5\r\nvalue\r\n",
+		" 3\r\n3\r\nkey\r\n2\r\n60\r\n10\r\nvalue\r\n",
+		" 3\r\n-1\r\n",
+	} {
+		request := NewSetRequest()
+		err := request.Decode(NewFramedReadWriter(bytes.NewBufferString(str)))
+		c.Assert(err, ErrorMatches, "Invalid request format")
+	}
+}
+
+func (s *FramingTestSuite) TestSetOptionsEncodeDecode(c *C) {
+	request := NewSetRequest()
+	request.Key = "key"
+	request.Value = "value"
+	request.Condition = SetOptionUpsert
+	request.KeepTTL = true
+	data := &bytes.Buffer{}
+	err := request.Encode(NewFramedReadWriter(data))
+	c.Assert(err, IsNil)
+	c.Assert(data.String(), Equals, "SET 5\r\n3\r\nkey\r\n1\r\n0\r\n5\r\nvalue\r\n6\r\nUPSERT\r\n7\r\nKEEPTTL\r\n")
+
+	decoded := NewSetRequest()
+	err = decoded.Decode(NewFramedReadWriter(bytes.NewBufferString(strings.TrimPrefix(data.String(), "SET"))))
+	c.Assert(err, IsNil)
+	c.Assert(decoded, DeepEquals, request)
+}
+
+func (s *FramingTestSuite) TestKeyFieldValueEncodeDecode(c *C) {
+	request := NewHashSetRequest()
+	request.Key = "ключ"
+	request.Field = "field name"
+	request.Value = "value"
+	data := &bytes.Buffer{}
+	err := request.Encode(NewFramedReadWriter(data))
+	c.Assert(err, IsNil)
+
+	reader := NewFramedReadWriter(bufio.NewReadWriter(bufio.NewReader(data), nil))
+	command, err := ReadRequestCommand(reader)
+	c.Assert(err, IsNil)
+	c.Assert(command, Equals, "HSET")
+
+	decoded := NewHashSetRequest()
+	err = decoded.Decode(reader)
+	c.Assert(err, IsNil)
+	c.Assert(decoded.Key, Equals, "ключ")
+	c.Assert(decoded.Field, Equals, "field name")
+	c.Assert(decoded.Value, Equals, "value")
+}
+
+func (s *FramingTestSuite) TestOversizedHeaderDecodeError(c *C) {
+	for _, str := range []string{
+		" 4611686018427387904\r\n",
+		" 1\r\n4611686018427387904\r\n",
+		" 1\r\n9223372036854775807\r\n",
+	} {
+		_, err := readFramedArgs(NewFramedReadWriter(bytes.NewBufferString(str)))
+		c.Assert(err, ErrorMatches, "Invalid request format")
+		// Arguments of unknown command are skipped the same way
+		FlushRequest(NewFramedReadWriter(bytes.NewBufferString(str)))
+	}
+}
+
+func (s *FramingTestSuite) TestModeDecodeError(c *C) {
+	request := NewModeRequest()
+	err := request.Decode(bytes.NewBufferString("UNKNOWN\r\n"))
+	c.Assert(err, ErrorMatches, "Mode is not valid")
+}
+
+func (s *FramingTestSuite) TestKeysEncodeDecode(c *C) {
+	response := NewKeysResponse()
+	response.Keys = []string{"key 1", "key:2"}
+	data := &bytes.Buffer{}
+	err := response.Encode(NewFramedReadWriter(data))
+	c.Assert(err, IsNil)
+	c.Assert(data.String(), Equals, "COUNT 2\r\nKEY 5\r\nkey 1\r\nKEY 5\r\nkey:2\r\n")
+
+	decoded := NewKeysResponse()
+	err = decoded.Decode(NewFramedReadWriter(data))
+	c.Assert(err, IsNil)
+	c.Assert(decoded.Keys, DeepEquals, []string{"key 1", "key:2"})
+}
+
+func (s *FramingTestSuite) TestFieldsEncodeDecode(c *C) {
+	response := NewHashGetAllResponse()
+	response.Fields = map[string]string{"field 1": "value"}
+	data := &bytes.Buffer{}
+	err := response.Encode(NewFramedReadWriter(data))
+	c.Assert(err, IsNil)
+	c.Assert(data.String(), Equals, "COUNT 1\r\nFIELD 7 5\r\nfield 1\r\nvalue\r\n")
+
+	decoded := NewHashGetAllResponse()
+	err = decoded.Decode(NewFramedReadWriter(data))
+	c.Assert(err, IsNil)
+	c.Assert(decoded.Fields, DeepEquals, map[string]string{"field 1": "value"})
+}
+
+func (s *FramingTestSuite) TestKeyFieldValuesEncodeDecode(c *C) {
+	request := NewHashSetMultiRequest()
+	request.Key = "key 1"
+	request.Fields = []string{"field 1", ""}
+	request.Values = []string{"value 1", "value 2"}
+	data := &bytes.Buffer{}
+	err := request.Encode(NewFramedReadWriter(data))
+	c.Assert(err, IsNil)
+	c.Assert(data.String(), Equals, "HMSET 5\r\n5\r\nkey 1\r\n7\r\nfield 1\r\n7\r\nvalue 1\r\n0\r\n\r\n7\r\nvalue 2\r\n")
+
+	decoded := NewHashSetMultiRequest()
+	err = decoded.Decode(NewFramedReadWriter(bytes.NewBufferString(strings.TrimPrefix(data.String(), "HMSET"))))
+	c.Assert(err, IsNil)
+	c.Assert(decoded, DeepEquals, request)
+
+	err = decoded.Decode(NewFramedReadWriter(bytes.NewBufferString(" 2\r\n3\r\nkey\r\n5\r\nfield\r\n")))
+	c.Assert(err, ErrorMatches, "Invalid request format")
+}
+
+func (s *FramingTestSuite) TestHashScanEncodeDecode(c *C) {
+	request := NewHashScanRequest()
+	request.Key = "key 1"
+	request.Cursor = ScanStart
+	request.Match = "a b*"
+	data := &bytes.Buffer{}
+	err := request.Encode(NewFramedReadWriter(data))
+	c.Assert(err, IsNil)
+	c.Assert(data.String(), Equals, "HSCAN 4\r\n5\r\nkey 1\r\n1\r\n0\r\n5\r\nMATCH\r\n4\r\na b*\r\n")
+
+	decoded := NewHashScanRequest()
+	err = decoded.Decode(NewFramedReadWriter(bytes.NewBufferString(strings.TrimPrefix(data.String(), "HSCAN"))))
+	c.Assert(err, IsNil)
+	c.Assert(decoded, DeepEquals, request)
+
+	response := NewHashScanResponse()
+	response.Cursor = "61"
+	response.Fields = map[string]string{"field 1": "value"}
+	data = &bytes.Buffer{}
+	err = response.Encode(NewFramedReadWriter(data))
+	c.Assert(err, IsNil)
+	c.Assert(data.String(), Equals, "CURSOR 61\r\nCOUNT 1\r\nFIELD 7 5\r\nfield 1\r\nvalue\r\n")
+
+	decodedResponse := NewHashScanResponse()
+	err = decodedResponse.Decode(NewFramedReadWriter(data))
+	c.Assert(err, IsNil)
+	c.Assert(decodedResponse.Fields, DeepEquals, response.Fields)
+}
+
+func (s *FramingTestSuite) TestBlockingPopEncodeDecode(c *C) {
+	request := NewListBlockingRightPopRequest()
+	request.Keys = []string{"key 1", "key 2"}
+	request.Timeout = 0
+	data := &bytes.Buffer{}
+	err := request.Encode(NewFramedReadWriter(data))
+	c.Assert(err, IsNil)
+	c.Assert(data.String(), Equals, "BRPOP 3\r\n5\r\nkey 1\r\n5\r\nkey 2\r\n1\r\n0\r\n")
+
+	decoded := NewListBlockingRightPopRequest()
+	err = decoded.Decode(NewFramedReadWriter(bytes.NewBufferString(strings.TrimPrefix(data.String(), "BRPOP"))))
+	c.Assert(err, IsNil)
+	c.Assert(decoded, DeepEquals, request)
+
+	response := NewListBlockingRightPopResponse()
+	response.Key = "key 1"
+	response.Value = "value"
+	data = &bytes.Buffer{}
+	err = response.Encode(NewFramedReadWriter(data))
+	c.Assert(err, IsNil)
+	c.Assert(data.String(), Equals, "KEYVALUE 5 5\r\nkey 1\r\nvalue\r\n")
+
+	decodedResponse := NewListBlockingRightPopResponse()
+	err = decodedResponse.Decode(NewFramedReadWriter(data))
+	c.Assert(err, IsNil)
+	c.Assert(decodedResponse.Key, Equals, "key 1")
+	c.Assert(decodedResponse.Value, Equals, "value")
+}
+
+func (s *FramingTestSuite) TestListMoveEncodeDecode(c *C) {
+	request := NewListBlockingMoveRequest()
+	request.Source = "source list"
+	request.Destination = "destination"
+	request.From = ListRight
+	request.To = ListLeft
+	request.Timeout = 1
+	data := &bytes.Buffer{}
+	err := request.Encode(NewFramedReadWriter(data))
+	c.Assert(err, IsNil)
+	c.Assert(data.String(), Equals, "BLMOVE 5\r\n11\r\nsource list\r\n11\r\ndestination\r\n5\r\nRIGHT\r\n4\r\nLEFT\r\n1\r\n1\r\n")
+
+	decoded := NewListBlockingMoveRequest()
+	err = decoded.Decode(NewFramedReadWriter(bytes.NewBufferString(strings.TrimPrefix(data.String(), "BLMOVE"))))
+	c.Assert(err, IsNil)
+	c.Assert(decoded, DeepEquals, request)
+}
+
+func (s *FramingTestSuite) TestListInsertEncodeDecode(c *C) {
+	request := NewListInsertRequest()
+	request.Key = "key 1"
+	request.Position = ListAfter
+	request.Pivot = "a\r\nb"
+	request.Value = ""
+	data := &bytes.Buffer{}
+	err := request.Encode(NewFramedReadWriter(data))
+	c.Assert(err, IsNil)
+	c.Assert(data.String(), Equals, "LINSERT 4\r\n5\r\nkey 1\r\n5\r\nAFTER\r\n4\r\na\r\nb\r\n0\r\n\r\n")
+
+	decoded := NewListInsertRequest()
+	err = decoded.Decode(NewFramedReadWriter(bytes.NewBufferString(strings.TrimPrefix(data.String(), "LINSERT"))))
+	c.Assert(err, IsNil)
+	c.Assert(decoded, DeepEquals, request)
+
+	err = decoded.Decode(NewFramedReadWriter(bytes.NewBufferString(" 4\r\n3\r\nkey\r\n2\r\nUP\r\n1\r\na\r\n1\r\nb\r\n")))
+	c.Assert(err, ErrorMatches, "Option is not valid")
+}
+
+func (s *FramingTestSuite) TestMultiSetEncodeDecode(c *C) {
+	request := NewMSetRequest()
+	request.Keys = []string{"key 1", "key 2"}
+	request.Values = []string{"value 1", "value 2"}
+	data := &bytes.Buffer{}
+	err := request.Encode(NewFramedReadWriter(data))
+	c.Assert(err, IsNil)
+	c.Assert(data.String(), Equals, "MSET 5\r\n1\r\n0\r\n5\r\nkey 1\r\n7\r\nvalue 1\r\n5\r\nkey 2\r\n7\r\nvalue 2\r\n")
+
+	decoded := NewMSetRequest()
+	err = decoded.Decode(NewFramedReadWriter(bytes.NewBufferString(strings.TrimPrefix(data.String(), "MSET"))))
+	c.Assert(err, IsNil)
+	c.Assert(decoded, DeepEquals, request)
+
+	err = decoded.Decode(NewFramedReadWriter(bytes.NewBufferString(" 2\r\n1\r\n0\r\n5\r\nkey 1\r\n")))
+	c.Assert(err, ErrorMatches, "Invalid request format")
+}
+
+func (s *FramingTestSuite) TestPublishEncodeDecode(c *C) {
+	request := NewPublishRequest()
+	request.Channel = "news 1"
+	request.Message = "hello"
+	data := &bytes.Buffer{}
+	err := request.Encode(NewFramedReadWriter(data))
+	c.Assert(err, IsNil)
+	c.Assert(data.String(), Equals, "PUBLISH 2\r\n6\r\nnews 1\r\n5\r\nhello\r\n")
+
+	decoded := NewPublishRequest()
+	err = decoded.Decode(NewFramedReadWriter(bytes.NewBufferString(strings.TrimPrefix(data.String(), "PUBLISH"))))
+	c.Assert(err, IsNil)
+	c.Assert(decoded, DeepEquals, request)
+
+	subscribe := NewSubscribeRequest()
+	subscribe.Channels = []string{"news 1", "a\r\nb"}
+	data = &bytes.Buffer{}
+	err = subscribe.Encode(NewFramedReadWriter(data))
+	c.Assert(err, IsNil)
+	c.Assert(data.String(), Equals, "SUBSCRIBE 2\r\n6\r\nnews 1\r\n4\r\na\r\nb\r\n")
+
+	decodedSubscribe := NewSubscribeRequest()
+	err = decodedSubscribe.Decode(NewFramedReadWriter(bytes.NewBufferString(strings.TrimPrefix(data.String(), "SUBSCRIBE"))))
+	c.Assert(err, IsNil)
+	c.Assert(decodedSubscribe, DeepEquals, subscribe)
+}
+
+func (s *FramingTestSuite) TestMessageEncodeDecode(c *C) {
+	response := NewMessageResponse()
+	response.Pattern = "news *"
+	response.Channel = "news 1"
+	response.Message = "a\r\nb"
+	data := &bytes.Buffer{}
+	err := response.Encode(NewFramedReadWriter(data))
+	c.Assert(err, IsNil)
+	c.Assert(data.String(), Equals, "PMESSAGE 6 6 4\r\nnews *\r\nnews 1\r\na\r\nb\r\n")
+
+	decoded := NewMessageResponse()
+	err = decoded.Decode(NewFramedReadWriter(data))
+	c.Assert(err, IsNil)
+	c.Assert(decoded, DeepEquals, response)
+
+	response.Pattern = ""
+	data = &bytes.Buffer{}
+	err = response.Encode(NewFramedReadWriter(data))
+	c.Assert(err, IsNil)
+	c.Assert(data.String(), Equals, "MESSAGE 6 4\r\nnews 1\r\na\r\nb\r\n")
+
+	err = decoded.Decode(NewFramedReadWriter(data))
+	c.Assert(err, IsNil)
+	c.Assert(decoded, DeepEquals, response)
+}
@@ -1,6 +1,7 @@
 package protocol
 
 import (
+	"bufio"
 	"fmt"
 	"io"
 )
@@ -15,7 +16,7 @@ type Decoder interface {
 
 func ReadRequestCommand(r io.Reader) (string, error) {
 	var command string
-	_, err := fmt.Fscanf(r, "%s", &command)
+	_, err := fmt.Fscanf(newReader(r), "%s", &command)
 	if err != nil {
 		return "", err
 	}
@@ -23,20 +24,59 @@ func ReadRequestCommand(r io.Reader) (string, error) {
 }
 
 func FlushRequest(r io.Reader) {
+	if isFramed(r) {
+		readFramedArgs(r)
+		return
+	}
 	readRequestEnd(r)
 }
 
+// newReader returns buffered reader which shares buffer with r if r is already buffered.
+// It allows to decode several pipelined messages from one connection without losing read-ahead data.
+func newReader(r io.Reader) *bufio.Reader {
+	switch rw := r.(type) {
+	case *FramedReadWriter:
+		return newReader(rw.ReadWriter)
+	case *bufio.ReadWriter:
+		return rw.Reader
+	}
+	return bufio.NewReader(r)
+}
+
 // Requests
 
 func NewAuthRequest() *authRequest {
 	return &authRequest{request: newRequest("AUTH")}
 }
 
+func NewModeRequest() *modeRequest {
+	return &modeRequest{request: newRequest("MODE")}
+}
+
+func NewMultiRequest() *request {
+	r := newRequest("MULTI")
+	return &r
+}
+
+func NewExecRequest() *request {
+	r := newRequest("EXEC")
+	return &r
+}
+
+func NewDiscardRequest() *request {
+	r := newRequest("DISCARD")
+	return &r
+}
+
 func NewKeysRequest() *request {
 	r := newRequest("KEYS")
 	return &r
 }
 
+func NewScanRequest() *scanRequest {
+	return &scanRequest{request: newRequest("SCAN")}
+}
+
 func NewGetRequest() *keyRequest {
 	return newKeyRequest("GET")
 }
@@ -45,16 +85,57 @@ func NewSetRequest() *setRequest {
 	return &setRequest{keyValueRequest: newKeyValueRequest("SET")}
 }
 
+// NewPSetExRequest is like SET request but TTL is in milliseconds
+func NewPSetExRequest() *setRequest {
+	return &setRequest{keyValueRequest: newKeyValueRequest("PSETEX")}
+}
+
+func NewGetsRequest() *keyRequest {
+	return newKeyRequest("GETS")
+}
+
+func NewCasRequest() *casRequest {
+	return &casRequest{keyValueRequest: newKeyValueRequest("CAS")}
+}
+
+func NewIncrRequest() *keyTTLRequest {
+	return newKeyTTLRequest("INCR")
+}
+
+func NewDecrRequest() *keyTTLRequest {
+	return newKeyTTLRequest("DECR")
+}
+
+func NewIncrByRequest() *keyDeltaTTLRequest {
+	return newKeyDeltaTTLRequest("INCRBY")
+}
+
+func NewDecrByRequest() *keyDeltaTTLRequest {
+	return newKeyDeltaTTLRequest("DECRBY")
+}
+
 func NewDelRequest() *keyRequest {
 	return newKeyRequest("DEL")
 }
 
+func NewMGetRequest() *multiKeyRequest {
+	return newMultiKeyRequest("MGET")
+}
+
+func NewMSetRequest() *multiSetRequest {
+	return &multiSetRequest{request: newRequest("MSET")}
+}
+
+func NewMDelRequest() *multiKeyRequest {
+	return newMultiKeyRequest("MDEL")
+}
+
 func NewUpdRequest() *keyValueRequest {
 	return newKeyValueRequest("UPD")
 }
 
-func NewHashCreateRequest() *keyTTLRequest {
-	return newKeyTTLRequest("HCREATE")
+func NewHashCreateRequest() *createRequest {
+	return newCreateRequest("HCREATE")
 }
 
 func NewHashGetRequest() *keyFieldRequest {
@@ -81,8 +162,72 @@ func NewHashLenRequest() *keyRequest {
 	return newKeyRequest("HLEN")
 }
 
-func NewListCreateRequest() *keyTTLRequest {
-	return newKeyTTLRequest("LCREATE")
+func NewHashGetMultiRequest() *keyFieldsRequest {
+	return newKeyFieldsRequest("HMGET")
+}
+
+func NewHashSetMultiRequest() *keyFieldValuesRequest {
+	return &keyFieldValuesRequest{keyFieldsRequest: newKeyFieldsRequest("HMSET")}
+}
+
+// NewHashIncrementByRequest contains integer delta of field value
+func NewHashIncrementByRequest() *keyFieldDeltaRequest {
+	return &keyFieldDeltaRequest{keyFieldRequest: newKeyFieldRequest("HINCRBY")}
+}
+
+// NewHashSetIfNotExistsRequest sets field value only if field doesn't exist
+func NewHashSetIfNotExistsRequest() *keyFieldValueRequest {
+	return newKeyFieldValueRequest("HSETNX")
+}
+
+func NewHashExistsRequest() *keyFieldRequest {
+	return newKeyFieldRequest("HEXISTS")
+}
+
+// NewHashScanRequest iterates over hash fields like SCAN iterates over keys, TYPE option is not accepted
+func NewHashScanRequest() *hashScanRequest {
+	return &hashScanRequest{scanRequest: scanRequest{request: newRequest("HSCAN")}}
+}
+
+// NewHashExpireRequest sets TTL of hash field in seconds, zero TTL makes field exist forever
+func NewHashExpireRequest() *keyFieldTTLRequest {
+	return &keyFieldTTLRequest{keyFieldRequest: newKeyFieldRequest("HEXPIRE")}
+}
+
+func NewHashTTLRequest() *keyFieldRequest {
+	return newKeyFieldRequest("HTTL")
+}
+
+func NewHashPersistRequest() *keyFieldRequest {
+	return newKeyFieldRequest("HPERSIST")
+}
+
+// NewSubscribeRequest switches session into subscriber mode and subscribes it to channels
+func NewSubscribeRequest() *channelsRequest {
+	return newChannelsRequest("SUBSCRIBE", false)
+}
+
+// NewPSubscribeRequest subscribes session to channels which match glob-style patterns, Channels contains patterns
+func NewPSubscribeRequest() *channelsRequest {
+	return newChannelsRequest("PSUBSCRIBE", false)
+}
+
+// NewUnsubscribeRequest unsubscribes session from channels or from all channels if Channels is empty
+func NewUnsubscribeRequest() *channelsRequest {
+	return newChannelsRequest("UNSUBSCRIBE", true)
+}
+
+// NewPUnsubscribeRequest unsubscribes session from patterns or from all patterns if Channels is empty
+func NewPUnsubscribeRequest() *channelsRequest {
+	return newChannelsRequest("PUNSUBSCRIBE", true)
+}
+
+func NewPublishRequest() *publishRequest {
+	return &publishRequest{request: newRequest("PUBLISH")}
+}
+
+func NewListCreateRequest() *createRequest {
+	return newCreateRequest("LCREATE")
 }
 
 func NewListLenRequest() *keyRequest {
@@ -97,6 +242,26 @@ func NewListRightPopRequest() *keyRequest {
 	return newKeyRequest("LRPOP")
 }
 
+// NewListBlockingLeftPopRequest waits up to Timeout seconds for value of any of keys, zero timeout means forever
+func NewListBlockingLeftPopRequest() *blockingPopRequest {
+	return newBlockingPopRequest("BLPOP")
+}
+
+// NewListBlockingRightPopRequest waits up to Timeout seconds for value of any of keys, zero timeout means forever
+func NewListBlockingRightPopRequest() *blockingPopRequest {
+	return newBlockingPopRequest("BRPOP")
+}
+
+// NewListMoveRequest moves value from From end of Source list to To end of Destination list
+func NewListMoveRequest() *listMoveRequest {
+	return newListMoveRequest("LMOVE", false)
+}
+
+// NewListBlockingMoveRequest waits up to Timeout seconds for value of Source list, zero timeout means forever
+func NewListBlockingMoveRequest() *listMoveRequest {
+	return newListMoveRequest("BLMOVE", true)
+}
+
 func NewListLeftPushRequest() *keyValueRequest {
 	return newKeyValueRequest("LLPUSH")
 }
@@ -109,32 +274,229 @@ func NewListRangeRequest() *listRangeRequest {
 	return &listRangeRequest{keyRequest: newKeyRequest("LRANGE")}
 }
 
+// NewListIndexRequest contains index of element, negative index is counted from the list ending
+func NewListIndexRequest() *listIndexRequest {
+	return newListIndexRequest("LINDEX")
+}
+
+// NewListSetRequest contains index and new value of element
+func NewListSetRequest() *listIndexValueRequest {
+	return &listIndexValueRequest{listIndexRequest: newListIndexRequest("LSET")}
+}
+
+// NewListInsertRequest contains value inserted before or after pivot, position is ListBefore or ListAfter
+func NewListInsertRequest() *listInsertRequest {
+	return &listInsertRequest{keyRequest: newKeyRequest("LINSERT")}
+}
+
+// NewListRemoveRequest contains value and count of removed elements
+func NewListRemoveRequest() *listRemoveRequest {
+	return &listRemoveRequest{keyRequest: newKeyRequest("LREM")}
+}
+
+// NewListTrimRequest contains range of kept elements
+func NewListTrimRequest() *listRangeRequest {
+	return &listRangeRequest{keyRequest: newKeyRequest("LTRIM")}
+}
+
+func NewSetAddRequest() *keyMembersRequest {
+	return newKeyMembersRequest("SADD")
+}
+
+func NewSetRemoveRequest() *keyMembersRequest {
+	return newKeyMembersRequest("SREM")
+}
+
+func NewSetIsMemberRequest() *keyMemberRequest {
+	return newKeyMemberRequest("SISMEMBER")
+}
+
+func NewSetMembersRequest() *keyRequest {
+	return newKeyRequest("SMEMBERS")
+}
+
+func NewSetLenRequest() *keyRequest {
+	return newKeyRequest("SCARD")
+}
+
+func NewSetIntersectRequest() *multiKeyRequest {
+	return newMultiKeyRequest("SINTER")
+}
+
+func NewSetUnionRequest() *multiKeyRequest {
+	return newMultiKeyRequest("SUNION")
+}
+
+func NewSetDiffRequest() *multiKeyRequest {
+	return newMultiKeyRequest("SDIFF")
+}
+
+// NewSortedSetAddRequest contains pairs of score and member
+func NewSortedSetAddRequest() *scoreMembersRequest {
+	return newScoreMembersRequest("ZADD")
+}
+
+func NewSortedSetRemoveRequest() *keyMembersRequest {
+	return newKeyMembersRequest("ZREM")
+}
+
+func NewSortedSetScoreRequest() *keyMemberRequest {
+	return newKeyMemberRequest("ZSCORE")
+}
+
+func NewSortedSetIncrementByRequest() *keyMemberDeltaRequest {
+	return newKeyMemberDeltaRequest("ZINCRBY")
+}
+
+// NewSortedSetRangeRequest returns members by rank in ascending order, negative ranks are counted from the end
+func NewSortedSetRangeRequest() *listRangeRequest {
+	return &listRangeRequest{keyRequest: newKeyRequest("ZRANGE")}
+}
+
+// NewSortedSetReverseRangeRequest returns members by rank in descending order
+func NewSortedSetReverseRangeRequest() *listRangeRequest {
+	return &listRangeRequest{keyRequest: newKeyRequest("ZREVRANGE")}
+}
+
+func NewSortedSetRangeByScoreRequest() *scoreRangeRequest {
+	return newScoreRangeRequest("ZRANGEBYSCORE")
+}
+
+func NewSortedSetRankRequest() *keyMemberRequest {
+	return newKeyMemberRequest("ZRANK")
+}
+
+func NewSortedSetLenRequest() *keyRequest {
+	return newKeyRequest("ZCARD")
+}
+
 func NewExpireRequest() *keyTTLRequest {
 	return newKeyTTLRequest("EXPIRE")
 }
 
+// NewPExpireRequest is like EXPIRE request but TTL is in milliseconds
+func NewPExpireRequest() *keyTTLRequest {
+	return newKeyTTLRequest("PEXPIRE")
+}
+
+// NewExpireAtRequest sets key expiration to Unix timestamp in seconds
+func NewExpireAtRequest() *keyTimestampRequest {
+	return newKeyTimestampRequest("EXPIREAT")
+}
+
+// NewPExpireAtRequest sets key expiration to Unix timestamp in milliseconds
+func NewPExpireAtRequest() *keyTimestampRequest {
+	return newKeyTimestampRequest("PEXPIREAT")
+}
+
+func NewTouchRequest() *keyRequest {
+	return newKeyRequest("TOUCH")
+}
+
+func NewPersistRequest() *keyRequest {
+	return newKeyRequest("PERSIST")
+}
+
+func NewTypeRequest() *keyRequest {
+	return newKeyRequest("TYPE")
+}
+
+func NewTTLRequest() *keyRequest {
+	return newKeyRequest("TTL")
+}
+
+func NewPTTLRequest() *keyRequest {
+	return newKeyRequest("PTTL")
+}
+
 // Responses
 
 func NewAuthResponse() *okResponse {
 	return newOkResponse()
 }
 
+func NewModeResponse() *okResponse {
+	return newOkResponse()
+}
+
+func NewMultiResponse() *okResponse {
+	return newOkResponse()
+}
+
+// NewQueuedResponse is a response to any command sent between MULTI and EXEC
+func NewQueuedResponse() *queuedResponse {
+	return newQueuedResponse()
+}
+
+// NewExecResponse creates response which decodes results of queued commands into responses
+func NewExecResponse(responses ...Decoder) *execResponse {
+	return &execResponse{countResponse: newCountResponse(), decoders: responses}
+}
+
+func NewDiscardResponse() *okResponse {
+	return newOkResponse()
+}
+
 func NewKeysResponse() *keysResponse {
 	return &keysResponse{countResponse: newCountResponse()}
 }
 
+func NewScanResponse() *scanResponse {
+	return &scanResponse{countResponse: newCountResponse()}
+}
+
 func NewGetResponse() *valueResponse {
 	return newValueResponse()
 }
 
-func NewSetResponse() *okResponse {
+func NewSetResponse() *setResponse {
+	return &setResponse{response: &response{}}
+}
+
+func NewPSetExResponse() *setResponse {
+	return &setResponse{response: &response{}}
+}
+
+func NewGetsResponse() *versionedValueResponse {
+	return &versionedValueResponse{response: &response{}}
+}
+
+func NewCasResponse() *okResponse {
 	return newOkResponse()
 }
 
+func NewIncrResponse() *intResponse {
+	return &intResponse{response: &response{}}
+}
+
+func NewDecrResponse() *intResponse {
+	return &intResponse{response: &response{}}
+}
+
+func NewIncrByResponse() *intResponse {
+	return &intResponse{response: &response{}}
+}
+
+func NewDecrByResponse() *intResponse {
+	return &intResponse{response: &response{}}
+}
+
 func NewDelResponse() *okResponse {
 	return newOkResponse()
 }
 
+func NewMGetResponse() *multiValueResponse {
+	return &multiValueResponse{countResponse: newCountResponse()}
+}
+
+func NewMSetResponse() *multiOkResponse {
+	return &multiOkResponse{countResponse: newCountResponse()}
+}
+
+func NewMDelResponse() *multiOkResponse {
+	return &multiOkResponse{countResponse: newCountResponse()}
+}
+
 func NewUpdResponse() *okResponse {
 	return newOkResponse()
 }
@@ -167,6 +529,64 @@ func NewHashLenResponse() *lenResponse {
 	return &lenResponse{response: &response{}}
 }
 
+// NewHashGetMultiResponse contains value or error of every requested field
+func NewHashGetMultiResponse() *multiValueResponse {
+	return &multiValueResponse{countResponse: newCountResponse()}
+}
+
+func NewHashSetMultiResponse() *okResponse {
+	return newOkResponse()
+}
+
+// NewHashIncrementByResponse contains new value of field
+func NewHashIncrementByResponse() *intResponse {
+	return &intResponse{response: &response{}}
+}
+
+// NewHashSetIfNotExistsResponse contains 1 if field is set and 0 if it already exists
+func NewHashSetIfNotExistsResponse() *intResponse {
+	return &intResponse{response: &response{}}
+}
+
+// NewHashExistsResponse contains 1 if field exists and 0 otherwise
+func NewHashExistsResponse() *intResponse {
+	return &intResponse{response: &response{}}
+}
+
+// NewHashScanResponse contains cursor of the next page and fields with values
+func NewHashScanResponse() *hashScanResponse {
+	return &hashScanResponse{countResponse: newCountResponse()}
+}
+
+func NewHashExpireResponse() *okResponse {
+	return newOkResponse()
+}
+
+// NewHashTTLResponse contains remaining ttl of field in seconds or one of TTLNoExpire and TTLNotExists
+func NewHashTTLResponse() *intResponse {
+	return &intResponse{response: &response{}}
+}
+
+func NewHashPersistResponse() *okResponse {
+	return newOkResponse()
+}
+
+// NewSubscribeResponse contains number of channels and patterns which session is subscribed to.
+// It is returned by SUBSCRIBE, PSUBSCRIBE, UNSUBSCRIBE and PUNSUBSCRIBE.
+func NewSubscribeResponse() *intResponse {
+	return &intResponse{response: &response{}}
+}
+
+// NewPublishResponse contains number of subscribers which received message
+func NewPublishResponse() *intResponse {
+	return &intResponse{response: &response{}}
+}
+
+// NewMessageResponse is pushed to session in subscriber mode when message is published
+func NewMessageResponse() *messageResponse {
+	return &messageResponse{response: &response{}}
+}
+
 func NewListCreateResponse() *okResponse {
 	return newOkResponse()
 }
@@ -187,6 +607,26 @@ func NewListLeftPopResponse() *valueResponse {
 	return newValueResponse()
 }
 
+// NewListBlockingLeftPopResponse contains popped value and key of its list
+func NewListBlockingLeftPopResponse() *keyValueResponse {
+	return &keyValueResponse{response: &response{}}
+}
+
+// NewListBlockingRightPopResponse contains popped value and key of its list
+func NewListBlockingRightPopResponse() *keyValueResponse {
+	return &keyValueResponse{response: &response{}}
+}
+
+// NewListMoveResponse contains moved value
+func NewListMoveResponse() *valueResponse {
+	return newValueResponse()
+}
+
+// NewListBlockingMoveResponse contains moved value
+func NewListBlockingMoveResponse() *valueResponse {
+	return newValueResponse()
+}
+
 func NewListLenResponse() *lenResponse {
 	return &lenResponse{response: &response{}}
 }
@@ -195,10 +635,143 @@ func NewListRangeResponse() *valuesResponse {
 	return &valuesResponse{countResponse: newCountResponse()}
 }
 
+// NewListIndexResponse contains value of element
+func NewListIndexResponse() *valueResponse {
+	return newValueResponse()
+}
+
+func NewListSetResponse() *okResponse {
+	return newOkResponse()
+}
+
+// NewListInsertResponse contains length of list after insert
+func NewListInsertResponse() *lenResponse {
+	return &lenResponse{response: &response{}}
+}
+
+// NewListRemoveResponse contains number of removed elements
+func NewListRemoveResponse() *intResponse {
+	return &intResponse{response: &response{}}
+}
+
+func NewListTrimResponse() *okResponse {
+	return newOkResponse()
+}
+
+// NewSetAddResponse contains number of added members
+func NewSetAddResponse() *intResponse {
+	return &intResponse{response: &response{}}
+}
+
+// NewSetRemoveResponse contains number of removed members
+func NewSetRemoveResponse() *intResponse {
+	return &intResponse{response: &response{}}
+}
+
+// NewSetIsMemberResponse contains 1 if member is in set and 0 otherwise
+func NewSetIsMemberResponse() *intResponse {
+	return &intResponse{response: &response{}}
+}
+
+func NewSetMembersResponse() *valuesResponse {
+	return &valuesResponse{countResponse: newCountResponse()}
+}
+
+func NewSetLenResponse() *lenResponse {
+	return &lenResponse{response: &response{}}
+}
+
+func NewSetIntersectResponse() *valuesResponse {
+	return &valuesResponse{countResponse: newCountResponse()}
+}
+
+func NewSetUnionResponse() *valuesResponse {
+	return &valuesResponse{countResponse: newCountResponse()}
+}
+
+func NewSetDiffResponse() *valuesResponse {
+	return &valuesResponse{countResponse: newCountResponse()}
+}
+
+// NewSortedSetAddResponse contains number of added members
+func NewSortedSetAddResponse() *intResponse {
+	return &intResponse{response: &response{}}
+}
+
+// NewSortedSetRemoveResponse contains number of removed members
+func NewSortedSetRemoveResponse() *intResponse {
+	return &intResponse{response: &response{}}
+}
+
+func NewSortedSetScoreResponse() *scoreResponse {
+	return &scoreResponse{response: &response{}}
+}
+
+// NewSortedSetIncrementByResponse contains new score of member
+func NewSortedSetIncrementByResponse() *scoreResponse {
+	return &scoreResponse{response: &response{}}
+}
+
+func NewSortedSetRangeResponse() *scoredMembersResponse {
+	return &scoredMembersResponse{countResponse: newCountResponse()}
+}
+
+func NewSortedSetReverseRangeResponse() *scoredMembersResponse {
+	return &scoredMembersResponse{countResponse: newCountResponse()}
+}
+
+func NewSortedSetRangeByScoreResponse() *scoredMembersResponse {
+	return &scoredMembersResponse{countResponse: newCountResponse()}
+}
+
+// NewSortedSetRankResponse contains 0-based rank of member in ascending order
+func NewSortedSetRankResponse() *intResponse {
+	return &intResponse{response: &response{}}
+}
+
+func NewSortedSetLenResponse() *lenResponse {
+	return &lenResponse{response: &response{}}
+}
+
 func NewExpireResponse() *okResponse {
 	return newOkResponse()
 }
 
+func NewPExpireResponse() *okResponse {
+	return newOkResponse()
+}
+
+func NewExpireAtResponse() *okResponse {
+	return newOkResponse()
+}
+
+func NewPExpireAtResponse() *okResponse {
+	return newOkResponse()
+}
+
+func NewTouchResponse() *okResponse {
+	return newOkResponse()
+}
+
+func NewPersistResponse() *okResponse {
+	return newOkResponse()
+}
+
+// NewTypeResponse contains type of key value or TypeNone if key doesn't exist
+func NewTypeResponse() *valueResponse {
+	return newValueResponse()
+}
+
+// NewTTLResponse contains remaining ttl in seconds or one of TTLNoExpire and TTLNotExists
+func NewTTLResponse() *intResponse {
+	return &intResponse{response: &response{}}
+}
+
+// NewPTTLResponse contains remaining ttl in milliseconds or one of TTLNoExpire and TTLNotExists
+func NewPTTLResponse() *intResponse {
+	return &intResponse{response: &response{}}
+}
+
 func NewErrorResponse(err error) *okResponse {
 	return &okResponse{response: &response{Error: err}}
 }
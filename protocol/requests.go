@@ -1,15 +1,21 @@
 package protocol
 
 import (
-	"bufio"
 	"errors"
 	"fmt"
 	"io"
+	"math"
 	"regexp"
+	"strconv"
+	"strings"
 )
 
 const (
 	keyTemplate = "[a-zA-Z0-9_]+"
+	// maxRequestArgsLength limits length of request line read by readRequestArgs
+	maxRequestArgsLength = 1024 * 1024
+	// maxRequestValueLength limits length of request value read by readRequestValue
+	maxRequestValueLength = 512 * 1024 * 1024
 )
 
 var (
@@ -18,6 +24,10 @@ var (
 	invalidPasswordFormatError = errors.New("Password is not valid")
 	invalidKeyFormatError      = errors.New("Key is not valid")
 	invalidFieldFormatError    = errors.New("Field is not valid")
+	invalidMemberFormatError   = errors.New("Member is not valid")
+	invalidScoreError          = errors.New("Score is not valid")
+	invalidOptionError         = errors.New("Option is not valid")
+	invalidChannelFormatError  = errors.New("Channel is not valid")
 
 	keyRegexp = regexp.MustCompile("^" + keyTemplate + "$")
 )
@@ -31,10 +41,16 @@ func (r request) Command() string {
 }
 
 func (r *request) Decode(reader io.Reader) error {
+	if isFramed(reader) {
+		return decodeFramed(reader)
+	}
 	return readRequestEnd(reader)
 }
 
 func (r *request) Encode(writer io.Writer) (err error) {
+	if isFramed(writer) {
+		return encodeFramed(writer, r.command)
+	}
 	_, err = writer.Write([]byte(fmt.Sprintf("%s\r\n", r.command)))
 	return
 }
@@ -60,6 +76,10 @@ func (r *authRequest) validate() error {
 }
 
 func (r *authRequest) Decode(reader io.Reader) error {
+	if isFramed(reader) {
+		return decodeFramed(reader, &r.User, &r.Password)
+	}
+
 	var user string
 	var password string
 
@@ -74,6 +94,9 @@ func (r *authRequest) Decode(reader io.Reader) error {
 }
 
 func (r *authRequest) Encode(writer io.Writer) (err error) {
+	if isFramed(writer) {
+		return encodeFramed(writer, r.command, r.User, r.Password)
+	}
 	if err := r.validate(); err != nil {
 		return err
 	}
@@ -81,6 +104,48 @@ func (r *authRequest) Encode(writer io.Writer) (err error) {
 	return
 }
 
+type modeRequest struct {
+	request
+	Mode string
+}
+
+func (r *modeRequest) validate() error {
+	if r.Mode == ModeText || r.Mode == ModeFramed {
+		return nil
+	}
+	return invalidModeError
+}
+
+func (r *modeRequest) Decode(reader io.Reader) error {
+	if isFramed(reader) {
+		if err := decodeFramed(reader, &r.Mode); err != nil {
+			return err
+		}
+		return r.validate()
+	}
+
+	var mode string
+
+	_, err := fmt.Fscanf(reader, "%s\r\n", &mode)
+	if err != nil {
+		return invalidRequestFormatError
+	}
+
+	r.Mode = mode
+	return r.validate()
+}
+
+func (r *modeRequest) Encode(writer io.Writer) (err error) {
+	if err := r.validate(); err != nil {
+		return err
+	}
+	if isFramed(writer) {
+		return encodeFramed(writer, r.command, r.Mode)
+	}
+	_, err = writer.Write([]byte(fmt.Sprintf("%s %s\r\n", r.command, r.Mode)))
+	return
+}
+
 type keyRequest struct {
 	request
 	Key string
@@ -93,7 +158,19 @@ func (r *keyRequest) validate() error {
 	return invalidKeyFormatError
 }
 
+// validateFramed checks key in framed mode where any non-empty byte sequence is allowed
+func (r *keyRequest) validateFramed() error {
+	if r.Key != "" {
+		return nil
+	}
+	return invalidKeyFormatError
+}
+
 func (r *keyRequest) Decode(reader io.Reader) error {
+	if isFramed(reader) {
+		return decodeFramed(reader, &r.Key)
+	}
+
 	var key string
 
 	_, err := fmt.Fscanf(reader, "%s\r\n", &key)
@@ -106,6 +183,12 @@ func (r *keyRequest) Decode(reader io.Reader) error {
 }
 
 func (r *keyRequest) Encode(writer io.Writer) (err error) {
+	if isFramed(writer) {
+		if err := r.validateFramed(); err != nil {
+			return err
+		}
+		return encodeFramed(writer, r.command, r.Key)
+	}
 	if err := r.validate(); err != nil {
 		return err
 	}
@@ -117,12 +200,17 @@ func newKeyRequest(command string) *keyRequest {
 	return &keyRequest{request: newRequest(command)}
 }
 
+// keyTTLRequest contains TTL in seconds or in milliseconds for P-prefixed commands like PEXPIRE
 type keyTTLRequest struct {
 	*keyRequest
 	TTL uint64
 }
 
 func (r *keyTTLRequest) Decode(reader io.Reader) error {
+	if isFramed(reader) {
+		return decodeFramed(reader, &r.Key, &r.TTL)
+	}
+
 	var key string
 	var ttl uint64
 
@@ -137,6 +225,12 @@ func (r *keyTTLRequest) Decode(reader io.Reader) error {
 }
 
 func (r *keyTTLRequest) Encode(writer io.Writer) (err error) {
+	if isFramed(writer) {
+		if err := r.validateFramed(); err != nil {
+			return err
+		}
+		return encodeFramed(writer, r.command, r.Key, r.TTL)
+	}
 	if err := r.validate(); err != nil {
 		return err
 	}
@@ -144,6 +238,152 @@ func (r *keyTTLRequest) Encode(writer io.Writer) (err error) {
 	return
 }
 
+// keyTimestampRequest contains absolute Unix timestamp in seconds or in milliseconds for PEXPIREAT
+type keyTimestampRequest struct {
+	*keyRequest
+	Timestamp uint64
+}
+
+func newKeyTimestampRequest(command string) *keyTimestampRequest {
+	return &keyTimestampRequest{keyRequest: newKeyRequest(command)}
+}
+
+func (r *keyTimestampRequest) Decode(reader io.Reader) error {
+	if isFramed(reader) {
+		return decodeFramed(reader, &r.Key, &r.Timestamp)
+	}
+
+	var key string
+	var timestamp uint64
+
+	_, err := fmt.Fscanf(reader, "%s %d\r\n", &key, &timestamp)
+	if err != nil {
+		return invalidRequestFormatError
+	}
+
+	r.Key = key
+	r.Timestamp = timestamp
+	return nil
+}
+
+func (r *keyTimestampRequest) Encode(writer io.Writer) (err error) {
+	if isFramed(writer) {
+		if err := r.validateFramed(); err != nil {
+			return err
+		}
+		return encodeFramed(writer, r.command, r.Key, r.Timestamp)
+	}
+	if err := r.validate(); err != nil {
+		return err
+	}
+	_, err = writer.Write([]byte(fmt.Sprintf("%s %s %d\r\n", r.command, r.Key, r.Timestamp)))
+	return
+}
+
+// createRequest creates key of hash or list type with optional OptionSliding after TTL
+type createRequest struct {
+	*keyTTLRequest
+	Sliding bool
+}
+
+func newCreateRequest(command string) *createRequest {
+	return &createRequest{keyTTLRequest: newKeyTTLRequest(command)}
+}
+
+func (r *createRequest) Decode(reader io.Reader) error {
+	var args []string
+	var err error
+	if isFramed(reader) {
+		args, err = readFramedArgs(reader)
+	} else {
+		args, err = readRequestArgs(reader)
+	}
+	if err != nil {
+		return err
+	}
+	if len(args) < 2 || len(args) > 3 {
+		return invalidRequestFormatError
+	}
+	ttl, err := strconv.ParseUint(args[1], 10, 64)
+	if err != nil {
+		return invalidRequestFormatError
+	}
+	r.Key, r.TTL, r.Sliding = args[0], ttl, false
+	if len(args) == 3 {
+		if args[2] != OptionSliding {
+			return invalidOptionError
+		}
+		r.Sliding = true
+	}
+	return nil
+}
+
+func (r *createRequest) Encode(writer io.Writer) (err error) {
+	if isFramed(writer) {
+		if err := r.validateFramed(); err != nil {
+			return err
+		}
+		args := []interface{}{r.Key, r.TTL}
+		if r.Sliding {
+			args = append(args, OptionSliding)
+		}
+		return encodeFramed(writer, r.command, args...)
+	}
+	if err := r.validate(); err != nil {
+		return err
+	}
+	line := fmt.Sprintf("%s %s %d", r.command, r.Key, r.TTL)
+	if r.Sliding {
+		line += " " + OptionSliding
+	}
+	_, err = writer.Write([]byte(line + "\r\n"))
+	return
+}
+
+type keyDeltaTTLRequest struct {
+	*keyRequest
+	Delta int64
+	TTL   uint64
+}
+
+func newKeyDeltaTTLRequest(command string) *keyDeltaTTLRequest {
+	return &keyDeltaTTLRequest{keyRequest: newKeyRequest(command)}
+}
+
+func (r *keyDeltaTTLRequest) Decode(reader io.Reader) error {
+	if isFramed(reader) {
+		return decodeFramed(reader, &r.Key, &r.Delta, &r.TTL)
+	}
+
+	var key string
+	var delta int64
+	var ttl uint64
+
+	_, err := fmt.Fscanf(reader, "%s %d %d\r\n", &key, &delta, &ttl)
+	if err != nil {
+		return invalidRequestFormatError
+	}
+
+	r.Key = key
+	r.Delta = delta
+	r.TTL = ttl
+	return nil
+}
+
+func (r *keyDeltaTTLRequest) Encode(writer io.Writer) (err error) {
+	if isFramed(writer) {
+		if err := r.validateFramed(); err != nil {
+			return err
+		}
+		return encodeFramed(writer, r.command, r.Key, r.Delta, r.TTL)
+	}
+	if err := r.validate(); err != nil {
+		return err
+	}
+	_, err = writer.Write([]byte(fmt.Sprintf("%s %s %d %d\r\n", r.command, r.Key, r.Delta, r.TTL)))
+	return
+}
+
 type keyValueRequest struct {
 	*keyRequest
 	Value string
@@ -154,6 +394,10 @@ func newKeyTTLRequest(command string) *keyTTLRequest {
 }
 
 func (r *keyValueRequest) Decode(reader io.Reader) error {
+	if isFramed(reader) {
+		return decodeFramed(reader, &r.Key, &r.Value)
+	}
+
 	var key string
 	var length int
 
@@ -173,6 +417,12 @@ func (r *keyValueRequest) Decode(reader io.Reader) error {
 }
 
 func (r *keyValueRequest) Encode(writer io.Writer) (err error) {
+	if isFramed(writer) {
+		if err := r.validateFramed(); err != nil {
+			return err
+		}
+		return encodeFramed(writer, r.command, r.Key, r.Value)
+	}
 	if err := r.validate(); err != nil {
 		return err
 	}
@@ -200,6 +450,10 @@ func (r *keyFieldRequest) validate() error {
 }
 
 func (r *keyFieldRequest) Decode(reader io.Reader) error {
+	if isFramed(reader) {
+		return decodeFramed(reader, &r.Key, &r.Field)
+	}
+
 	var key string
 	var field string
 
@@ -214,6 +468,12 @@ func (r *keyFieldRequest) Decode(reader io.Reader) error {
 }
 
 func (r *keyFieldRequest) Encode(writer io.Writer) (err error) {
+	if isFramed(writer) {
+		if err := r.validateFramed(); err != nil {
+			return err
+		}
+		return encodeFramed(writer, r.command, r.Key, r.Field)
+	}
 	if err := r.validate(); err != nil {
 		return err
 	}
@@ -225,109 +485,1581 @@ func newKeyFieldRequest(command string) *keyFieldRequest {
 	return &keyFieldRequest{keyRequest: newKeyRequest(command)}
 }
 
-type keyFieldValueRequest struct {
-	*keyFieldRequest
-	Value string
+// keyMemberRequest contains key of set and one member which has the same format as key
+type keyMemberRequest struct {
+	*keyRequest
+	Member string
 }
 
-func (r *keyFieldValueRequest) Decode(reader io.Reader) error {
+func newKeyMemberRequest(command string) *keyMemberRequest {
+	return &keyMemberRequest{keyRequest: newKeyRequest(command)}
+}
+
+func (r *keyMemberRequest) validate(framed bool) error {
+	if framed {
+		if err := r.validateFramed(); err != nil {
+			return err
+		}
+		if r.Member == "" {
+			return invalidMemberFormatError
+		}
+		return nil
+	}
+	if err := r.keyRequest.validate(); err != nil {
+		return err
+	}
+	if !keyRegexp.MatchString(r.Member) {
+		return invalidMemberFormatError
+	}
+	return nil
+}
+
+func (r *keyMemberRequest) Decode(reader io.Reader) error {
+	if isFramed(reader) {
+		return decodeFramed(reader, &r.Key, &r.Member)
+	}
+
 	var key string
-	var field string
-	var length int
+	var member string
 
-	_, err := fmt.Fscanf(reader, "%s %s %d\r\n", &key, &field, &length)
+	_, err := fmt.Fscanf(reader, "%s %s\r\n", &key, &member)
 	if err != nil {
 		return invalidRequestFormatError
 	}
 
-	value, err := readRequestValue(reader, length)
-	if err != nil {
+	r.Key = key
+	r.Member = member
+	return nil
+}
+
+func (r *keyMemberRequest) Encode(writer io.Writer) (err error) {
+	framed := isFramed(writer)
+	if err := r.validate(framed); err != nil {
 		return err
 	}
+	if framed {
+		return encodeFramed(writer, r.command, r.Key, r.Member)
+	}
+	_, err = writer.Write([]byte(fmt.Sprintf("%s %s %s\r\n", r.command, r.Key, r.Member)))
+	return
+}
 
-	r.Key = key
-	r.Field = field
-	r.Value = string(value)
+// keyMembersRequest contains key of set and one or more members which have the same format as keys
+type keyMembersRequest struct {
+	*keyRequest
+	Members []string
+}
+
+func newKeyMembersRequest(command string) *keyMembersRequest {
+	return &keyMembersRequest{keyRequest: newKeyRequest(command)}
+}
+
+func (r *keyMembersRequest) validate(framed bool) error {
+	if len(r.Members) == 0 {
+		return invalidRequestFormatError
+	}
+	keyErr := r.keyRequest.validate()
+	if framed {
+		keyErr = r.validateFramed()
+	}
+	if keyErr != nil {
+		return keyErr
+	}
+	for _, member := range r.Members {
+		if (framed && member == "") || (!framed && !keyRegexp.MatchString(member)) {
+			return invalidMemberFormatError
+		}
+	}
 	return nil
 }
 
-func (r *keyFieldValueRequest) Encode(writer io.Writer) (err error) {
-	if err := r.validate(); err != nil {
+func (r *keyMembersRequest) Decode(reader io.Reader) error {
+	var args []string
+	var err error
+	if isFramed(reader) {
+		args, err = readFramedArgs(reader)
+	} else {
+		args, err = readRequestArgs(reader)
+	}
+	if err != nil {
 		return err
 	}
-	_, err = writer.Write([]byte(fmt.Sprintf("%s %s %s %d\r\n%s\r\n", r.command, r.Key, r.Field, len(r.Value), r.Value)))
+	if len(args) < 2 {
+		return invalidRequestFormatError
+	}
+	r.Key, r.Members = args[0], args[1:]
+	return nil
+}
+
+func (r *keyMembersRequest) Encode(writer io.Writer) (err error) {
+	framed := isFramed(writer)
+	if err := r.validate(framed); err != nil {
+		return err
+	}
+	if framed {
+		args := []interface{}{r.Key}
+		for _, member := range r.Members {
+			args = append(args, member)
+		}
+		return encodeFramed(writer, r.command, args...)
+	}
+	_, err = writer.Write([]byte(fmt.Sprintf("%s %s %s\r\n", r.command, r.Key, strings.Join(r.Members, " "))))
 	return
 }
 
-func newKeyFieldValueRequest(command string) *keyFieldValueRequest {
-	return &keyFieldValueRequest{keyFieldRequest: newKeyFieldRequest(command)}
+// scoreMembersRequest contains key of sorted set and pairs of score and member
+type scoreMembersRequest struct {
+	*keyRequest
+	Scores  []float64
+	Members []string
 }
 
-type setRequest struct {
-	*keyValueRequest
-	TTL uint64
+func newScoreMembersRequest(command string) *scoreMembersRequest {
+	return &scoreMembersRequest{keyRequest: newKeyRequest(command)}
 }
 
-func (r *setRequest) Decode(reader io.Reader) error {
-	var key string
-	var ttl uint64
-	var length int
+func (r *scoreMembersRequest) validate(framed bool) error {
+	if len(r.Scores) != len(r.Members) {
+		return invalidRequestFormatError
+	}
+	members := keyMembersRequest{keyRequest: r.keyRequest, Members: r.Members}
+	if err := members.validate(framed); err != nil {
+		return err
+	}
+	for _, score := range r.Scores {
+		if math.IsNaN(score) {
+			return invalidScoreError
+		}
+	}
+	return nil
+}
 
-	_, err := fmt.Fscanf(reader, "%s %d %d\r\n", &key, &ttl, &length)
+func (r *scoreMembersRequest) Decode(reader io.Reader) error {
+	var args []string
+	var err error
+	if isFramed(reader) {
+		args, err = readFramedArgs(reader)
+	} else {
+		args, err = readRequestArgs(reader)
+	}
 	if err != nil {
+		return err
+	}
+	if len(args) < 3 || len(args)%2 == 0 {
 		return invalidRequestFormatError
 	}
+	r.Key, r.Scores, r.Members = args[0], nil, nil
+	for i := 1; i < len(args); i += 2 {
+		score, err := parseScore(args[i])
+		if err != nil {
+			return err
+		}
+		r.Scores = append(r.Scores, score)
+		r.Members = append(r.Members, args[i+1])
+	}
+	return nil
+}
 
-	value, err := readRequestValue(reader, length)
-	if err != nil {
+func (r *scoreMembersRequest) Encode(writer io.Writer) (err error) {
+	framed := isFramed(writer)
+	if err := r.validate(framed); err != nil {
 		return err
 	}
+	args := []interface{}{r.Key}
+	for i, member := range r.Members {
+		args = append(args, formatScore(r.Scores[i]), member)
+	}
+	if framed {
+		return encodeFramed(writer, r.command, args...)
+	}
+	line := r.command
+	for _, arg := range args {
+		line += " " + fmt.Sprint(arg)
+	}
+	_, err = writer.Write([]byte(line + "\r\n"))
+	return
+}
+
+// keyMemberDeltaRequest contains key of sorted set, delta of score and member
+type keyMemberDeltaRequest struct {
+	*keyMemberRequest
+	Delta float64
+}
+
+func newKeyMemberDeltaRequest(command string) *keyMemberDeltaRequest {
+	return &keyMemberDeltaRequest{keyMemberRequest: newKeyMemberRequest(command)}
+}
+
+func (r *keyMemberDeltaRequest) Decode(reader io.Reader) error {
+	if isFramed(reader) {
+		return decodeFramed(reader, &r.Key, &r.Delta, &r.Member)
+	}
+
+	var key, delta, member string
+
+	_, err := fmt.Fscanf(reader, "%s %s %s\r\n", &key, &delta, &member)
+	if err != nil {
+		return invalidRequestFormatError
+	}
 
 	r.Key = key
-	r.TTL = ttl
-	r.Value = string(value)
-	return nil
+	r.Member = member
+	r.Delta, err = parseScore(delta)
+	return err
 }
 
-func (r *setRequest) Encode(writer io.Writer) (err error) {
-	if err := r.validate(); err != nil {
+func (r *keyMemberDeltaRequest) Encode(writer io.Writer) (err error) {
+	framed := isFramed(writer)
+	if err := r.validate(framed); err != nil {
 		return err
 	}
-	_, err = writer.Write([]byte(fmt.Sprintf("%s %s %d %d\r\n%s\r\n", r.command, r.Key, r.TTL, len(r.Value), r.Value)))
+	if math.IsNaN(r.Delta) {
+		return invalidScoreError
+	}
+	if framed {
+		return encodeFramed(writer, r.command, r.Key, formatScore(r.Delta), r.Member)
+	}
+	_, err = writer.Write([]byte(fmt.Sprintf("%s %s %s %s\r\n", r.command, r.Key, formatScore(r.Delta), r.Member)))
 	return
 }
 
-type listRangeRequest struct {
-	*keyRequest
-	Start int
-	Stop  int
+type keyFieldValueRequest struct {
+	*keyFieldRequest
+	Value string
 }
 
-func (r *listRangeRequest) Decode(reader io.Reader) error {
+func (r *keyFieldValueRequest) Decode(reader io.Reader) error {
+	if isFramed(reader) {
+		return decodeFramed(reader, &r.Key, &r.Field, &r.Value)
+	}
+
 	var key string
-	var start, stop int
+	var field string
+	var length int
 
-	_, err := fmt.Fscanf(reader, "%s %d %d\r\n", &key, &start, &stop)
+	_, err := fmt.Fscanf(reader, "%s %s %d\r\n", &key, &field, &length)
 	if err != nil {
 		return invalidRequestFormatError
 	}
 
+	value, err := readRequestValue(reader, length)
+	if err != nil {
+		return err
+	}
+
 	r.Key = key
-	r.Start = start
-	r.Stop = stop
+	r.Field = field
+	r.Value = string(value)
 	return nil
 }
 
-func (r *listRangeRequest) Encode(writer io.Writer) (err error) {
+func (r *keyFieldValueRequest) Encode(writer io.Writer) (err error) {
+	if isFramed(writer) {
+		if err := r.validateFramed(); err != nil {
+			return err
+		}
+		return encodeFramed(writer, r.command, r.Key, r.Field, r.Value)
+	}
 	if err := r.validate(); err != nil {
 		return err
 	}
-	_, err = writer.Write([]byte(fmt.Sprintf("%s %s %d %d\r\n", r.command, r.Key, r.Start, r.Stop)))
+	_, err = writer.Write([]byte(fmt.Sprintf("%s %s %s %d\r\n%s\r\n", r.command, r.Key, r.Field, len(r.Value), r.Value)))
 	return
 }
 
-func readRequestValue(reader io.Reader, length int) ([]byte, error) {
-	value := make([]byte, length, length)
+func newKeyFieldValueRequest(command string) *keyFieldValueRequest {
+	return &keyFieldValueRequest{keyFieldRequest: newKeyFieldRequest(command)}
+}
+
+// keyFieldsRequest contains key of hash and several fields which have the same format as key
+type keyFieldsRequest struct {
+	*keyRequest
+	Fields []string
+}
+
+func newKeyFieldsRequest(command string) *keyFieldsRequest {
+	return &keyFieldsRequest{keyRequest: newKeyRequest(command)}
+}
+
+func (r *keyFieldsRequest) validate(framed bool) error {
+	if len(r.Fields) == 0 {
+		return invalidRequestFormatError
+	}
+	if framed {
+		return r.validateFramed()
+	}
+	if err := r.keyRequest.validate(); err != nil {
+		return err
+	}
+	for _, field := range r.Fields {
+		if !keyRegexp.MatchString(field) {
+			return invalidFieldFormatError
+		}
+	}
+	return nil
+}
+
+func (r *keyFieldsRequest) Decode(reader io.Reader) error {
+	var args []string
+	var err error
+	if isFramed(reader) {
+		args, err = readFramedArgs(reader)
+	} else {
+		args, err = readRequestArgs(reader)
+	}
+	if err != nil {
+		return err
+	}
+	if len(args) < 2 {
+		return invalidRequestFormatError
+	}
+	r.Key, r.Fields = args[0], args[1:]
+	return nil
+}
+
+func (r *keyFieldsRequest) Encode(writer io.Writer) (err error) {
+	framed := isFramed(writer)
+	if err := r.validate(framed); err != nil {
+		return err
+	}
+	if framed {
+		args := []interface{}{r.Key}
+		for _, field := range r.Fields {
+			args = append(args, field)
+		}
+		return encodeFramed(writer, r.command, args...)
+	}
+	_, err = writer.Write([]byte(fmt.Sprintf("%s %s %s\r\n", r.command, r.Key, strings.Join(r.Fields, " "))))
+	return
+}
+
+// keyFieldValuesRequest contains key of hash and several field-value pairs.
+// In text mode values follow the request line like in MSET: "HMSET key field1 len1 field2 len2\r\nvalue1\r\nvalue2\r\n".
+type keyFieldValuesRequest struct {
+	*keyFieldsRequest
+	Values []string
+}
+
+func (r *keyFieldValuesRequest) validate(framed bool) error {
+	if len(r.Fields) != len(r.Values) {
+		return invalidRequestFormatError
+	}
+	return r.keyFieldsRequest.validate(framed)
+}
+
+func (r *keyFieldValuesRequest) Decode(reader io.Reader) error {
+	r.Fields, r.Values = nil, nil
+	if isFramed(reader) {
+		args, err := readFramedArgs(reader)
+		if err != nil {
+			return err
+		}
+		if len(args) < 3 || len(args)%2 == 0 {
+			return invalidRequestFormatError
+		}
+		r.Key = args[0]
+		for i := 1; i < len(args); i += 2 {
+			r.Fields = append(r.Fields, args[i])
+			r.Values = append(r.Values, args[i+1])
+		}
+		return nil
+	}
+
+	args, err := readRequestArgs(reader)
+	if err != nil {
+		return err
+	}
+	if len(args) < 3 || len(args)%2 == 0 {
+		return invalidRequestFormatError
+	}
+	r.Key = args[0]
+	var lengths []int
+	for i := 1; i < len(args); i += 2 {
+		length, err := strconv.Atoi(args[i+1])
+		if err != nil {
+			return invalidRequestFormatError
+		}
+		r.Fields = append(r.Fields, args[i])
+		lengths = append(lengths, length)
+	}
+	for _, length := range lengths {
+		value, err := readRequestValue(reader, length)
+		if err != nil {
+			return err
+		}
+		r.Values = append(r.Values, string(value))
+	}
+	return nil
+}
+
+func (r *keyFieldValuesRequest) Encode(writer io.Writer) (err error) {
+	framed := isFramed(writer)
+	if err := r.validate(framed); err != nil {
+		return err
+	}
+	if framed {
+		args := []interface{}{r.Key}
+		for i, field := range r.Fields {
+			args = append(args, field, r.Values[i])
+		}
+		return encodeFramed(writer, r.command, args...)
+	}
+	header := fmt.Sprintf("%s %s", r.command, r.Key)
+	var values string
+	for i, field := range r.Fields {
+		header += fmt.Sprintf(" %s %d", field, len(r.Values[i]))
+		values += r.Values[i] + "\r\n"
+	}
+	_, err = writer.Write([]byte(header + "\r\n" + values))
+	return
+}
+
+// keyFieldDeltaRequest contains key of hash, field and integer delta of field value
+type keyFieldDeltaRequest struct {
+	*keyFieldRequest
+	Delta int64
+}
+
+func (r *keyFieldDeltaRequest) Decode(reader io.Reader) error {
+	if isFramed(reader) {
+		return decodeFramed(reader, &r.Key, &r.Field, &r.Delta)
+	}
+
+	var key, field string
+	var delta int64
+
+	_, err := fmt.Fscanf(reader, "%s %s %d\r\n", &key, &field, &delta)
+	if err != nil {
+		return invalidRequestFormatError
+	}
+
+	r.Key = key
+	r.Field = field
+	r.Delta = delta
+	return nil
+}
+
+func (r *keyFieldDeltaRequest) Encode(writer io.Writer) (err error) {
+	if isFramed(writer) {
+		if err := r.validateFramed(); err != nil {
+			return err
+		}
+		return encodeFramed(writer, r.command, r.Key, r.Field, r.Delta)
+	}
+	if err := r.validate(); err != nil {
+		return err
+	}
+	_, err = writer.Write([]byte(fmt.Sprintf("%s %s %s %d\r\n", r.command, r.Key, r.Field, r.Delta)))
+	return
+}
+
+// keyFieldTTLRequest contains key of hash, field and TTL of field in seconds
+type keyFieldTTLRequest struct {
+	*keyFieldRequest
+	TTL uint64
+}
+
+func (r *keyFieldTTLRequest) Decode(reader io.Reader) error {
+	if isFramed(reader) {
+		return decodeFramed(reader, &r.Key, &r.Field, &r.TTL)
+	}
+
+	var key, field string
+	var ttl uint64
+
+	_, err := fmt.Fscanf(reader, "%s %s %d\r\n", &key, &field, &ttl)
+	if err != nil {
+		return invalidRequestFormatError
+	}
+
+	r.Key = key
+	r.Field = field
+	r.TTL = ttl
+	return nil
+}
+
+func (r *keyFieldTTLRequest) Encode(writer io.Writer) (err error) {
+	if isFramed(writer) {
+		if err := r.validateFramed(); err != nil {
+			return err
+		}
+		return encodeFramed(writer, r.command, r.Key, r.Field, r.TTL)
+	}
+	if err := r.validate(); err != nil {
+		return err
+	}
+	_, err = writer.Write([]byte(fmt.Sprintf("%s %s %s %d\r\n", r.command, r.Key, r.Field, r.TTL)))
+	return
+}
+
+// multiKeyRequest contains several keys, command is applied to every key separately
+type multiKeyRequest struct {
+	request
+	Keys []string
+}
+
+func newMultiKeyRequest(command string) *multiKeyRequest {
+	return &multiKeyRequest{request: newRequest(command)}
+}
+
+func (r *multiKeyRequest) validate(framed bool) error {
+	if len(r.Keys) == 0 {
+		return invalidRequestFormatError
+	}
+	for _, key := range r.Keys {
+		if (framed && key == "") || (!framed && !keyRegexp.MatchString(key)) {
+			return invalidKeyFormatError
+		}
+	}
+	return nil
+}
+
+func (r *multiKeyRequest) Decode(reader io.Reader) (err error) {
+	if isFramed(reader) {
+		r.Keys, err = readFramedArgs(reader)
+	} else {
+		r.Keys, err = readRequestArgs(reader)
+	}
+	if err != nil {
+		return err
+	}
+	if len(r.Keys) == 0 {
+		return invalidRequestFormatError
+	}
+	return nil
+}
+
+func (r *multiKeyRequest) Encode(writer io.Writer) (err error) {
+	framed := isFramed(writer)
+	if err := r.validate(framed); err != nil {
+		return err
+	}
+	if framed {
+		args := make([]interface{}, len(r.Keys))
+		for i, key := range r.Keys {
+			args[i] = key
+		}
+		return encodeFramed(writer, r.command, args...)
+	}
+	_, err = writer.Write([]byte(fmt.Sprintf("%s %s\r\n", r.command, strings.Join(r.Keys, " "))))
+	return
+}
+
+// multiSetRequest contains several key-value pairs which are set with the same ttl
+// blockingPopRequest contains keys of lists and timeout in seconds which follows keys like in Redis
+type blockingPopRequest struct {
+	*multiKeyRequest
+	Timeout uint64
+}
+
+func newBlockingPopRequest(command string) *blockingPopRequest {
+	return &blockingPopRequest{multiKeyRequest: newMultiKeyRequest(command)}
+}
+
+func (r *blockingPopRequest) Decode(reader io.Reader) (err error) {
+	var args []string
+	if isFramed(reader) {
+		args, err = readFramedArgs(reader)
+	} else {
+		args, err = readRequestArgs(reader)
+	}
+	if err != nil {
+		return err
+	}
+	if len(args) < 2 {
+		return invalidRequestFormatError
+	}
+	if r.Timeout, err = strconv.ParseUint(args[len(args)-1], 10, 64); err != nil {
+		return invalidRequestFormatError
+	}
+	r.Keys = args[:len(args)-1]
+	return nil
+}
+
+func (r *blockingPopRequest) Encode(writer io.Writer) (err error) {
+	framed := isFramed(writer)
+	if err := r.validate(framed); err != nil {
+		return err
+	}
+	if framed {
+		args := make([]interface{}, 0, len(r.Keys)+1)
+		for _, key := range r.Keys {
+			args = append(args, key)
+		}
+		return encodeFramed(writer, r.command, append(args, r.Timeout)...)
+	}
+	_, err = writer.Write([]byte(fmt.Sprintf("%s %s %d\r\n", r.command, strings.Join(r.Keys, " "), r.Timeout)))
+	return
+}
+
+// List ends which LMOVE and BLMOVE pop value from and push value to
+const (
+	ListLeft  = "LEFT"
+	ListRight = "RIGHT"
+)
+
+// listMoveRequest contains source and destination lists with their ends.
+// Timeout in seconds follows ends if request is blocking.
+type listMoveRequest struct {
+	request
+	Source      string
+	Destination string
+	From        string
+	To          string
+	Timeout     uint64
+	blocking    bool
+}
+
+func newListMoveRequest(command string, blocking bool) *listMoveRequest {
+	return &listMoveRequest{request: newRequest(command), blocking: blocking}
+}
+
+func (r *listMoveRequest) validate(framed bool) error {
+	keys := multiKeyRequest{Keys: []string{r.Source, r.Destination}}
+	if err := keys.validate(framed); err != nil {
+		return err
+	}
+	if !isListEnd(r.From) || !isListEnd(r.To) {
+		return invalidOptionError
+	}
+	return nil
+}
+
+func (r *listMoveRequest) args() []interface{} {
+	args := []interface{}{r.Source, r.Destination, r.From, r.To}
+	if r.blocking {
+		args = append(args, r.Timeout)
+	}
+	return args
+}
+
+func (r *listMoveRequest) setArgs(args []string) (err error) {
+	if (r.blocking && len(args) != 5) || (!r.blocking && len(args) != 4) {
+		return invalidRequestFormatError
+	}
+	r.Source, r.Destination, r.From, r.To = args[0], args[1], args[2], args[3]
+	if !isListEnd(r.From) || !isListEnd(r.To) {
+		return invalidOptionError
+	}
+	if r.blocking {
+		if r.Timeout, err = strconv.ParseUint(args[4], 10, 64); err != nil {
+			return invalidRequestFormatError
+		}
+	}
+	return nil
+}
+
+func (r *listMoveRequest) Decode(reader io.Reader) (err error) {
+	var args []string
+	if isFramed(reader) {
+		args, err = readFramedArgs(reader)
+	} else {
+		args, err = readRequestArgs(reader)
+	}
+	if err != nil {
+		return err
+	}
+	return r.setArgs(args)
+}
+
+func (r *listMoveRequest) Encode(writer io.Writer) (err error) {
+	framed := isFramed(writer)
+	if err := r.validate(framed); err != nil {
+		return err
+	}
+	if framed {
+		return encodeFramed(writer, r.command, r.args()...)
+	}
+	line := r.command
+	for _, arg := range r.args() {
+		line += " " + fmt.Sprint(arg)
+	}
+	_, err = writer.Write([]byte(line + "\r\n"))
+	return
+}
+
+func isListEnd(end string) bool {
+	return end == ListLeft || end == ListRight
+}
+
+// listIndexRequest contains index of list element, negative index is counted from the list ending
+type listIndexRequest struct {
+	*keyRequest
+	Index int
+}
+
+func newListIndexRequest(command string) *listIndexRequest {
+	return &listIndexRequest{keyRequest: newKeyRequest(command)}
+}
+
+func (r *listIndexRequest) Decode(reader io.Reader) error {
+	if isFramed(reader) {
+		return decodeFramed(reader, &r.Key, &r.Index)
+	}
+
+	var key string
+	var index int
+
+	_, err := fmt.Fscanf(reader, "%s %d\r\n", &key, &index)
+	if err != nil {
+		return invalidRequestFormatError
+	}
+
+	r.Key = key
+	r.Index = index
+	return nil
+}
+
+func (r *listIndexRequest) Encode(writer io.Writer) (err error) {
+	if isFramed(writer) {
+		if err := r.validateFramed(); err != nil {
+			return err
+		}
+		return encodeFramed(writer, r.command, r.Key, r.Index)
+	}
+	if err := r.validate(); err != nil {
+		return err
+	}
+	_, err = writer.Write([]byte(fmt.Sprintf("%s %s %d\r\n", r.command, r.Key, r.Index)))
+	return
+}
+
+// listIndexValueRequest contains new value of list element with index
+type listIndexValueRequest struct {
+	*listIndexRequest
+	Value string
+}
+
+func (r *listIndexValueRequest) Decode(reader io.Reader) error {
+	if isFramed(reader) {
+		return decodeFramed(reader, &r.Key, &r.Index, &r.Value)
+	}
+
+	var key string
+	var index, length int
+
+	_, err := fmt.Fscanf(reader, "%s %d %d\r\n", &key, &index, &length)
+	if err != nil {
+		return invalidRequestFormatError
+	}
+
+	value, err := readRequestValue(reader, length)
+	if err != nil {
+		return err
+	}
+
+	r.Key = key
+	r.Index = index
+	r.Value = string(value)
+	return nil
+}
+
+func (r *listIndexValueRequest) Encode(writer io.Writer) (err error) {
+	if isFramed(writer) {
+		if err := r.validateFramed(); err != nil {
+			return err
+		}
+		return encodeFramed(writer, r.command, r.Key, r.Index, r.Value)
+	}
+	if err := r.validate(); err != nil {
+		return err
+	}
+	_, err = writer.Write([]byte(fmt.Sprintf("%s %s %d %d\r\n%s\r\n", r.command, r.Key, r.Index, len(r.Value), r.Value)))
+	return
+}
+
+// listRemoveRequest contains value and count of removed list elements. Negative count removes elements
+// from the list ending, zero count removes all elements equal to value.
+type listRemoveRequest struct {
+	*keyRequest
+	Count int
+	Value string
+}
+
+func (r *listRemoveRequest) Decode(reader io.Reader) error {
+	if isFramed(reader) {
+		return decodeFramed(reader, &r.Key, &r.Count, &r.Value)
+	}
+
+	var key string
+	var count, length int
+
+	_, err := fmt.Fscanf(reader, "%s %d %d\r\n", &key, &count, &length)
+	if err != nil {
+		return invalidRequestFormatError
+	}
+
+	value, err := readRequestValue(reader, length)
+	if err != nil {
+		return err
+	}
+
+	r.Key = key
+	r.Count = count
+	r.Value = string(value)
+	return nil
+}
+
+func (r *listRemoveRequest) Encode(writer io.Writer) (err error) {
+	if isFramed(writer) {
+		if err := r.validateFramed(); err != nil {
+			return err
+		}
+		return encodeFramed(writer, r.command, r.Key, r.Count, r.Value)
+	}
+	if err := r.validate(); err != nil {
+		return err
+	}
+	_, err = writer.Write([]byte(fmt.Sprintf("%s %s %d %d\r\n%s\r\n", r.command, r.Key, r.Count, len(r.Value), r.Value)))
+	return
+}
+
+// Positions of value inserted by LINSERT relative to pivot
+const (
+	ListBefore = "BEFORE"
+	ListAfter  = "AFTER"
+)
+
+// listInsertRequest contains value which is inserted before or after pivot element.
+// Both pivot and value are binary-safe, so their lengths are passed in text mode:
+// LINSERT <key> <BEFORE|AFTER> <pivot_length> <value_length>\r\n<pivot>\r\n<value>\r\n
+type listInsertRequest struct {
+	*keyRequest
+	Position string
+	Pivot    string
+	Value    string
+}
+
+func (r *listInsertRequest) validate(framed bool) error {
+	if framed {
+		if err := r.validateFramed(); err != nil {
+			return err
+		}
+	} else if err := r.keyRequest.validate(); err != nil {
+		return err
+	}
+	if !isListPosition(r.Position) {
+		return invalidOptionError
+	}
+	return nil
+}
+
+func (r *listInsertRequest) Decode(reader io.Reader) error {
+	if isFramed(reader) {
+		if err := decodeFramed(reader, &r.Key, &r.Position, &r.Pivot, &r.Value); err != nil {
+			return err
+		}
+		if !isListPosition(r.Position) {
+			return invalidOptionError
+		}
+		return nil
+	}
+
+	args, err := readRequestArgs(reader)
+	if err != nil {
+		return err
+	}
+	if len(args) != 4 {
+		return invalidRequestFormatError
+	}
+	pivotLength, pivotErr := strconv.Atoi(args[2])
+	valueLength, valueErr := strconv.Atoi(args[3])
+	if pivotErr != nil || valueErr != nil {
+		return invalidRequestFormatError
+	}
+	pivot, err := readRequestValue(reader, pivotLength)
+	if err != nil {
+		return err
+	}
+	value, err := readRequestValue(reader, valueLength)
+	if err != nil {
+		return err
+	}
+
+	r.Key = args[0]
+	r.Position = args[1]
+	r.Pivot = string(pivot)
+	r.Value = string(value)
+	if !isListPosition(r.Position) {
+		return invalidOptionError
+	}
+	return nil
+}
+
+func (r *listInsertRequest) Encode(writer io.Writer) (err error) {
+	framed := isFramed(writer)
+	if err := r.validate(framed); err != nil {
+		return err
+	}
+	if framed {
+		return encodeFramed(writer, r.command, r.Key, r.Position, r.Pivot, r.Value)
+	}
+	_, err = writer.Write([]byte(fmt.Sprintf("%s %s %s %d %d\r\n%s\r\n%s\r\n",
+		r.command, r.Key, r.Position, len(r.Pivot), len(r.Value), r.Pivot, r.Value)))
+	return
+}
+
+func isListPosition(position string) bool {
+	return position == ListBefore || position == ListAfter
+}
+
+type multiSetRequest struct {
+	request
+	TTL    uint64
+	Keys   []string
+	Values []string
+}
+
+func (r *multiSetRequest) validate(framed bool) error {
+	if len(r.Keys) != len(r.Values) {
+		return invalidRequestFormatError
+	}
+	keys := multiKeyRequest{Keys: r.Keys}
+	return keys.validate(framed)
+}
+
+func (r *multiSetRequest) Decode(reader io.Reader) error {
+	r.Keys, r.Values = nil, nil
+	if isFramed(reader) {
+		args, err := readFramedArgs(reader)
+		if err != nil {
+			return err
+		}
+		if len(args) < 3 || len(args)%2 == 0 {
+			return invalidRequestFormatError
+		}
+		if r.TTL, err = strconv.ParseUint(args[0], 10, 64); err != nil {
+			return invalidRequestFormatError
+		}
+		for i := 1; i < len(args); i += 2 {
+			r.Keys = append(r.Keys, args[i])
+			r.Values = append(r.Values, args[i+1])
+		}
+		return nil
+	}
+
+	args, err := readRequestArgs(reader)
+	if err != nil {
+		return err
+	}
+	if len(args) < 3 || len(args)%2 == 0 {
+		return invalidRequestFormatError
+	}
+	if r.TTL, err = strconv.ParseUint(args[0], 10, 64); err != nil {
+		return invalidRequestFormatError
+	}
+	var lengths []int
+	for i := 1; i < len(args); i += 2 {
+		length, err := strconv.Atoi(args[i+1])
+		if err != nil {
+			return invalidRequestFormatError
+		}
+		r.Keys = append(r.Keys, args[i])
+		lengths = append(lengths, length)
+	}
+	for _, length := range lengths {
+		value, err := readRequestValue(reader, length)
+		if err != nil {
+			return err
+		}
+		r.Values = append(r.Values, string(value))
+	}
+	return nil
+}
+
+func (r *multiSetRequest) Encode(writer io.Writer) (err error) {
+	framed := isFramed(writer)
+	if err := r.validate(framed); err != nil {
+		return err
+	}
+	if framed {
+		args := []interface{}{r.TTL}
+		for i, key := range r.Keys {
+			args = append(args, key, r.Values[i])
+		}
+		return encodeFramed(writer, r.command, args...)
+	}
+	header := fmt.Sprintf("%s %d", r.command, r.TTL)
+	var values string
+	for i, key := range r.Keys {
+		header += fmt.Sprintf(" %s %d", key, len(r.Values[i]))
+		values += r.Values[i] + "\r\n"
+	}
+	_, err = writer.Write([]byte(header + "\r\n" + values))
+	return
+}
+
+// ScanStart is a cursor which starts SCAN iteration, it is returned when iteration is finished
+const ScanStart = "0"
+
+// SCAN options
+const (
+	ScanOptionMatch = "MATCH"
+	ScanOptionCount = "COUNT"
+	ScanOptionType  = "TYPE"
+)
+
+// scanRequest contains cursor of the page and optional filters. Empty filter is not applied.
+type scanRequest struct {
+	request
+	Cursor string
+	Match  string
+	Count  int
+	Type   string
+}
+
+func (r *scanRequest) args() []interface{} {
+	args := []interface{}{r.Cursor}
+	if r.Match != "" {
+		args = append(args, ScanOptionMatch, r.Match)
+	}
+	if r.Count != 0 {
+		args = append(args, ScanOptionCount, r.Count)
+	}
+	if r.Type != "" {
+		args = append(args, ScanOptionType, r.Type)
+	}
+	return args
+}
+
+func (r *scanRequest) setArgs(args []string) (err error) {
+	if len(args)%2 == 0 || args[0] == "" {
+		return invalidRequestFormatError
+	}
+	r.Cursor, r.Match, r.Count, r.Type = args[0], "", 0, ""
+	seen := make(map[string]bool)
+	for i := 1; i < len(args); i += 2 {
+		option, value := args[i], args[i+1]
+		if seen[option] {
+			return invalidOptionError
+		}
+		seen[option] = true
+		switch option {
+		case ScanOptionMatch:
+			r.Match = value
+		case ScanOptionCount:
+			if r.Count, err = strconv.Atoi(value); err != nil || r.Count <= 0 {
+				return invalidRequestFormatError
+			}
+		case ScanOptionType:
+			r.Type = value
+		default:
+			return invalidOptionError
+		}
+	}
+	return nil
+}
+
+func (r *scanRequest) Decode(reader io.Reader) error {
+	var args []string
+	var err error
+	if isFramed(reader) {
+		args, err = readFramedArgs(reader)
+	} else {
+		args, err = readRequestArgs(reader)
+	}
+	if err != nil {
+		return err
+	}
+	return r.setArgs(args)
+}
+
+func (r *scanRequest) Encode(writer io.Writer) error {
+	return r.encode(writer, r.args())
+}
+
+// encode writes command with args, every arg must be a non-empty word in text mode
+func (r *scanRequest) encode(writer io.Writer, args []interface{}) (err error) {
+	if r.Count < 0 {
+		return invalidRequestFormatError
+	}
+	if isFramed(writer) {
+		return encodeFramed(writer, r.command, args...)
+	}
+	line := r.command
+	for _, arg := range args {
+		value := fmt.Sprint(arg)
+		if value == "" || strings.ContainsAny(value, " \r\n") {
+			return invalidRequestFormatError
+		}
+		line += " " + value
+	}
+	_, err = writer.Write([]byte(line + "\r\n"))
+	return
+}
+
+// hashScanRequest contains key of hash followed by arguments of SCAN. TYPE option is not accepted.
+type hashScanRequest struct {
+	scanRequest
+	Key string
+}
+
+func (r *hashScanRequest) Decode(reader io.Reader) error {
+	var args []string
+	var err error
+	if isFramed(reader) {
+		args, err = readFramedArgs(reader)
+	} else {
+		args, err = readRequestArgs(reader)
+	}
+	if err != nil {
+		return err
+	}
+	if len(args) < 2 {
+		return invalidRequestFormatError
+	}
+	if err := r.setArgs(args[1:]); err != nil {
+		return err
+	}
+	if r.Type != "" {
+		return invalidOptionError
+	}
+	r.Key = args[0]
+	return nil
+}
+
+func (r *hashScanRequest) Encode(writer io.Writer) error {
+	if r.Type != "" {
+		return invalidOptionError
+	}
+	key := keyRequest{Key: r.Key}
+	keyErr := key.validate()
+	if isFramed(writer) {
+		keyErr = key.validateFramed()
+	}
+	if keyErr != nil {
+		return keyErr
+	}
+	return r.encode(writer, append([]interface{}{r.Key}, r.args()...))
+}
+
+// SET options. Without condition option key is set only if it doesn't exist.
+const (
+	// SetOptionNX sets key only if it doesn't exist
+	SetOptionNX = "NX"
+	// SetOptionXX sets key only if it exists
+	SetOptionXX = "XX"
+	// SetOptionUpsert sets key regardless of its existence
+	SetOptionUpsert = "UPSERT"
+	// SetOptionGet makes previous value of key returned
+	SetOptionGet = "GET"
+	// SetOptionKeepTTL keeps ttl of existing key
+	SetOptionKeepTTL = "KEEPTTL"
+	// OptionSliding makes ttl of created key sliding, it is extended on every access.
+	// It is accepted by SET, PSETEX, HCREATE and LCREATE.
+	OptionSliding = "SLIDING"
+)
+
+type setRequest struct {
+	*keyValueRequest
+	TTL uint64
+	// Condition is one of SetOptionNX, SetOptionXX or SetOptionUpsert. Empty condition means SetOptionNX.
+	Condition string
+	Get       bool
+	KeepTTL   bool
+	Sliding   bool
+}
+
+// options returns list of request options in canonical order
+func (r *setRequest) options() []interface{} {
+	var options []interface{}
+	if r.Condition != "" {
+		options = append(options, r.Condition)
+	}
+	if r.Get {
+		options = append(options, SetOptionGet)
+	}
+	if r.KeepTTL {
+		options = append(options, SetOptionKeepTTL)
+	}
+	if r.Sliding {
+		options = append(options, OptionSliding)
+	}
+	return options
+}
+
+// setOptions parses request options, every option may be used only once
+func (r *setRequest) setOptions(options []string) error {
+	r.Condition, r.Get, r.KeepTTL, r.Sliding = "", false, false, false
+	for _, option := range options {
+		switch {
+		case (option == SetOptionNX || option == SetOptionXX || option == SetOptionUpsert) && r.Condition == "":
+			r.Condition = option
+		case option == SetOptionGet && !r.Get:
+			r.Get = true
+		case option == SetOptionKeepTTL && !r.KeepTTL:
+			r.KeepTTL = true
+		case option == OptionSliding && !r.Sliding:
+			r.Sliding = true
+		default:
+			return invalidOptionError
+		}
+	}
+	return nil
+}
+
+func (r *setRequest) validateOptions() error {
+	switch r.Condition {
+	case "", SetOptionNX, SetOptionXX, SetOptionUpsert:
+		return nil
+	}
+	return invalidOptionError
+}
+
+func (r *setRequest) Decode(reader io.Reader) error {
+	if isFramed(reader) {
+		args, err := readFramedArgs(reader)
+		if err != nil {
+			return err
+		}
+		if len(args) < 3 {
+			return invalidRequestFormatError
+		}
+		ttl, err := strconv.ParseUint(args[1], 10, 64)
+		if err != nil {
+			return invalidRequestFormatError
+		}
+		r.Key, r.TTL, r.Value = args[0], ttl, args[2]
+		return r.setOptions(args[3:])
+	}
+
+	args, err := readRequestArgs(reader)
+	if err != nil {
+		return err
+	}
+	if len(args) < 3 {
+		return invalidRequestFormatError
+	}
+	ttl, err := strconv.ParseUint(args[1], 10, 64)
+	if err != nil {
+		return invalidRequestFormatError
+	}
+	length, err := strconv.Atoi(args[2])
+	if err != nil {
+		return invalidRequestFormatError
+	}
+
+	value, err := readRequestValue(reader, length)
+	if err != nil {
+		return err
+	}
+
+	r.Key = args[0]
+	r.TTL = ttl
+	r.Value = string(value)
+	return r.setOptions(args[3:])
+}
+
+func (r *setRequest) Encode(writer io.Writer) (err error) {
+	if err := r.validateOptions(); err != nil {
+		return err
+	}
+	if isFramed(writer) {
+		if err := r.validateFramed(); err != nil {
+			return err
+		}
+		args := append([]interface{}{r.Key, r.TTL, r.Value}, r.options()...)
+		return encodeFramed(writer, r.command, args...)
+	}
+	if err := r.validate(); err != nil {
+		return err
+	}
+	header := fmt.Sprintf("%s %s %d %d", r.command, r.Key, r.TTL, len(r.Value))
+	for _, option := range r.options() {
+		header += " " + option.(string)
+	}
+	_, err = writer.Write([]byte(fmt.Sprintf("%s\r\n%s\r\n", header, r.Value)))
+	return
+}
+
+type casRequest struct {
+	*keyValueRequest
+	Version uint64
+}
+
+func (r *casRequest) Decode(reader io.Reader) error {
+	if isFramed(reader) {
+		return decodeFramed(reader, &r.Key, &r.Version, &r.Value)
+	}
+
+	var key string
+	var version uint64
+	var length int
+
+	_, err := fmt.Fscanf(reader, "%s %d %d\r\n", &key, &version, &length)
+	if err != nil {
+		return invalidRequestFormatError
+	}
+
+	value, err := readRequestValue(reader, length)
+	if err != nil {
+		return err
+	}
+
+	r.Key = key
+	r.Version = version
+	r.Value = string(value)
+	return nil
+}
+
+func (r *casRequest) Encode(writer io.Writer) (err error) {
+	if isFramed(writer) {
+		if err := r.validateFramed(); err != nil {
+			return err
+		}
+		return encodeFramed(writer, r.command, r.Key, r.Version, r.Value)
+	}
+	if err := r.validate(); err != nil {
+		return err
+	}
+	_, err = writer.Write([]byte(fmt.Sprintf("%s %s %d %d\r\n%s\r\n", r.command, r.Key, r.Version, len(r.Value), r.Value)))
+	return
+}
+
+type listRangeRequest struct {
+	*keyRequest
+	Start int
+	Stop  int
+}
+
+func (r *listRangeRequest) Decode(reader io.Reader) error {
+	if isFramed(reader) {
+		return decodeFramed(reader, &r.Key, &r.Start, &r.Stop)
+	}
+
+	var key string
+	var start, stop int
+
+	_, err := fmt.Fscanf(reader, "%s %d %d\r\n", &key, &start, &stop)
+	if err != nil {
+		return invalidRequestFormatError
+	}
+
+	r.Key = key
+	r.Start = start
+	r.Stop = stop
+	return nil
+}
+
+func (r *listRangeRequest) Encode(writer io.Writer) (err error) {
+	if isFramed(writer) {
+		if err := r.validateFramed(); err != nil {
+			return err
+		}
+		return encodeFramed(writer, r.command, r.Key, r.Start, r.Stop)
+	}
+	if err := r.validate(); err != nil {
+		return err
+	}
+	_, err = writer.Write([]byte(fmt.Sprintf("%s %s %d %d\r\n", r.command, r.Key, r.Start, r.Stop)))
+	return
+}
+
+// ScoreRangeOptionLimit is followed by offset and count of returned members
+const ScoreRangeOptionLimit = "LIMIT"
+
+// scoreRangeRequest contains inclusive range of scores. Count 0 means all members after offset.
+type scoreRangeRequest struct {
+	*keyRequest
+	Min    float64
+	Max    float64
+	Offset int
+	Count  int
+}
+
+func newScoreRangeRequest(command string) *scoreRangeRequest {
+	return &scoreRangeRequest{keyRequest: newKeyRequest(command)}
+}
+
+func (r *scoreRangeRequest) Decode(reader io.Reader) error {
+	var args []string
+	var err error
+	if isFramed(reader) {
+		args, err = readFramedArgs(reader)
+	} else {
+		args, err = readRequestArgs(reader)
+	}
+	if err != nil {
+		return err
+	}
+	if len(args) != 3 && len(args) != 6 {
+		return invalidRequestFormatError
+	}
+	r.Key, r.Offset, r.Count = args[0], 0, 0
+	if r.Min, err = parseScore(args[1]); err != nil {
+		return err
+	}
+	if r.Max, err = parseScore(args[2]); err != nil {
+		return err
+	}
+	if len(args) == 3 {
+		return nil
+	}
+	if args[3] != ScoreRangeOptionLimit {
+		return invalidOptionError
+	}
+	offset, offsetErr := strconv.Atoi(args[4])
+	count, countErr := strconv.Atoi(args[5])
+	if offsetErr != nil || countErr != nil || offset < 0 || count < 0 {
+		return invalidRequestFormatError
+	}
+	r.Offset, r.Count = offset, count
+	return nil
+}
+
+func (r *scoreRangeRequest) Encode(writer io.Writer) (err error) {
+	if math.IsNaN(r.Min) || math.IsNaN(r.Max) {
+		return invalidScoreError
+	}
+	if r.Offset < 0 || r.Count < 0 {
+		return invalidRequestFormatError
+	}
+	args := []interface{}{r.Key, formatScore(r.Min), formatScore(r.Max)}
+	if r.Offset > 0 || r.Count > 0 {
+		args = append(args, ScoreRangeOptionLimit, r.Offset, r.Count)
+	}
+	if isFramed(writer) {
+		if err := r.validateFramed(); err != nil {
+			return err
+		}
+		return encodeFramed(writer, r.command, args...)
+	}
+	if err := r.validate(); err != nil {
+		return err
+	}
+	line := r.command
+	for _, arg := range args {
+		line += " " + fmt.Sprint(arg)
+	}
+	_, err = writer.Write([]byte(line + "\r\n"))
+	return
+}
+
+// parseScore parses score of sorted set member. Infinities are allowed as inf, +inf and -inf.
+func parseScore(value string) (float64, error) {
+	score, err := strconv.ParseFloat(value, 64)
+	if err != nil || math.IsNaN(score) {
+		return 0, invalidScoreError
+	}
+	return score, nil
+}
+
+func formatScore(score float64) string {
+	return strconv.FormatFloat(score, 'g', -1, 64)
+}
+
+// isValidChannel reports whether channel or pattern may be sent, it must be a non-empty word in text mode
+func isValidChannel(channel string, framed bool) bool {
+	return channel != "" && (framed || !strings.ContainsAny(channel, " \r\n"))
+}
+
+// channelsRequest contains channels of SUBSCRIBE and UNSUBSCRIBE or patterns of PSUBSCRIBE and PUNSUBSCRIBE.
+// Channels may be empty only if allowEmpty is set, then command is applied to all subscriptions of session.
+type channelsRequest struct {
+	request
+	Channels   []string
+	allowEmpty bool
+}
+
+func newChannelsRequest(command string, allowEmpty bool) *channelsRequest {
+	return &channelsRequest{request: newRequest(command), allowEmpty: allowEmpty}
+}
+
+func (r *channelsRequest) validate(framed bool) error {
+	if len(r.Channels) == 0 && !r.allowEmpty {
+		return invalidRequestFormatError
+	}
+	for _, channel := range r.Channels {
+		if !isValidChannel(channel, framed) {
+			return invalidChannelFormatError
+		}
+	}
+	return nil
+}
+
+func (r *channelsRequest) Decode(reader io.Reader) (err error) {
+	var channels []string
+	if isFramed(reader) {
+		channels, err = readFramedArgs(reader)
+	} else {
+		channels, err = readRequestArgs(reader)
+	}
+	if err != nil {
+		return err
+	}
+	if len(channels) == 0 && !r.allowEmpty {
+		return invalidRequestFormatError
+	}
+	r.Channels = channels
+	return nil
+}
+
+func (r *channelsRequest) Encode(writer io.Writer) (err error) {
+	framed := isFramed(writer)
+	if err := r.validate(framed); err != nil {
+		return err
+	}
+	if framed {
+		args := make([]interface{}, len(r.Channels))
+		for i, channel := range r.Channels {
+			args[i] = channel
+		}
+		return encodeFramed(writer, r.command, args...)
+	}
+	line := r.command
+	if len(r.Channels) > 0 {
+		line += " " + strings.Join(r.Channels, " ")
+	}
+	_, err = writer.Write([]byte(line + "\r\n"))
+	return
+}
+
+// publishRequest contains channel and message which is sent to all subscribers of channel
+type publishRequest struct {
+	request
+	Channel string
+	Message string
+}
+
+func (r *publishRequest) Decode(reader io.Reader) error {
+	if isFramed(reader) {
+		return decodeFramed(reader, &r.Channel, &r.Message)
+	}
+
+	var channel string
+	var length int
+
+	_, err := fmt.Fscanf(reader, "%s %d\r\n", &channel, &length)
+	if err != nil {
+		return invalidRequestFormatError
+	}
+
+	message, err := readRequestValue(reader, length)
+	if err != nil {
+		return err
+	}
+
+	r.Channel = channel
+	r.Message = string(message)
+	return nil
+}
+
+func (r *publishRequest) Encode(writer io.Writer) (err error) {
+	if !isValidChannel(r.Channel, isFramed(writer)) {
+		return invalidChannelFormatError
+	}
+	if isFramed(writer) {
+		return encodeFramed(writer, r.command, r.Channel, r.Message)
+	}
+	_, err = writer.Write([]byte(fmt.Sprintf("%s %s %d\r\n%s\r\n", r.command, r.Channel, len(r.Message), r.Message)))
+	return
+}
+
+func readRequestValue(reader io.Reader, length int) ([]byte, error) {
+	if length < 0 || length > maxRequestValueLength {
+		return nil, invalidRequestFormatError
+	}
+	value := make([]byte, length, length)
 	n, err := io.ReadFull(reader, value)
 	if err != nil || n != length {
 		return nil, invalidRequestFormatError
@@ -338,8 +2070,32 @@ func readRequestValue(reader io.Reader, length int) ([]byte, error) {
 	return value, nil
 }
 
+// readRequestArgs reads the rest of request line and splits it into space separated arguments.
+// Line is read byte by byte, so request value following the line is not read ahead even by unbuffered reader.
+func readRequestArgs(reader io.Reader) ([]string, error) {
+	var line []byte
+	b := make([]byte, 1)
+	for {
+		if _, err := io.ReadFull(reader, b); err != nil {
+			return nil, invalidRequestFormatError
+		}
+		if b[0] == '\n' {
+			break
+		}
+		if len(line) == maxRequestArgsLength {
+			return nil, invalidRequestFormatError
+		}
+		line = append(line, b[0])
+	}
+
+	if len(line) == 0 || line[len(line)-1] != '\r' {
+		return nil, invalidRequestFormatError
+	}
+	return strings.Fields(string(line[:len(line)-1])), nil
+}
+
 func readRequestEnd(reader io.Reader) error {
-	buf := bufio.NewReader(reader)
+	buf := newReader(reader)
 	rest, _, err := buf.ReadLine()
 	if err != nil || len(rest) > 0 {
 		return invalidRequestFormatError
@@ -3,6 +3,7 @@ package protocol
 import (
 	"bufio"
 	"bytes"
+	"math"
 	"time"
 
 	. "gopkg.in/check.v1"
@@ -94,6 +95,50 @@ func (s *RequestsTestSuite) TestSetDecode(c *C) {
 	c.Assert(request.TTL, Equals, uint64(3))
 }
 
+func (s *RequestsTestSuite) TestSetOptionsEncodeDecode(c *C) {
+	request := NewSetRequest()
+	request.Key = "key"
+	request.Value = "value"
+	request.TTL = 3
+	request.Condition = SetOptionXX
+	request.Get = true
+	request.KeepTTL = true
+	request.Sliding = true
+	data := &bytes.Buffer{}
+	err := request.Encode(data)
+	c.Assert(err, IsNil)
+	c.Assert(data.String(), Equals, "SET key 3 5 XX GET KEEPTTL SLIDING\r\nvalue\r\n")
+
+	decoded := NewSetRequest()
+	err = decoded.Decode(bytes.NewBufferString("key 3 5 SLIDING XX GET KEEPTTL\r\nvalue\r\n"))
+	c.Assert(err, IsNil)
+	c.Assert(decoded, DeepEquals, request)
+
+	err = decoded.Decode(bytes.NewBufferString("key 3 5\r\nvalue\r\n"))
+	c.Assert(err, IsNil)
+	c.Assert(decoded.Condition, Equals, "")
+	c.Assert(decoded.Get, Equals, false)
+	c.Assert(decoded.KeepTTL, Equals, false)
+	c.Assert(decoded.Sliding, Equals, false)
+
+	request.Condition = "ANY"
+	err = request.Encode(&bytes.Buffer{})
+	c.Assert(err, ErrorMatches, "Option is not valid")
+}
+
+func (s *RequestsTestSuite) TestSetOptionsDecodeError(c *C) {
+	for _, str := range []string{
+		"key 3 5 NX XX\r\nvalue\r\n",
+		"key 3 5 GET GET\r\nvalue\r\n",
+		"key 3 5 nx\r\nvalue\r\n",
+		"key 3 5 UNKNOWN\r\nvalue\r\n",
+	} {
+		request := NewSetRequest()
+		err := request.Decode(bytes.NewBufferString(str))
+		c.Assert(err, ErrorMatches, "Option is not valid", Commentf("request %q", str))
+	}
+}
+
 func (s *RequestsTestSuite) TestSetDecodeError(c *C) {
 	request := &setRequest{keyValueRequest: newKeyValueRequest("CMD")}
 	var err error
@@ -107,6 +152,8 @@ func (s *RequestsTestSuite) TestSetDecodeError(c *C) {
 	c.Assert(err, ErrorMatches, "Invalid request format")
 	err = request.Decode(bytes.NewBufferString("key 3 5\r\nv\r\n"))
 	c.Assert(err, ErrorMatches, "Invalid request format")
+	err = request.Decode(bytes.NewBufferString("key 3 4611686018427387904\r\nv\r\n"))
+	c.Assert(err, ErrorMatches, "Invalid request format")
 }
 
 func (s *RequestsTestSuite) TestSetDecodeSlowConnection(c *C) {
@@ -128,6 +175,27 @@ func (s *RequestsTestSuite) TestSetDecodeSlowConnectionError(c *C) {
 	}
 }
 
+func (s *RequestsTestSuite) TestDecodePipelined(c *C) {
+	reader := bufio.NewReadWriter(bufio.NewReader(bytes.NewBufferString("SET key1 3 6\r\nvalue1\r\nGET key2\r\n")), nil)
+
+	command, err := ReadRequestCommand(reader)
+	c.Assert(err, IsNil)
+	c.Assert(command, Equals, "SET")
+	setRequest := NewSetRequest()
+	err = setRequest.Decode(reader)
+	c.Assert(err, IsNil)
+	c.Assert(setRequest.Key, Equals, "key1")
+	c.Assert(setRequest.Value, Equals, "value1")
+
+	command, err = ReadRequestCommand(reader)
+	c.Assert(err, IsNil)
+	c.Assert(command, Equals, "GET")
+	getRequest := NewGetRequest()
+	err = getRequest.Decode(reader)
+	c.Assert(err, IsNil)
+	c.Assert(getRequest.Key, Equals, "key2")
+}
+
 func (s *RequestsTestSuite) TestKeyValueEncode(c *C) {
 	request := newKeyValueRequest("CMD")
 	request.Key = "key"
@@ -421,3 +489,675 @@ func (c *slowConn) Read(p []byte) (n int, err error) {
 	}
 	return len(p), nil
 }
+
+func (s *RequestsTestSuite) TestCasEncode(c *C) {
+	request := NewCasRequest()
+	request.Key = "key"
+	request.Value = "value"
+	request.Version = 42
+	data := &bytes.Buffer{}
+	err := request.Encode(data)
+	c.Assert(err, IsNil)
+	c.Assert(data.Bytes(), DeepEquals, []byte("CAS key 42 5\r\nvalue\r\n"))
+}
+
+func (s *RequestsTestSuite) TestCasDecode(c *C) {
+	request := NewCasRequest()
+	err := request.Decode(bytes.NewBufferString("key 42 5\r\nvalue\r\n"))
+	c.Assert(err, IsNil)
+	c.Assert(request.Key, Equals, "key")
+	c.Assert(request.Value, Equals, "value")
+	c.Assert(request.Version, Equals, uint64(42))
+
+	err = request.Decode(bytes.NewBufferString("key -1 5\r\nvalue\r\n"))
+	c.Assert(err, ErrorMatches, "Invalid request format")
+}
+
+func (s *RequestsTestSuite) TestKeyDeltaTTLEncode(c *C) {
+	request := NewIncrByRequest()
+	request.Key = "key"
+	request.Delta = -5
+	request.TTL = 60
+	data := &bytes.Buffer{}
+	err := request.Encode(data)
+	c.Assert(err, IsNil)
+	c.Assert(data.Bytes(), DeepEquals, []byte("INCRBY key -5 60\r\n"))
+}
+
+func (s *RequestsTestSuite) TestKeyDeltaTTLDecode(c *C) {
+	request := NewIncrByRequest()
+	err := request.Decode(bytes.NewBufferString("key -5 60\r\n"))
+	c.Assert(err, IsNil)
+	c.Assert(request.Key, Equals, "key")
+	c.Assert(request.Delta, Equals, int64(-5))
+	c.Assert(request.TTL, Equals, uint64(60))
+
+	err = request.Decode(bytes.NewBufferString("key abc 60\r\n"))
+	c.Assert(err, ErrorMatches, "Invalid request format")
+}
+
+func (s *RequestsTestSuite) TestCreateEncodeDecode(c *C) {
+	request := NewHashCreateRequest()
+	request.Key = "key"
+	request.TTL = 60
+	data := &bytes.Buffer{}
+	err := request.Encode(data)
+	c.Assert(err, IsNil)
+	c.Assert(data.String(), Equals, "HCREATE key 60\r\n")
+
+	request.Sliding = true
+	data.Reset()
+	err = request.Encode(data)
+	c.Assert(err, IsNil)
+	c.Assert(data.String(), Equals, "HCREATE key 60 SLIDING\r\n")
+
+	decoded := NewHashCreateRequest()
+	err = decoded.Decode(bytes.NewBufferString("key 60 SLIDING\r\n"))
+	c.Assert(err, IsNil)
+	c.Assert(decoded, DeepEquals, request)
+
+	err = decoded.Decode(bytes.NewBufferString("key 60\r\n"))
+	c.Assert(err, IsNil)
+	c.Assert(decoded.Sliding, Equals, false)
+
+	err = decoded.Decode(bytes.NewBufferString("key 60 FIXED\r\n"))
+	c.Assert(err, ErrorMatches, "Option is not valid")
+	err = decoded.Decode(bytes.NewBufferString("key\r\n"))
+	c.Assert(err, ErrorMatches, "Invalid request format")
+}
+
+func (s *RequestsTestSuite) TestKeyTimestampEncodeDecode(c *C) {
+	request := NewPExpireAtRequest()
+	request.Key = "key"
+	request.Timestamp = 1700000000123
+	data := &bytes.Buffer{}
+	err := request.Encode(data)
+	c.Assert(err, IsNil)
+	c.Assert(data.String(), Equals, "PEXPIREAT key 1700000000123\r\n")
+
+	decoded := NewPExpireAtRequest()
+	err = decoded.Decode(bytes.NewBufferString("key 1700000000123\r\n"))
+	c.Assert(err, IsNil)
+	c.Assert(decoded.Key, Equals, "key")
+	c.Assert(decoded.Timestamp, Equals, uint64(1700000000123))
+
+	err = decoded.Decode(bytes.NewBufferString("key -1\r\n"))
+	c.Assert(err, ErrorMatches, "Invalid request format")
+}
+
+func (s *RequestsTestSuite) TestMultiKeyEncodeDecode(c *C) {
+	request := NewMGetRequest()
+	request.Keys = []string{"key1", "key2"}
+	data := &bytes.Buffer{}
+	err := request.Encode(data)
+	c.Assert(err, IsNil)
+	c.Assert(data.String(), Equals, "MGET key1 key2\r\n")
+
+	decoded := NewMGetRequest()
+	err = decoded.Decode(bytes.NewBufferString("key1 key2\r\n"))
+	c.Assert(err, IsNil)
+	c.Assert(decoded.Keys, DeepEquals, []string{"key1", "key2"})
+
+	err = decoded.Decode(bytes.NewBufferString("\r\n"))
+	c.Assert(err, ErrorMatches, "Invalid request format")
+
+	request.Keys = []string{"key1", "key 2"}
+	err = request.Encode(&bytes.Buffer{})
+	c.Assert(err, ErrorMatches, "Key is not valid")
+	request.Keys = nil
+	err = request.Encode(&bytes.Buffer{})
+	c.Assert(err, ErrorMatches, "Invalid request format")
+}
+
+func (s *RequestsTestSuite) TestBlockingPopEncodeDecode(c *C) {
+	request := NewListBlockingLeftPopRequest()
+	request.Keys = []string{"key1", "key2"}
+	request.Timeout = 5
+	data := &bytes.Buffer{}
+	err := request.Encode(data)
+	c.Assert(err, IsNil)
+	c.Assert(data.String(), Equals, "BLPOP key1 key2 5\r\n")
+
+	decoded := NewListBlockingLeftPopRequest()
+	err = decoded.Decode(bytes.NewBufferString("key1 key2 5\r\n"))
+	c.Assert(err, IsNil)
+	c.Assert(decoded, DeepEquals, request)
+
+	err = decoded.Decode(bytes.NewBufferString("key1\r\n"))
+	c.Assert(err, ErrorMatches, "Invalid request format")
+	err = decoded.Decode(bytes.NewBufferString("key1 key2\r\n"))
+	c.Assert(err, ErrorMatches, "Invalid request format")
+
+	request.Keys = nil
+	err = request.Encode(&bytes.Buffer{})
+	c.Assert(err, ErrorMatches, "Invalid request format")
+}
+
+func (s *RequestsTestSuite) TestListMoveEncodeDecode(c *C) {
+	request := NewListMoveRequest()
+	request.Source = "source"
+	request.Destination = "destination"
+	request.From = ListRight
+	request.To = ListLeft
+	data := &bytes.Buffer{}
+	err := request.Encode(data)
+	c.Assert(err, IsNil)
+	c.Assert(data.String(), Equals, "LMOVE source destination RIGHT LEFT\r\n")
+
+	decoded := NewListMoveRequest()
+	err = decoded.Decode(bytes.NewBufferString("source destination RIGHT LEFT\r\n"))
+	c.Assert(err, IsNil)
+	c.Assert(decoded, DeepEquals, request)
+
+	err = decoded.Decode(bytes.NewBufferString("source destination RIGHT\r\n"))
+	c.Assert(err, ErrorMatches, "Invalid request format")
+	err = decoded.Decode(bytes.NewBufferString("source destination RIGHT MIDDLE\r\n"))
+	c.Assert(err, ErrorMatches, "Option is not valid")
+
+	request.From = "left"
+	err = request.Encode(&bytes.Buffer{})
+	c.Assert(err, ErrorMatches, "Option is not valid")
+
+	blocking := NewListBlockingMoveRequest()
+	blocking.Source = "source"
+	blocking.Destination = "destination"
+	blocking.From = ListLeft
+	blocking.To = ListRight
+	blocking.Timeout = 5
+	data = &bytes.Buffer{}
+	err = blocking.Encode(data)
+	c.Assert(err, IsNil)
+	c.Assert(data.String(), Equals, "BLMOVE source destination LEFT RIGHT 5\r\n")
+
+	decodedBlocking := NewListBlockingMoveRequest()
+	err = decodedBlocking.Decode(bytes.NewBufferString("source destination LEFT RIGHT 5\r\n"))
+	c.Assert(err, IsNil)
+	c.Assert(decodedBlocking, DeepEquals, blocking)
+
+	err = decodedBlocking.Decode(bytes.NewBufferString("source destination LEFT RIGHT\r\n"))
+	c.Assert(err, ErrorMatches, "Invalid request format")
+	err = decodedBlocking.Decode(bytes.NewBufferString("source destination LEFT RIGHT -1\r\n"))
+	c.Assert(err, ErrorMatches, "Invalid request format")
+}
+
+func (s *RequestsTestSuite) TestListIndexEncodeDecode(c *C) {
+	request := NewListSetRequest()
+	request.Key = "key"
+	request.Index = -1
+	request.Value = "new value"
+	data := &bytes.Buffer{}
+	err := request.Encode(data)
+	c.Assert(err, IsNil)
+	c.Assert(data.String(), Equals, "LSET key -1 9\r\nnew value\r\n")
+
+	decoded := NewListSetRequest()
+	err = decoded.Decode(bytes.NewBufferString("key -1 9\r\nnew value\r\n"))
+	c.Assert(err, IsNil)
+	c.Assert(decoded, DeepEquals, request)
+
+	index := NewListIndexRequest()
+	index.Key = "key"
+	index.Index = -2
+	data = &bytes.Buffer{}
+	err = index.Encode(data)
+	c.Assert(err, IsNil)
+	c.Assert(data.String(), Equals, "LINDEX key -2\r\n")
+
+	err = index.Decode(bytes.NewBufferString("key index\r\n"))
+	c.Assert(err, ErrorMatches, "Invalid request format")
+}
+
+func (s *RequestsTestSuite) TestListRemoveEncodeDecode(c *C) {
+	request := NewListRemoveRequest()
+	request.Key = "key"
+	request.Count = -2
+	request.Value = "value"
+	data := &bytes.Buffer{}
+	err := request.Encode(data)
+	c.Assert(err, IsNil)
+	c.Assert(data.String(), Equals, "LREM key -2 5\r\nvalue\r\n")
+
+	decoded := NewListRemoveRequest()
+	err = decoded.Decode(bytes.NewBufferString("key -2 5\r\nvalue\r\n"))
+	c.Assert(err, IsNil)
+	c.Assert(decoded, DeepEquals, request)
+
+	err = decoded.Decode(bytes.NewBufferString("key 5\r\nvalue\r\n"))
+	c.Assert(err, ErrorMatches, "Invalid request format")
+
+	trim := NewListTrimRequest()
+	trim.Key = "key"
+	trim.Start = -100
+	trim.Stop = -1
+	data = &bytes.Buffer{}
+	err = trim.Encode(data)
+	c.Assert(err, IsNil)
+	c.Assert(data.String(), Equals, "LTRIM key -100 -1\r\n")
+}
+
+func (s *RequestsTestSuite) TestListInsertEncodeDecode(c *C) {
+	request := NewListInsertRequest()
+	request.Key = "key"
+	request.Position = ListBefore
+	request.Pivot = "pivot value"
+	request.Value = "value"
+	data := &bytes.Buffer{}
+	err := request.Encode(data)
+	c.Assert(err, IsNil)
+	c.Assert(data.String(), Equals, "LINSERT key BEFORE 11 5\r\npivot value\r\nvalue\r\n")
+
+	decoded := NewListInsertRequest()
+	reader := bufio.NewReadWriter(bufio.NewReader(bytes.NewBufferString("key BEFORE 11 5\r\npivot value\r\nvalue\r\n")), nil)
+	err = decoded.Decode(reader)
+	c.Assert(err, IsNil)
+	c.Assert(decoded, DeepEquals, request)
+
+	for str, message := range map[string]string{
+		"key BEFORE 11\r\npivot value\r\n":            "Invalid request format",
+		"key BEFORE 11 x\r\npivot value\r\nvalue\r\n": "Invalid request format",
+		"key BEFORE 11 5\r\npivot value\r\n":          "Invalid request format",
+		"key INSIDE 11 5\r\npivot value\r\nvalue\r\n": "Option is not valid",
+	} {
+		reader := bufio.NewReadWriter(bufio.NewReader(bytes.NewBufferString(str)), nil)
+		err = decoded.Decode(reader)
+		c.Assert(err, ErrorMatches, message, Commentf(str))
+	}
+
+	request.Position = "before"
+	err = request.Encode(&bytes.Buffer{})
+	c.Assert(err, ErrorMatches, "Option is not valid")
+}
+
+func (s *RequestsTestSuite) TestKeyMemberEncodeDecode(c *C) {
+	request := NewSetIsMemberRequest()
+	request.Key = "key"
+	request.Member = "member"
+	data := &bytes.Buffer{}
+	err := request.Encode(data)
+	c.Assert(err, IsNil)
+	c.Assert(data.String(), Equals, "SISMEMBER key member\r\n")
+
+	decoded := NewSetIsMemberRequest()
+	err = decoded.Decode(bytes.NewBufferString("key member\r\n"))
+	c.Assert(err, IsNil)
+	c.Assert(decoded, DeepEquals, request)
+
+	err = decoded.Decode(bytes.NewBufferString("key\r\n"))
+	c.Assert(err, ErrorMatches, "Invalid request format")
+
+	request.Member = "with space"
+	err = request.Encode(&bytes.Buffer{})
+	c.Assert(err, ErrorMatches, "Member is not valid")
+}
+
+func (s *RequestsTestSuite) TestKeyMembersEncodeDecode(c *C) {
+	request := NewSetAddRequest()
+	request.Key = "key"
+	request.Members = []string{"member1", "member2"}
+	data := &bytes.Buffer{}
+	err := request.Encode(data)
+	c.Assert(err, IsNil)
+	c.Assert(data.String(), Equals, "SADD key member1 member2\r\n")
+
+	decoded := NewSetAddRequest()
+	err = decoded.Decode(bytes.NewBufferString("key member1 member2\r\n"))
+	c.Assert(err, IsNil)
+	c.Assert(decoded, DeepEquals, request)
+
+	err = decoded.Decode(bytes.NewBufferString("key\r\n"))
+	c.Assert(err, ErrorMatches, "Invalid request format")
+
+	request.Members = []string{"member1", "member 2"}
+	err = request.Encode(&bytes.Buffer{})
+	c.Assert(err, ErrorMatches, "Member is not valid")
+	request.Members = nil
+	err = request.Encode(&bytes.Buffer{})
+	c.Assert(err, ErrorMatches, "Invalid request format")
+}
+
+func (s *RequestsTestSuite) TestScoreMembersEncodeDecode(c *C) {
+	request := NewSortedSetAddRequest()
+	request.Key = "key"
+	request.Scores = []float64{1.5, math.Inf(-1)}
+	request.Members = []string{"member1", "member2"}
+	data := &bytes.Buffer{}
+	err := request.Encode(data)
+	c.Assert(err, IsNil)
+	c.Assert(data.String(), Equals, "ZADD key 1.5 member1 -Inf member2\r\n")
+
+	decoded := NewSortedSetAddRequest()
+	err = decoded.Decode(bytes.NewBufferString("key 1.5 member1 -inf member2\r\n"))
+	c.Assert(err, IsNil)
+	c.Assert(decoded, DeepEquals, request)
+
+	err = decoded.Decode(bytes.NewBufferString("key 1.5\r\n"))
+	c.Assert(err, ErrorMatches, "Invalid request format")
+	err = decoded.Decode(bytes.NewBufferString("key abc member\r\n"))
+	c.Assert(err, ErrorMatches, "Score is not valid")
+	err = decoded.Decode(bytes.NewBufferString("key NaN member\r\n"))
+	c.Assert(err, ErrorMatches, "Score is not valid")
+
+	request.Scores = request.Scores[:1]
+	err = request.Encode(&bytes.Buffer{})
+	c.Assert(err, ErrorMatches, "Invalid request format")
+	request.Scores = []float64{math.NaN(), 1}
+	err = request.Encode(&bytes.Buffer{})
+	c.Assert(err, ErrorMatches, "Score is not valid")
+}
+
+func (s *RequestsTestSuite) TestKeyMemberDeltaEncodeDecode(c *C) {
+	request := NewSortedSetIncrementByRequest()
+	request.Key = "key"
+	request.Delta = -0.25
+	request.Member = "member"
+	data := &bytes.Buffer{}
+	err := request.Encode(data)
+	c.Assert(err, IsNil)
+	c.Assert(data.String(), Equals, "ZINCRBY key -0.25 member\r\n")
+
+	decoded := NewSortedSetIncrementByRequest()
+	err = decoded.Decode(bytes.NewBufferString("key -0.25 member\r\n"))
+	c.Assert(err, IsNil)
+	c.Assert(decoded, DeepEquals, request)
+
+	err = decoded.Decode(bytes.NewBufferString("key abc member\r\n"))
+	c.Assert(err, ErrorMatches, "Score is not valid")
+}
+
+func (s *RequestsTestSuite) TestScoreRangeEncodeDecode(c *C) {
+	request := NewSortedSetRangeByScoreRequest()
+	request.Key = "key"
+	request.Min = math.Inf(-1)
+	request.Max = 10
+	data := &bytes.Buffer{}
+	err := request.Encode(data)
+	c.Assert(err, IsNil)
+	c.Assert(data.String(), Equals, "ZRANGEBYSCORE key -Inf 10\r\n")
+
+	request.Offset, request.Count = 5, 10
+	data.Reset()
+	err = request.Encode(data)
+	c.Assert(err, IsNil)
+	c.Assert(data.String(), Equals, "ZRANGEBYSCORE key -Inf 10 LIMIT 5 10\r\n")
+
+	decoded := NewSortedSetRangeByScoreRequest()
+	err = decoded.Decode(bytes.NewBufferString("key -inf 10 LIMIT 5 10\r\n"))
+	c.Assert(err, IsNil)
+	c.Assert(decoded, DeepEquals, request)
+
+	for _, t := range []struct {
+		request string
+		err     string
+	}{
+		{"key 1\r\n", "Invalid request format"},
+		{"key a 1\r\n", "Score is not valid"},
+		{"key 1 2 OFFSET 5 10\r\n", "Option is not valid"},
+		{"key 1 2 LIMIT 5 -1\r\n", "Invalid request format"},
+	} {
+		err := decoded.Decode(bytes.NewBufferString(t.request))
+		c.Assert(err, ErrorMatches, t.err, Commentf("request %q", t.request))
+	}
+}
+
+func (s *RequestsTestSuite) TestMultiSetEncodeDecode(c *C) {
+	request := NewMSetRequest()
+	request.TTL = 60
+	request.Keys = []string{"key1", "key2"}
+	request.Values = []string{"value1", ""}
+	data := &bytes.Buffer{}
+	err := request.Encode(data)
+	c.Assert(err, IsNil)
+	c.Assert(data.String(), Equals, "MSET 60 key1 6 key2 0\r\nvalue1\r\n\r\n")
+
+	decoded := NewMSetRequest()
+	reader := bufio.NewReadWriter(bufio.NewReader(bytes.NewBufferString("60 key1 6 key2 0\r\nvalue1\r\n\r\n")), nil)
+	err = decoded.Decode(reader)
+	c.Assert(err, IsNil)
+	c.Assert(decoded, DeepEquals, request)
+
+	for _, str := range []string{
+		"60\r\n",
+		"60 key1\r\nvalue1\r\n",
+		"60 key1 abc\r\nvalue1\r\n",
+		"ttl key1 6\r\nvalue1\r\n",
+		"60 key1 6 key2 3\r\nvalue1\r\n",
+	} {
+		reader := bufio.NewReadWriter(bufio.NewReader(bytes.NewBufferString(str)), nil)
+		err = decoded.Decode(reader)
+		c.Assert(err, ErrorMatches, "Invalid request format", Commentf("request %q", str))
+	}
+
+	request.Values = request.Values[:1]
+	err = request.Encode(&bytes.Buffer{})
+	c.Assert(err, ErrorMatches, "Invalid request format")
+}
+
+func (s *RequestsTestSuite) TestScanEncodeDecode(c *C) {
+	request := NewScanRequest()
+	request.Cursor = ScanStart
+	request.Match = "user:*"
+	request.Count = 100
+	request.Type = "hash"
+	data := &bytes.Buffer{}
+	err := request.Encode(data)
+	c.Assert(err, IsNil)
+	c.Assert(data.String(), Equals, "SCAN 0 MATCH user:* COUNT 100 TYPE hash\r\n")
+
+	decoded := NewScanRequest()
+	err = decoded.Decode(bytes.NewBufferString("0 MATCH user:* COUNT 100 TYPE hash\r\n"))
+	c.Assert(err, IsNil)
+	c.Assert(decoded, DeepEquals, request)
+
+	err = decoded.Decode(bytes.NewBufferString("12\r\n"))
+	c.Assert(err, IsNil)
+	c.Assert(decoded.Cursor, Equals, "12")
+	c.Assert(decoded.Match, Equals, "")
+	c.Assert(decoded.Count, Equals, 0)
+
+	request.Match = "with space"
+	err = request.Encode(&bytes.Buffer{})
+	c.Assert(err, ErrorMatches, "Invalid request format")
+}
+
+func (s *RequestsTestSuite) TestScanDecodeError(c *C) {
+	for _, t := range []struct {
+		request string
+		err     string
+	}{
+		{"\r\n", "Invalid request format"},
+		{"0 MATCH\r\n", "Invalid request format"},
+		{"0 COUNT abc\r\n", "Invalid request format"},
+		{"0 COUNT 0\r\n", "Invalid request format"},
+		{"0 LIMIT 10\r\n", "Option is not valid"},
+		{"0 TYPE hash TYPE list\r\n", "Option is not valid"},
+	} {
+		request := NewScanRequest()
+		err := request.Decode(bytes.NewBufferString(t.request))
+		c.Assert(err, ErrorMatches, t.err, Commentf("request %q", t.request))
+	}
+}
+
+func (s *RequestsTestSuite) TestKeyFieldsEncodeDecode(c *C) {
+	request := NewHashGetMultiRequest()
+	request.Key = "key"
+	request.Fields = []string{"field1", "field2"}
+	data := &bytes.Buffer{}
+	err := request.Encode(data)
+	c.Assert(err, IsNil)
+	c.Assert(data.String(), Equals, "HMGET key field1 field2\r\n")
+
+	decoded := NewHashGetMultiRequest()
+	reader := bufio.NewReadWriter(bufio.NewReader(bytes.NewBufferString("key field1 field2\r\n")), nil)
+	err = decoded.Decode(reader)
+	c.Assert(err, IsNil)
+	c.Assert(decoded, DeepEquals, request)
+
+	err = decoded.Decode(bytes.NewBufferString("key\r\n"))
+	c.Assert(err, ErrorMatches, "Invalid request format")
+
+	request.Fields = []string{"field 1"}
+	err = request.Encode(&bytes.Buffer{})
+	c.Assert(err, ErrorMatches, "Field is not valid")
+	request.Fields = nil
+	err = request.Encode(&bytes.Buffer{})
+	c.Assert(err, ErrorMatches, "Invalid request format")
+}
+
+func (s *RequestsTestSuite) TestKeyFieldValuesEncodeDecode(c *C) {
+	request := NewHashSetMultiRequest()
+	request.Key = "key"
+	request.Fields = []string{"field1", "field2"}
+	request.Values = []string{"value 1", ""}
+	data := &bytes.Buffer{}
+	err := request.Encode(data)
+	c.Assert(err, IsNil)
+	c.Assert(data.String(), Equals, "HMSET key field1 7 field2 0\r\nvalue 1\r\n\r\n")
+
+	decoded := NewHashSetMultiRequest()
+	reader := bufio.NewReadWriter(bufio.NewReader(bytes.NewBufferString("key field1 7 field2 0\r\nvalue 1\r\n\r\n")), nil)
+	err = decoded.Decode(reader)
+	c.Assert(err, IsNil)
+	c.Assert(decoded, DeepEquals, request)
+
+	for _, str := range []string{
+		"key\r\n",
+		"key field1\r\nvalue1\r\n",
+		"key field1 abc\r\nvalue1\r\n",
+		"key field1 6 field2 3\r\nvalue1\r\n",
+	} {
+		reader := bufio.NewReadWriter(bufio.NewReader(bytes.NewBufferString(str)), nil)
+		err = decoded.Decode(reader)
+		c.Assert(err, ErrorMatches, "Invalid request format", Commentf("request %q", str))
+	}
+
+	request.Values = request.Values[:1]
+	err = request.Encode(&bytes.Buffer{})
+	c.Assert(err, ErrorMatches, "Invalid request format")
+}
+
+func (s *RequestsTestSuite) TestKeyFieldDeltaEncodeDecode(c *C) {
+	request := NewHashIncrementByRequest()
+	request.Key = "key"
+	request.Field = "field"
+	request.Delta = -5
+	data := &bytes.Buffer{}
+	err := request.Encode(data)
+	c.Assert(err, IsNil)
+	c.Assert(data.String(), Equals, "HINCRBY key field -5\r\n")
+
+	decoded := NewHashIncrementByRequest()
+	err = decoded.Decode(bytes.NewBufferString("key field -5\r\n"))
+	c.Assert(err, IsNil)
+	c.Assert(decoded, DeepEquals, request)
+
+	err = decoded.Decode(bytes.NewBufferString("key field 1.5\r\n"))
+	c.Assert(err, ErrorMatches, "Invalid request format")
+}
+
+func (s *RequestsTestSuite) TestHashScanEncodeDecode(c *C) {
+	request := NewHashScanRequest()
+	request.Key = "key"
+	request.Cursor = ScanStart
+	request.Match = "name*"
+	request.Count = 100
+	data := &bytes.Buffer{}
+	err := request.Encode(data)
+	c.Assert(err, IsNil)
+	c.Assert(data.String(), Equals, "HSCAN key 0 MATCH name* COUNT 100\r\n")
+
+	decoded := NewHashScanRequest()
+	err = decoded.Decode(bytes.NewBufferString("key 0 MATCH name* COUNT 100\r\n"))
+	c.Assert(err, IsNil)
+	c.Assert(decoded, DeepEquals, request)
+
+	for _, t := range []struct {
+		request string
+		err     string
+	}{
+		{"key\r\n", "Invalid request format"},
+		{"key 0 COUNT 0\r\n", "Invalid request format"},
+		{"key 0 TYPE hash\r\n", "Option is not valid"},
+	} {
+		err := decoded.Decode(bytes.NewBufferString(t.request))
+		c.Assert(err, ErrorMatches, t.err, Commentf("request %q", t.request))
+	}
+
+	request.Type = "hash"
+	err = request.Encode(&bytes.Buffer{})
+	c.Assert(err, ErrorMatches, "Option is not valid")
+	request.Type, request.Key = "", "key 1"
+	err = request.Encode(&bytes.Buffer{})
+	c.Assert(err, ErrorMatches, "Key is not valid")
+}
+
+func (s *RequestsTestSuite) TestKeyFieldTTLEncodeDecode(c *C) {
+	request := NewHashExpireRequest()
+	request.Key = "key"
+	request.Field = "field"
+	request.TTL = 60
+	data := &bytes.Buffer{}
+	err := request.Encode(data)
+	c.Assert(err, IsNil)
+	c.Assert(data.String(), Equals, "HEXPIRE key field 60\r\n")
+
+	decoded := NewHashExpireRequest()
+	err = decoded.Decode(bytes.NewBufferString("key field 60\r\n"))
+	c.Assert(err, IsNil)
+	c.Assert(decoded, DeepEquals, request)
+
+	err = decoded.Decode(bytes.NewBufferString("key field -1\r\n"))
+	c.Assert(err, ErrorMatches, "Invalid request format")
+
+	request.Field = "field 1"
+	err = request.Encode(&bytes.Buffer{})
+	c.Assert(err, ErrorMatches, "Field is not valid")
+}
+
+func (s *RequestsTestSuite) TestChannelsEncodeDecode(c *C) {
+	request := NewSubscribeRequest()
+	request.Channels = []string{"news", "sport"}
+	data := &bytes.Buffer{}
+	err := request.Encode(data)
+	c.Assert(err, IsNil)
+	c.Assert(data.String(), Equals, "SUBSCRIBE news sport\r\n")
+
+	decoded := NewSubscribeRequest()
+	err = decoded.Decode(bytes.NewBufferString(" news sport\r\n"))
+	c.Assert(err, IsNil)
+	c.Assert(decoded, DeepEquals, request)
+
+	err = decoded.Decode(bytes.NewBufferString("\r\n"))
+	c.Assert(err, ErrorMatches, "Invalid request format")
+
+	unsubscribe := NewPUnsubscribeRequest()
+	data = &bytes.Buffer{}
+	err = unsubscribe.Encode(data)
+	c.Assert(err, IsNil)
+	c.Assert(data.String(), Equals, "PUNSUBSCRIBE\r\n")
+	err = unsubscribe.Decode(bytes.NewBufferString("\r\n"))
+	c.Assert(err, IsNil)
+	c.Assert(unsubscribe.Channels, HasLen, 0)
+
+	request.Channels = []string{"news 1"}
+	err = request.Encode(&bytes.Buffer{})
+	c.Assert(err, ErrorMatches, "Channel is not valid")
+}
+
+func (s *RequestsTestSuite) TestPublishEncodeDecode(c *C) {
+	request := NewPublishRequest()
+	request.Channel = "news"
+	request.Message = "hello\r\nworld"
+	data := &bytes.Buffer{}
+	err := request.Encode(data)
+	c.Assert(err, IsNil)
+	c.Assert(data.String(), Equals, "PUBLISH news 12\r\nhello\r\nworld\r\n")
+
+	decoded := NewPublishRequest()
+	err = decoded.Decode(bytes.NewBufferString(" news 12\r\nhello\r\nworld\r\n"))
+	c.Assert(err, IsNil)
+	c.Assert(decoded, DeepEquals, request)
+
+	request.Channel = ""
+	err = request.Encode(&bytes.Buffer{})
+	c.Assert(err, ErrorMatches, "Channel is not valid")
+}
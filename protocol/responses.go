@@ -8,6 +8,15 @@ import (
 	"strings"
 )
 
+const (
+	// TypeNone is returned by TYPE when key doesn't exist
+	TypeNone = "none"
+	// TTLNoExpire is returned by TTL and PTTL when key exists forever
+	TTLNoExpire int64 = -1
+	// TTLNotExists is returned by TTL and PTTL when key doesn't exist
+	TTLNotExists int64 = -2
+)
+
 var (
 	invalidResponseFormatError = errors.New("Invalid response format")
 )
@@ -48,7 +57,7 @@ func (r *okResponse) Encode(writer io.Writer) (err error) {
 }
 
 func (r *okResponse) Decode(reader io.Reader) error {
-	buf := bufio.NewReader(reader)
+	buf := newReader(reader)
 	header, err := r.decodeHeader(buf)
 	if err != nil {
 		return err
@@ -62,6 +71,34 @@ func (r *okResponse) Decode(reader io.Reader) error {
 	return invalidResponseFormatError
 }
 
+type queuedResponse struct {
+	*response
+}
+
+func newQueuedResponse() *queuedResponse {
+	return &queuedResponse{response: &response{}}
+}
+
+func (r *queuedResponse) Encode(writer io.Writer) (err error) {
+	_, err = writer.Write(r.prepareResponse([]byte("QUEUED\r\n")))
+	return
+}
+
+func (r *queuedResponse) Decode(reader io.Reader) error {
+	buf := newReader(reader)
+	header, err := r.decodeHeader(buf)
+	if err != nil {
+		return err
+	}
+	if r.Error != nil {
+		return nil
+	}
+	if string(header) == "QUEUED" {
+		return nil
+	}
+	return invalidResponseFormatError
+}
+
 type countResponse struct {
 	*response
 }
@@ -96,7 +133,7 @@ func (r *lenResponse) Encode(writer io.Writer) (err error) {
 }
 
 func (r *lenResponse) Decode(reader io.Reader) error {
-	buf := bufio.NewReader(reader)
+	buf := newReader(reader)
 	header, err := r.decodeHeader(buf)
 	if err != nil {
 		return err
@@ -114,6 +151,35 @@ func (r *lenResponse) Decode(reader io.Reader) error {
 	return nil
 }
 
+type intResponse struct {
+	*response
+	Value int64
+}
+
+func (r *intResponse) Encode(writer io.Writer) (err error) {
+	_, err = writer.Write(r.prepareResponse([]byte(fmt.Sprintf("INT %d\r\n", r.Value))))
+	return
+}
+
+func (r *intResponse) Decode(reader io.Reader) error {
+	buf := newReader(reader)
+	header, err := r.decodeHeader(buf)
+	if err != nil {
+		return err
+	}
+	if r.Error != nil {
+		return nil
+	}
+
+	var value int64
+	_, err = fmt.Sscanf(string(header), "INT %d", &value)
+	if err != nil {
+		return invalidResponseFormatError
+	}
+	r.Value = value
+	return nil
+}
+
 type valueResponse struct {
 	*response
 	Value string
@@ -129,7 +195,45 @@ func (r *valueResponse) Encode(writer io.Writer) (err error) {
 }
 
 func (r *valueResponse) Decode(reader io.Reader) error {
-	buf := bufio.NewReader(reader)
+	buf := newReader(reader)
+	header, err := r.decodeHeader(buf)
+	if err != nil {
+		return err
+	}
+	if r.Error != nil {
+		return nil
+	}
+	var length int
+	_, err = fmt.Sscanf(string(header), "VALUE %d", &length)
+	if err != nil {
+		return invalidResponseFormatError
+	}
+	value, err := readResponseValue(buf, length)
+	if err != nil {
+		return err
+	}
+	r.Value = string(value)
+	return nil
+}
+
+// keyValueResponse contains value and key of list which value was popped from
+type keyValueResponse struct {
+	*response
+	Key   string
+	Value string
+}
+
+func (r *keyValueResponse) Encode(writer io.Writer) (err error) {
+	if isFramed(writer) {
+		_, err = writer.Write(r.prepareResponse([]byte(fmt.Sprintf("KEYVALUE %d %d\r\n%s\r\n%s\r\n", len(r.Key), len(r.Value), r.Key, r.Value))))
+		return
+	}
+	_, err = writer.Write(r.prepareResponse([]byte(fmt.Sprintf("KEYVALUE %s %d\r\n%s\r\n", r.Key, len(r.Value), r.Value))))
+	return
+}
+
+func (r *keyValueResponse) Decode(reader io.Reader) error {
+	buf := newReader(reader)
 	header, err := r.decodeHeader(buf)
 	if err != nil {
 		return err
@@ -138,6 +242,49 @@ func (r *valueResponse) Decode(reader io.Reader) error {
 		return nil
 	}
 	var length int
+	if isFramed(reader) {
+		var keyLength int
+		if _, err = fmt.Sscanf(string(header), "KEYVALUE %d %d", &keyLength, &length); err != nil {
+			return invalidResponseFormatError
+		}
+		if r.Key, err = readResponseValue(buf, keyLength); err != nil {
+			return err
+		}
+	} else if _, err = fmt.Sscanf(string(header), "KEYVALUE %s %d", &r.Key, &length); err != nil {
+		return invalidResponseFormatError
+	}
+	r.Value, err = readResponseValue(buf, length)
+	return err
+}
+
+// setResponse is OK or previous value of key if SET was called with GET option and key existed
+type setResponse struct {
+	*response
+	Value string
+	// Exists is true if response contains previous value
+	Exists bool
+}
+
+func (r *setResponse) Encode(writer io.Writer) (err error) {
+	if !r.Exists {
+		_, err = writer.Write(r.prepareResponse([]byte("OK\r\n")))
+		return
+	}
+	_, err = writer.Write(r.prepareResponse([]byte(fmt.Sprintf("VALUE %d\r\n%s\r\n", len(r.Value), r.Value))))
+	return
+}
+
+func (r *setResponse) Decode(reader io.Reader) error {
+	buf := newReader(reader)
+	header, err := r.decodeHeader(buf)
+	if err != nil {
+		return err
+	}
+	r.Value, r.Exists = "", false
+	if r.Error != nil || string(header) == "OK" {
+		return nil
+	}
+	var length int
 	_, err = fmt.Sscanf(string(header), "VALUE %d", &length)
 	if err != nil {
 		return invalidResponseFormatError
@@ -147,6 +294,42 @@ func (r *valueResponse) Decode(reader io.Reader) error {
 		return err
 	}
 	r.Value = string(value)
+	r.Exists = true
+	return nil
+}
+
+type versionedValueResponse struct {
+	*response
+	Value   string
+	Version uint64
+}
+
+func (r *versionedValueResponse) Encode(writer io.Writer) (err error) {
+	_, err = writer.Write(r.prepareResponse([]byte(fmt.Sprintf("VALUE %d %d\r\n%s\r\n", len(r.Value), r.Version, r.Value))))
+	return
+}
+
+func (r *versionedValueResponse) Decode(reader io.Reader) error {
+	buf := newReader(reader)
+	header, err := r.decodeHeader(buf)
+	if err != nil {
+		return err
+	}
+	if r.Error != nil {
+		return nil
+	}
+	var length int
+	var version uint64
+	_, err = fmt.Sscanf(string(header), "VALUE %d %d", &length, &version)
+	if err != nil {
+		return invalidResponseFormatError
+	}
+	value, err := readResponseValue(buf, length)
+	if err != nil {
+		return err
+	}
+	r.Value = string(value)
+	r.Version = version
 	return nil
 }
 
@@ -156,19 +339,16 @@ type keysResponse struct {
 }
 
 func (r *keysResponse) Encode(writer io.Writer) (err error) {
-	var data []byte
-	for _, key := range r.Keys {
-		if !keyRegexp.MatchString(key) {
-			return fmt.Errorf("Invalid key: %s", key)
-		}
-		data = append(data, []byte(fmt.Sprintf("KEY %s\r\n", key))...)
+	data, err := encodeKeys(r.Keys, isFramed(writer))
+	if err != nil {
+		return err
 	}
 	_, err = writer.Write(r.prepareResponse(data, len(r.Keys)))
 	return
 }
 
 func (r *keysResponse) Decode(reader io.Reader) error {
-	buf := bufio.NewReader(reader)
+	buf := newReader(reader)
 	header, err := r.decodeHeader(buf)
 	if err != nil {
 		return err
@@ -180,21 +360,103 @@ func (r *keysResponse) Decode(reader io.Reader) error {
 	if err != nil {
 		return err
 	}
+	r.Keys, err = decodeKeys(buf, count, isFramed(reader))
+	return err
+}
+
+// scanResponse contains cursor of the next page and keys of the current page
+type scanResponse struct {
+	countResponse
+	Cursor string
+	Keys   []string
+}
+
+func (r *scanResponse) Encode(writer io.Writer) (err error) {
+	data, err := encodeKeys(r.Keys, isFramed(writer))
+	if err != nil {
+		return err
+	}
+	data = r.prepareResponse(data, len(r.Keys))
+	if r.Error == nil {
+		data = append([]byte(fmt.Sprintf("CURSOR %s\r\n", r.Cursor)), data...)
+	}
+	_, err = writer.Write(data)
+	return
+}
+
+func (r *scanResponse) Decode(reader io.Reader) error {
+	buf := newReader(reader)
+	header, err := r.decodeHeader(buf)
+	if err != nil {
+		return err
+	}
+	if r.Error != nil {
+		return nil
+	}
+	var cursor string
+	_, err = fmt.Sscanf(string(header), "CURSOR %s", &cursor)
+	if err != nil {
+		return invalidResponseFormatError
+	}
+	header, err = r.decodeHeader(buf)
+	if err != nil {
+		return err
+	}
+	count, err := r.decodeCount(header)
+	if err != nil {
+		return err
+	}
+	r.Keys, err = decodeKeys(buf, count, isFramed(reader))
+	if err != nil {
+		return err
+	}
+	r.Cursor = cursor
+	return nil
+}
+
+// encodeKeys encodes list of keys, keys are length-prefixed in framed mode
+func encodeKeys(keys []string, framed bool) ([]byte, error) {
+	var data []byte
+	for _, key := range keys {
+		if framed {
+			data = append(data, []byte(fmt.Sprintf("KEY %d\r\n%s\r\n", len(key), key))...)
+			continue
+		}
+		if !keyRegexp.MatchString(key) {
+			return nil, fmt.Errorf("Invalid key: %s", key)
+		}
+		data = append(data, []byte(fmt.Sprintf("KEY %s\r\n", key))...)
+	}
+	return data, nil
+}
+
+func decodeKeys(buf *bufio.Reader, count int, framed bool) ([]string, error) {
 	var keys []string
 	for i := 0; i < count; i++ {
 		header, _, err := buf.ReadLine()
 		if err != nil {
-			return err
+			return nil, err
 		}
 		var key string
-		_, err = fmt.Sscanf(string(header), "KEY %s", &key)
-		if err != nil {
-			return invalidResponseFormatError
+		if framed {
+			var length int
+			_, err = fmt.Sscanf(string(header), "KEY %d", &length)
+			if err != nil {
+				return nil, invalidResponseFormatError
+			}
+			key, err = readResponseValue(buf, length)
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			_, err = fmt.Sscanf(string(header), "KEY %s", &key)
+			if err != nil {
+				return nil, invalidResponseFormatError
+			}
 		}
 		keys = append(keys, key)
 	}
-	r.Keys = keys
-	return nil
+	return keys, nil
 }
 
 type valuesResponse struct {
@@ -212,7 +474,7 @@ func (r *valuesResponse) Encode(writer io.Writer) (err error) {
 }
 
 func (r *valuesResponse) Decode(reader io.Reader) error {
-	buf := bufio.NewReader(reader)
+	buf := newReader(reader)
 	header, err := r.decodeHeader(buf)
 	if err != nil {
 		return err
@@ -245,22 +507,139 @@ func (r *valuesResponse) Decode(reader io.Reader) error {
 	return nil
 }
 
+// scoreResponse contains score of sorted set member
+type scoreResponse struct {
+	*response
+	Score float64
+}
+
+func (r *scoreResponse) Encode(writer io.Writer) (err error) {
+	_, err = writer.Write(r.prepareResponse([]byte(fmt.Sprintf("SCORE %s\r\n", formatScore(r.Score)))))
+	return
+}
+
+func (r *scoreResponse) Decode(reader io.Reader) error {
+	buf := newReader(reader)
+	header, err := r.decodeHeader(buf)
+	if err != nil {
+		return err
+	}
+	if r.Error != nil {
+		return nil
+	}
+
+	var score string
+	_, err = fmt.Sscanf(string(header), "SCORE %s", &score)
+	if err != nil {
+		return invalidResponseFormatError
+	}
+	if r.Score, err = parseScore(score); err != nil {
+		return invalidResponseFormatError
+	}
+	return nil
+}
+
+// scoredMembersResponse contains members of sorted set and their scores in the same order
+type scoredMembersResponse struct {
+	countResponse
+	Members []string
+	Scores  []float64
+}
+
+func (r *scoredMembersResponse) Encode(writer io.Writer) (err error) {
+	var data []byte
+	for i, member := range r.Members {
+		data = append(data, []byte(fmt.Sprintf("MEMBER %s %d\r\n%s\r\n", formatScore(r.Scores[i]), len(member), member))...)
+	}
+	_, err = writer.Write(r.prepareResponse(data, len(r.Members)))
+	return
+}
+
+func (r *scoredMembersResponse) Decode(reader io.Reader) error {
+	buf := newReader(reader)
+	header, err := r.decodeHeader(buf)
+	if err != nil {
+		return err
+	}
+	if r.Error != nil {
+		return nil
+	}
+	count, err := r.decodeCount(header)
+	if err != nil {
+		return err
+	}
+	r.Members, r.Scores = nil, nil
+	for i := 0; i < count; i++ {
+		header, _, err := buf.ReadLine()
+		if err != nil {
+			return err
+		}
+		var score string
+		var length int
+		_, err = fmt.Sscanf(string(header), "MEMBER %s %d", &score, &length)
+		if err != nil {
+			return invalidResponseFormatError
+		}
+		parsed, err := parseScore(score)
+		if err != nil {
+			return invalidResponseFormatError
+		}
+		member, err := readResponseValue(buf, length)
+		if err != nil {
+			return err
+		}
+		r.Members = append(r.Members, member)
+		r.Scores = append(r.Scores, parsed)
+	}
+	return nil
+}
+
 type fieldsResponse struct {
 	countResponse
 	Fields map[string]string
 }
 
 func (r *fieldsResponse) Encode(writer io.Writer) (err error) {
-	var data []byte
-	for field, value := range r.Fields {
-		data = append(data, []byte(fmt.Sprintf("FIELD %s %d\r\n%s\r\n", field, len(value), value))...)
-	}
+	data := encodeFields(r.Fields, isFramed(writer))
 	_, err = writer.Write(r.prepareResponse(data, len(r.Fields)))
 	return
 }
 
 func (r *fieldsResponse) Decode(reader io.Reader) error {
-	buf := bufio.NewReader(reader)
+	buf := newReader(reader)
+	header, err := r.decodeHeader(buf)
+	if err != nil {
+		return err
+	}
+	if r.Error != nil {
+		return nil
+	}
+	count, err := r.decodeCount(header)
+	if err != nil {
+		return err
+	}
+	r.Fields, err = decodeFields(buf, count, isFramed(reader))
+	return err
+}
+
+// hashScanResponse contains cursor of the next page and fields of the current page
+type hashScanResponse struct {
+	countResponse
+	Cursor string
+	Fields map[string]string
+}
+
+func (r *hashScanResponse) Encode(writer io.Writer) (err error) {
+	data := r.prepareResponse(encodeFields(r.Fields, isFramed(writer)), len(r.Fields))
+	if r.Error == nil {
+		data = append([]byte(fmt.Sprintf("CURSOR %s\r\n", r.Cursor)), data...)
+	}
+	_, err = writer.Write(data)
+	return
+}
+
+func (r *hashScanResponse) Decode(reader io.Reader) error {
+	buf := newReader(reader)
 	header, err := r.decodeHeader(buf)
 	if err != nil {
 		return err
@@ -268,33 +647,285 @@ func (r *fieldsResponse) Decode(reader io.Reader) error {
 	if r.Error != nil {
 		return nil
 	}
+	var cursor string
+	_, err = fmt.Sscanf(string(header), "CURSOR %s", &cursor)
+	if err != nil {
+		return invalidResponseFormatError
+	}
+	header, err = r.decodeHeader(buf)
+	if err != nil {
+		return err
+	}
 	count, err := r.decodeCount(header)
 	if err != nil {
 		return err
 	}
+	r.Fields, err = decodeFields(buf, count, isFramed(reader))
+	if err != nil {
+		return err
+	}
+	r.Cursor = cursor
+	return nil
+}
+
+// encodeFields encodes hash fields with values, fields are length-prefixed in framed mode
+func encodeFields(fields map[string]string, framed bool) []byte {
+	var data []byte
+	for field, value := range fields {
+		if framed {
+			data = append(data, []byte(fmt.Sprintf("FIELD %d %d\r\n%s\r\n%s\r\n", len(field), len(value), field, value))...)
+			continue
+		}
+		data = append(data, []byte(fmt.Sprintf("FIELD %s %d\r\n%s\r\n", field, len(value), value))...)
+	}
+	return data
+}
+
+func decodeFields(buf *bufio.Reader, count int, framed bool) (map[string]string, error) {
 	fields := make(map[string]string)
 	for i := 0; i < count; i++ {
 		header, _, err := buf.ReadLine()
 		if err != nil {
-			return err
+			return nil, err
 		}
 		var field string
 		var length int
-		_, err = fmt.Sscanf(string(header), "FIELD %s %d", &field, &length)
-		if err != nil {
-			return invalidResponseFormatError
+		if framed {
+			var fieldLength int
+			_, err = fmt.Sscanf(string(header), "FIELD %d %d", &fieldLength, &length)
+			if err != nil {
+				return nil, invalidResponseFormatError
+			}
+			field, err = readResponseValue(buf, fieldLength)
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			_, err = fmt.Sscanf(string(header), "FIELD %s %d", &field, &length)
+			if err != nil {
+				return nil, invalidResponseFormatError
+			}
 		}
 		value, err := readResponseValue(buf, length)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		fields[field] = string(value)
 	}
-	r.Fields = fields
+	return fields, nil
+}
+
+// execResponse contains responses of all commands executed in transaction.
+// Server encodes Responses, client decodes into responses passed to NewExecResponse.
+// multiValueResponse contains value or error of every requested key
+type multiValueResponse struct {
+	countResponse
+	Values []string
+	Errors []error
+}
+
+func (r *multiValueResponse) Encode(writer io.Writer) (err error) {
+	var data []byte
+	for i, value := range r.Values {
+		if i < len(r.Errors) && r.Errors[i] != nil {
+			data = append(data, []byte(fmt.Sprintf("ERROR %s\r\n", r.Errors[i]))...)
+		} else {
+			data = append(data, []byte(fmt.Sprintf("VALUE %d\r\n%s\r\n", len(value), value))...)
+		}
+	}
+	_, err = writer.Write(r.prepareResponse(data, len(r.Values)))
+	return
+}
+
+func (r *multiValueResponse) Decode(reader io.Reader) error {
+	buf := newReader(reader)
+	header, err := r.decodeHeader(buf)
+	if err != nil {
+		return err
+	}
+	if r.Error != nil {
+		return nil
+	}
+	count, err := r.decodeCount(header)
+	if err != nil {
+		return err
+	}
+
+	r.Values, r.Errors = make([]string, count), make([]error, count)
+	nested := bufio.NewReadWriter(buf, nil)
+	for i := 0; i < count; i++ {
+		value := newValueResponse()
+		if err := value.Decode(nested); err != nil {
+			return err
+		}
+		r.Values[i], r.Errors[i] = value.Value, value.Error
+	}
+	return nil
+}
+
+// multiOkResponse contains OK or error of every requested key
+type multiOkResponse struct {
+	countResponse
+	Errors []error
+}
+
+func (r *multiOkResponse) Encode(writer io.Writer) (err error) {
+	var data []byte
+	for _, err := range r.Errors {
+		if err != nil {
+			data = append(data, []byte(fmt.Sprintf("ERROR %s\r\n", err))...)
+		} else {
+			data = append(data, []byte("OK\r\n")...)
+		}
+	}
+	_, err = writer.Write(r.prepareResponse(data, len(r.Errors)))
+	return
+}
+
+func (r *multiOkResponse) Decode(reader io.Reader) error {
+	buf := newReader(reader)
+	header, err := r.decodeHeader(buf)
+	if err != nil {
+		return err
+	}
+	if r.Error != nil {
+		return nil
+	}
+	count, err := r.decodeCount(header)
+	if err != nil {
+		return err
+	}
+
+	r.Errors = make([]error, count)
+	nested := bufio.NewReadWriter(buf, nil)
+	for i := 0; i < count; i++ {
+		ok := newOkResponse()
+		if err := ok.Decode(nested); err != nil {
+			return err
+		}
+		r.Errors[i] = ok.Error
+	}
 	return nil
 }
 
+type execResponse struct {
+	countResponse
+	Responses []Encoder
+	decoders  []Decoder
+}
+
+func (r *execResponse) Encode(writer io.Writer) error {
+	if _, err := writer.Write(r.prepareResponse(nil, len(r.Responses))); err != nil {
+		return err
+	}
+	if r.Error != nil {
+		return nil
+	}
+	for _, response := range r.Responses {
+		if err := response.Encode(writer); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *execResponse) Decode(reader io.Reader) error {
+	buf := newReader(reader)
+	header, err := r.decodeHeader(buf)
+	if err != nil {
+		return err
+	}
+	if r.Error != nil {
+		return nil
+	}
+	count, err := r.decodeCount(header)
+	if err != nil {
+		return err
+	}
+	if count != len(r.decoders) {
+		return invalidResponseFormatError
+	}
+
+	// Nested responses must share buffer and framing mode with reader
+	var nested io.Reader = bufio.NewReadWriter(buf, nil)
+	if isFramed(reader) {
+		nested = NewFramedReadWriter(bufio.NewReadWriter(buf, nil))
+	}
+	for _, decoder := range r.decoders {
+		if err := decoder.Decode(nested); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// messageResponse is pushed to subscriber when message is published to channel.
+// Pattern is not empty if subscriber receives message because channel matches pattern of PSUBSCRIBE.
+type messageResponse struct {
+	*response
+	Pattern string
+	Channel string
+	Message string
+}
+
+// Encode returns error if channel or pattern can't be written in text mode, e.g. channel of key with spaces
+func (r *messageResponse) Encode(writer io.Writer) (err error) {
+	framed := isFramed(writer)
+	if r.Error == nil && (!isValidChannel(r.Channel, framed) || r.Pattern != "" && !isValidChannel(r.Pattern, framed)) {
+		return invalidChannelFormatError
+	}
+	var header string
+	switch {
+	case framed && r.Pattern != "":
+		header = fmt.Sprintf("PMESSAGE %d %d %d\r\n%s\r\n%s", len(r.Pattern), len(r.Channel), len(r.Message), r.Pattern, r.Channel)
+	case framed:
+		header = fmt.Sprintf("MESSAGE %d %d\r\n%s", len(r.Channel), len(r.Message), r.Channel)
+	case r.Pattern != "":
+		header = fmt.Sprintf("PMESSAGE %s %s %d", r.Pattern, r.Channel, len(r.Message))
+	default:
+		header = fmt.Sprintf("MESSAGE %s %d", r.Channel, len(r.Message))
+	}
+	_, err = writer.Write(r.prepareResponse([]byte(fmt.Sprintf("%s\r\n%s\r\n", header, r.Message))))
+	return
+}
+
+func (r *messageResponse) Decode(reader io.Reader) error {
+	buf := newReader(reader)
+	header, err := r.decodeHeader(buf)
+	if err != nil {
+		return err
+	}
+	if r.Error != nil {
+		return nil
+	}
+	r.Pattern = ""
+	var length int
+	if isFramed(reader) {
+		var patternLength, channelLength int
+		if _, err = fmt.Sscanf(string(header), "PMESSAGE %d %d %d", &patternLength, &channelLength, &length); err == nil {
+			if r.Pattern, err = readResponseValue(buf, patternLength); err != nil {
+				return err
+			}
+		} else if _, err = fmt.Sscanf(string(header), "MESSAGE %d %d", &channelLength, &length); err != nil {
+			return invalidResponseFormatError
+		}
+		if r.Channel, err = readResponseValue(buf, channelLength); err != nil {
+			return err
+		}
+	} else if _, err = fmt.Sscanf(string(header), "PMESSAGE %s %s %d", &r.Pattern, &r.Channel, &length); err != nil {
+		r.Pattern = ""
+		if _, err = fmt.Sscanf(string(header), "MESSAGE %s %d", &r.Channel, &length); err != nil {
+			return invalidResponseFormatError
+		}
+	}
+	r.Message, err = readResponseValue(buf, length)
+	return err
+}
+
 func readResponseValue(buf *bufio.Reader, length int) (string, error) {
+	if length < 0 {
+		return "", invalidResponseFormatError
+	}
 	value := make([]byte, length, length)
 	n, err := io.ReadFull(buf, value)
 	if err != nil || n != length {
@@ -1,8 +1,10 @@
 package protocol
 
 import (
+	"bufio"
 	"bytes"
 	"errors"
+	"math"
 
 	. "gopkg.in/check.v1"
 )
@@ -121,6 +123,25 @@ func (s *ResponsesTestSuite) TestValueDecodeError(c *C) {
 	c.Assert(err, ErrorMatches, "Invalid response format")
 }
 
+func (s *ResponsesTestSuite) TestValueDecodePipelined(c *C) {
+	reader := bufio.NewReader(bytes.NewBufferString("VALUE 6\r\nvalue1\r\nERROR TEST\r\nVALUE 6\r\nvalue2\r\n"))
+
+	response1 := newValueResponse()
+	err := response1.Decode(reader)
+	c.Assert(err, IsNil)
+	c.Assert(response1.Value, Equals, "value1")
+
+	response2 := newValueResponse()
+	err = response2.Decode(reader)
+	c.Assert(err, IsNil)
+	c.Assert(response2.Error, ErrorMatches, "Response error: TEST")
+
+	response3 := newValueResponse()
+	err = response3.Decode(reader)
+	c.Assert(err, IsNil)
+	c.Assert(response3.Value, Equals, "value2")
+}
+
 func (s *ResponsesTestSuite) TestKeysEncode(c *C) {
 	response := &keysResponse{countResponse: newCountResponse()}
 	response.Keys = []string{"key1", "key2"}
@@ -241,3 +262,303 @@ func (s *ResponsesTestSuite) TestValuesDecodeError(c *C) {
 	err = response.Decode(bytes.NewBufferString("COUNT 1\r\nVALUE 5\r\n\r\n"))
 	c.Assert(err, ErrorMatches, "Invalid response format")
 }
+
+func (s *ResponsesTestSuite) TestExecEncode(c *C) {
+	value := newValueResponse()
+	value.Value = "value"
+	response := NewExecResponse()
+	response.Responses = []Encoder{newOkResponse(), value}
+
+	data := &bytes.Buffer{}
+	err := response.Encode(data)
+	c.Assert(err, IsNil)
+	c.Assert(data.String(), Equals, "COUNT 2\r\nOK\r\nVALUE 5\r\nvalue\r\n")
+
+	response.Error = errors.New("TEST")
+	data = &bytes.Buffer{}
+	err = response.Encode(data)
+	c.Assert(err, IsNil)
+	c.Assert(data.String(), Equals, "ERROR TEST\r\n")
+}
+
+func (s *ResponsesTestSuite) TestExecDecode(c *C) {
+	ok := newOkResponse()
+	value := newValueResponse()
+	response := NewExecResponse(ok, value)
+
+	err := response.Decode(bytes.NewBufferString("COUNT 2\r\nOK\r\nVALUE 5\r\nvalue\r\n"))
+	c.Assert(err, IsNil)
+	c.Assert(response.Error, IsNil)
+	c.Assert(ok.Error, IsNil)
+	c.Assert(value.Value, Equals, "value")
+
+	err = response.Decode(bytes.NewBufferString("COUNT 1\r\nOK\r\n"))
+	c.Assert(err, ErrorMatches, "Invalid response format")
+
+	err = response.Decode(bytes.NewBufferString("ERROR TEST\r\n"))
+	c.Assert(err, IsNil)
+	c.Assert(response.Error, ErrorMatches, "Response error: TEST")
+}
+
+func (s *ResponsesTestSuite) TestSetEncodeDecode(c *C) {
+	response := NewSetResponse()
+	data := &bytes.Buffer{}
+	err := response.Encode(data)
+	c.Assert(err, IsNil)
+	c.Assert(data.String(), Equals, "OK\r\n")
+
+	response.Value = "old"
+	response.Exists = true
+	err = response.Encode(data)
+	c.Assert(err, IsNil)
+	c.Assert(data.String(), Equals, "OK\r\nVALUE 3\r\nold\r\n")
+
+	reader := bufio.NewReadWriter(bufio.NewReader(data), nil)
+	decoded := NewSetResponse()
+	err = decoded.Decode(reader)
+	c.Assert(err, IsNil)
+	c.Assert(decoded.Exists, Equals, false)
+	err = decoded.Decode(reader)
+	c.Assert(err, IsNil)
+	c.Assert(decoded.Exists, Equals, true)
+	c.Assert(decoded.Value, Equals, "old")
+
+	err = decoded.Decode(bytes.NewBufferString("TEST\r\n"))
+	c.Assert(err, ErrorMatches, "Invalid response format")
+}
+
+func (s *ResponsesTestSuite) TestVersionedValueEncodeDecode(c *C) {
+	response := NewGetsResponse()
+	response.Value = "value"
+	response.Version = 42
+
+	data := &bytes.Buffer{}
+	err := response.Encode(data)
+	c.Assert(err, IsNil)
+	c.Assert(data.String(), Equals, "VALUE 5 42\r\nvalue\r\n")
+
+	decoded := NewGetsResponse()
+	err = decoded.Decode(data)
+	c.Assert(err, IsNil)
+	c.Assert(decoded.Value, Equals, "value")
+	c.Assert(decoded.Version, Equals, uint64(42))
+
+	err = decoded.Decode(bytes.NewBufferString("VALUE 5\r\nvalue\r\n"))
+	c.Assert(err, ErrorMatches, "Invalid response format")
+}
+
+func (s *ResponsesTestSuite) TestIntEncodeDecode(c *C) {
+	response := NewIncrResponse()
+	response.Value = -42
+
+	data := &bytes.Buffer{}
+	err := response.Encode(data)
+	c.Assert(err, IsNil)
+	c.Assert(data.Bytes(), DeepEquals, []byte("INT -42\r\n"))
+
+	decoded := NewIncrResponse()
+	err = decoded.Decode(data)
+	c.Assert(err, IsNil)
+	c.Assert(decoded.Error, IsNil)
+	c.Assert(decoded.Value, Equals, int64(-42))
+
+	err = decoded.Decode(bytes.NewBufferString("INT abc\r\n"))
+	c.Assert(err, ErrorMatches, "Invalid response format")
+}
+
+func (s *ResponsesTestSuite) TestKeyValueEncodeDecode(c *C) {
+	response := NewListBlockingLeftPopResponse()
+	response.Key = "key"
+	response.Value = "value 1"
+
+	data := &bytes.Buffer{}
+	err := response.Encode(data)
+	c.Assert(err, IsNil)
+	c.Assert(data.String(), Equals, "KEYVALUE key 7\r\nvalue 1\r\n")
+
+	decoded := NewListBlockingLeftPopResponse()
+	err = decoded.Decode(data)
+	c.Assert(err, IsNil)
+	c.Assert(decoded.Error, IsNil)
+	c.Assert(decoded.Key, Equals, "key")
+	c.Assert(decoded.Value, Equals, "value 1")
+
+	err = decoded.Decode(bytes.NewBufferString("ERROR List is empty\r\n"))
+	c.Assert(err, IsNil)
+	c.Assert(decoded.Error, ErrorMatches, "Response error: List is empty")
+
+	decoded = NewListBlockingLeftPopResponse()
+	err = decoded.Decode(bytes.NewBufferString("KEYVALUE key\r\nvalue\r\n"))
+	c.Assert(err, ErrorMatches, "Invalid response format")
+}
+
+func (s *ResponsesTestSuite) TestScoreEncodeDecode(c *C) {
+	response := NewSortedSetScoreResponse()
+	response.Score = -1.5
+
+	data := &bytes.Buffer{}
+	err := response.Encode(data)
+	c.Assert(err, IsNil)
+	c.Assert(data.Bytes(), DeepEquals, []byte("SCORE -1.5\r\n"))
+
+	decoded := NewSortedSetScoreResponse()
+	err = decoded.Decode(data)
+	c.Assert(err, IsNil)
+	c.Assert(decoded.Error, IsNil)
+	c.Assert(decoded.Score, Equals, -1.5)
+
+	err = decoded.Decode(bytes.NewBufferString("SCORE +Inf\r\n"))
+	c.Assert(err, IsNil)
+	c.Assert(math.IsInf(decoded.Score, 1), Equals, true)
+
+	err = decoded.Decode(bytes.NewBufferString("SCORE NaN\r\n"))
+	c.Assert(err, ErrorMatches, "Invalid response format")
+}
+
+func (s *ResponsesTestSuite) TestScoredMembersEncodeDecode(c *C) {
+	response := NewSortedSetRangeResponse()
+	response.Members = []string{"member1", "member 2"}
+	response.Scores = []float64{1, 2.5}
+
+	data := &bytes.Buffer{}
+	err := response.Encode(data)
+	c.Assert(err, IsNil)
+	c.Assert(data.String(), Equals, "COUNT 2\r\nMEMBER 1 7\r\nmember1\r\nMEMBER 2.5 8\r\nmember 2\r\n")
+
+	decoded := NewSortedSetRangeResponse()
+	err = decoded.Decode(data)
+	c.Assert(err, IsNil)
+	c.Assert(decoded.Error, IsNil)
+	c.Assert(decoded.Members, DeepEquals, response.Members)
+	c.Assert(decoded.Scores, DeepEquals, response.Scores)
+
+	err = decoded.Decode(bytes.NewBufferString("COUNT 1\r\nMEMBER abc 1\r\na\r\n"))
+	c.Assert(err, ErrorMatches, "Invalid response format")
+	err = decoded.Decode(bytes.NewBufferString("COUNT 1\r\nMEMBER 1 5\r\na\r\n"))
+	c.Assert(err, ErrorMatches, "Invalid response format")
+}
+
+func (s *ResponsesTestSuite) TestMultiValueEncodeDecode(c *C) {
+	response := NewMGetResponse()
+	response.Values = []string{"value", ""}
+	response.Errors = []error{nil, errors.New("Key does not exist")}
+
+	data := &bytes.Buffer{}
+	err := response.Encode(data)
+	c.Assert(err, IsNil)
+	c.Assert(data.String(), Equals, "COUNT 2\r\nVALUE 5\r\nvalue\r\nERROR Key does not exist\r\n")
+
+	decoded := NewMGetResponse()
+	err = decoded.Decode(data)
+	c.Assert(err, IsNil)
+	c.Assert(decoded.Error, IsNil)
+	c.Assert(decoded.Values, DeepEquals, []string{"value", ""})
+	c.Assert(decoded.Errors[0], IsNil)
+	c.Assert(decoded.Errors[1], ErrorMatches, "Response error: Key does not exist")
+
+	err = decoded.Decode(bytes.NewBufferString("COUNT 1\r\nOK\r\n"))
+	c.Assert(err, ErrorMatches, "Invalid response format")
+}
+
+func (s *ResponsesTestSuite) TestMultiOkEncodeDecode(c *C) {
+	response := NewMDelResponse()
+	response.Errors = []error{nil, errors.New("Key does not exist")}
+
+	data := &bytes.Buffer{}
+	err := response.Encode(data)
+	c.Assert(err, IsNil)
+	c.Assert(data.String(), Equals, "COUNT 2\r\nOK\r\nERROR Key does not exist\r\n")
+
+	decoded := NewMDelResponse()
+	err = decoded.Decode(data)
+	c.Assert(err, IsNil)
+	c.Assert(decoded.Errors, HasLen, 2)
+	c.Assert(decoded.Errors[0], IsNil)
+	c.Assert(decoded.Errors[1], ErrorMatches, "Response error: Key does not exist")
+}
+
+func (s *ResponsesTestSuite) TestScanEncodeDecode(c *C) {
+	response := NewScanResponse()
+	response.Cursor = "42"
+	response.Keys = []string{"key1", "key2"}
+
+	data := &bytes.Buffer{}
+	err := response.Encode(data)
+	c.Assert(err, IsNil)
+	c.Assert(data.String(), Equals, "CURSOR 42\r\nCOUNT 2\r\nKEY key1\r\nKEY key2\r\n")
+
+	decoded := NewScanResponse()
+	err = decoded.Decode(data)
+	c.Assert(err, IsNil)
+	c.Assert(decoded.Cursor, Equals, "42")
+	c.Assert(decoded.Keys, DeepEquals, []string{"key1", "key2"})
+
+	response.Error = errors.New("TEST")
+	data = &bytes.Buffer{}
+	err = response.Encode(data)
+	c.Assert(err, IsNil)
+	c.Assert(data.String(), Equals, "ERROR TEST\r\n")
+
+	err = decoded.Decode(bytes.NewBufferString("COUNT 0\r\n"))
+	c.Assert(err, ErrorMatches, "Invalid response format")
+}
+
+func (s *ResponsesTestSuite) TestHashScanEncodeDecode(c *C) {
+	response := NewHashScanResponse()
+	response.Cursor = "6669656c6432"
+	response.Fields = map[string]string{"field1": "value1"}
+
+	data := &bytes.Buffer{}
+	err := response.Encode(data)
+	c.Assert(err, IsNil)
+	c.Assert(data.String(), Equals, "CURSOR 6669656c6432\r\nCOUNT 1\r\nFIELD field1 6\r\nvalue1\r\n")
+
+	decoded := NewHashScanResponse()
+	err = decoded.Decode(data)
+	c.Assert(err, IsNil)
+	c.Assert(decoded.Cursor, Equals, "6669656c6432")
+	c.Assert(decoded.Fields, DeepEquals, map[string]string{"field1": "value1"})
+
+	response.Error = errors.New("TEST")
+	data = &bytes.Buffer{}
+	err = response.Encode(data)
+	c.Assert(err, IsNil)
+	c.Assert(data.String(), Equals, "ERROR TEST\r\n")
+
+	err = decoded.Decode(bytes.NewBufferString("COUNT 0\r\n"))
+	c.Assert(err, ErrorMatches, "Invalid response format")
+}
+
+func (s *ResponsesTestSuite) TestMessageEncodeDecode(c *C) {
+	response := NewMessageResponse()
+	response.Channel = "news"
+	response.Message = "hello"
+
+	data := &bytes.Buffer{}
+	err := response.Encode(data)
+	c.Assert(err, IsNil)
+	c.Assert(data.String(), Equals, "MESSAGE news 5\r\nhello\r\n")
+
+	decoded := NewMessageResponse()
+	decoded.Pattern = "stale"
+	err = decoded.Decode(data)
+	c.Assert(err, IsNil)
+	c.Assert(decoded, DeepEquals, response)
+
+	response.Pattern = "n*"
+	data = &bytes.Buffer{}
+	err = response.Encode(data)
+	c.Assert(err, IsNil)
+	c.Assert(data.String(), Equals, "PMESSAGE n* news 5\r\nhello\r\n")
+
+	err = decoded.Decode(data)
+	c.Assert(err, IsNil)
+	c.Assert(decoded, DeepEquals, response)
+
+	err = decoded.Decode(bytes.NewBufferString("VALUE 5\r\nhello\r\n"))
+	c.Assert(err, ErrorMatches, "Invalid response format")
+
+	response.Channel = "news 1"
+	err = response.Encode(&bytes.Buffer{})
+	c.Assert(err, ErrorMatches, "Channel is not valid")
+}
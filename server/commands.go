@@ -3,13 +3,21 @@ package server
 import (
 	"errors"
 	"io"
+	"math"
+	"time"
 
 	"github.com/Barberrrry/jcache/protocol"
 	"github.com/Barberrrry/jcache/server/htpasswd"
 	"github.com/Barberrrry/jcache/server/storage"
 )
 
-type command func(io.ReadWriter)
+// command decodes request and returns action which executes it.
+// Session executes action immediately or queues it until EXEC if transaction is started.
+type command func(reader io.Reader) (action, error)
+
+// action executes decoded request with storage and returns response.
+// Error stored in response is returned too, it rolls back transaction.
+type action func(s storage.Storage) (protocol.Encoder, error)
 
 var (
 	invalidCredentialsError = errors.New("Invalid credentials")
@@ -20,230 +28,1067 @@ func writeError(writer io.Writer, err error) {
 	response.Encode(writer)
 }
 
-func run(rw io.ReadWriter, request protocol.Decoder, response protocol.Encoder, action func()) {
-	err := request.Decode(rw)
-	if err != nil {
-		writeError(rw, err)
+// decode decodes request and returns action if request is valid
+func decode(reader io.Reader, request protocol.Decoder, a action) (action, error) {
+	if err := request.Decode(reader); err != nil {
+		return nil, err
 	}
+	return a, nil
+}
 
-	action()
+// overwriteValue sets string value and ttl of key regardless of key existence
+func overwriteValue(s storage.Storage, key, value string, ttl uint64) error {
+	_, _, err := s.SetWithOptions(key, value, ttl, storage.SetOptions{Mode: storage.SetAlways})
+	return err
+}
 
-	err = response.Encode(rw)
-	if err != nil {
-		writeError(rw, err)
-	}
+// setModes maps SET condition options to storage modes
+var setModes = map[string]storage.SetMode{
+	"":                       storage.SetIfNotExists,
+	protocol.SetOptionNX:     storage.SetIfNotExists,
+	protocol.SetOptionXX:     storage.SetIfExists,
+	protocol.SetOptionUpsert: storage.SetAlways,
 }
 
-func newKeysCommand(storage storage.Storage) command {
-	return func(rw io.ReadWriter) {
+func newKeysCommand() command {
+	return func(reader io.Reader) (action, error) {
 		request := protocol.NewKeysRequest()
-		response := protocol.NewKeysResponse()
-		run(rw, request, response, func() {
-			response.Keys = storage.Keys()
+		return decode(reader, request, func(s storage.Storage) (protocol.Encoder, error) {
+			response := protocol.NewKeysResponse()
+			response.Keys = s.Keys()
+			return response, response.Error
 		})
 	}
 }
 
-func newGetCommand(storage storage.Storage) command {
-	return func(rw io.ReadWriter) {
+func newScanCommand() command {
+	return func(reader io.Reader) (action, error) {
+		request := protocol.NewScanRequest()
+		return decode(reader, request, func(s storage.Storage) (protocol.Encoder, error) {
+			response := protocol.NewScanResponse()
+			options := storage.ScanOptions{Pattern: request.Match, Count: request.Count, Type: request.Type}
+			response.Cursor, response.Keys, response.Error = s.Scan(request.Cursor, options)
+			return response, response.Error
+		})
+	}
+}
+
+func newGetCommand() command {
+	return func(reader io.Reader) (action, error) {
 		request := protocol.NewGetRequest()
-		response := protocol.NewGetResponse()
-		run(rw, request, response, func() {
-			response.Value, response.Error = storage.Get(request.Key)
+		return decode(reader, request, func(s storage.Storage) (protocol.Encoder, error) {
+			response := protocol.NewGetResponse()
+			response.Value, response.Error = s.Get(request.Key)
+			return response, response.Error
+		})
+	}
+}
+
+func newGetsCommand() command {
+	return func(reader io.Reader) (action, error) {
+		request := protocol.NewGetsRequest()
+		return decode(reader, request, func(s storage.Storage) (protocol.Encoder, error) {
+			response := protocol.NewGetsResponse()
+			response.Value, response.Version, response.Error = s.GetWithVersion(request.Key)
+			return response, response.Error
 		})
 	}
 }
 
-func newSetCommand(storage storage.Storage) command {
-	return func(rw io.ReadWriter) {
+func newCasCommand() command {
+	return func(reader io.Reader) (action, error) {
+		request := protocol.NewCasRequest()
+		return decode(reader, request, func(s storage.Storage) (protocol.Encoder, error) {
+			response := protocol.NewCasResponse()
+			response.Error = s.CompareAndSwap(request.Key, request.Value, request.Version)
+			return response, response.Error
+		})
+	}
+}
+
+func newSetCommand() command {
+	return func(reader io.Reader) (action, error) {
 		request := protocol.NewSetRequest()
-		response := protocol.NewSetResponse()
-		run(rw, request, response, func() {
-			response.Error = storage.Set(request.Key, request.Value, request.TTL)
+		return decode(reader, request, func(s storage.Storage) (protocol.Encoder, error) {
+			response := protocol.NewSetResponse()
+			options := storage.SetOptions{
+				Mode:       setModes[request.Condition],
+				KeepTTL:    request.KeepTTL,
+				Get:        request.Get,
+				SlidingTTL: slidingTTL(request.Sliding, request.TTL, time.Second),
+			}
+			var existed bool
+			response.Value, existed, response.Error = s.SetWithOptions(request.Key, request.Value, request.TTL, options)
+			response.Exists = existed && request.Get
+			return response, response.Error
+		})
+	}
+}
+
+// newPSetExCommand works like SET but TTL is in milliseconds
+func newPSetExCommand() command {
+	return func(reader io.Reader) (action, error) {
+		request := protocol.NewPSetExRequest()
+		return decode(reader, request, func(s storage.Storage) (protocol.Encoder, error) {
+			response := protocol.NewPSetExResponse()
+			options := storage.SetOptions{
+				Mode:       setModes[request.Condition],
+				KeepTTL:    request.KeepTTL,
+				Get:        request.Get,
+				ExpireTime: expireTimeAfter(request.TTL, time.Millisecond),
+				SlidingTTL: slidingTTL(request.Sliding, request.TTL, time.Millisecond),
+			}
+			var existed bool
+			response.Value, existed, response.Error = s.SetWithOptions(request.Key, request.Value, 0, options)
+			response.Exists = existed && request.Get
+			return response, response.Error
+		})
+	}
+}
+
+// Multi-key commands return errors per key, so missing keys don't fail transaction
+
+func newMGetCommand() command {
+	return func(reader io.Reader) (action, error) {
+		request := protocol.NewMGetRequest()
+		return decode(reader, request, func(s storage.Storage) (protocol.Encoder, error) {
+			response := protocol.NewMGetResponse()
+			response.Values, response.Errors = s.GetMulti(request.Keys)
+			return response, nil
+		})
+	}
+}
+
+func newMSetCommand() command {
+	return func(reader io.Reader) (action, error) {
+		request := protocol.NewMSetRequest()
+		return decode(reader, request, func(s storage.Storage) (protocol.Encoder, error) {
+			response := protocol.NewMSetResponse()
+			response.Errors = s.SetMulti(request.Keys, request.Values, request.TTL)
+			return response, nil
+		})
+	}
+}
+
+func newMDelCommand() command {
+	return func(reader io.Reader) (action, error) {
+		request := protocol.NewMDelRequest()
+		return decode(reader, request, func(s storage.Storage) (protocol.Encoder, error) {
+			response := protocol.NewMDelResponse()
+			response.Errors = s.DeleteMulti(request.Keys)
+			return response, nil
 		})
 	}
 }
 
-func newUpdCommand(storage storage.Storage) command {
-	return func(rw io.ReadWriter) {
+func newUpdCommand() command {
+	return func(reader io.Reader) (action, error) {
 		request := protocol.NewUpdRequest()
-		response := protocol.NewUpdResponse()
-		run(rw, request, response, func() {
-			response.Error = storage.Update(request.Key, request.Value)
+		return decode(reader, request, func(s storage.Storage) (protocol.Encoder, error) {
+			response := protocol.NewUpdResponse()
+			response.Error = s.Update(request.Key, request.Value)
+			return response, response.Error
 		})
 	}
 }
 
-func newDelCommand(storage storage.Storage) command {
-	return func(rw io.ReadWriter) {
+func newIncrCommand() command {
+	return func(reader io.Reader) (action, error) {
+		request := protocol.NewIncrRequest()
+		return decode(reader, request, func(s storage.Storage) (protocol.Encoder, error) {
+			response := protocol.NewIncrResponse()
+			response.Value, response.Error = s.Increment(request.Key, 1, request.TTL)
+			return response, response.Error
+		})
+	}
+}
+
+func newDecrCommand() command {
+	return func(reader io.Reader) (action, error) {
+		request := protocol.NewDecrRequest()
+		return decode(reader, request, func(s storage.Storage) (protocol.Encoder, error) {
+			response := protocol.NewDecrResponse()
+			response.Value, response.Error = s.Increment(request.Key, -1, request.TTL)
+			return response, response.Error
+		})
+	}
+}
+
+func newIncrByCommand() command {
+	return func(reader io.Reader) (action, error) {
+		request := protocol.NewIncrByRequest()
+		return decode(reader, request, func(s storage.Storage) (protocol.Encoder, error) {
+			response := protocol.NewIncrByResponse()
+			response.Value, response.Error = s.Increment(request.Key, request.Delta, request.TTL)
+			return response, response.Error
+		})
+	}
+}
+
+func newDecrByCommand() command {
+	return func(reader io.Reader) (action, error) {
+		request := protocol.NewDecrByRequest()
+		return decode(reader, request, func(s storage.Storage) (protocol.Encoder, error) {
+			response := protocol.NewDecrByResponse()
+			// Negated minimal int64 doesn't fit into int64
+			if request.Delta == math.MinInt64 {
+				response.Error = storage.OverflowError
+			} else {
+				response.Value, response.Error = s.Increment(request.Key, -request.Delta, request.TTL)
+			}
+			return response, response.Error
+		})
+	}
+}
+
+func newDelCommand() command {
+	return func(reader io.Reader) (action, error) {
 		request := protocol.NewDelRequest()
-		response := protocol.NewDelResponse()
-		run(rw, request, response, func() {
-			response.Error = storage.Delete(request.Key)
+		return decode(reader, request, func(s storage.Storage) (protocol.Encoder, error) {
+			response := protocol.NewDelResponse()
+			response.Error = s.Delete(request.Key)
+			return response, response.Error
 		})
 	}
 }
 
-func newHashCreateCommand(storage storage.Storage) command {
-	return func(rw io.ReadWriter) {
+func newHashCreateCommand() command {
+	return func(reader io.Reader) (action, error) {
 		request := protocol.NewHashCreateRequest()
-		response := protocol.NewHashCreateResponse()
-		run(rw, request, response, func() {
-			response.Error = storage.HashCreate(request.Key, request.TTL)
+		return decode(reader, request, func(s storage.Storage) (protocol.Encoder, error) {
+			response := protocol.NewHashCreateResponse()
+			response.Error = s.HashCreate(request.Key, request.TTL)
+			if response.Error == nil && request.Sliding {
+				response.Error = s.ExpireSliding(request.Key, time.Duration(request.TTL)*time.Second)
+			}
+			return response, response.Error
 		})
 	}
 }
 
-func newHashGetAllCommand(storage storage.Storage) command {
-	return func(rw io.ReadWriter) {
+func newHashGetAllCommand() command {
+	return func(reader io.Reader) (action, error) {
 		request := protocol.NewHashGetAllRequest()
-		response := protocol.NewHashGetAllResponse()
-		run(rw, request, response, func() {
-			response.Fields, response.Error = storage.HashGetAll(request.Key)
+		return decode(reader, request, func(s storage.Storage) (protocol.Encoder, error) {
+			response := protocol.NewHashGetAllResponse()
+			response.Fields, response.Error = s.HashGetAll(request.Key)
+			return response, response.Error
 		})
 	}
 }
 
-func newHashGetCommand(storage storage.Storage) command {
-	return func(rw io.ReadWriter) {
+func newHashGetCommand() command {
+	return func(reader io.Reader) (action, error) {
 		request := protocol.NewHashGetRequest()
-		response := protocol.NewHashGetResponse()
-		run(rw, request, response, func() {
-			response.Value, response.Error = storage.HashGet(request.Key, request.Field)
+		return decode(reader, request, func(s storage.Storage) (protocol.Encoder, error) {
+			response := protocol.NewHashGetResponse()
+			response.Value, response.Error = s.HashGet(request.Key, request.Field)
+			return response, response.Error
 		})
 	}
 }
 
-func newHashSetCommand(storage storage.Storage) command {
-	return func(rw io.ReadWriter) {
+func newHashSetCommand() command {
+	return func(reader io.Reader) (action, error) {
 		request := protocol.NewHashSetRequest()
-		response := protocol.NewHashSetResponse()
-		run(rw, request, response, func() {
-			response.Error = storage.HashSet(request.Key, request.Field, request.Value)
+		return decode(reader, request, func(s storage.Storage) (protocol.Encoder, error) {
+			response := protocol.NewHashSetResponse()
+			response.Error = s.HashSet(request.Key, request.Field, request.Value)
+			return response, response.Error
 		})
 	}
 }
 
-func newHashDelCommand(storage storage.Storage) command {
-	return func(rw io.ReadWriter) {
+func newHashDelCommand() command {
+	return func(reader io.Reader) (action, error) {
 		request := protocol.NewHashDelRequest()
-		response := protocol.NewHashDelResponse()
-		run(rw, request, response, func() {
-			response.Error = storage.HashDelete(request.Key, request.Field)
+		return decode(reader, request, func(s storage.Storage) (protocol.Encoder, error) {
+			response := protocol.NewHashDelResponse()
+			response.Error = s.HashDelete(request.Key, request.Field)
+			return response, response.Error
 		})
 	}
 }
 
-func newHashLenCommand(storage storage.Storage) command {
-	return func(rw io.ReadWriter) {
+func newHashLenCommand() command {
+	return func(reader io.Reader) (action, error) {
 		request := protocol.NewHashLenRequest()
-		response := protocol.NewHashLenResponse()
-		run(rw, request, response, func() {
-			response.Len, response.Error = storage.HashLen(request.Key)
+		return decode(reader, request, func(s storage.Storage) (protocol.Encoder, error) {
+			response := protocol.NewHashLenResponse()
+			response.Len, response.Error = s.HashLen(request.Key)
+			return response, response.Error
 		})
 	}
 }
 
-func newHashKeysCommand(storage storage.Storage) command {
-	return func(rw io.ReadWriter) {
+func newHashKeysCommand() command {
+	return func(reader io.Reader) (action, error) {
 		request := protocol.NewHashKeysRequest()
-		response := protocol.NewHashKeysResponse()
-		run(rw, request, response, func() {
-			response.Keys, response.Error = storage.HashKeys(request.Key)
+		return decode(reader, request, func(s storage.Storage) (protocol.Encoder, error) {
+			response := protocol.NewHashKeysResponse()
+			response.Keys, response.Error = s.HashKeys(request.Key)
+			return response, response.Error
+		})
+	}
+}
+
+// newHashGetMultiCommand returns error per field, so missing fields don't fail transaction
+func newHashGetMultiCommand() command {
+	return func(reader io.Reader) (action, error) {
+		request := protocol.NewHashGetMultiRequest()
+		return decode(reader, request, func(s storage.Storage) (protocol.Encoder, error) {
+			response := protocol.NewHashGetMultiResponse()
+			response.Values, response.Errors = s.HashGetMulti(request.Key, request.Fields)
+			return response, nil
+		})
+	}
+}
+
+func newHashSetMultiCommand() command {
+	return func(reader io.Reader) (action, error) {
+		request := protocol.NewHashSetMultiRequest()
+		return decode(reader, request, func(s storage.Storage) (protocol.Encoder, error) {
+			response := protocol.NewHashSetMultiResponse()
+			_, response.Error = s.HashSetMulti(request.Key, request.Fields, request.Values)
+			return response, response.Error
 		})
 	}
 }
 
-func newListCreateCommand(storage storage.Storage) command {
-	return func(rw io.ReadWriter) {
+func newHashIncrementByCommand() command {
+	return func(reader io.Reader) (action, error) {
+		request := protocol.NewHashIncrementByRequest()
+		return decode(reader, request, func(s storage.Storage) (protocol.Encoder, error) {
+			response := protocol.NewHashIncrementByResponse()
+			response.Value, response.Error = s.HashIncrementBy(request.Key, request.Field, request.Delta)
+			return response, response.Error
+		})
+	}
+}
+
+func newHashSetIfNotExistsCommand() command {
+	return func(reader io.Reader) (action, error) {
+		request := protocol.NewHashSetIfNotExistsRequest()
+		return decode(reader, request, func(s storage.Storage) (protocol.Encoder, error) {
+			response := protocol.NewHashSetIfNotExistsResponse()
+			set, err := s.HashSetIfNotExists(request.Key, request.Field, request.Value)
+			if set {
+				response.Value = 1
+			}
+			response.Error = err
+			return response, response.Error
+		})
+	}
+}
+
+func newHashExistsCommand() command {
+	return func(reader io.Reader) (action, error) {
+		request := protocol.NewHashExistsRequest()
+		return decode(reader, request, func(s storage.Storage) (protocol.Encoder, error) {
+			response := protocol.NewHashExistsResponse()
+			found, err := s.HashExists(request.Key, request.Field)
+			if found {
+				response.Value = 1
+			}
+			response.Error = err
+			return response, response.Error
+		})
+	}
+}
+
+func newHashScanCommand() command {
+	return func(reader io.Reader) (action, error) {
+		request := protocol.NewHashScanRequest()
+		return decode(reader, request, func(s storage.Storage) (protocol.Encoder, error) {
+			response := protocol.NewHashScanResponse()
+			options := storage.ScanOptions{Pattern: request.Match, Count: request.Count}
+			response.Cursor, response.Fields, response.Error = s.HashScan(request.Key, request.Cursor, options)
+			return response, response.Error
+		})
+	}
+}
+
+func newHashExpireCommand() command {
+	return func(reader io.Reader) (action, error) {
+		request := protocol.NewHashExpireRequest()
+		return decode(reader, request, func(s storage.Storage) (protocol.Encoder, error) {
+			response := protocol.NewHashExpireResponse()
+			response.Error = s.HashExpireAt(request.Key, request.Field, expireTimeAfter(request.TTL, time.Second))
+			return response, response.Error
+		})
+	}
+}
+
+func newHashTTLCommand() command {
+	return func(reader io.Reader) (action, error) {
+		request := protocol.NewHashTTLRequest()
+		return decode(reader, request, func(s storage.Storage) (protocol.Encoder, error) {
+			response := protocol.NewHashTTLResponse()
+			expireTime, err := s.HashExpireTime(request.Key, request.Field)
+			response.Value, response.Error = remainingTTL(expireTime, err, time.Second)
+			return response, response.Error
+		})
+	}
+}
+
+func newHashPersistCommand() command {
+	return func(reader io.Reader) (action, error) {
+		request := protocol.NewHashPersistRequest()
+		return decode(reader, request, func(s storage.Storage) (protocol.Encoder, error) {
+			response := protocol.NewHashPersistResponse()
+			response.Error = s.HashPersist(request.Key, request.Field)
+			return response, response.Error
+		})
+	}
+}
+
+func newListCreateCommand() command {
+	return func(reader io.Reader) (action, error) {
 		request := protocol.NewListCreateRequest()
-		response := protocol.NewListCreateResponse()
-		run(rw, request, response, func() {
-			response.Error = storage.ListCreate(request.Key, request.TTL)
+		return decode(reader, request, func(s storage.Storage) (protocol.Encoder, error) {
+			response := protocol.NewListCreateResponse()
+			response.Error = s.ListCreate(request.Key, request.TTL)
+			if response.Error == nil && request.Sliding {
+				response.Error = s.ExpireSliding(request.Key, time.Duration(request.TTL)*time.Second)
+			}
+			return response, response.Error
 		})
 	}
 }
 
-func newListLeftPopCommand(storage storage.Storage) command {
-	return func(rw io.ReadWriter) {
+func newListLeftPopCommand() command {
+	return func(reader io.Reader) (action, error) {
 		request := protocol.NewListLeftPopRequest()
-		response := protocol.NewListLeftPopResponse()
-		run(rw, request, response, func() {
-			response.Value, response.Error = storage.ListLeftPop(request.Key)
+		return decode(reader, request, func(s storage.Storage) (protocol.Encoder, error) {
+			response := protocol.NewListLeftPopResponse()
+			response.Value, response.Error = s.ListLeftPop(request.Key)
+			return response, response.Error
 		})
 	}
 }
 
-func newListRightPopCommand(storage storage.Storage) command {
-	return func(rw io.ReadWriter) {
+func newListRightPopCommand() command {
+	return func(reader io.Reader) (action, error) {
 		request := protocol.NewListRightPopRequest()
-		response := protocol.NewListRightPopResponse()
-		run(rw, request, response, func() {
-			response.Value, response.Error = storage.ListRightPop(request.Key)
+		return decode(reader, request, func(s storage.Storage) (protocol.Encoder, error) {
+			response := protocol.NewListRightPopResponse()
+			response.Value, response.Error = s.ListRightPop(request.Key)
+			return response, response.Error
+		})
+	}
+}
+
+func newListBlockingLeftPopCommand() command {
+	return func(reader io.Reader) (action, error) {
+		request := protocol.NewListBlockingLeftPopRequest()
+		return decode(reader, request, func(s storage.Storage) (protocol.Encoder, error) {
+			response := protocol.NewListBlockingLeftPopResponse()
+			response.Key, response.Value, response.Error = s.ListBlockingLeftPop(request.Keys, blockingTimeout(request.Timeout))
+			return response, response.Error
+		})
+	}
+}
+
+func newListBlockingRightPopCommand() command {
+	return func(reader io.Reader) (action, error) {
+		request := protocol.NewListBlockingRightPopRequest()
+		return decode(reader, request, func(s storage.Storage) (protocol.Encoder, error) {
+			response := protocol.NewListBlockingRightPopResponse()
+			response.Key, response.Value, response.Error = s.ListBlockingRightPop(request.Keys, blockingTimeout(request.Timeout))
+			return response, response.Error
+		})
+	}
+}
+
+func newListMoveCommand() command {
+	return func(reader io.Reader) (action, error) {
+		request := protocol.NewListMoveRequest()
+		return decode(reader, request, func(s storage.Storage) (protocol.Encoder, error) {
+			response := protocol.NewListMoveResponse()
+			response.Value, response.Error = s.ListMove(request.Source, request.Destination,
+				request.From == protocol.ListLeft, request.To == protocol.ListLeft)
+			return response, response.Error
 		})
 	}
 }
 
-func newListLeftPushCommand(storage storage.Storage) command {
-	return func(rw io.ReadWriter) {
+func newListBlockingMoveCommand() command {
+	return func(reader io.Reader) (action, error) {
+		request := protocol.NewListBlockingMoveRequest()
+		return decode(reader, request, func(s storage.Storage) (protocol.Encoder, error) {
+			response := protocol.NewListBlockingMoveResponse()
+			response.Value, response.Error = s.ListBlockingMove(request.Source, request.Destination,
+				request.From == protocol.ListLeft, request.To == protocol.ListLeft, blockingTimeout(request.Timeout))
+			return response, response.Error
+		})
+	}
+}
+
+// blockingTimeout converts timeout in seconds to duration. Timeout which doesn't fit duration means waiting forever.
+func blockingTimeout(seconds uint64) time.Duration {
+	if seconds > uint64(math.MaxInt64/int64(time.Second)) {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+func newListLeftPushCommand() command {
+	return func(reader io.Reader) (action, error) {
 		request := protocol.NewListLeftPushRequest()
-		response := protocol.NewListLeftPushResponse()
-		run(rw, request, response, func() {
-			response.Error = storage.ListLeftPush(request.Key, request.Value)
+		return decode(reader, request, func(s storage.Storage) (protocol.Encoder, error) {
+			response := protocol.NewListLeftPushResponse()
+			response.Error = s.ListLeftPush(request.Key, request.Value)
+			return response, response.Error
 		})
 	}
 }
 
-func newListRightPushCommand(storage storage.Storage) command {
-	return func(rw io.ReadWriter) {
+func newListRightPushCommand() command {
+	return func(reader io.Reader) (action, error) {
 		request := protocol.NewListRightPushRequest()
-		response := protocol.NewListRightPushResponse()
-		run(rw, request, response, func() {
-			response.Error = storage.ListRightPush(request.Key, request.Value)
+		return decode(reader, request, func(s storage.Storage) (protocol.Encoder, error) {
+			response := protocol.NewListRightPushResponse()
+			response.Error = s.ListRightPush(request.Key, request.Value)
+			return response, response.Error
 		})
 	}
 }
 
-func newListLenCommand(storage storage.Storage) command {
-	return func(rw io.ReadWriter) {
+func newListLenCommand() command {
+	return func(reader io.Reader) (action, error) {
 		request := protocol.NewListLenRequest()
-		response := protocol.NewListLenResponse()
-		run(rw, request, response, func() {
-			response.Len, response.Error = storage.ListLen(request.Key)
+		return decode(reader, request, func(s storage.Storage) (protocol.Encoder, error) {
+			response := protocol.NewListLenResponse()
+			response.Len, response.Error = s.ListLen(request.Key)
+			return response, response.Error
 		})
 	}
 }
 
-func newListRangeCommand(storage storage.Storage) command {
-	return func(rw io.ReadWriter) {
+func newListRangeCommand() command {
+	return func(reader io.Reader) (action, error) {
 		request := protocol.NewListRangeRequest()
-		response := protocol.NewListRangeResponse()
-		run(rw, request, response, func() {
-			response.Values, response.Error = storage.ListRange(request.Key, request.Start, request.Stop)
+		return decode(reader, request, func(s storage.Storage) (protocol.Encoder, error) {
+			response := protocol.NewListRangeResponse()
+			response.Values, response.Error = s.ListRange(request.Key, request.Start, request.Stop)
+			return response, response.Error
+		})
+	}
+}
+
+func newListIndexCommand() command {
+	return func(reader io.Reader) (action, error) {
+		request := protocol.NewListIndexRequest()
+		return decode(reader, request, func(s storage.Storage) (protocol.Encoder, error) {
+			response := protocol.NewListIndexResponse()
+			response.Value, response.Error = s.ListIndex(request.Key, request.Index)
+			return response, response.Error
+		})
+	}
+}
+
+func newListSetCommand() command {
+	return func(reader io.Reader) (action, error) {
+		request := protocol.NewListSetRequest()
+		return decode(reader, request, func(s storage.Storage) (protocol.Encoder, error) {
+			response := protocol.NewListSetResponse()
+			response.Error = s.ListSet(request.Key, request.Index, request.Value)
+			return response, response.Error
+		})
+	}
+}
+
+func newListInsertCommand() command {
+	return func(reader io.Reader) (action, error) {
+		request := protocol.NewListInsertRequest()
+		return decode(reader, request, func(s storage.Storage) (protocol.Encoder, error) {
+			response := protocol.NewListInsertResponse()
+			response.Len, response.Error = s.ListInsert(request.Key, request.Pivot, request.Value,
+				request.Position == protocol.ListBefore)
+			return response, response.Error
 		})
 	}
 }
 
-func newExpireCommand(storage storage.Storage) command {
-	return func(rw io.ReadWriter) {
+func newListRemoveCommand() command {
+	return func(reader io.Reader) (action, error) {
+		request := protocol.NewListRemoveRequest()
+		return decode(reader, request, func(s storage.Storage) (protocol.Encoder, error) {
+			response := protocol.NewListRemoveResponse()
+			removed, err := s.ListRemove(request.Key, request.Count, request.Value)
+			response.Value, response.Error = int64(removed), err
+			return response, response.Error
+		})
+	}
+}
+
+func newListTrimCommand() command {
+	return func(reader io.Reader) (action, error) {
+		request := protocol.NewListTrimRequest()
+		return decode(reader, request, func(s storage.Storage) (protocol.Encoder, error) {
+			response := protocol.NewListTrimResponse()
+			response.Error = s.ListTrim(request.Key, request.Start, request.Stop)
+			return response, response.Error
+		})
+	}
+}
+
+func newSetAddCommand() command {
+	return func(reader io.Reader) (action, error) {
+		request := protocol.NewSetAddRequest()
+		return decode(reader, request, func(s storage.Storage) (protocol.Encoder, error) {
+			response := protocol.NewSetAddResponse()
+			added, err := s.SetAdd(request.Key, request.Members)
+			response.Value, response.Error = int64(added), err
+			return response, response.Error
+		})
+	}
+}
+
+func newSetRemoveCommand() command {
+	return func(reader io.Reader) (action, error) {
+		request := protocol.NewSetRemoveRequest()
+		return decode(reader, request, func(s storage.Storage) (protocol.Encoder, error) {
+			response := protocol.NewSetRemoveResponse()
+			removed, err := s.SetRemove(request.Key, request.Members)
+			response.Value, response.Error = int64(removed), err
+			return response, response.Error
+		})
+	}
+}
+
+func newSetIsMemberCommand() command {
+	return func(reader io.Reader) (action, error) {
+		request := protocol.NewSetIsMemberRequest()
+		return decode(reader, request, func(s storage.Storage) (protocol.Encoder, error) {
+			response := protocol.NewSetIsMemberResponse()
+			found, err := s.SetIsMember(request.Key, request.Member)
+			if found {
+				response.Value = 1
+			}
+			response.Error = err
+			return response, response.Error
+		})
+	}
+}
+
+func newSetMembersCommand() command {
+	return func(reader io.Reader) (action, error) {
+		request := protocol.NewSetMembersRequest()
+		return decode(reader, request, func(s storage.Storage) (protocol.Encoder, error) {
+			response := protocol.NewSetMembersResponse()
+			response.Values, response.Error = s.SetMembers(request.Key)
+			return response, response.Error
+		})
+	}
+}
+
+func newSetLenCommand() command {
+	return func(reader io.Reader) (action, error) {
+		request := protocol.NewSetLenRequest()
+		return decode(reader, request, func(s storage.Storage) (protocol.Encoder, error) {
+			response := protocol.NewSetLenResponse()
+			response.Len, response.Error = s.SetLen(request.Key)
+			return response, response.Error
+		})
+	}
+}
+
+func newSetIntersectCommand() command {
+	return func(reader io.Reader) (action, error) {
+		request := protocol.NewSetIntersectRequest()
+		return decode(reader, request, func(s storage.Storage) (protocol.Encoder, error) {
+			response := protocol.NewSetIntersectResponse()
+			response.Values, response.Error = s.SetIntersect(request.Keys)
+			return response, response.Error
+		})
+	}
+}
+
+func newSetUnionCommand() command {
+	return func(reader io.Reader) (action, error) {
+		request := protocol.NewSetUnionRequest()
+		return decode(reader, request, func(s storage.Storage) (protocol.Encoder, error) {
+			response := protocol.NewSetUnionResponse()
+			response.Values, response.Error = s.SetUnion(request.Keys)
+			return response, response.Error
+		})
+	}
+}
+
+func newSetDiffCommand() command {
+	return func(reader io.Reader) (action, error) {
+		request := protocol.NewSetDiffRequest()
+		return decode(reader, request, func(s storage.Storage) (protocol.Encoder, error) {
+			response := protocol.NewSetDiffResponse()
+			response.Values, response.Error = s.SetDiff(request.Keys)
+			return response, response.Error
+		})
+	}
+}
+
+func newSortedSetAddCommand() command {
+	return func(reader io.Reader) (action, error) {
+		request := protocol.NewSortedSetAddRequest()
+		return decode(reader, request, func(s storage.Storage) (protocol.Encoder, error) {
+			response := protocol.NewSortedSetAddResponse()
+			members := make([]storage.ScoredMember, len(request.Members))
+			for i, member := range request.Members {
+				members[i] = storage.ScoredMember{Member: member, Score: request.Scores[i]}
+			}
+			added, err := s.SortedSetAdd(request.Key, members)
+			response.Value, response.Error = int64(added), err
+			return response, response.Error
+		})
+	}
+}
+
+func newSortedSetRemoveCommand() command {
+	return func(reader io.Reader) (action, error) {
+		request := protocol.NewSortedSetRemoveRequest()
+		return decode(reader, request, func(s storage.Storage) (protocol.Encoder, error) {
+			response := protocol.NewSortedSetRemoveResponse()
+			removed, err := s.SortedSetRemove(request.Key, request.Members)
+			response.Value, response.Error = int64(removed), err
+			return response, response.Error
+		})
+	}
+}
+
+func newSortedSetScoreCommand() command {
+	return func(reader io.Reader) (action, error) {
+		request := protocol.NewSortedSetScoreRequest()
+		return decode(reader, request, func(s storage.Storage) (protocol.Encoder, error) {
+			response := protocol.NewSortedSetScoreResponse()
+			response.Score, response.Error = s.SortedSetScore(request.Key, request.Member)
+			return response, response.Error
+		})
+	}
+}
+
+func newSortedSetIncrementByCommand() command {
+	return func(reader io.Reader) (action, error) {
+		request := protocol.NewSortedSetIncrementByRequest()
+		return decode(reader, request, func(s storage.Storage) (protocol.Encoder, error) {
+			response := protocol.NewSortedSetIncrementByResponse()
+			response.Score, response.Error = s.SortedSetIncrementBy(request.Key, request.Member, request.Delta)
+			return response, response.Error
+		})
+	}
+}
+
+func newSortedSetRangeCommand(reverse bool) command {
+	return func(reader io.Reader) (action, error) {
+		request := protocol.NewSortedSetRangeRequest()
+		if reverse {
+			request = protocol.NewSortedSetReverseRangeRequest()
+		}
+		return decode(reader, request, func(s storage.Storage) (protocol.Encoder, error) {
+			response := protocol.NewSortedSetRangeResponse()
+			members, err := s.SortedSetRange(request.Key, request.Start, request.Stop, reverse)
+			response.Members, response.Scores = splitScoredMembers(members)
+			response.Error = err
+			return response, response.Error
+		})
+	}
+}
+
+func newSortedSetRangeByScoreCommand() command {
+	return func(reader io.Reader) (action, error) {
+		request := protocol.NewSortedSetRangeByScoreRequest()
+		return decode(reader, request, func(s storage.Storage) (protocol.Encoder, error) {
+			response := protocol.NewSortedSetRangeByScoreResponse()
+			// Count 0 of protocol means no limit
+			count := request.Count
+			if count == 0 {
+				count = -1
+			}
+			members, err := s.SortedSetRangeByScore(request.Key, request.Min, request.Max, request.Offset, count)
+			response.Members, response.Scores = splitScoredMembers(members)
+			response.Error = err
+			return response, response.Error
+		})
+	}
+}
+
+func newSortedSetRankCommand() command {
+	return func(reader io.Reader) (action, error) {
+		request := protocol.NewSortedSetRankRequest()
+		return decode(reader, request, func(s storage.Storage) (protocol.Encoder, error) {
+			response := protocol.NewSortedSetRankResponse()
+			rank, err := s.SortedSetRank(request.Key, request.Member)
+			response.Value, response.Error = int64(rank), err
+			return response, response.Error
+		})
+	}
+}
+
+func newSortedSetLenCommand() command {
+	return func(reader io.Reader) (action, error) {
+		request := protocol.NewSortedSetLenRequest()
+		return decode(reader, request, func(s storage.Storage) (protocol.Encoder, error) {
+			response := protocol.NewSortedSetLenResponse()
+			response.Len, response.Error = s.SortedSetLen(request.Key)
+			return response, response.Error
+		})
+	}
+}
+
+// splitScoredMembers returns members and their scores as separate slices of response
+func splitScoredMembers(scored []storage.ScoredMember) (members []string, scores []float64) {
+	for _, m := range scored {
+		members = append(members, m.Member)
+		scores = append(scores, m.Score)
+	}
+	return
+}
+
+func newExpireCommand() command {
+	return func(reader io.Reader) (action, error) {
 		request := protocol.NewExpireRequest()
-		response := protocol.NewExpireResponse()
-		run(rw, request, response, func() {
-			response.Error = storage.Expire(request.Key, request.TTL)
+		return decode(reader, request, func(s storage.Storage) (protocol.Encoder, error) {
+			response := protocol.NewExpireResponse()
+			response.Error = s.Expire(request.Key, request.TTL)
+			return response, response.Error
+		})
+	}
+}
+
+func newPExpireCommand() command {
+	return func(reader io.Reader) (action, error) {
+		request := protocol.NewPExpireRequest()
+		return decode(reader, request, func(s storage.Storage) (protocol.Encoder, error) {
+			response := protocol.NewPExpireResponse()
+			response.Error = s.ExpireAt(request.Key, expireTimeAfter(request.TTL, time.Millisecond))
+			return response, response.Error
+		})
+	}
+}
+
+func newExpireAtCommand() command {
+	return func(reader io.Reader) (action, error) {
+		request := protocol.NewExpireAtRequest()
+		return decode(reader, request, func(s storage.Storage) (protocol.Encoder, error) {
+			response := protocol.NewExpireAtResponse()
+			response.Error = s.ExpireAt(request.Key, unixTime(request.Timestamp, time.Second))
+			return response, response.Error
+		})
+	}
+}
+
+func newPExpireAtCommand() command {
+	return func(reader io.Reader) (action, error) {
+		request := protocol.NewPExpireAtRequest()
+		return decode(reader, request, func(s storage.Storage) (protocol.Encoder, error) {
+			response := protocol.NewPExpireAtResponse()
+			response.Error = s.ExpireAt(request.Key, unixTime(request.Timestamp, time.Millisecond))
+			return response, response.Error
+		})
+	}
+}
+
+// slidingTTL returns ttl in units if sliding expiration is requested and zero otherwise
+func slidingTTL(sliding bool, ttl uint64, unit time.Duration) time.Duration {
+	if !sliding {
+		return 0
+	}
+	return time.Duration(ttl) * unit
+}
+
+// expireTimeAfter returns time which is ttl units later than now. Zero ttl means no expiration.
+func expireTimeAfter(ttl uint64, unit time.Duration) (expireTime time.Time) {
+	if ttl > 0 {
+		expireTime = time.Now().Add(time.Duration(ttl) * unit)
+	}
+	return
+}
+
+// unixTime converts Unix timestamp measured in units to time.
+// Timestamp in the past is allowed, key expires immediately then.
+func unixTime(timestamp uint64, unit time.Duration) time.Time {
+	perSecond := uint64(time.Second / unit)
+	return time.Unix(int64(timestamp/perSecond), int64(timestamp%perSecond)*int64(unit))
+}
+
+func newTouchCommand() command {
+	return func(reader io.Reader) (action, error) {
+		request := protocol.NewTouchRequest()
+		return decode(reader, request, func(s storage.Storage) (protocol.Encoder, error) {
+			response := protocol.NewTouchResponse()
+			response.Error = s.Touch(request.Key)
+			return response, response.Error
+		})
+	}
+}
+
+func newPersistCommand() command {
+	return func(reader io.Reader) (action, error) {
+		request := protocol.NewPersistRequest()
+		return decode(reader, request, func(s storage.Storage) (protocol.Encoder, error) {
+			response := protocol.NewPersistResponse()
+			response.Error = s.Persist(request.Key)
+			return response, response.Error
+		})
+	}
+}
+
+// newTypeCommand returns type of key value. Missing key isn't an error, its type is "none".
+func newTypeCommand() command {
+	return func(reader io.Reader) (action, error) {
+		request := protocol.NewTypeRequest()
+		return decode(reader, request, func(s storage.Storage) (protocol.Encoder, error) {
+			response := protocol.NewTypeResponse()
+			response.Value, response.Error = s.Type(request.Key)
+			if response.Error == storage.KeyNotExistsError {
+				response.Value, response.Error = protocol.TypeNone, nil
+			}
+			return response, response.Error
+		})
+	}
+}
+
+func newTTLCommand() command {
+	return func(reader io.Reader) (action, error) {
+		request := protocol.NewTTLRequest()
+		return decode(reader, request, func(s storage.Storage) (protocol.Encoder, error) {
+			response := protocol.NewTTLResponse()
+			response.Value, response.Error = keyTTL(s, request.Key, time.Second)
+			return response, response.Error
+		})
+	}
+}
+
+func newPTTLCommand() command {
+	return func(reader io.Reader) (action, error) {
+		request := protocol.NewPTTLRequest()
+		return decode(reader, request, func(s storage.Storage) (protocol.Encoder, error) {
+			response := protocol.NewPTTLResponse()
+			response.Value, response.Error = keyTTL(s, request.Key, time.Millisecond)
+			return response, response.Error
+		})
+	}
+}
+
+// keyTTL returns remaining ttl of key rounded to unit.
+// Missing key and key without expiration are reported by protocol.TTLNotExists and protocol.TTLNoExpire.
+func keyTTL(s storage.Storage, key string, unit time.Duration) (int64, error) {
+	expireTime, err := s.ExpireTime(key)
+	return remainingTTL(expireTime, err, unit)
+}
+
+// remainingTTL converts expiration time of key or hash field returned by storage to remaining ttl rounded to unit.
+// Missing key or field is reported by protocol.TTLNotExists, zero time is reported by protocol.TTLNoExpire.
+func remainingTTL(expireTime time.Time, err error, unit time.Duration) (int64, error) {
+	switch {
+	case err == storage.KeyNotExistsError, err == storage.FieldNotExistError:
+		return protocol.TTLNotExists, nil
+	case err != nil:
+		return 0, err
+	case expireTime.IsZero():
+		return protocol.TTLNoExpire, nil
+	}
+	remaining := time.Until(expireTime)
+	if remaining < 0 {
+		remaining = 0
+	}
+	return int64((remaining + unit/2) / unit), nil
+}
+
+// newPublishCommand sends message to subscribers of channel. Publishing isn't a storage change,
+// so inside of transaction message is sent on EXEC and isn't recalled on rollback.
+func newPublishCommand(ps *pubSub) command {
+	return func(reader io.Reader) (action, error) {
+		request := protocol.NewPublishRequest()
+		return decode(reader, request, func(storage.Storage) (protocol.Encoder, error) {
+			response := protocol.NewPublishResponse()
+			response.Value = int64(ps.publish(request.Channel, request.Message))
+			return response, nil
 		})
 	}
 }
 
 func newAuthCommand(htpasswdFile *htpasswd.HtpasswdFile, session *session) command {
-	return func(rw io.ReadWriter) {
+	return func(reader io.Reader) (action, error) {
 		request := protocol.NewAuthRequest()
-		response := protocol.NewAuthResponse()
-		run(rw, request, response, func() {
+		return decode(reader, request, func(storage.Storage) (protocol.Encoder, error) {
+			response := protocol.NewAuthResponse()
 			if htpasswdFile == nil || htpasswdFile.Validate(request.User, request.Password) {
 				session.authorize()
 			} else {
 				response.Error = invalidCredentialsError
 			}
+			return response, response.Error
+		})
+	}
+}
+
+func newModeCommand(session *session) command {
+	return func(reader io.Reader) (action, error) {
+		request := protocol.NewModeRequest()
+		return decode(reader, request, func(storage.Storage) (protocol.Encoder, error) {
+			session.setMode(request.Mode)
+			return protocol.NewModeResponse(), nil
+		})
+	}
+}
+
+func newMultiCommand(session *session) command {
+	return func(reader io.Reader) (action, error) {
+		return decode(reader, protocol.NewMultiRequest(), func(storage.Storage) (protocol.Encoder, error) {
+			response := protocol.NewMultiResponse()
+			response.Error = session.multi()
+			return response, response.Error
+		})
+	}
+}
+
+func newExecCommand(session *session) command {
+	return func(reader io.Reader) (action, error) {
+		return decode(reader, protocol.NewExecRequest(), func(s storage.Storage) (protocol.Encoder, error) {
+			response := protocol.NewExecResponse()
+			response.Responses, response.Error = session.exec(s)
+			return response, response.Error
+		})
+	}
+}
+
+func newDiscardCommand(session *session) command {
+	return func(reader io.Reader) (action, error) {
+		return decode(reader, protocol.NewDiscardRequest(), func(storage.Storage) (protocol.Encoder, error) {
+			response := protocol.NewDiscardResponse()
+			response.Error = session.discard()
+			return response, response.Error
+		})
+	}
+}
+
+// newSubscribeCommand subscribes session to channels or patterns and returns number of its subscriptions
+func newSubscribeCommand(session *session, isPattern bool) command {
+	return func(reader io.Reader) (action, error) {
+		request := protocol.NewSubscribeRequest()
+		if isPattern {
+			request = protocol.NewPSubscribeRequest()
+		}
+		return decode(reader, request, func(storage.Storage) (protocol.Encoder, error) {
+			response := protocol.NewSubscribeResponse()
+			count, err := session.subscribe(request.Channels, isPattern)
+			response.Value, response.Error = int64(count), err
+			return response, response.Error
+		})
+	}
+}
+
+// newUnsubscribeCommand unsubscribes session from channels or patterns and returns number of remaining subscriptions
+func newUnsubscribeCommand(session *session, isPattern bool) command {
+	return func(reader io.Reader) (action, error) {
+		request := protocol.NewUnsubscribeRequest()
+		if isPattern {
+			request = protocol.NewPUnsubscribeRequest()
+		}
+		return decode(reader, request, func(storage.Storage) (protocol.Encoder, error) {
+			response := protocol.NewSubscribeResponse()
+			response.Value = int64(session.unsubscribe(request.Channels, isPattern))
+			return response, nil
 		})
 	}
 }
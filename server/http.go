@@ -0,0 +1,433 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/Barberrrry/jcache/server/htpasswd"
+	"github.com/Barberrrry/jcache/server/storage"
+)
+
+const httpMaxBodySize = 1024 * 1024
+
+// httpRequest is JSON body of PUT and POST requests. Fields are used depending on resource.
+type httpRequest struct {
+	Value  *string           `json:"value"`
+	TTL    uint64            `json:"ttl"`
+	Fields map[string]string `json:"fields"`
+	Values []string          `json:"values"`
+}
+
+type httpKeysResponse struct {
+	Keys []string `json:"keys"`
+}
+
+type httpValueResponse struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+type httpHashResponse struct {
+	Key    string            `json:"key"`
+	Fields map[string]string `json:"fields"`
+}
+
+type httpListResponse struct {
+	Key    string   `json:"key"`
+	Values []string `json:"values"`
+	Len    int      `json:"len"`
+}
+
+type httpLenResponse struct {
+	Key string `json:"key"`
+	Len int    `json:"len"`
+}
+
+type httpErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// httpHandler exposes storage as REST resources:
+// /keys, /keys/{key}, /hashes/{key}, /hashes/{key}/{field}, /lists/{key} and /lists/{key}/{lpush|rpush|lpop|rpop}.
+// Key and field must be URL-encoded when contain "/".
+type httpHandler struct {
+	storage      storage.Storage
+	htpasswdFile *htpasswd.HtpasswdFile
+	logger       *log.Logger
+}
+
+func newHTTPHandler(storage storage.Storage, htpasswdFile *htpasswd.HtpasswdFile, logger *log.Logger) *httpHandler {
+	return &httpHandler{
+		storage:      storage,
+		htpasswdFile: htpasswdFile,
+		logger:       logger,
+	}
+}
+
+func (h *httpHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.logger.Printf("[%s] %s %s", r.RemoteAddr, r.Method, r.URL.RequestURI())
+
+	if h.htpasswdFile != nil {
+		user, password, ok := r.BasicAuth()
+		if !ok || !h.htpasswdFile.Validate(user, password) {
+			w.Header().Set("WWW-Authenticate", `Basic realm="jcache"`)
+			writeHTTPError(w, http.StatusUnauthorized, "Authentication required")
+			return
+		}
+	}
+
+	path, err := splitHTTPPath(r.URL.EscapedPath())
+	if err != nil || len(path) == 0 {
+		writeHTTPError(w, http.StatusNotFound, "Resource not found")
+		return
+	}
+
+	switch {
+	case path[0] == "keys" && len(path) == 1:
+		h.keys(w, r)
+	case path[0] == "keys" && len(path) == 2:
+		h.key(w, r, path[1])
+	case path[0] == "hashes" && len(path) == 2:
+		h.hash(w, r, path[1])
+	case path[0] == "hashes" && len(path) == 3:
+		h.hashField(w, r, path[1], path[2])
+	case path[0] == "lists" && len(path) == 2:
+		h.list(w, r, path[1])
+	case path[0] == "lists" && len(path) == 3:
+		h.listOperation(w, r, path[1], path[2])
+	default:
+		writeHTTPError(w, http.StatusNotFound, "Resource not found")
+	}
+}
+
+func (h *httpHandler) keys(w http.ResponseWriter, r *http.Request) {
+	if !allowHTTPMethods(w, r, "GET") {
+		return
+	}
+	keys := h.storage.Keys()
+	if keys == nil {
+		keys = []string{}
+	}
+	writeHTTPBody(w, http.StatusOK, httpKeysResponse{Keys: keys})
+}
+
+// key handles string value. PUT overwrites existing key of any type.
+func (h *httpHandler) key(w http.ResponseWriter, r *http.Request, key string) {
+	if !allowHTTPMethods(w, r, "GET", "PUT", "DELETE") {
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		value, err := h.storage.Get(key)
+		if err != nil {
+			writeHTTPStorageError(w, err)
+			return
+		}
+		writeHTTPBody(w, http.StatusOK, httpValueResponse{Key: key, Value: value})
+	case "PUT":
+		body, ok := readHTTPRequest(w, r)
+		if !ok {
+			return
+		}
+		if body.Value == nil {
+			writeHTTPError(w, http.StatusBadRequest, "Value is required")
+			return
+		}
+		if err := overwriteValue(h.storage, key, *body.Value, body.TTL); err != nil {
+			writeHTTPStorageError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case "DELETE":
+		h.delete(w, key)
+	}
+}
+
+// hash handles whole hash. PUT creates new hash and fails if key already exists.
+func (h *httpHandler) hash(w http.ResponseWriter, r *http.Request, key string) {
+	if !allowHTTPMethods(w, r, "GET", "PUT", "DELETE") {
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		fields, err := h.storage.HashGetAll(key)
+		if err != nil {
+			writeHTTPStorageError(w, err)
+			return
+		}
+		if fields == nil {
+			fields = map[string]string{}
+		}
+		writeHTTPBody(w, http.StatusOK, httpHashResponse{Key: key, Fields: fields})
+	case "PUT":
+		body, ok := readHTTPRequest(w, r)
+		if !ok {
+			return
+		}
+		err := atomically(h.storage, func(s storage.Storage) error {
+			if err := s.HashCreate(key, body.TTL); err != nil {
+				return err
+			}
+			if len(body.Fields) == 0 {
+				return nil
+			}
+			fields, values := make([]string, 0, len(body.Fields)), make([]string, 0, len(body.Fields))
+			for field, value := range body.Fields {
+				fields, values = append(fields, field), append(values, value)
+			}
+			_, err := s.HashSetMulti(key, fields, values)
+			return err
+		})
+		if err != nil {
+			writeHTTPStorageError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	case "DELETE":
+		h.delete(w, key)
+	}
+}
+
+func (h *httpHandler) hashField(w http.ResponseWriter, r *http.Request, key, field string) {
+	if !allowHTTPMethods(w, r, "GET", "PUT", "DELETE") {
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		value, err := h.storage.HashGet(key, field)
+		if err != nil {
+			writeHTTPStorageError(w, err)
+			return
+		}
+		writeHTTPBody(w, http.StatusOK, httpValueResponse{Key: key, Value: value})
+	case "PUT":
+		body, ok := readHTTPRequest(w, r)
+		if !ok {
+			return
+		}
+		if body.Value == nil {
+			writeHTTPError(w, http.StatusBadRequest, "Value is required")
+			return
+		}
+		if err := h.storage.HashSet(key, field, *body.Value); err != nil {
+			writeHTTPStorageError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case "DELETE":
+		if err := h.storage.HashDelete(key, field); err != nil {
+			writeHTTPStorageError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// list handles whole list. GET returns range of values defined by optional "start" and "stop" query parameters.
+// PUT creates new list and fails if key already exists.
+func (h *httpHandler) list(w http.ResponseWriter, r *http.Request, key string) {
+	if !allowHTTPMethods(w, r, "GET", "PUT", "DELETE") {
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		length, err := h.storage.ListLen(key)
+		if err != nil {
+			writeHTTPStorageError(w, err)
+			return
+		}
+		start, startErr := httpQueryIndex(r, "start", 0)
+		stop, stopErr := httpQueryIndex(r, "stop", length-1)
+		if startErr != nil || stopErr != nil {
+			writeHTTPError(w, http.StatusBadRequest, "Start and stop must be non-negative integers")
+			return
+		}
+		values, err := h.storage.ListRange(key, start, stop)
+		if err != nil {
+			writeHTTPStorageError(w, err)
+			return
+		}
+		if values == nil {
+			values = []string{}
+		}
+		writeHTTPBody(w, http.StatusOK, httpListResponse{Key: key, Values: values, Len: length})
+	case "PUT":
+		body, ok := readHTTPRequest(w, r)
+		if !ok {
+			return
+		}
+		err := atomically(h.storage, func(s storage.Storage) error {
+			if err := s.ListCreate(key, body.TTL); err != nil {
+				return err
+			}
+			for _, value := range body.Values {
+				if err := s.ListRightPush(key, value); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			writeHTTPStorageError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	case "DELETE":
+		h.delete(w, key)
+	}
+}
+
+// listOperation handles pushes and pops. Push returns new list length, pop returns taken value.
+func (h *httpHandler) listOperation(w http.ResponseWriter, r *http.Request, key, operation string) {
+	push := map[string]func(key, value string) error{
+		"lpush": h.storage.ListLeftPush,
+		"rpush": h.storage.ListRightPush,
+	}[operation]
+	pop := map[string]func(key string) (string, error){
+		"lpop": h.storage.ListLeftPop,
+		"rpop": h.storage.ListRightPop,
+	}[operation]
+	if push == nil && pop == nil {
+		writeHTTPError(w, http.StatusNotFound, "Resource not found")
+		return
+	}
+	if !allowHTTPMethods(w, r, "POST") {
+		return
+	}
+
+	if pop != nil {
+		value, err := pop(key)
+		if err != nil {
+			writeHTTPStorageError(w, err)
+			return
+		}
+		writeHTTPBody(w, http.StatusOK, httpValueResponse{Key: key, Value: value})
+		return
+	}
+
+	body, ok := readHTTPRequest(w, r)
+	if !ok {
+		return
+	}
+	values := body.Values
+	if body.Value != nil {
+		values = append([]string{*body.Value}, values...)
+	}
+	if len(values) == 0 {
+		writeHTTPError(w, http.StatusBadRequest, "Value is required")
+		return
+	}
+	for _, value := range values {
+		if err := push(key, value); err != nil {
+			writeHTTPStorageError(w, err)
+			return
+		}
+	}
+	length, err := h.storage.ListLen(key)
+	if err != nil {
+		writeHTTPStorageError(w, err)
+		return
+	}
+	writeHTTPBody(w, http.StatusOK, httpLenResponse{Key: key, Len: length})
+}
+
+func (h *httpHandler) delete(w http.ResponseWriter, key string) {
+	if err := h.storage.Delete(key); err != nil {
+		writeHTTPStorageError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// atomically calls fn inside of transaction, so partially written value is never visible and is rolled back on error.
+// Storage which doesn't support transactions is passed to fn as is.
+func atomically(s storage.Storage, fn func(s storage.Storage) error) error {
+	t, ok := s.(storage.Transactional)
+	if !ok {
+		return fn(s)
+	}
+	if err := t.Transaction(fn); err != storage.TxNotSupportedError {
+		return err
+	}
+	return fn(s)
+}
+
+// splitHTTPPath splits escaped path into unescaped segments, so "/" inside of key may be passed as "%2F"
+func splitHTTPPath(path string) ([]string, error) {
+	var segments []string
+	for _, segment := range strings.Split(strings.Trim(path, "/"), "/") {
+		unescaped, err := url.PathUnescape(segment)
+		if err != nil {
+			return nil, err
+		}
+		if unescaped == "" {
+			return nil, fmt.Errorf("empty path segment")
+		}
+		segments = append(segments, unescaped)
+	}
+	return segments, nil
+}
+
+func allowHTTPMethods(w http.ResponseWriter, r *http.Request, methods ...string) bool {
+	for _, method := range methods {
+		if r.Method == method {
+			return true
+		}
+	}
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	writeHTTPError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	return false
+}
+
+// httpQueryIndex returns non-negative integer query parameter or default value if parameter is missing
+func httpQueryIndex(r *http.Request, name string, defaultValue int) (int, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return defaultValue, nil
+	}
+	index, err := strconv.ParseUint(value, 10, 31)
+	return int(index), err
+}
+
+func readHTTPRequest(w http.ResponseWriter, r *http.Request) (httpRequest, bool) {
+	var body httpRequest
+	// Empty body is allowed for requests which have only optional parameters
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, httpMaxBodySize)).Decode(&body)
+	if err != nil && err != io.EOF {
+		writeHTTPError(w, http.StatusBadRequest, fmt.Sprintf("Invalid JSON body: %s", err))
+		return body, false
+	}
+	return body, true
+}
+
+func writeHTTPBody(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func writeHTTPError(w http.ResponseWriter, status int, message string) {
+	writeHTTPBody(w, status, httpErrorResponse{Error: message})
+}
+
+// writeHTTPStorageError maps storage error to HTTP status code
+func writeHTTPStorageError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	switch err {
+	case storage.KeyNotExistsError, storage.FieldNotExistError, storage.ListEmptyError:
+		status = http.StatusNotFound
+	case storage.KeyAlreadyExistsError, storage.KeyStringTypeError, storage.KeyHashTypeError, storage.KeyListTypeError, storage.KeySetTypeError, storage.KeySortedSetTypeError:
+		status = http.StatusConflict
+	}
+	writeHTTPError(w, status, err.Error())
+}
@@ -0,0 +1,113 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"github.com/Barberrrry/jcache/server/htpasswd"
+	"github.com/Barberrrry/jcache/server/storage"
+	"github.com/Barberrrry/jcache/server/storage/memory"
+	. "gopkg.in/check.v1"
+)
+
+type HTTPTestSuite struct{}
+
+var _ = Suite(&HTTPTestSuite{})
+
+func (s *HTTPTestSuite) TestRequests(c *C) {
+	storage, _ := memory.NewStorage(100, time.Minute)
+	handler := newHTTPHandler(storage, nil, log.New(&bytes.Buffer{}, "", 0))
+
+	for _, t := range []struct {
+		method string
+		path   string
+		body   string
+		status int
+		result string
+	}{
+		{"GET", "/keys/key", "", http.StatusNotFound, `{"error":"Key does not exist"}`},
+		{"PUT", "/keys/key", `{"value":"value","ttl":60}`, http.StatusNoContent, ""},
+		{"PUT", "/keys/a%2Fb", `{"value":"slash"}`, http.StatusNoContent, ""},
+		{"GET", "/keys/a%2Fb", "", http.StatusOK, `{"key":"a/b","value":"slash"}`},
+		{"PUT", "/keys/key", `{}`, http.StatusBadRequest, `{"error":"Value is required"}`},
+		{"PUT", "/keys/key", `{`, http.StatusBadRequest, `{"error":"Invalid JSON body: unexpected EOF"}`},
+		{"GET", "/keys/key", "", http.StatusOK, `{"key":"key","value":"value"}`},
+		{"POST", "/keys/key", "", http.StatusMethodNotAllowed, `{"error":"Method not allowed"}`},
+		{"PUT", "/hashes/hash", `{"fields":{"f":"v"}}`, http.StatusCreated, ""},
+		{"PUT", "/hashes/hash", "", http.StatusConflict, `{"error":"Key already exists"}`},
+		{"PUT", "/hashes/hash/g", `{"value":"w"}`, http.StatusNoContent, ""},
+		{"GET", "/hashes/hash", "", http.StatusOK, `{"key":"hash","fields":{"f":"v","g":"w"}}`},
+		{"GET", "/hashes/hash/f", "", http.StatusOK, `{"key":"hash","value":"v"}`},
+		{"DELETE", "/hashes/hash/f", "", http.StatusNoContent, ""},
+		{"GET", "/hashes/hash/f", "", http.StatusNotFound, `{"error":"Field does not exist"}`},
+		{"GET", "/keys/hash", "", http.StatusConflict, `{"error":"Key type is not string"}`},
+		{"PUT", "/hashes/hash2", `{"fields":{"a":"1","b":"2","c":"3"},"ttl":60}`, http.StatusCreated, ""},
+		{"GET", "/hashes/hash2", "", http.StatusOK, `{"key":"hash2","fields":{"a":"1","b":"2","c":"3"}}`},
+		{"DELETE", "/hashes/hash2", "", http.StatusNoContent, ""},
+		{"PUT", "/lists/list", `{"values":["b"]}`, http.StatusCreated, ""},
+		{"POST", "/lists/list/rpush", `{"values":["c","d"]}`, http.StatusOK, `{"key":"list","len":3}`},
+		{"POST", "/lists/list/lpush", `{"value":"a"}`, http.StatusOK, `{"key":"list","len":4}`},
+		{"GET", "/lists/list", "", http.StatusOK, `{"key":"list","values":["a","b","c","d"],"len":4}`},
+		{"GET", "/lists/list?start=1&stop=2", "", http.StatusOK, `{"key":"list","values":["b","c"],"len":4}`},
+		{"GET", "/lists/list?start=-1", "", http.StatusBadRequest, `{"error":"Start and stop must be non-negative integers"}`},
+		{"POST", "/lists/list/rpop", "", http.StatusOK, `{"key":"list","value":"d"}`},
+		{"GET", "/lists/list/rpop", "", http.StatusMethodNotAllowed, `{"error":"Method not allowed"}`},
+		{"POST", "/lists/list/unknown", "", http.StatusNotFound, `{"error":"Resource not found"}`},
+		{"DELETE", "/lists/list", "", http.StatusNoContent, ""},
+		{"POST", "/lists/list/lpop", "", http.StatusNotFound, `{"error":"Key does not exist"}`},
+		{"GET", "/keys", "", http.StatusOK, `{"keys":["a/b","hash","key"]}`},
+		{"GET", "/unknown", "", http.StatusNotFound, `{"error":"Resource not found"}`},
+	} {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(t.method, t.path, strings.NewReader(t.body)))
+
+		comment := Commentf("%s %s", t.method, t.path)
+		c.Assert(recorder.Code, Equals, t.status, comment)
+		c.Assert(strings.TrimSpace(recorder.Body.String()), Equals, t.result, comment)
+	}
+}
+
+func (s *HTTPTestSuite) TestAtomically(c *C) {
+	st, _ := memory.NewStorage(100, time.Minute)
+
+	err := atomically(st, func(tx storage.Storage) error {
+		tx.ListCreate("list", 0)
+		tx.ListRightPush("list", "a")
+		return errors.New("failure")
+	})
+	c.Assert(err, ErrorMatches, "failure")
+	c.Assert(st.Keys(), HasLen, 0)
+}
+
+func (s *HTTPTestSuite) TestAuth(c *C) {
+	storage, _ := memory.NewStorage(100, time.Minute)
+	htpasswdFile, _ := htpasswd.NewHtpasswd(bytes.NewBufferString("user:{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g="))
+	server := httptest.NewServer(newHTTPHandler(storage, htpasswdFile, log.New(&bytes.Buffer{}, "", 0)))
+	defer server.Close()
+
+	for _, t := range []struct {
+		user     string
+		password string
+		status   int
+	}{
+		{"", "", http.StatusUnauthorized},
+		{"user", "wrong", http.StatusUnauthorized},
+		{"user", "password", http.StatusOK},
+	} {
+		request, _ := http.NewRequest("GET", server.URL+"/keys", nil)
+		if t.user != "" {
+			request.SetBasicAuth(t.user, t.password)
+		}
+		response, err := http.DefaultClient.Do(request)
+		c.Assert(err, IsNil)
+		ioutil.ReadAll(response.Body)
+		response.Body.Close()
+		c.Assert(response.StatusCode, Equals, t.status)
+	}
+}
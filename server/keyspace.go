@@ -0,0 +1,105 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Barberrrry/jcache/server/storage"
+)
+
+// Keyspace events are published to channel of key with event as message
+// and to channel of event with key as message, channels are named like in Redis
+const (
+	keyspaceChannelPrefix = "__keyspace@0__:"
+	keyeventChannelPrefix = "__keyevent@0__:"
+
+	// KeyspaceEventsAll enables all keyspace events
+	KeyspaceEventsAll = "all"
+)
+
+var (
+	keyspaceEventNames = []string{storage.EventSet, storage.EventDel, storage.EventExpired, storage.EventEvicted, storage.EventHash, storage.EventList}
+
+	notificationsNotSupportedError = errors.New("Keyspace events are not supported by storage")
+)
+
+// KeyspaceEvents is a comma-separated list of keyspace events which are published to subscribers.
+// Empty list disables keyspace events.
+type KeyspaceEvents string
+
+func (e *KeyspaceEvents) String() string {
+	return string(*e)
+}
+
+func (e *KeyspaceEvents) Set(value string) error {
+	for _, event := range splitKeyspaceEvents(value) {
+		if !isKeyspaceEvent(event) {
+			return fmt.Errorf("Unknown keyspace event: %s", event)
+		}
+	}
+	*e = KeyspaceEvents(value)
+	return nil
+}
+
+// enabled returns set of events of list
+func (e KeyspaceEvents) enabled() map[string]bool {
+	enabled := make(map[string]bool)
+	for _, event := range splitKeyspaceEvents(string(e)) {
+		if event == KeyspaceEventsAll {
+			for _, name := range keyspaceEventNames {
+				enabled[name] = true
+			}
+		} else if isKeyspaceEvent(event) {
+			enabled[event] = true
+		}
+	}
+	return enabled
+}
+
+func splitKeyspaceEvents(value string) []string {
+	var events []string
+	for _, event := range strings.Split(value, ",") {
+		if event = strings.TrimSpace(event); event != "" {
+			events = append(events, event)
+		}
+	}
+	return events
+}
+
+func isKeyspaceEvent(event string) bool {
+	if event == KeyspaceEventsAll {
+		return true
+	}
+	for _, name := range keyspaceEventNames {
+		if event == name {
+			return true
+		}
+	}
+	return false
+}
+
+// SetKeyspaceEvents makes storage report keyspace events which are published to subscribers.
+// It must be called before server starts listening. Error will occur if storage doesn't report events.
+func (s *server) SetKeyspaceEvents(events KeyspaceEvents) error {
+	enabled := events.enabled()
+	n, ok := s.storage.(storage.Notifying)
+	if !ok {
+		if len(enabled) == 0 {
+			return nil
+		}
+		return notificationsNotSupportedError
+	}
+	if len(enabled) == 0 {
+		n.SetNotifier(nil)
+		return nil
+	}
+
+	n.SetNotifier(func(event, key string) {
+		if enabled[event] {
+			s.pubSub.publish(keyspaceChannelPrefix+key, event)
+			s.pubSub.publish(keyeventChannelPrefix+event, key)
+		}
+	})
+	return nil
+}
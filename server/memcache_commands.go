@@ -0,0 +1,419 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/Barberrrry/jcache/server/storage"
+)
+
+const (
+	memcacheVersion = "1.6.0-jcache"
+	// Exptime values greater than 30 days are treated as absolute unix timestamp
+	memcacheMaxRelativeExptime = 60 * 60 * 24 * 30
+)
+
+var (
+	memcacheBadFormatError   = errors.New("bad command line format")
+	memcacheBadChunkError    = errors.New("bad data chunk")
+	memcacheTooLargeError    = errors.New("object too large for cache")
+	memcacheNonNumericError  = errors.New("cannot increment or decrement non-numeric value")
+	memcacheLineTooLongError = errors.New("line is too long")
+)
+
+// memcacheCommand handles command of memcached text protocol. Trailing "noreply" is removed from args.
+type memcacheCommand func(s *memcacheSession, args []string)
+
+type memcacheStats struct {
+	startTime        time.Time
+	currConnections  int64
+	totalConnections int64
+	cmdGet           int64
+	cmdSet           int64
+	cmdTouch         int64
+	getHits          int64
+	getMisses        int64
+}
+
+func newMemcacheStats() *memcacheStats {
+	return &memcacheStats{startTime: time.Now()}
+}
+
+func newMemcacheCommands(s storage.Storage) map[string]memcacheCommand {
+	return map[string]memcacheCommand{
+		"get":       newMemcacheGetCommand(s, false),
+		"gets":      newMemcacheGetCommand(s, true),
+		"set":       newMemcacheStoreCommand(s, memcacheSet),
+		"add":       newMemcacheStoreCommand(s, memcacheAdd),
+		"replace":   newMemcacheStoreCommand(s, memcacheReplace),
+		"append":    newMemcacheStoreCommand(s, memcacheAppend),
+		"prepend":   newMemcacheStoreCommand(s, memcachePrepend),
+		"cas":       newMemcacheCasCommand(s),
+		"delete":    newMemcacheDeleteCommand(s),
+		"incr":      newMemcacheIncrCommand(s, true),
+		"decr":      newMemcacheIncrCommand(s, false),
+		"touch":     newMemcacheTouchCommand(s),
+		"flush_all": newMemcacheFlushAllCommand(s),
+		"stats":     newMemcacheStatsCommand(s),
+		"version":   memcacheVersionCommand,
+	}
+}
+
+// memcacheStore stores value with ttl and returns reply line
+type memcacheStore func(s storage.Storage, key, value string, ttl uint64) string
+
+func memcacheSet(s storage.Storage, key, value string, ttl uint64) string {
+	if err := overwriteValue(s, key, value, ttl); err != nil {
+		return fmt.Sprintf("SERVER_ERROR %s", err)
+	}
+	return "STORED"
+}
+
+func memcacheAdd(s storage.Storage, key, value string, ttl uint64) string {
+	if err := s.Set(key, value, ttl); err != nil {
+		return "NOT_STORED"
+	}
+	return "STORED"
+}
+
+// memcacheReplace stores value only if string key exists, Get option rejects keys of other types
+func memcacheReplace(s storage.Storage, key, value string, ttl uint64) string {
+	options := storage.SetOptions{Mode: storage.SetIfExists, Get: true}
+	if _, _, err := s.SetWithOptions(key, value, ttl, options); err != nil {
+		return "NOT_STORED"
+	}
+	return "STORED"
+}
+
+// memcacheAppend and memcachePrepend keep key ttl like memcached does. Flags and exptime are ignored.
+func memcacheAppend(s storage.Storage, key, value string, ttl uint64) string {
+	_, err := memcacheModify(s, key, func(current string) (string, error) {
+		return current + value, nil
+	})
+	if err != nil {
+		return "NOT_STORED"
+	}
+	return "STORED"
+}
+
+func memcachePrepend(s storage.Storage, key, value string, ttl uint64) string {
+	_, err := memcacheModify(s, key, func(current string) (string, error) {
+		return value + current, nil
+	})
+	if err != nil {
+		return "NOT_STORED"
+	}
+	return "STORED"
+}
+
+// memcacheModify replaces value of key by result of modify and returns new value.
+// Value is written by CompareAndSwap, so modification is repeated if key is changed concurrently.
+func memcacheModify(s storage.Storage, key string, modify func(current string) (string, error)) (string, error) {
+	for {
+		current, version, err := s.GetWithVersion(key)
+		if err != nil {
+			return "", err
+		}
+		value, err := modify(current)
+		if err != nil {
+			return "", err
+		}
+		err = s.CompareAndSwap(key, value, version)
+		if err != storage.VersionMismatchError {
+			return value, err
+		}
+	}
+}
+
+// newMemcacheStoreCommand handles "<command> <key> <flags> <exptime> <bytes> [noreply]".
+// Flags are not stored, they are always returned as 0.
+func newMemcacheStoreCommand(s storage.Storage, store memcacheStore) memcacheCommand {
+	return func(session *memcacheSession, args []string) {
+		if len(args) != 4 {
+			session.writeLine("ERROR")
+			return
+		}
+		// Data block is read first, so it is discarded even if the other args are invalid
+		value, err := session.readData(args[3])
+		if err != nil {
+			session.writeError(err)
+			return
+		}
+		key, ttl, expired, err := parseMemcacheStoreArgs(args)
+		if err != nil {
+			session.writeError(err)
+			return
+		}
+
+		atomic.AddInt64(&session.stats.cmdSet, 1)
+		reply := store(s, key, value, ttl)
+		if expired && reply == "STORED" {
+			s.Delete(key)
+		}
+		session.reply(reply)
+	}
+}
+
+// newMemcacheCasCommand handles "cas <key> <flags> <exptime> <bytes> <cas unique> [noreply]".
+// CAS unique is a version of the key.
+func newMemcacheCasCommand(s storage.Storage) memcacheCommand {
+	return func(session *memcacheSession, args []string) {
+		if len(args) != 5 {
+			session.writeLine("ERROR")
+			return
+		}
+		value, err := session.readData(args[3])
+		if err != nil {
+			session.writeError(err)
+			return
+		}
+		key, ttl, expired, err := parseMemcacheStoreArgs(args)
+		if err != nil {
+			session.writeError(err)
+			return
+		}
+		unique, err := parseMemcacheUint(args[4])
+		if err != nil {
+			session.writeError(memcacheBadFormatError)
+			return
+		}
+
+		atomic.AddInt64(&session.stats.cmdSet, 1)
+		switch err := memcacheCas(s, key, value, ttl, expired, unique); err {
+		case nil:
+			session.reply("STORED")
+		case storage.VersionMismatchError:
+			session.reply("EXISTS")
+		default:
+			session.reply("NOT_FOUND")
+		}
+	}
+}
+
+// memcacheCas replaces value and ttl of key if its version is unique. Value and ttl are written by the same
+// operation within transaction, so version is changed once and concurrent writes are never interleaved.
+func memcacheCas(s storage.Storage, key, value string, ttl uint64, expired bool, unique uint64) error {
+	return atomically(s, func(s storage.Storage) error {
+		_, version, err := s.GetWithVersion(key)
+		if err != nil {
+			return err
+		}
+		if version != unique {
+			return storage.VersionMismatchError
+		}
+		if expired {
+			return s.Delete(key)
+		}
+		_, _, err = s.SetWithOptions(key, value, ttl, storage.SetOptions{Mode: storage.SetIfExists})
+		return err
+	})
+}
+
+func newMemcacheGetCommand(s storage.Storage, withCas bool) memcacheCommand {
+	return func(session *memcacheSession, keys []string) {
+		if len(keys) == 0 {
+			session.writeLine("ERROR")
+			return
+		}
+		for _, key := range keys {
+			atomic.AddInt64(&session.stats.cmdGet, 1)
+			value, version, err := s.GetWithVersion(key)
+			if err != nil {
+				atomic.AddInt64(&session.stats.getMisses, 1)
+				continue
+			}
+			atomic.AddInt64(&session.stats.getHits, 1)
+			if withCas {
+				session.writeLine(fmt.Sprintf("VALUE %s 0 %d %d", key, len(value), version))
+			} else {
+				session.writeLine(fmt.Sprintf("VALUE %s 0 %d", key, len(value)))
+			}
+			session.writeLine(value)
+		}
+		session.writeLine("END")
+	}
+}
+
+func newMemcacheDeleteCommand(s storage.Storage) memcacheCommand {
+	return func(session *memcacheSession, args []string) {
+		// Legacy "delete <key> 0" form is allowed
+		if len(args) == 0 || len(args) > 2 || (len(args) == 2 && args[1] != "0") {
+			session.writeLine("ERROR")
+			return
+		}
+		if err := s.Delete(args[0]); err != nil {
+			session.reply("NOT_FOUND")
+			return
+		}
+		session.reply("DELETED")
+	}
+}
+
+// newMemcacheIncrCommand handles incr and decr. Incr wraps around on 64-bit overflow, decr stops at 0.
+func newMemcacheIncrCommand(s storage.Storage, incr bool) memcacheCommand {
+	return func(session *memcacheSession, args []string) {
+		if len(args) != 2 {
+			session.writeLine("ERROR")
+			return
+		}
+		delta, err := parseMemcacheUint(args[1])
+		if err != nil {
+			session.writeLine("CLIENT_ERROR invalid numeric delta argument")
+			return
+		}
+
+		value, err := memcacheModify(s, args[0], func(current string) (string, error) {
+			n, err := parseMemcacheUint(current)
+			if err != nil {
+				return "", memcacheNonNumericError
+			}
+			if incr {
+				n += delta
+			} else if delta > n {
+				n = 0
+			} else {
+				n -= delta
+			}
+			return strconv.FormatUint(n, 10), nil
+		})
+		if err == memcacheNonNumericError {
+			session.writeError(err)
+			return
+		}
+		if err != nil {
+			session.reply("NOT_FOUND")
+			return
+		}
+		session.reply(value)
+	}
+}
+
+func newMemcacheTouchCommand(s storage.Storage) memcacheCommand {
+	return func(session *memcacheSession, args []string) {
+		if len(args) != 2 {
+			session.writeLine("ERROR")
+			return
+		}
+		ttl, expired, err := parseMemcacheExptime(args[1])
+		if err != nil {
+			session.writeError(err)
+			return
+		}
+
+		atomic.AddInt64(&session.stats.cmdTouch, 1)
+		if expired {
+			err = s.Delete(args[0])
+		} else {
+			err = s.Expire(args[0], ttl)
+		}
+		if err != nil {
+			session.reply("NOT_FOUND")
+			return
+		}
+		session.reply("TOUCHED")
+	}
+}
+
+// newMemcacheFlushAllCommand deletes all keys immediately or after optional delay in seconds
+func newMemcacheFlushAllCommand(s storage.Storage) memcacheCommand {
+	flush := func() {
+		for _, key := range s.Keys() {
+			s.Delete(key)
+		}
+	}
+	return func(session *memcacheSession, args []string) {
+		if len(args) > 1 {
+			session.writeLine("ERROR")
+			return
+		}
+		if len(args) == 1 {
+			delay, err := parseMemcacheUint(args[0])
+			if err != nil {
+				session.writeError(memcacheBadFormatError)
+				return
+			}
+			if delay > 0 {
+				time.AfterFunc(time.Duration(delay)*time.Second, flush)
+				session.reply("OK")
+				return
+			}
+		}
+		flush()
+		session.reply("OK")
+	}
+}
+
+func newMemcacheStatsCommand(s storage.Storage) memcacheCommand {
+	return func(session *memcacheSession, args []string) {
+		if len(args) > 0 {
+			session.writeLine("ERROR")
+			return
+		}
+		stats := session.stats
+		now := time.Now()
+		for _, stat := range []struct {
+			name  string
+			value interface{}
+		}{
+			{"pid", os.Getpid()},
+			{"uptime", int64(now.Sub(stats.startTime).Seconds())},
+			{"time", now.Unix()},
+			{"version", memcacheVersion},
+			{"curr_items", len(s.Keys())},
+			{"curr_connections", atomic.LoadInt64(&stats.currConnections)},
+			{"total_connections", atomic.LoadInt64(&stats.totalConnections)},
+			{"cmd_get", atomic.LoadInt64(&stats.cmdGet)},
+			{"cmd_set", atomic.LoadInt64(&stats.cmdSet)},
+			{"cmd_touch", atomic.LoadInt64(&stats.cmdTouch)},
+			{"get_hits", atomic.LoadInt64(&stats.getHits)},
+			{"get_misses", atomic.LoadInt64(&stats.getMisses)},
+		} {
+			session.writeLine(fmt.Sprintf("STAT %s %v", stat.name, stat.value))
+		}
+		session.writeLine("END")
+	}
+}
+
+func memcacheVersionCommand(session *memcacheSession, args []string) {
+	session.writeLine(fmt.Sprintf("VERSION %s", memcacheVersion))
+}
+
+// parseMemcacheStoreArgs parses key, flags and exptime of storage command
+func parseMemcacheStoreArgs(args []string) (key string, ttl uint64, expired bool, err error) {
+	key = args[0]
+	if len(key) > memcacheMaxKeyLength {
+		return "", 0, false, memcacheBadFormatError
+	}
+	if _, err := strconv.ParseUint(args[1], 10, 32); err != nil {
+		return "", 0, false, memcacheBadFormatError
+	}
+	ttl, expired, err = parseMemcacheExptime(args[2])
+	return
+}
+
+// parseMemcacheExptime converts memcached exptime to ttl.
+// Exptime may be relative number of seconds or absolute unix timestamp, negative exptime means expired item.
+func parseMemcacheExptime(exptime string) (ttl uint64, expired bool, err error) {
+	n, err := strconv.ParseInt(exptime, 10, 64)
+	if err != nil {
+		return 0, false, memcacheBadFormatError
+	}
+	switch {
+	case n < 0:
+		return 0, true, nil
+	case n > memcacheMaxRelativeExptime:
+		n -= time.Now().Unix()
+		if n <= 0 {
+			return 0, true, nil
+		}
+	}
+	return uint64(n), false, nil
+}
+
+func parseMemcacheUint(s string) (uint64, error) {
+	return strconv.ParseUint(s, 10, 64)
+}
@@ -0,0 +1,224 @@
+package server
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"strings"
+	"sync/atomic"
+
+	"github.com/Barberrrry/jcache/server/htpasswd"
+)
+
+const (
+	memcacheMaxKeyLength = 250
+	memcacheMaxLineSize  = 2048
+	memcacheMaxValueSize = 1024 * 1024
+)
+
+type memcacheSession struct {
+	id           string
+	rwc          io.ReadWriteCloser
+	reader       *bufio.Reader
+	writer       *bufio.Writer
+	commands     map[string]memcacheCommand
+	htpasswdFile *htpasswd.HtpasswdFile
+	stats        *memcacheStats
+	isAuthorized bool
+	isClosed     bool
+	isNoReply    bool
+	logger       *log.Logger
+}
+
+func newMemcacheSession(id string, rwc io.ReadWriteCloser, commands map[string]memcacheCommand, stats *memcacheStats, htpasswdFile *htpasswd.HtpasswdFile, logger *log.Logger) *memcacheSession {
+	return &memcacheSession{
+		id:           id,
+		rwc:          rwc,
+		reader:       bufio.NewReader(rwc),
+		writer:       bufio.NewWriter(rwc),
+		commands:     commands,
+		htpasswdFile: htpasswdFile,
+		stats:        stats,
+		logger:       logger,
+	}
+}
+
+func (s *memcacheSession) start() {
+	defer s.rwc.Close()
+
+	atomic.AddInt64(&s.stats.currConnections, 1)
+	atomic.AddInt64(&s.stats.totalConnections, 1)
+	defer atomic.AddInt64(&s.stats.currConnections, -1)
+
+	s.log("open memcache session")
+	defer s.log("close memcache session")
+
+	for !s.isClosed {
+		// Replies are flushed only when all pipelined commands are processed
+		if s.reader.Buffered() == 0 {
+			if err := s.writer.Flush(); err != nil {
+				s.log(fmt.Sprintf("write error: %s", err))
+				return
+			}
+		}
+
+		line, err := s.readLine()
+		if err == memcacheLineTooLongError {
+			s.writeError(err)
+			continue
+		}
+		if err != nil {
+			s.log(fmt.Sprintf("read error: %s", err))
+			return
+		}
+
+		args := strings.Fields(line)
+		if len(args) == 0 {
+			s.writeLine("ERROR")
+			continue
+		}
+
+		s.log(fmt.Sprintf("command: %s", args[0]))
+		s.execute(args[0], args[1:])
+	}
+	s.writer.Flush()
+}
+
+func (s *memcacheSession) execute(name string, args []string) {
+	if name == "quit" {
+		s.isClosed = true
+		return
+	}
+
+	command, found := s.commands[name]
+	if !found {
+		s.writeLine("ERROR")
+		return
+	}
+
+	if s.htpasswdFile != nil && !s.isAuthorized {
+		s.authenticate(name, args)
+		return
+	}
+
+	s.isNoReply = len(args) > 0 && args[len(args)-1] == "noreply"
+	if s.isNoReply {
+		args = args[:len(args)-1]
+	}
+	command(s, args)
+	s.isNoReply = false
+}
+
+// authenticate implements memcached ASCII authentication:
+// the first command must be "set" with "<user> <password>" as data.
+// Data block of other storage commands is skipped, so it isn't read as the next command.
+func (s *memcacheSession) authenticate(name string, args []string) {
+	switch name {
+	case "set", "add", "replace", "append", "prepend", "cas":
+	default:
+		s.writeLine("CLIENT_ERROR unauthenticated")
+		return
+	}
+	if len(args) < 4 {
+		s.writeLine("CLIENT_ERROR unauthenticated")
+		return
+	}
+	data, err := s.readData(args[3])
+	if err != nil {
+		s.writeError(err)
+		return
+	}
+	if name != "set" {
+		s.writeLine("CLIENT_ERROR unauthenticated")
+		return
+	}
+
+	credentials := strings.Fields(data)
+	if len(credentials) == 2 && s.htpasswdFile.Validate(credentials[0], credentials[1]) {
+		s.isAuthorized = true
+		s.log("successful authentication")
+		s.writeLine("STORED")
+		return
+	}
+	s.writeLine("CLIENT_ERROR authentication failure")
+}
+
+// readLine reads command line. Too long line is skipped without buffering it, so memory of session is limited.
+func (s *memcacheSession) readLine() (string, error) {
+	line, err := s.reader.ReadSlice('\n')
+	if err == bufio.ErrBufferFull || (err == nil && len(line) > memcacheMaxLineSize) {
+		if err == bufio.ErrBufferFull {
+			err = s.skipLine()
+		}
+		if err != nil {
+			return "", err
+		}
+		return "", memcacheLineTooLongError
+	}
+	if err != nil {
+		return "", err
+	}
+	return string(line), nil
+}
+
+// skipLine discards input up to the end of the current line
+func (s *memcacheSession) skipLine() error {
+	for {
+		_, err := s.reader.ReadSlice('\n')
+		if err != bufio.ErrBufferFull {
+			return err
+		}
+	}
+}
+
+// readData reads data block of storage command which length is passed as string.
+// Too large data block is skipped to keep connection in consistent state.
+func (s *memcacheSession) readData(length string) (string, error) {
+	n, err := parseMemcacheUint(length)
+	if err != nil {
+		return "", memcacheBadFormatError
+	}
+	if n > memcacheMaxValueSize {
+		io.CopyN(ioutil.Discard, s.reader, int64(n)+2)
+		return "", memcacheTooLargeError
+	}
+	data := make([]byte, n+2)
+	if _, err := io.ReadFull(s.reader, data); err != nil {
+		return "", err
+	}
+	if data[n] != '\r' || data[n+1] != '\n' {
+		// Skip rest of the line so the next command is read from its beginning
+		if data[n+1] != '\n' {
+			s.skipLine()
+		}
+		return "", memcacheBadChunkError
+	}
+	return string(data[:n]), nil
+}
+
+// reply writes line unless client asked for no reply
+func (s *memcacheSession) reply(line string) {
+	if !s.isNoReply {
+		s.writeLine(line)
+	}
+}
+
+// writeError writes client error except of too large value which is treated as server error like memcached does
+func (s *memcacheSession) writeError(err error) {
+	if err == memcacheTooLargeError {
+		s.writeLine(fmt.Sprintf("SERVER_ERROR %s", err))
+		return
+	}
+	s.writeLine(fmt.Sprintf("CLIENT_ERROR %s", err))
+}
+
+func (s *memcacheSession) writeLine(line string) {
+	s.writer.WriteString(line)
+	s.writer.WriteString("\r\n")
+}
+
+func (s *memcacheSession) log(message string) {
+	s.logger.Printf("[%s] %s", s.id, message)
+}
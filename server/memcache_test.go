@@ -0,0 +1,136 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Barberrrry/jcache/server/htpasswd"
+	"github.com/Barberrrry/jcache/server/storage/memory"
+	. "gopkg.in/check.v1"
+)
+
+type MemcacheTestSuite struct{}
+
+var _ = Suite(&MemcacheTestSuite{})
+
+func (s *MemcacheTestSuite) TestCommands(c *C) {
+	storage, _ := memory.NewStorage(100, time.Minute)
+
+	conn := newTestConn()
+	go newMemcacheSession("test", conn, newMemcacheCommands(storage), newMemcacheStats(), nil, log.New(&bytes.Buffer{}, "", 0)).start()
+
+	reader := bufio.NewReader(conn.outReader)
+	for _, t := range []struct {
+		request  string
+		response string
+	}{
+		{"get key\r\n", "END\r\n"},
+		{"set key 0 0 5\r\nvalue\r\n", "STORED\r\n"},
+		{"add key 0 0 5\r\nvalue\r\n", "NOT_STORED\r\n"},
+		{"replace key 0 60 6\r\nvalue2\r\n", "STORED\r\n"},
+		{"replace unknown 0 0 1\r\nx\r\n", "NOT_STORED\r\n"},
+		{"gets key\r\n", "VALUE key 0 6 2\r\nvalue2\r\nEND\r\n"},
+		{"cas key 0 0 1 1\r\nx\r\n", "EXISTS\r\n"},
+		{"cas key 0 0 1 2\r\nx\r\n", "STORED\r\n"},
+		// Value and ttl are changed at once, so version is incremented once
+		{"gets key\r\n", "VALUE key 0 1 3\r\nx\r\nEND\r\n"},
+		{"cas key 0 60 1 3\r\nx\r\n", "STORED\r\n"},
+		{"gets key\r\n", "VALUE key 0 1 4\r\nx\r\nEND\r\n"},
+		{"append key 0 0 2\r\nyz\r\n", "STORED\r\n"},
+		{"prepend key 0 0 1\r\nw\r\n", "STORED\r\n"},
+		{"get key unknown\r\n", "VALUE key 0 4\r\nwxyz\r\nEND\r\n"},
+		{"incr key 1\r\n", "CLIENT_ERROR cannot increment or decrement non-numeric value\r\n"},
+		{"set counter 0 0 2 noreply\r\n10\r\n", ""},
+		{"incr counter 5\r\n", "15\r\n"},
+		{"decr counter 20\r\n", "0\r\n"},
+		{"touch counter 10\r\n", "TOUCHED\r\n"},
+		{"touch unknown 10\r\n", "NOT_FOUND\r\n"},
+		{"delete counter\r\n", "DELETED\r\n"},
+		{"delete counter\r\n", "NOT_FOUND\r\n"},
+		{"set key 0 0 1\r\nxx\r\n", "CLIENT_ERROR bad data chunk\r\n"},
+		// Data block of invalid command is discarded, so it isn't executed as the next command
+		{"set key 0 x 9\r\nflush_all\r\n", "CLIENT_ERROR bad command line format\r\n"},
+		{"add key x 0 9\r\nflush_all\r\n", "CLIENT_ERROR bad command line format\r\n"},
+		{"set " + strings.Repeat("k", 251) + " 0 0 9\r\nflush_all\r\n", "CLIENT_ERROR bad command line format\r\n"},
+		{"cas key 0 x 9 1\r\nflush_all\r\n", "CLIENT_ERROR bad command line format\r\n"},
+		{"cas key 0 0 9 x\r\nflush_all\r\n", "CLIENT_ERROR bad command line format\r\n"},
+		{"get key\r\n", "VALUE key 0 4\r\nwxyz\r\nEND\r\n"},
+		{"flush_all\r\n", "OK\r\n"},
+		{"get key\r\n", "END\r\n"},
+		{"unknown\r\n", "ERROR\r\n"},
+		{"get " + strings.Repeat("k", 3000) + "\r\n", "CLIENT_ERROR line is too long\r\n"},
+		{"get " + strings.Repeat("k", 100000) + "\r\n", "CLIENT_ERROR line is too long\r\n"},
+		{"version\r\n", "VERSION " + memcacheVersion + "\r\n"},
+	} {
+		conn.inWriter.Write([]byte(t.request))
+		response := make([]byte, len(t.response))
+		_, err := io.ReadFull(reader, response)
+		c.Assert(err, IsNil)
+		c.Assert(string(response), Equals, t.response, Commentf("request %q", t.request))
+	}
+
+	conn.inWriter.Close()
+}
+
+func (s *MemcacheTestSuite) TestConcurrentModify(c *C) {
+	storage, _ := memory.NewStorage(100, time.Minute)
+	storage.Set("counter", "0", 0)
+	storage.Set("key", "", 0)
+	commands := newMemcacheCommands(storage)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			session := newMemcacheSession("test", newTestConn(), commands, newMemcacheStats(), nil, log.New(ioutil.Discard, "", 0))
+			session.writer = bufio.NewWriter(ioutil.Discard)
+			for j := 0; j < 1000; j++ {
+				commands["incr"](session, []string{"counter", "2"})
+				commands["decr"](session, []string{"counter", "1"})
+				memcacheAppend(storage, "key", "x", 0)
+			}
+		}()
+	}
+	wg.Wait()
+
+	value, _ := storage.Get("counter")
+	c.Assert(value, Equals, "10000")
+	value, _ = storage.Get("key")
+	c.Assert(len(value), Equals, 10000)
+}
+
+func (s *MemcacheTestSuite) TestAuth(c *C) {
+	storage, _ := memory.NewStorage(100, time.Minute)
+	htpasswdFile, _ := htpasswd.NewHtpasswd(bytes.NewBufferString("user:{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g="))
+
+	conn := newTestConn()
+	go newMemcacheSession("test", conn, newMemcacheCommands(storage), newMemcacheStats(), htpasswdFile, log.New(&bytes.Buffer{}, "", 0)).start()
+
+	reader := bufio.NewReader(conn.outReader)
+	for _, t := range []struct {
+		request  string
+		response string
+	}{
+		{"get key\r\n", "CLIENT_ERROR unauthenticated\r\n"},
+		{"add key 0 0 7\r\nversion\r\n", "CLIENT_ERROR unauthenticated\r\n"},
+		{"cas key 0 0 7 1\r\nversion\r\n", "CLIENT_ERROR unauthenticated\r\n"},
+		{"set auth 0 0 10\r\nuser wrong\r\n", "CLIENT_ERROR authentication failure\r\n"},
+		{"set auth 0 0 13\r\nuser password\r\n", "STORED\r\n"},
+		{"get key\r\n", "END\r\n"},
+	} {
+		conn.inWriter.Write([]byte(t.request))
+		response := make([]byte, len(t.response))
+		_, err := io.ReadFull(reader, response)
+		c.Assert(err, IsNil)
+		c.Assert(string(response), Equals, t.response, Commentf("request %q", t.request))
+	}
+
+	conn.inWriter.Close()
+}
@@ -0,0 +1,168 @@
+package server
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/Barberrrry/jcache/server/storage"
+)
+
+const (
+	// SlowSubscriberDrop drops messages which don't fit into queue of subscriber
+	SlowSubscriberDrop = "drop"
+	// SlowSubscriberDisconnect closes connection of subscriber which queue is full
+	SlowSubscriberDisconnect = "disconnect"
+
+	// DefaultSubscriberQueueSize is a number of messages which may wait for delivery to one subscriber
+	DefaultSubscriberQueueSize = 1000
+)
+
+// SlowSubscriberPolicy defines what happens when message is published to subscriber which queue is full
+type SlowSubscriberPolicy string
+
+func (p *SlowSubscriberPolicy) String() string {
+	return string(*p)
+}
+
+func (p *SlowSubscriberPolicy) Set(value string) error {
+	switch value {
+	case SlowSubscriberDrop, SlowSubscriberDisconnect:
+		*p = SlowSubscriberPolicy(value)
+	default:
+		return fmt.Errorf("Unknown slow subscriber policy: %s", value)
+	}
+	return nil
+}
+
+// message is published to channel, pattern is set if it is delivered by pattern subscription
+type message struct {
+	pattern string
+	channel string
+	payload string
+}
+
+// subscriber receives messages of its channels and patterns through bounded queue,
+// so publishers are never blocked by slow subscribers
+type subscriber struct {
+	messages chan message
+	// channels and patterns are guarded by mutex of pubSub
+	channels map[string]bool
+	patterns map[string]bool
+	// disconnect is called at most once when queue overflows and policy is SlowSubscriberDisconnect
+	disconnect     func()
+	disconnectOnce sync.Once
+	// done is closed when session leaves subscriber mode
+	done chan struct{}
+}
+
+// pubSub routes published messages to subscribers of channels and patterns
+type pubSub struct {
+	mu        sync.RWMutex
+	channels  map[string]map[*subscriber]bool
+	patterns  map[string]map[*subscriber]bool
+	queueSize int
+	policy    SlowSubscriberPolicy
+}
+
+func newPubSub(queueSize int, policy SlowSubscriberPolicy) *pubSub {
+	return &pubSub{
+		channels:  make(map[string]map[*subscriber]bool),
+		patterns:  make(map[string]map[*subscriber]bool),
+		queueSize: queueSize,
+		policy:    policy,
+	}
+}
+
+// newSubscriber creates subscriber without subscriptions, disconnect closes its connection
+func (ps *pubSub) newSubscriber(disconnect func()) *subscriber {
+	return &subscriber{
+		messages:   make(chan message, ps.queueSize),
+		channels:   make(map[string]bool),
+		patterns:   make(map[string]bool),
+		disconnect: disconnect,
+		done:       make(chan struct{}),
+	}
+}
+
+// subscribe adds channels or patterns to subscriber and returns number of its subscriptions
+func (ps *pubSub) subscribe(sub *subscriber, channels []string, isPattern bool) int {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	index, own := ps.channels, sub.channels
+	if isPattern {
+		index, own = ps.patterns, sub.patterns
+	}
+	for _, channel := range channels {
+		if index[channel] == nil {
+			index[channel] = make(map[*subscriber]bool)
+		}
+		index[channel][sub] = true
+		own[channel] = true
+	}
+	return len(sub.channels) + len(sub.patterns)
+}
+
+// unsubscribe removes channels or patterns of subscriber, all of them are removed if channels is empty.
+// Number of remaining subscriptions is returned.
+func (ps *pubSub) unsubscribe(sub *subscriber, channels []string, isPattern bool) int {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	index, own := ps.channels, sub.channels
+	if isPattern {
+		index, own = ps.patterns, sub.patterns
+	}
+	if len(channels) == 0 {
+		for channel := range own {
+			channels = append(channels, channel)
+		}
+	}
+	for _, channel := range channels {
+		delete(own, channel)
+		delete(index[channel], sub)
+		if len(index[channel]) == 0 {
+			delete(index, channel)
+		}
+	}
+	return len(sub.channels) + len(sub.patterns)
+}
+
+// publish sends message to subscribers of channel and of matching patterns without waiting for delivery.
+// Subscriber subscribed by several patterns receives message several times.
+// Number of subscribers which queued message is returned, messages dropped by full queues are not counted.
+func (ps *pubSub) publish(channel, payload string) int {
+	ps.mu.RLock()
+	defer ps.mu.RUnlock()
+
+	receivers := 0
+	for sub := range ps.channels[channel] {
+		if ps.enqueue(sub, message{channel: channel, payload: payload}) {
+			receivers++
+		}
+	}
+	for pattern, subs := range ps.patterns {
+		if !storage.MatchPattern(pattern, channel) {
+			continue
+		}
+		for sub := range subs {
+			if ps.enqueue(sub, message{pattern: pattern, channel: channel, payload: payload}) {
+				receivers++
+			}
+		}
+	}
+	return receivers
+}
+
+// enqueue puts message into queue of subscriber or applies policy if queue is full
+func (ps *pubSub) enqueue(sub *subscriber, m message) bool {
+	select {
+	case sub.messages <- m:
+		return true
+	default:
+	}
+	if ps.policy == SlowSubscriberDisconnect {
+		sub.disconnectOnce.Do(sub.disconnect)
+	}
+	return false
+}
@@ -0,0 +1,111 @@
+package server
+
+import (
+	"bytes"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/Barberrrry/jcache/server/storage/memory"
+	. "gopkg.in/check.v1"
+)
+
+type PubSubTestSuite struct{}
+
+var _ = Suite(&PubSubTestSuite{})
+
+func (s *PubSubTestSuite) TestPublish(c *C) {
+	ps := newPubSub(10, SlowSubscriberDrop)
+	first := ps.newSubscriber(nil)
+	second := ps.newSubscriber(nil)
+
+	c.Assert(ps.subscribe(first, []string{"news", "sport"}, false), Equals, 2)
+	c.Assert(ps.subscribe(first, []string{"news"}, false), Equals, 2)
+	c.Assert(ps.subscribe(second, []string{"n*", "*s"}, true), Equals, 2)
+
+	c.Assert(ps.publish("weather", "rainy"), Equals, 0)
+	c.Assert(ps.publish("sport", "goal"), Equals, 1)
+	c.Assert(<-first.messages, Equals, message{channel: "sport", payload: "goal"})
+
+	c.Assert(ps.publish("news", "hello"), Equals, 3)
+	c.Assert(<-first.messages, Equals, message{channel: "news", payload: "hello"})
+	received := []message{<-second.messages, <-second.messages}
+	sort.Slice(received, func(i, j int) bool { return received[i].pattern < received[j].pattern })
+	c.Assert(received, DeepEquals, []message{
+		{pattern: "*s", channel: "news", payload: "hello"},
+		{pattern: "n*", channel: "news", payload: "hello"},
+	})
+
+	c.Assert(ps.unsubscribe(first, []string{"news", "unknown"}, false), Equals, 1)
+	c.Assert(ps.unsubscribe(second, nil, true), Equals, 0)
+	c.Assert(ps.publish("news", "bye"), Equals, 0)
+	c.Assert(ps.unsubscribe(first, nil, false), Equals, 0)
+	c.Assert(ps.channels, HasLen, 0)
+	c.Assert(ps.patterns, HasLen, 0)
+}
+
+func (s *PubSubTestSuite) TestSlowSubscriberDrop(c *C) {
+	ps := newPubSub(2, SlowSubscriberDrop)
+	sub := ps.newSubscriber(func() { c.Fatal("slow subscriber must not be disconnected") })
+	ps.subscribe(sub, []string{"news"}, false)
+
+	c.Assert(ps.publish("news", "1"), Equals, 1)
+	c.Assert(ps.publish("news", "2"), Equals, 1)
+	c.Assert(ps.publish("news", "3"), Equals, 0)
+	c.Assert((<-sub.messages).payload, Equals, "1")
+	c.Assert(ps.publish("news", "4"), Equals, 1)
+	c.Assert((<-sub.messages).payload, Equals, "2")
+	c.Assert((<-sub.messages).payload, Equals, "4")
+}
+
+func (s *PubSubTestSuite) TestSlowSubscriberDisconnect(c *C) {
+	ps := newPubSub(1, SlowSubscriberDisconnect)
+	disconnects := 0
+	sub := ps.newSubscriber(func() { disconnects++ })
+	ps.subscribe(sub, []string{"news"}, false)
+
+	c.Assert(ps.publish("news", "1"), Equals, 1)
+	c.Assert(ps.publish("news", "2"), Equals, 0)
+	c.Assert(ps.publish("news", "3"), Equals, 0)
+	c.Assert(disconnects, Equals, 1)
+}
+
+func (s *PubSubTestSuite) TestSlowSubscriberPolicy(c *C) {
+	var policy SlowSubscriberPolicy
+	c.Assert(policy.Set(SlowSubscriberDisconnect), IsNil)
+	c.Assert(policy, Equals, SlowSubscriberPolicy(SlowSubscriberDisconnect))
+	c.Assert(policy.Set("block"), ErrorMatches, "Unknown slow subscriber policy: block")
+}
+
+func (s *PubSubTestSuite) TestKeyspaceEvents(c *C) {
+	st, _ := memory.NewStorage(100, time.Minute)
+	srv := New(st, "", log.New(&bytes.Buffer{}, "", 0))
+	c.Assert(srv.SetKeyspaceEvents(KeyspaceEvents("del, expired")), IsNil)
+
+	sub := srv.pubSub.newSubscriber(nil)
+	srv.pubSub.subscribe(sub, []string{"__keyspace@0__:*"}, true)
+	srv.pubSub.subscribe(sub, []string{"__keyevent@0__:del"}, false)
+
+	st.Set("key", "value", 0)
+	st.Delete("key")
+	c.Assert(sub.messages, HasLen, 2)
+	c.Assert(<-sub.messages, Equals, message{pattern: "__keyspace@0__:*", channel: "__keyspace@0__:key", payload: "del"})
+	c.Assert(<-sub.messages, Equals, message{channel: "__keyevent@0__:del", payload: "key"})
+
+	c.Assert(srv.SetKeyspaceEvents(KeyspaceEvents(KeyspaceEventsAll)), IsNil)
+	st.Set("key", "value", 0)
+	c.Assert(<-sub.messages, Equals, message{pattern: "__keyspace@0__:*", channel: "__keyspace@0__:key", payload: "set"})
+
+	c.Assert(srv.SetKeyspaceEvents(""), IsNil)
+	st.Update("key", "value2")
+	c.Assert(sub.messages, HasLen, 0)
+}
+
+func (s *PubSubTestSuite) TestKeyspaceEventsFlag(c *C) {
+	var events KeyspaceEvents
+	c.Assert(events.Set("set,hash"), IsNil)
+	c.Assert(events.enabled(), DeepEquals, map[string]bool{"set": true, "hash": true})
+	c.Assert(events.Set("set,touch"), ErrorMatches, "Unknown keyspace event: touch")
+	c.Assert(events.String(), Equals, "set,hash")
+	c.Assert(KeyspaceEvents("all").enabled(), HasLen, 6)
+}
@@ -0,0 +1,160 @@
+package server
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/Barberrrry/jcache/server/storage"
+)
+
+// RESP2 is the serialization protocol of Redis. It allows to use Redis clients and tools with jcache.
+// Specification: https://redis.io/topics/protocol
+
+const (
+	respMaxArgs      = 1024 * 1024
+	respMaxBulkSize  = 512 * 1024 * 1024
+	respWrongTypeMsg = "WRONGTYPE Operation against a key holding the wrong kind of value"
+)
+
+var (
+	respProtocolError = errors.New("Protocol error")
+)
+
+// readRESPCommand reads command as array of bulk strings or as inline command separated by spaces
+func readRESPCommand(reader *bufio.Reader) ([]string, error) {
+	line, err := readRESPLine(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	if !strings.HasPrefix(line, "*") {
+		return strings.Fields(line), nil
+	}
+
+	count, err := strconv.Atoi(line[1:])
+	if err != nil || count < -1 || count > respMaxArgs {
+		return nil, respProtocolError
+	}
+	// Null array is skipped as empty command
+	if count <= 0 {
+		return nil, nil
+	}
+
+	args := make([]string, 0, count)
+	for i := 0; i < count; i++ {
+		line, err := readRESPLine(reader)
+		if err != nil {
+			return nil, err
+		}
+		if !strings.HasPrefix(line, "$") {
+			return nil, respProtocolError
+		}
+		length, err := strconv.Atoi(line[1:])
+		if err != nil || length < 0 || length > respMaxBulkSize {
+			return nil, respProtocolError
+		}
+		data := make([]byte, length+2)
+		if _, err := io.ReadFull(reader, data); err != nil {
+			return nil, err
+		}
+		if data[length] != '\r' || data[length+1] != '\n' {
+			return nil, respProtocolError
+		}
+		args = append(args, string(data[:length]))
+	}
+	return args, nil
+}
+
+func readRESPLine(reader *bufio.Reader) (string, error) {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// respWriter writes RESP replies into buffered writer
+type respWriter struct {
+	*bufio.Writer
+}
+
+func (w *respWriter) writeSimple(s string) {
+	fmt.Fprintf(w, "+%s\r\n", s)
+}
+
+func (w *respWriter) writeOk() {
+	w.writeSimple("OK")
+}
+
+func (w *respWriter) writeErrorMessage(message string) {
+	fmt.Fprintf(w, "-%s\r\n", message)
+}
+
+// writeError maps storage errors to RESP error replies
+func (w *respWriter) writeError(err error) {
+	switch err {
+	case storage.KeyStringTypeError, storage.KeyHashTypeError, storage.KeyListTypeError, storage.KeySetTypeError, storage.KeySortedSetTypeError:
+		w.writeErrorMessage(respWrongTypeMsg)
+	case storage.NotIntegerError:
+		w.writeErrorMessage(respNotIntegerMsg)
+	case storage.ScoreNaNError:
+		w.writeErrorMessage(respNaNMsg)
+	default:
+		w.writeErrorMessage(fmt.Sprintf("ERR %s", err))
+	}
+}
+
+func (w *respWriter) writeInt(n int64) {
+	fmt.Fprintf(w, ":%d\r\n", n)
+}
+
+func (w *respWriter) writeBool(b bool) {
+	if b {
+		w.writeInt(1)
+	} else {
+		w.writeInt(0)
+	}
+}
+
+func (w *respWriter) writeBulk(s string) {
+	fmt.Fprintf(w, "$%d\r\n%s\r\n", len(s), s)
+}
+
+func (w *respWriter) writeNil() {
+	w.WriteString("$-1\r\n")
+}
+
+// writeNilArray writes null array which is returned by blocking commands on timeout
+func (w *respWriter) writeNilArray() {
+	w.WriteString("*-1\r\n")
+}
+
+func (w *respWriter) writeArrayHeader(count int) {
+	fmt.Fprintf(w, "*%d\r\n", count)
+}
+
+// writeScoredMembers writes members of sorted set, every member is followed by its score if withScores is set
+func (w *respWriter) writeScoredMembers(members []storage.ScoredMember, withScores bool) {
+	if withScores {
+		w.writeArrayHeader(2 * len(members))
+	} else {
+		w.writeArrayHeader(len(members))
+	}
+	for _, m := range members {
+		w.writeBulk(m.Member)
+		if withScores {
+			w.writeBulk(formatRESPScore(m.Score))
+		}
+	}
+}
+
+func (w *respWriter) writeBulks(values []string) {
+	w.writeArrayHeader(len(values))
+	for _, value := range values {
+		w.writeBulk(value)
+	}
+}
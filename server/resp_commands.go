@@ -0,0 +1,1198 @@
+package server
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Barberrrry/jcache/protocol"
+	"github.com/Barberrrry/jcache/server/storage"
+)
+
+const (
+	respNotIntegerMsg = "ERR value is not an integer or out of range"
+	respNotFloatMsg   = "ERR value is not a valid float"
+	respMinMaxMsg     = "ERR min or max is not a float"
+	respNaNMsg        = "ERR resulting score is not a number (NaN)"
+	respSyntaxMsg     = "ERR syntax error"
+	respTimeoutMsg    = "ERR timeout is not a float or out of range"
+	respNegTimeoutMsg = "ERR timeout is negative"
+	respNoSuchKeyMsg  = "ERR no such key"
+	respIndexMsg      = "ERR index out of range"
+	respFieldsMsg     = "ERR Mandatory argument FIELDS is missing or not at the right position"
+	respNumFieldsMsg  = "ERR The `numfields` parameter must match the number of arguments"
+)
+
+// respCommand describes RESP command with allowed number of arguments (except of command name).
+// Negative maxArgs means unlimited number of arguments.
+type respCommand struct {
+	minArgs int
+	maxArgs int
+	run     func(w *respWriter, args []string)
+}
+
+func (c respCommand) checkArity(n int) bool {
+	return n >= c.minArgs && (c.maxArgs < 0 || n <= c.maxArgs)
+}
+
+func newRESPCommands(s storage.Storage) map[string]respCommand {
+	return map[string]respCommand{
+		"PING":          {0, 1, respPing},
+		"ECHO":          {1, 1, respEcho},
+		"SELECT":        {1, 1, respSelect},
+		"COMMAND":       {0, -1, respCommandInfo},
+		"DBSIZE":        {0, 0, newRESPDBSizeCommand(s)},
+		"KEYS":          {1, 1, newRESPKeysCommand(s)},
+		"EXISTS":        {1, -1, newRESPExistsCommand(s)},
+		"EXPIRE":        {2, 2, newRESPExpireCommand(s, time.Second)},
+		"PEXPIRE":       {2, 2, newRESPExpireCommand(s, time.Millisecond)},
+		"EXPIREAT":      {2, 2, newRESPExpireAtCommand(s, time.Second)},
+		"PEXPIREAT":     {2, 2, newRESPExpireAtCommand(s, time.Millisecond)},
+		"PERSIST":       {1, 1, newRESPPersistCommand(s)},
+		"TOUCH":         {1, -1, newRESPTouchCommand(s)},
+		"TYPE":          {1, 1, newRESPTypeCommand(s)},
+		"TTL":           {1, 1, newRESPTTLCommand(s, time.Second)},
+		"PTTL":          {1, 1, newRESPTTLCommand(s, time.Millisecond)},
+		"GET":           {1, 1, newRESPGetCommand(s)},
+		"MGET":          {1, -1, newRESPMGetCommand(s)},
+		"MSET":          {2, -1, newRESPMSetCommand(s)},
+		"SET":           {2, -1, newRESPSetCommand(s)},
+		"SETEX":         {3, 3, newRESPSetExCommand(s, "setex", time.Second)},
+		"PSETEX":        {3, 3, newRESPSetExCommand(s, "psetex", time.Millisecond)},
+		"SETNX":         {2, 2, newRESPSetNXCommand(s)},
+		"INCR":          {1, 1, newRESPIncrCommand(s, 1)},
+		"DECR":          {1, 1, newRESPIncrCommand(s, -1)},
+		"INCRBY":        {2, 2, newRESPIncrByCommand(s, 1)},
+		"DECRBY":        {2, 2, newRESPIncrByCommand(s, -1)},
+		"DEL":           {1, -1, newRESPDelCommand(s)},
+		"HSET":          {3, -1, newRESPHashSetCommand(s, "hset", false)},
+		"HMSET":         {3, -1, newRESPHashSetCommand(s, "hmset", true)},
+		"HSETNX":        {3, 3, newRESPHashSetIfNotExistsCommand(s)},
+		"HGET":          {2, 2, newRESPHashGetCommand(s)},
+		"HMGET":         {2, -1, newRESPHashGetMultiCommand(s)},
+		"HINCRBY":       {3, 3, newRESPHashIncrementByCommand(s)},
+		"HDEL":          {2, -1, newRESPHashDelCommand(s)},
+		"HEXISTS":       {2, 2, newRESPHashExistsCommand(s)},
+		"HGETALL":       {1, 1, newRESPHashGetAllCommand(s)},
+		"HKEYS":         {1, 1, newRESPHashKeysCommand(s)},
+		"HVALS":         {1, 1, newRESPHashValuesCommand(s)},
+		"HLEN":          {1, 1, newRESPHashLenCommand(s)},
+		"HEXPIRE":       {4, -1, newRESPHashExpireCommand(s)},
+		"HTTL":          {3, -1, newRESPHashTTLCommand(s)},
+		"HPERSIST":      {3, -1, newRESPHashPersistCommand(s)},
+		"LPUSH":         {2, -1, newRESPListPushCommand(s, s.ListLeftPush)},
+		"RPUSH":         {2, -1, newRESPListPushCommand(s, s.ListRightPush)},
+		"LPOP":          {1, 1, newRESPListPopCommand(s.ListLeftPop)},
+		"RPOP":          {1, 1, newRESPListPopCommand(s.ListRightPop)},
+		"BLPOP":         {2, -1, newRESPListBlockingPopCommand(s.ListBlockingLeftPop)},
+		"BRPOP":         {2, -1, newRESPListBlockingPopCommand(s.ListBlockingRightPop)},
+		"LMOVE":         {4, 4, newRESPListMoveCommand(s, true, false)},
+		"BLMOVE":        {5, 5, newRESPListMoveCommand(s, true, true)},
+		"RPOPLPUSH":     {2, 2, newRESPListMoveCommand(s, false, false)},
+		"BRPOPLPUSH":    {3, 3, newRESPListMoveCommand(s, false, true)},
+		"LLEN":          {1, 1, newRESPListLenCommand(s)},
+		"LRANGE":        {3, 3, newRESPListRangeCommand(s)},
+		"LINDEX":        {2, 2, newRESPListIndexCommand(s)},
+		"LSET":          {3, 3, newRESPListSetCommand(s)},
+		"LINSERT":       {4, 4, newRESPListInsertCommand(s)},
+		"LREM":          {3, 3, newRESPListRemoveCommand(s)},
+		"LTRIM":         {3, 3, newRESPListTrimCommand(s)},
+		"SADD":          {2, -1, newRESPSetAddCommand(s)},
+		"SREM":          {2, -1, newRESPSetRemoveCommand(s)},
+		"SISMEMBER":     {2, 2, newRESPSetIsMemberCommand(s)},
+		"SMEMBERS":      {1, 1, newRESPSetMembersCommand(s)},
+		"SCARD":         {1, 1, newRESPSetLenCommand(s)},
+		"SINTER":        {1, -1, newRESPSetCombineCommand(s.SetIntersect)},
+		"SUNION":        {1, -1, newRESPSetCombineCommand(s.SetUnion)},
+		"SDIFF":         {1, -1, newRESPSetCombineCommand(s.SetDiff)},
+		"ZADD":          {3, -1, newRESPSortedSetAddCommand(s)},
+		"ZREM":          {2, -1, newRESPSortedSetRemoveCommand(s)},
+		"ZSCORE":        {2, 2, newRESPSortedSetScoreCommand(s)},
+		"ZINCRBY":       {3, 3, newRESPSortedSetIncrementByCommand(s)},
+		"ZRANGE":        {3, 4, newRESPSortedSetRangeCommand(s, false)},
+		"ZREVRANGE":     {3, 4, newRESPSortedSetRangeCommand(s, true)},
+		"ZRANK":         {2, 2, newRESPSortedSetRankCommand(s)},
+		"ZCARD":         {1, 1, newRESPSortedSetLenCommand(s)},
+		"ZRANGEBYSCORE": {3, 7, newRESPSortedSetRangeByScoreCommand(s)},
+	}
+}
+
+func respPing(w *respWriter, args []string) {
+	if len(args) == 0 {
+		w.writeSimple("PONG")
+		return
+	}
+	w.writeBulk(args[0])
+}
+
+func respEcho(w *respWriter, args []string) {
+	w.writeBulk(args[0])
+}
+
+// respSelect accepts only default database because jcache has single key space
+func respSelect(w *respWriter, args []string) {
+	if args[0] != "0" {
+		w.writeErrorMessage("ERR DB index is out of range")
+		return
+	}
+	w.writeOk()
+}
+
+// respCommandInfo returns empty commands description which is enough for redis-cli
+func respCommandInfo(w *respWriter, args []string) {
+	w.writeArrayHeader(0)
+}
+
+func newRESPDBSizeCommand(s storage.Storage) func(*respWriter, []string) {
+	return func(w *respWriter, args []string) {
+		w.writeInt(int64(len(s.Keys())))
+	}
+}
+
+func newRESPKeysCommand(s storage.Storage) func(*respWriter, []string) {
+	return func(w *respWriter, args []string) {
+		keys := []string{}
+		for _, key := range s.Keys() {
+			if storage.MatchPattern(args[0], key) {
+				keys = append(keys, key)
+			}
+		}
+		w.writeBulks(keys)
+	}
+}
+
+func newRESPExistsCommand(s storage.Storage) func(*respWriter, []string) {
+	return func(w *respWriter, args []string) {
+		var count int64
+		for _, key := range args {
+			if _, err := s.Get(key); err != storage.KeyNotExistsError {
+				count++
+			}
+		}
+		w.writeInt(count)
+	}
+}
+
+// newRESPExpireCommand sets key ttl in units. Non-positive ttl deletes the key like Redis does.
+func newRESPExpireCommand(s storage.Storage, unit time.Duration) func(*respWriter, []string) {
+	return func(w *respWriter, args []string) {
+		ttl, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			w.writeErrorMessage(respNotIntegerMsg)
+			return
+		}
+		if ttl <= 0 {
+			w.writeBool(s.Delete(args[0]) == nil)
+			return
+		}
+		w.writeBool(s.ExpireAt(args[0], expireTimeAfter(uint64(ttl), unit)) == nil)
+	}
+}
+
+// newRESPExpireAtCommand sets key expiration to Unix timestamp in units. Key expires immediately if timestamp is in the past.
+func newRESPExpireAtCommand(s storage.Storage, unit time.Duration) func(*respWriter, []string) {
+	return func(w *respWriter, args []string) {
+		timestamp, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			w.writeErrorMessage(respNotIntegerMsg)
+			return
+		}
+		if timestamp < 0 {
+			timestamp = 0
+		}
+		w.writeBool(s.ExpireAt(args[0], unixTime(uint64(timestamp), unit)) == nil)
+	}
+}
+
+// newRESPPersistCommand replies 1 if ttl is removed and 0 if key doesn't exist or has no ttl
+func newRESPPersistCommand(s storage.Storage) func(*respWriter, []string) {
+	return func(w *respWriter, args []string) {
+		expireTime, err := s.ExpireTime(args[0])
+		if err != nil || expireTime.IsZero() {
+			w.writeBool(false)
+			return
+		}
+		w.writeBool(s.Persist(args[0]) == nil)
+	}
+}
+
+// newRESPTouchCommand extends expiration of sliding keys and returns number of existing keys
+func newRESPTouchCommand(s storage.Storage) func(*respWriter, []string) {
+	return func(w *respWriter, args []string) {
+		var count int64
+		for _, key := range args {
+			if s.Touch(key) == nil {
+				count++
+			}
+		}
+		w.writeInt(count)
+	}
+}
+
+func newRESPTypeCommand(s storage.Storage) func(*respWriter, []string) {
+	return func(w *respWriter, args []string) {
+		keyType, err := s.Type(args[0])
+		if err != nil {
+			keyType = protocol.TypeNone
+		}
+		w.writeSimple(keyType)
+	}
+}
+
+func newRESPTTLCommand(s storage.Storage, unit time.Duration) func(*respWriter, []string) {
+	return func(w *respWriter, args []string) {
+		ttl, err := keyTTL(s, args[0], unit)
+		if err != nil {
+			w.writeError(err)
+			return
+		}
+		w.writeInt(ttl)
+	}
+}
+
+func newRESPGetCommand(s storage.Storage) func(*respWriter, []string) {
+	return func(w *respWriter, args []string) {
+		value, err := s.Get(args[0])
+		switch err {
+		case nil:
+			w.writeBulk(value)
+		case storage.KeyNotExistsError:
+			w.writeNil()
+		default:
+			w.writeError(err)
+		}
+	}
+}
+
+func newRESPMGetCommand(s storage.Storage) func(*respWriter, []string) {
+	return func(w *respWriter, args []string) {
+		values, errs := s.GetMulti(args)
+		w.writeArrayHeader(len(args))
+		for i, value := range values {
+			if errs[i] == nil {
+				w.writeBulk(value)
+			} else {
+				w.writeNil()
+			}
+		}
+	}
+}
+
+func newRESPMSetCommand(s storage.Storage) func(*respWriter, []string) {
+	return func(w *respWriter, args []string) {
+		if len(args)%2 != 0 {
+			w.writeErrorMessage("ERR wrong number of arguments for 'mset' command")
+			return
+		}
+		var keys, values []string
+		for i := 0; i < len(args); i += 2 {
+			keys = append(keys, args[i])
+			values = append(values, args[i+1])
+		}
+		for _, err := range s.SetMulti(keys, values, 0) {
+			if err != nil {
+				w.writeError(err)
+				return
+			}
+		}
+		w.writeOk()
+	}
+}
+
+// newRESPSetCommand supports SET key value [EX seconds|PX milliseconds|KEEPTTL] [NX|XX] [GET]
+// respSetExpireOptions are SET options followed by relative or absolute expiration
+var respSetExpireOptions = map[string]bool{"EX": true, "PX": true, "EXAT": true, "PXAT": true}
+
+func newRESPSetCommand(s storage.Storage) func(*respWriter, []string) {
+	return func(w *respWriter, args []string) {
+		var hasTTL bool
+		options := storage.SetOptions{Mode: storage.SetAlways}
+		for i := 2; i < len(args); i++ {
+			switch option := strings.ToUpper(args[i]); {
+			case (option == "NX" || option == "XX") && options.Mode == storage.SetAlways:
+				options.Mode = storage.SetIfNotExists
+				if option == "XX" {
+					options.Mode = storage.SetIfExists
+				}
+			case option == "GET":
+				options.Get = true
+			case option == "KEEPTTL" && !hasTTL:
+				options.KeepTTL = true
+			case respSetExpireOptions[option] && !hasTTL && !options.KeepTTL:
+				if i+1 == len(args) {
+					w.writeErrorMessage(respSyntaxMsg)
+					return
+				}
+				i++
+				n, err := strconv.ParseUint(args[i], 10, 64)
+				if err != nil || n == 0 {
+					w.writeErrorMessage("ERR invalid expire time in 'set' command")
+					return
+				}
+				unit := time.Second
+				if option == "PX" || option == "PXAT" {
+					unit = time.Millisecond
+				}
+				if option == "EX" || option == "PX" {
+					options.ExpireTime = expireTimeAfter(n, unit)
+				} else {
+					options.ExpireTime = unixTime(n, unit)
+				}
+				hasTTL = true
+			default:
+				w.writeErrorMessage(respSyntaxMsg)
+				return
+			}
+		}
+
+		old, existed, err := s.SetWithOptions(args[0], args[1], 0, options)
+		switch {
+		case err == storage.KeyAlreadyExistsError || err == storage.KeyNotExistsError:
+			w.writeNil()
+		case err != nil:
+			w.writeError(err)
+		case options.Get && existed:
+			w.writeBulk(old)
+		case options.Get:
+			w.writeNil()
+		default:
+			w.writeOk()
+		}
+	}
+}
+
+// newRESPSetExCommand overwrites key with ttl in units, it serves SETEX and PSETEX
+func newRESPSetExCommand(s storage.Storage, name string, unit time.Duration) func(*respWriter, []string) {
+	return func(w *respWriter, args []string) {
+		ttl, err := strconv.ParseUint(args[1], 10, 64)
+		if err != nil || ttl == 0 {
+			w.writeErrorMessage(fmt.Sprintf("ERR invalid expire time in '%s' command", name))
+			return
+		}
+		options := storage.SetOptions{Mode: storage.SetAlways, ExpireTime: expireTimeAfter(ttl, unit)}
+		if _, _, err := s.SetWithOptions(args[0], args[2], 0, options); err != nil {
+			w.writeError(err)
+			return
+		}
+		w.writeOk()
+	}
+}
+
+func newRESPSetNXCommand(s storage.Storage) func(*respWriter, []string) {
+	return func(w *respWriter, args []string) {
+		err := s.Set(args[0], args[1], 0)
+		switch err {
+		case nil, storage.KeyAlreadyExistsError:
+			w.writeBool(err == nil)
+		default:
+			w.writeError(err)
+		}
+	}
+}
+
+func newRESPIncrCommand(s storage.Storage, delta int64) func(*respWriter, []string) {
+	return func(w *respWriter, args []string) {
+		value, err := s.Increment(args[0], delta, 0)
+		if err != nil {
+			w.writeError(err)
+			return
+		}
+		w.writeInt(value)
+	}
+}
+
+// newRESPIncrByCommand multiplies parsed delta by sign, so DECRBY is INCRBY with negated delta
+func newRESPIncrByCommand(s storage.Storage, sign int64) func(*respWriter, []string) {
+	return func(w *respWriter, args []string) {
+		delta, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil || (sign < 0 && delta == math.MinInt64) {
+			w.writeErrorMessage(respNotIntegerMsg)
+			return
+		}
+		newRESPIncrCommand(s, sign*delta)(w, args)
+	}
+}
+
+func newRESPDelCommand(s storage.Storage) func(*respWriter, []string) {
+	return func(w *respWriter, args []string) {
+		var count int64
+		for _, err := range s.DeleteMulti(args) {
+			if err == nil {
+				count++
+			}
+		}
+		w.writeInt(count)
+	}
+}
+
+// newRESPHashSetCommand sets hash fields at once and returns number of added fields.
+// HMSET is the same command which replies OK instead of number.
+func newRESPHashSetCommand(s storage.Storage, name string, replyOk bool) func(*respWriter, []string) {
+	return func(w *respWriter, args []string) {
+		if len(args)%2 != 1 {
+			w.writeErrorMessage(fmt.Sprintf("ERR wrong number of arguments for '%s' command", name))
+			return
+		}
+		var fields, values []string
+		for i := 1; i < len(args); i += 2 {
+			fields = append(fields, args[i])
+			values = append(values, args[i+1])
+		}
+		added, err := s.HashSetMulti(args[0], fields, values)
+		switch {
+		case err != nil:
+			w.writeError(err)
+		case replyOk:
+			w.writeOk()
+		default:
+			w.writeInt(int64(added))
+		}
+	}
+}
+
+// newRESPHashGetMultiCommand replies nil for missing fields, all fields are missing if key doesn't exist
+func newRESPHashGetMultiCommand(s storage.Storage) func(*respWriter, []string) {
+	return func(w *respWriter, args []string) {
+		values, errs := s.HashGetMulti(args[0], args[1:])
+		for _, err := range errs {
+			if err != nil && err != storage.KeyNotExistsError && err != storage.FieldNotExistError {
+				w.writeError(err)
+				return
+			}
+		}
+		w.writeArrayHeader(len(values))
+		for i, value := range values {
+			if errs[i] == nil {
+				w.writeBulk(value)
+			} else {
+				w.writeNil()
+			}
+		}
+	}
+}
+
+func newRESPHashIncrementByCommand(s storage.Storage) func(*respWriter, []string) {
+	return func(w *respWriter, args []string) {
+		delta, err := strconv.ParseInt(args[2], 10, 64)
+		if err != nil {
+			w.writeErrorMessage(respNotIntegerMsg)
+			return
+		}
+		value, err := s.HashIncrementBy(args[0], args[1], delta)
+		switch err {
+		case nil:
+			w.writeInt(value)
+		case storage.NotIntegerError:
+			w.writeErrorMessage("ERR hash value is not an integer")
+		default:
+			w.writeError(err)
+		}
+	}
+}
+
+func newRESPHashSetIfNotExistsCommand(s storage.Storage) func(*respWriter, []string) {
+	return func(w *respWriter, args []string) {
+		set, err := s.HashSetIfNotExists(args[0], args[1], args[2])
+		if err != nil {
+			w.writeError(err)
+			return
+		}
+		w.writeBool(set)
+	}
+}
+
+func newRESPHashGetCommand(s storage.Storage) func(*respWriter, []string) {
+	return func(w *respWriter, args []string) {
+		value, err := s.HashGet(args[0], args[1])
+		switch err {
+		case nil:
+			w.writeBulk(value)
+		case storage.KeyNotExistsError, storage.FieldNotExistError:
+			w.writeNil()
+		default:
+			w.writeError(err)
+		}
+	}
+}
+
+func newRESPHashDelCommand(s storage.Storage) func(*respWriter, []string) {
+	return func(w *respWriter, args []string) {
+		var count int64
+		for _, field := range args[1:] {
+			err := s.HashDelete(args[0], field)
+			switch err {
+			case nil:
+				count++
+			case storage.KeyNotExistsError, storage.FieldNotExistError:
+			default:
+				w.writeError(err)
+				return
+			}
+		}
+		w.writeInt(count)
+	}
+}
+
+func newRESPHashExistsCommand(s storage.Storage) func(*respWriter, []string) {
+	return func(w *respWriter, args []string) {
+		found, err := s.HashExists(args[0], args[1])
+		if err != nil && err != storage.KeyNotExistsError {
+			w.writeError(err)
+			return
+		}
+		w.writeBool(found)
+	}
+}
+
+// newRESPHashExpireCommand sets TTL of every field and returns array of results: 1 if TTL is set,
+// 2 if field is deleted by zero TTL and -2 if field doesn't exist. Conditional options are not supported.
+func newRESPHashExpireCommand(s storage.Storage) func(*respWriter, []string) {
+	return func(w *respWriter, args []string) {
+		ttl, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil || ttl < 0 {
+			w.writeErrorMessage(respNotIntegerMsg)
+			return
+		}
+		fields, ok := parseRESPFields(w, args[2:])
+		if !ok {
+			return
+		}
+		writeRESPFieldResults(w, fields, func(field string) (int64, error) {
+			if ttl == 0 {
+				return 2, s.HashDelete(args[0], field)
+			}
+			return 1, s.HashExpireAt(args[0], field, expireTimeAfter(uint64(ttl), time.Second))
+		})
+	}
+}
+
+// newRESPHashTTLCommand returns array of remaining TTLs of fields, see remainingTTL
+func newRESPHashTTLCommand(s storage.Storage) func(*respWriter, []string) {
+	return func(w *respWriter, args []string) {
+		fields, ok := parseRESPFields(w, args[1:])
+		if !ok {
+			return
+		}
+		writeRESPFieldResults(w, fields, func(field string) (int64, error) {
+			expireTime, err := s.HashExpireTime(args[0], field)
+			return remainingTTL(expireTime, err, time.Second)
+		})
+	}
+}
+
+// newRESPHashPersistCommand removes TTL of every field and returns array of results:
+// 1 if TTL is removed, -1 if field has no TTL and -2 if field doesn't exist
+func newRESPHashPersistCommand(s storage.Storage) func(*respWriter, []string) {
+	return func(w *respWriter, args []string) {
+		fields, ok := parseRESPFields(w, args[1:])
+		if !ok {
+			return
+		}
+		writeRESPFieldResults(w, fields, func(field string) (int64, error) {
+			expireTime, err := s.HashExpireTime(args[0], field)
+			if err != nil || expireTime.IsZero() {
+				return protocol.TTLNoExpire, err
+			}
+			return 1, s.HashPersist(args[0], field)
+		})
+	}
+}
+
+// parseRESPFields parses "FIELDS numfields field [field ...]" arguments of hash field expiration commands
+func parseRESPFields(w *respWriter, args []string) ([]string, bool) {
+	if strings.ToUpper(args[0]) != "FIELDS" || len(args) < 2 {
+		w.writeErrorMessage(respFieldsMsg)
+		return nil, false
+	}
+	count, err := strconv.Atoi(args[1])
+	if err != nil || count <= 0 || count != len(args)-2 {
+		w.writeErrorMessage(respNumFieldsMsg)
+		return nil, false
+	}
+	return args[2:], true
+}
+
+// writeRESPFieldResults writes array of results of fn called for every field.
+// Missing key or field is reported by protocol.TTLNotExists, other errors fail the whole command.
+func writeRESPFieldResults(w *respWriter, fields []string, fn func(field string) (int64, error)) {
+	results := make([]int64, len(fields))
+	for i, field := range fields {
+		result, err := fn(field)
+		switch err {
+		case nil:
+			results[i] = result
+		case storage.KeyNotExistsError, storage.FieldNotExistError:
+			results[i] = protocol.TTLNotExists
+		default:
+			w.writeError(err)
+			return
+		}
+	}
+	w.writeArrayHeader(len(results))
+	for _, result := range results {
+		w.writeInt(result)
+	}
+}
+
+func newRESPHashGetAllCommand(s storage.Storage) func(*respWriter, []string) {
+	return func(w *respWriter, args []string) {
+		fields, err := s.HashGetAll(args[0])
+		if err != nil && err != storage.KeyNotExistsError {
+			w.writeError(err)
+			return
+		}
+		w.writeArrayHeader(len(fields) * 2)
+		for field, value := range fields {
+			w.writeBulk(field)
+			w.writeBulk(value)
+		}
+	}
+}
+
+func newRESPHashKeysCommand(s storage.Storage) func(*respWriter, []string) {
+	return func(w *respWriter, args []string) {
+		keys, err := s.HashKeys(args[0])
+		if err != nil && err != storage.KeyNotExistsError {
+			w.writeError(err)
+			return
+		}
+		w.writeBulks(keys)
+	}
+}
+
+func newRESPHashValuesCommand(s storage.Storage) func(*respWriter, []string) {
+	return func(w *respWriter, args []string) {
+		fields, err := s.HashGetAll(args[0])
+		if err != nil && err != storage.KeyNotExistsError {
+			w.writeError(err)
+			return
+		}
+		w.writeArrayHeader(len(fields))
+		for _, value := range fields {
+			w.writeBulk(value)
+		}
+	}
+}
+
+func newRESPHashLenCommand(s storage.Storage) func(*respWriter, []string) {
+	return func(w *respWriter, args []string) {
+		length, err := s.HashLen(args[0])
+		if err != nil && err != storage.KeyNotExistsError {
+			w.writeError(err)
+			return
+		}
+		w.writeInt(int64(length))
+	}
+}
+
+// newRESPListPushCommand pushes all values one by one and returns new list length
+func newRESPListPushCommand(s storage.Storage, push func(key, value string) error) func(*respWriter, []string) {
+	return func(w *respWriter, args []string) {
+		for _, value := range args[1:] {
+			if err := push(args[0], value); err != nil {
+				w.writeError(err)
+				return
+			}
+		}
+		length, err := s.ListLen(args[0])
+		if err != nil {
+			w.writeError(err)
+			return
+		}
+		w.writeInt(int64(length))
+	}
+}
+
+func newRESPListPopCommand(pop func(key string) (string, error)) func(*respWriter, []string) {
+	return func(w *respWriter, args []string) {
+		value, err := pop(args[0])
+		switch err {
+		case nil:
+			w.writeBulk(value)
+		case storage.KeyNotExistsError, storage.ListEmptyError:
+			w.writeNil()
+		default:
+			w.writeError(err)
+		}
+	}
+}
+
+// newRESPListBlockingPopCommand replies with key and popped value or with null array on timeout.
+// The last argument is timeout in seconds, it may be fractional.
+func newRESPListBlockingPopCommand(pop func(keys []string, timeout time.Duration) (string, string, error)) func(*respWriter, []string) {
+	return func(w *respWriter, args []string) {
+		timeout, ok := parseRESPTimeout(w, args[len(args)-1])
+		if !ok {
+			return
+		}
+
+		key, value, err := pop(args[:len(args)-1], timeout)
+		switch err {
+		case nil:
+			w.writeArrayHeader(2)
+			w.writeBulk(key)
+			w.writeBulk(value)
+		case storage.ListEmptyError:
+			w.writeNilArray()
+		default:
+			w.writeError(err)
+		}
+	}
+}
+
+// newRESPListMoveCommand supports LMOVE and BLMOVE which ends are passed as arguments, and RPOPLPUSH and
+// BRPOPLPUSH which move value from the source ending to the destination beginning.
+// Blocking commands reply with null array on timeout.
+func newRESPListMoveCommand(s storage.Storage, withEnds, blocking bool) func(*respWriter, []string) {
+	return func(w *respWriter, args []string) {
+		fromLeft, toLeft := false, true
+		if withEnds {
+			var fromOk, toOk bool
+			fromLeft, fromOk = parseRESPListEnd(args[2])
+			toLeft, toOk = parseRESPListEnd(args[3])
+			if !fromOk || !toOk {
+				w.writeErrorMessage(respSyntaxMsg)
+				return
+			}
+		}
+
+		var value string
+		var err error
+		if blocking {
+			timeout, ok := parseRESPTimeout(w, args[len(args)-1])
+			if !ok {
+				return
+			}
+			value, err = s.ListBlockingMove(args[0], args[1], fromLeft, toLeft, timeout)
+		} else {
+			value, err = s.ListMove(args[0], args[1], fromLeft, toLeft)
+		}
+		switch {
+		case err == nil:
+			w.writeBulk(value)
+		case blocking && err == storage.ListEmptyError:
+			w.writeNilArray()
+		case err == storage.KeyNotExistsError, err == storage.ListEmptyError:
+			w.writeNil()
+		default:
+			w.writeError(err)
+		}
+	}
+}
+
+// parseRESPListEnd parses LEFT or RIGHT case-insensitively and reports whether end is LEFT
+func parseRESPListEnd(end string) (left, ok bool) {
+	switch strings.ToUpper(end) {
+	case protocol.ListLeft:
+		return true, true
+	case protocol.ListRight:
+		return false, true
+	}
+	return false, false
+}
+
+// parseRESPTimeout parses timeout of blocking command in seconds and writes error reply if timeout is not valid.
+// Timeout is rounded up to milliseconds, so small positive timeout doesn't mean waiting forever.
+func parseRESPTimeout(w *respWriter, value string) (time.Duration, bool) {
+	seconds, err := strconv.ParseFloat(value, 64)
+	if err != nil || math.IsNaN(seconds) || math.IsInf(seconds, 0) {
+		w.writeErrorMessage(respTimeoutMsg)
+		return 0, false
+	}
+	if seconds < 0 {
+		w.writeErrorMessage(respNegTimeoutMsg)
+		return 0, false
+	}
+	var timeout time.Duration
+	if seconds < float64(math.MaxInt64/int64(time.Second)) {
+		timeout = time.Duration(math.Ceil(seconds*1000)) * time.Millisecond
+	}
+	return timeout, true
+}
+
+func newRESPListLenCommand(s storage.Storage) func(*respWriter, []string) {
+	return func(w *respWriter, args []string) {
+		length, err := s.ListLen(args[0])
+		if err != nil && err != storage.KeyNotExistsError {
+			w.writeError(err)
+			return
+		}
+		w.writeInt(int64(length))
+	}
+}
+
+// newRESPListRangeCommand supports negative indexes which are counted from the list ending
+func newRESPListRangeCommand(s storage.Storage) func(*respWriter, []string) {
+	return func(w *respWriter, args []string) {
+		start, startErr := strconv.Atoi(args[1])
+		stop, stopErr := strconv.Atoi(args[2])
+		if startErr != nil || stopErr != nil {
+			w.writeErrorMessage(respNotIntegerMsg)
+			return
+		}
+
+		values, err := s.ListRange(args[0], start, stop)
+		if err != nil && err != storage.KeyNotExistsError {
+			w.writeError(err)
+			return
+		}
+		w.writeBulks(values)
+	}
+}
+
+func newRESPListIndexCommand(s storage.Storage) func(*respWriter, []string) {
+	return func(w *respWriter, args []string) {
+		index, err := strconv.Atoi(args[1])
+		if err != nil {
+			w.writeErrorMessage(respNotIntegerMsg)
+			return
+		}
+
+		value, err := s.ListIndex(args[0], index)
+		switch err {
+		case nil:
+			w.writeBulk(value)
+		case storage.KeyNotExistsError, storage.IndexOutOfRangeError:
+			w.writeNil()
+		default:
+			w.writeError(err)
+		}
+	}
+}
+
+func newRESPListSetCommand(s storage.Storage) func(*respWriter, []string) {
+	return func(w *respWriter, args []string) {
+		index, err := strconv.Atoi(args[1])
+		if err != nil {
+			w.writeErrorMessage(respNotIntegerMsg)
+			return
+		}
+
+		switch err := s.ListSet(args[0], index, args[2]); err {
+		case nil:
+			w.writeOk()
+		case storage.KeyNotExistsError:
+			w.writeErrorMessage(respNoSuchKeyMsg)
+		case storage.IndexOutOfRangeError:
+			w.writeErrorMessage(respIndexMsg)
+		default:
+			w.writeError(err)
+		}
+	}
+}
+
+// newRESPListInsertCommand returns 0 if key doesn't exist and -1 if pivot doesn't exist as Redis does
+func newRESPListInsertCommand(s storage.Storage) func(*respWriter, []string) {
+	return func(w *respWriter, args []string) {
+		var before bool
+		switch strings.ToUpper(args[1]) {
+		case protocol.ListBefore:
+			before = true
+		case protocol.ListAfter:
+		default:
+			w.writeErrorMessage(respSyntaxMsg)
+			return
+		}
+
+		length, err := s.ListInsert(args[0], args[2], args[3], before)
+		switch err {
+		case nil:
+			w.writeInt(int64(length))
+		case storage.KeyNotExistsError:
+			w.writeInt(0)
+		case storage.PivotNotExistError:
+			w.writeInt(-1)
+		default:
+			w.writeError(err)
+		}
+	}
+}
+
+func newRESPListRemoveCommand(s storage.Storage) func(*respWriter, []string) {
+	return func(w *respWriter, args []string) {
+		count, err := strconv.Atoi(args[1])
+		if err != nil {
+			w.writeErrorMessage(respNotIntegerMsg)
+			return
+		}
+
+		removed, err := s.ListRemove(args[0], count, args[2])
+		if err != nil && err != storage.KeyNotExistsError {
+			w.writeError(err)
+			return
+		}
+		w.writeInt(int64(removed))
+	}
+}
+
+func newRESPListTrimCommand(s storage.Storage) func(*respWriter, []string) {
+	return func(w *respWriter, args []string) {
+		start, startErr := strconv.Atoi(args[1])
+		stop, stopErr := strconv.Atoi(args[2])
+		if startErr != nil || stopErr != nil {
+			w.writeErrorMessage(respNotIntegerMsg)
+			return
+		}
+
+		if err := s.ListTrim(args[0], start, stop); err != nil && err != storage.KeyNotExistsError {
+			w.writeError(err)
+			return
+		}
+		w.writeOk()
+	}
+}
+
+func newRESPSetAddCommand(s storage.Storage) func(*respWriter, []string) {
+	return func(w *respWriter, args []string) {
+		added, err := s.SetAdd(args[0], args[1:])
+		if err != nil {
+			w.writeError(err)
+			return
+		}
+		w.writeInt(int64(added))
+	}
+}
+
+func newRESPSetRemoveCommand(s storage.Storage) func(*respWriter, []string) {
+	return func(w *respWriter, args []string) {
+		removed, err := s.SetRemove(args[0], args[1:])
+		if err != nil && err != storage.KeyNotExistsError {
+			w.writeError(err)
+			return
+		}
+		w.writeInt(int64(removed))
+	}
+}
+
+func newRESPSetIsMemberCommand(s storage.Storage) func(*respWriter, []string) {
+	return func(w *respWriter, args []string) {
+		found, err := s.SetIsMember(args[0], args[1])
+		if err != nil && err != storage.KeyNotExistsError {
+			w.writeError(err)
+			return
+		}
+		w.writeBool(found)
+	}
+}
+
+func newRESPSetMembersCommand(s storage.Storage) func(*respWriter, []string) {
+	return func(w *respWriter, args []string) {
+		members, err := s.SetMembers(args[0])
+		if err != nil && err != storage.KeyNotExistsError {
+			w.writeError(err)
+			return
+		}
+		w.writeBulks(members)
+	}
+}
+
+func newRESPSetLenCommand(s storage.Storage) func(*respWriter, []string) {
+	return func(w *respWriter, args []string) {
+		length, err := s.SetLen(args[0])
+		if err != nil && err != storage.KeyNotExistsError {
+			w.writeError(err)
+			return
+		}
+		w.writeInt(int64(length))
+	}
+}
+
+// newRESPSetCombineCommand runs one of SINTER, SUNION and SDIFF on all argument keys
+func newRESPSetCombineCommand(combine func(keys []string) ([]string, error)) func(*respWriter, []string) {
+	return func(w *respWriter, args []string) {
+		members, err := combine(args)
+		if err != nil {
+			w.writeError(err)
+			return
+		}
+		w.writeBulks(members)
+	}
+}
+
+func newRESPSortedSetAddCommand(s storage.Storage) func(*respWriter, []string) {
+	return func(w *respWriter, args []string) {
+		if len(args)%2 == 0 {
+			w.writeErrorMessage(respSyntaxMsg)
+			return
+		}
+		var members []storage.ScoredMember
+		for i := 1; i < len(args); i += 2 {
+			score, err := parseRESPScore(args[i])
+			if err != nil {
+				w.writeErrorMessage(respNotFloatMsg)
+				return
+			}
+			members = append(members, storage.ScoredMember{Member: args[i+1], Score: score})
+		}
+		added, err := s.SortedSetAdd(args[0], members)
+		if err != nil {
+			w.writeError(err)
+			return
+		}
+		w.writeInt(int64(added))
+	}
+}
+
+func newRESPSortedSetRemoveCommand(s storage.Storage) func(*respWriter, []string) {
+	return func(w *respWriter, args []string) {
+		removed, err := s.SortedSetRemove(args[0], args[1:])
+		if err != nil && err != storage.KeyNotExistsError {
+			w.writeError(err)
+			return
+		}
+		w.writeInt(int64(removed))
+	}
+}
+
+func newRESPSortedSetScoreCommand(s storage.Storage) func(*respWriter, []string) {
+	return func(w *respWriter, args []string) {
+		score, err := s.SortedSetScore(args[0], args[1])
+		switch err {
+		case nil:
+			w.writeBulk(formatRESPScore(score))
+		case storage.KeyNotExistsError, storage.MemberNotExistError:
+			w.writeNil()
+		default:
+			w.writeError(err)
+		}
+	}
+}
+
+func newRESPSortedSetIncrementByCommand(s storage.Storage) func(*respWriter, []string) {
+	return func(w *respWriter, args []string) {
+		delta, err := parseRESPScore(args[1])
+		if err != nil {
+			w.writeErrorMessage(respNotFloatMsg)
+			return
+		}
+		score, err := s.SortedSetIncrementBy(args[0], args[2], delta)
+		if err != nil {
+			w.writeError(err)
+			return
+		}
+		w.writeBulk(formatRESPScore(score))
+	}
+}
+
+// newRESPSortedSetRangeCommand supports WITHSCORES option, scores are written after their members
+func newRESPSortedSetRangeCommand(s storage.Storage, reverse bool) func(*respWriter, []string) {
+	return func(w *respWriter, args []string) {
+		start, startErr := strconv.Atoi(args[1])
+		stop, stopErr := strconv.Atoi(args[2])
+		if startErr != nil || stopErr != nil {
+			w.writeErrorMessage(respNotIntegerMsg)
+			return
+		}
+		withScores := len(args) == 4
+		if withScores && strings.ToUpper(args[3]) != "WITHSCORES" {
+			w.writeErrorMessage(respSyntaxMsg)
+			return
+		}
+		members, err := s.SortedSetRange(args[0], start, stop, reverse)
+		if err != nil && err != storage.KeyNotExistsError {
+			w.writeError(err)
+			return
+		}
+		w.writeScoredMembers(members, withScores)
+	}
+}
+
+// newRESPSortedSetRangeByScoreCommand supports exclusive bounds prefixed by "(", WITHSCORES and LIMIT options
+func newRESPSortedSetRangeByScoreCommand(s storage.Storage) func(*respWriter, []string) {
+	return func(w *respWriter, args []string) {
+		min, minErr := parseRESPScoreBound(args[1], math.Inf(1))
+		max, maxErr := parseRESPScoreBound(args[2], math.Inf(-1))
+		if minErr != nil || maxErr != nil {
+			w.writeErrorMessage(respMinMaxMsg)
+			return
+		}
+		withScores, offset, count := false, 0, -1
+		for i := 3; i < len(args); i++ {
+			switch strings.ToUpper(args[i]) {
+			case "WITHSCORES":
+				withScores = true
+			case "LIMIT":
+				if i+2 >= len(args) {
+					w.writeErrorMessage(respSyntaxMsg)
+					return
+				}
+				var offsetErr, countErr error
+				offset, offsetErr = strconv.Atoi(args[i+1])
+				count, countErr = strconv.Atoi(args[i+2])
+				if offsetErr != nil || countErr != nil {
+					w.writeErrorMessage(respNotIntegerMsg)
+					return
+				}
+				i += 2
+			default:
+				w.writeErrorMessage(respSyntaxMsg)
+				return
+			}
+		}
+		members, err := s.SortedSetRangeByScore(args[0], min, max, offset, count)
+		if err != nil && err != storage.KeyNotExistsError {
+			w.writeError(err)
+			return
+		}
+		w.writeScoredMembers(members, withScores)
+	}
+}
+
+func newRESPSortedSetRankCommand(s storage.Storage) func(*respWriter, []string) {
+	return func(w *respWriter, args []string) {
+		rank, err := s.SortedSetRank(args[0], args[1])
+		switch err {
+		case nil:
+			w.writeInt(int64(rank))
+		case storage.KeyNotExistsError, storage.MemberNotExistError:
+			w.writeNil()
+		default:
+			w.writeError(err)
+		}
+	}
+}
+
+func newRESPSortedSetLenCommand(s storage.Storage) func(*respWriter, []string) {
+	return func(w *respWriter, args []string) {
+		length, err := s.SortedSetLen(args[0])
+		if err != nil && err != storage.KeyNotExistsError {
+			w.writeError(err)
+			return
+		}
+		w.writeInt(int64(length))
+	}
+}
+
+// parseRESPScore parses score like Redis: infinities are written as inf, +inf and -inf, NaN is not allowed
+func parseRESPScore(value string) (float64, error) {
+	score, err := strconv.ParseFloat(value, 64)
+	if err == nil && math.IsNaN(score) {
+		err = strconv.ErrSyntax
+	}
+	return score, err
+}
+
+// parseRESPScoreBound parses inclusive bound or exclusive one prefixed by "(".
+// Exclusive bound is replaced by the closest float towards direction, so range stays inclusive.
+func parseRESPScoreBound(value string, direction float64) (float64, error) {
+	if !strings.HasPrefix(value, "(") {
+		return parseRESPScore(value)
+	}
+	score, err := parseRESPScore(value[1:])
+	if err != nil || math.IsInf(score, 0) {
+		return score, err
+	}
+	return math.Nextafter(score, direction), nil
+}
+
+func formatRESPScore(score float64) string {
+	switch {
+	case math.IsInf(score, 1):
+		return "inf"
+	case math.IsInf(score, -1):
+		return "-inf"
+	}
+	return strconv.FormatFloat(score, 'g', -1, 64)
+}
@@ -0,0 +1,123 @@
+package server
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+
+	"github.com/Barberrrry/jcache/server/htpasswd"
+)
+
+type respSession struct {
+	id             string
+	rwc            io.ReadWriteCloser
+	reader         *bufio.Reader
+	writer         *respWriter
+	serverCommands map[string]respCommand
+	htpasswdFile   *htpasswd.HtpasswdFile
+	isAuthorized   bool
+	isClosed       bool
+	logger         *log.Logger
+}
+
+func newRESPSession(id string, rwc io.ReadWriteCloser, commands map[string]respCommand, htpasswdFile *htpasswd.HtpasswdFile, logger *log.Logger) *respSession {
+	return &respSession{
+		id:             id,
+		rwc:            rwc,
+		reader:         bufio.NewReader(rwc),
+		writer:         &respWriter{Writer: bufio.NewWriter(rwc)},
+		serverCommands: commands,
+		htpasswdFile:   htpasswdFile,
+		logger:         logger,
+	}
+}
+
+func (s *respSession) start() {
+	defer s.rwc.Close()
+
+	s.log("open RESP session")
+	defer s.log("close RESP session")
+
+	for !s.isClosed {
+		// Replies are flushed only when all pipelined commands are processed
+		if s.reader.Buffered() == 0 {
+			if err := s.writer.Flush(); err != nil {
+				s.log(fmt.Sprintf("write error: %s", err))
+				return
+			}
+		}
+
+		args, err := readRESPCommand(s.reader)
+		if err == respProtocolError {
+			s.writer.writeErrorMessage(fmt.Sprintf("ERR %s", err))
+			s.writer.Flush()
+			return
+		}
+		if err != nil {
+			s.log(fmt.Sprintf("read error: %s", err))
+			return
+		}
+		if len(args) == 0 {
+			continue
+		}
+
+		s.log(fmt.Sprintf("command: %s", args[0]))
+		s.execute(strings.ToUpper(args[0]), args[1:])
+	}
+	s.writer.Flush()
+}
+
+func (s *respSession) execute(name string, args []string) {
+	switch name {
+	case "AUTH":
+		s.auth(args)
+		return
+	case "QUIT":
+		s.writer.writeOk()
+		s.isClosed = true
+		return
+	}
+
+	command, found := s.serverCommands[name]
+	if !found {
+		s.writer.writeErrorMessage(fmt.Sprintf("ERR unknown command '%s'", name))
+		return
+	}
+	if s.htpasswdFile != nil && !s.isAuthorized {
+		s.writer.writeErrorMessage("NOAUTH Authentication required.")
+		return
+	}
+	if !command.checkArity(len(args)) {
+		s.writer.writeErrorMessage(fmt.Sprintf("ERR wrong number of arguments for '%s' command", strings.ToLower(name)))
+		return
+	}
+	command.run(s.writer, args)
+}
+
+// auth supports both AUTH <password> for "default" user and AUTH <user> <password> forms
+func (s *respSession) auth(args []string) {
+	var user, password string
+	switch len(args) {
+	case 1:
+		user, password = "default", args[0]
+	case 2:
+		user, password = args[0], args[1]
+	default:
+		s.writer.writeErrorMessage("ERR wrong number of arguments for 'auth' command")
+		return
+	}
+
+	if s.htpasswdFile == nil || s.htpasswdFile.Validate(user, password) {
+		s.isAuthorized = true
+		s.log("successful authentication")
+		s.writer.writeOk()
+		return
+	}
+	s.writer.writeErrorMessage("WRONGPASS invalid username-password pair")
+}
+
+func (s *respSession) log(message string) {
+	s.logger.Printf("[%s] %s", s.id, message)
+}
@@ -0,0 +1,211 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"log"
+	"time"
+
+	"github.com/Barberrrry/jcache/server/htpasswd"
+	"github.com/Barberrrry/jcache/server/storage/memory"
+	. "gopkg.in/check.v1"
+)
+
+type RESPTestSuite struct{}
+
+var _ = Suite(&RESPTestSuite{})
+
+func (s *RESPTestSuite) TestReadCommand(c *C) {
+	reader := bufio.NewReader(bytes.NewBufferString("*2\r\n$3\r\nGET\r\n$5\r\nk\r\ney\r\nPING hello\r\n"))
+
+	args, err := readRESPCommand(reader)
+	c.Assert(err, IsNil)
+	c.Assert(args, DeepEquals, []string{"GET", "k\r\ney"})
+
+	args, err = readRESPCommand(reader)
+	c.Assert(err, IsNil)
+	c.Assert(args, DeepEquals, []string{"PING", "hello"})
+}
+
+func (s *RESPTestSuite) TestReadCommandError(c *C) {
+	for _, str := range []string{"*1\r\n+GET\r\n", "*1\r\n$-1\r\n", "*1\r\n$3\r\nGETX\r\n", "*x\r\n", "*-5\r\n", "*-2\r\n"} {
+		_, err := readRESPCommand(bufio.NewReader(bytes.NewBufferString(str)))
+		c.Assert(err, ErrorMatches, "Protocol error")
+	}
+}
+
+func (s *RESPTestSuite) TestReadEmptyCommand(c *C) {
+	for _, str := range []string{"*-1\r\n", "*0\r\n"} {
+		args, err := readRESPCommand(bufio.NewReader(bytes.NewBufferString(str)))
+		c.Assert(err, IsNil)
+		c.Assert(args, HasLen, 0)
+	}
+}
+
+func (s *RESPTestSuite) TestCommands(c *C) {
+	storage, _ := memory.NewStorage(100, time.Minute)
+	commands := newRESPCommands(storage)
+
+	conn := newTestConn()
+	go newRESPSession("test", conn, commands, nil, log.New(&bytes.Buffer{}, "", 0)).start()
+
+	reader := bufio.NewReader(conn.outReader)
+	for _, t := range []struct {
+		request  string
+		response string
+	}{
+		{"PING\r\n", "+PONG\r\n"},
+		{"*2\r\n$3\r\nGET\r\n$3\r\nkey\r\n", "$-1\r\n"},
+		{"*3\r\n$3\r\nSET\r\n$3\r\nkey\r\n$5\r\nvalue\r\n", "+OK\r\n"},
+		{"*3\r\n$3\r\nSET\r\n$3\r\nkey\r\n$6\r\nvalue2\r\n", "+OK\r\n"},
+		{"GET key\r\n", "$6\r\nvalue2\r\n"},
+		{"SET key value NX\r\n", "$-1\r\n"},
+		{"SET key value3 XX GET KEEPTTL\r\n", "$6\r\nvalue2\r\n"},
+		{"SET missing value XX\r\n", "$-1\r\n"},
+		{"SET key value EX 10 KEEPTTL\r\n", "-ERR syntax error\r\n"},
+		{"HSET hash field value\r\n", ":1\r\n"},
+		{"HGET hash field\r\n", "$5\r\nvalue\r\n"},
+		{"HMSET hash a 1 b 2\r\n", "+OK\r\n"},
+		{"HMGET hash a missing\r\n", "*2\r\n$1\r\n1\r\n$-1\r\n"},
+		{"HINCRBY hash a 5\r\n", ":6\r\n"},
+		{"HINCRBY hash field 1\r\n", "-ERR hash value is not an integer\r\n"},
+		{"HSETNX hash a z\r\n", ":0\r\n"},
+		{"HEXISTS hash b\r\n", ":1\r\n"},
+		{"HEXPIRE hash 100 FIELDS 2 a missing\r\n", "*2\r\n:1\r\n:-2\r\n"},
+		{"HTTL hash FIELDS 3 a b missing\r\n", "*3\r\n:100\r\n:-1\r\n:-2\r\n"},
+		{"HPERSIST hash FIELDS 2 a b\r\n", "*2\r\n:1\r\n:-1\r\n"},
+		{"HEXPIRE hash 0 FIELDS 1 b\r\n", "*1\r\n:2\r\n"},
+		{"HEXISTS hash b\r\n", ":0\r\n"},
+		{"HTTL hash FIELDS 2 a\r\n", "-ERR The `numfields` parameter must match the number of arguments\r\n"},
+		{"HTTL hash a b\r\n", "-ERR Mandatory argument FIELDS is missing or not at the right position\r\n"},
+		{"HTTL key FIELDS 1 a\r\n", "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"},
+		{"GET hash\r\n", "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"},
+		{"RPUSH list a b c\r\n", ":3\r\n"},
+		{"LRANGE list -2 -1\r\n", "*2\r\n$1\r\nb\r\n$1\r\nc\r\n"},
+		{"LPOP list\r\n", "$1\r\na\r\n"},
+		{"BRPOP empty list 1\r\n", "*2\r\n$4\r\nlist\r\n$1\r\nc\r\n"},
+		{"BLPOP empty 0.01\r\n", "*-1\r\n"},
+		{"BLPOP list -1\r\n", "-ERR timeout is negative\r\n"},
+		{"BLPOP list abc\r\n", "-ERR timeout is not a float or out of range\r\n"},
+		{"BLPOP hash 1\r\n", "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"},
+		{"RPUSH list d\r\n", ":2\r\n"},
+		{"LMOVE list queue LEFT RIGHT\r\n", "$1\r\nb\r\n"},
+		{"RPOPLPUSH list queue\r\n", "$1\r\nd\r\n"},
+		{"RPOPLPUSH list queue\r\n", "$-1\r\n"},
+		{"BLMOVE empty queue left left 0.01\r\n", "*-1\r\n"},
+		{"LMOVE queue list UP LEFT\r\n", "-ERR syntax error\r\n"},
+		{"LMOVE queue hash LEFT LEFT\r\n", "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"},
+		{"BRPOPLPUSH queue list 1\r\n", "$1\r\nb\r\n"},
+		{"RPUSH log a b c d\r\n", ":4\r\n"},
+		{"LTRIM log -3 -1\r\n", "+OK\r\n"},
+		{"LINDEX log -1\r\n", "$1\r\nd\r\n"},
+		{"LINDEX log 10\r\n", "$-1\r\n"},
+		{"LSET log 0 x\r\n", "+OK\r\n"},
+		{"LSET log 10 x\r\n", "-ERR index out of range\r\n"},
+		{"LSET missing 0 x\r\n", "-ERR no such key\r\n"},
+		{"LINSERT log BEFORE c y\r\n", ":4\r\n"},
+		{"LINSERT log after unknown z\r\n", ":-1\r\n"},
+		{"LINSERT missing BEFORE c y\r\n", ":0\r\n"},
+		{"LINSERT log UNDER c y\r\n", "-ERR syntax error\r\n"},
+		{"LREM log 0 x\r\n", ":1\r\n"},
+		{"LRANGE log 0 -1\r\n", "*3\r\n$1\r\ny\r\n$1\r\nc\r\n$1\r\nd\r\n"},
+		{"LTRIM missing 0 1\r\n", "+OK\r\n"},
+		{"LRANGE missing 0 -1\r\n", "*0\r\n"},
+		{"SADD set a b a\r\n", ":2\r\n"},
+		{"SADD other b c\r\n", ":2\r\n"},
+		{"SISMEMBER set a\r\n", ":1\r\n"},
+		{"SISMEMBER unknown a\r\n", ":0\r\n"},
+		{"SINTER set other\r\n", "*1\r\n$1\r\nb\r\n"},
+		{"SUNION set other unknown\r\n", "*3\r\n$1\r\na\r\n$1\r\nb\r\n$1\r\nc\r\n"},
+		{"SDIFF set other\r\n", "*1\r\n$1\r\na\r\n"},
+		{"SREM set a unknown\r\n", ":1\r\n"},
+		{"SMEMBERS set\r\n", "*1\r\n$1\r\nb\r\n"},
+		{"SCARD unknown\r\n", ":0\r\n"},
+		{"SADD list a\r\n", "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"},
+		{"TYPE set\r\n", "+set\r\n"},
+		{"ZADD board 10 alice 20 bob 15 carol\r\n", ":3\r\n"},
+		{"ZADD board 5 alice\r\n", ":0\r\n"},
+		{"ZADD board abc alice\r\n", "-ERR value is not a valid float\r\n"},
+		{"ZINCRBY board 2.5 bob\r\n", "$4\r\n22.5\r\n"},
+		{"ZSCORE board alice\r\n", "$1\r\n5\r\n"},
+		{"ZSCORE board unknown\r\n", "$-1\r\n"},
+		{"ZRANGE board 0 -1\r\n", "*3\r\n$5\r\nalice\r\n$5\r\ncarol\r\n$3\r\nbob\r\n"},
+		{"ZREVRANGE board 0 0 WITHSCORES\r\n", "*2\r\n$3\r\nbob\r\n$4\r\n22.5\r\n"},
+		{"ZRANGEBYSCORE board (5 +inf LIMIT 0 1\r\n", "*1\r\n$5\r\ncarol\r\n"},
+		{"ZRANGEBYSCORE board -inf 15 WITHSCORES\r\n", "*4\r\n$5\r\nalice\r\n$1\r\n5\r\n$5\r\ncarol\r\n$2\r\n15\r\n"},
+		{"ZRANGEBYSCORE board a 15\r\n", "-ERR min or max is not a float\r\n"},
+		{"ZRANK board bob\r\n", ":2\r\n"},
+		{"ZRANK board unknown\r\n", "$-1\r\n"},
+		{"ZREM board alice unknown\r\n", ":1\r\n"},
+		{"ZCARD board\r\n", ":2\r\n"},
+		{"ZCARD unknown\r\n", ":0\r\n"},
+		{"ZADD board inf top\r\n", ":1\r\n"},
+		{"ZINCRBY board -inf top\r\n", "-ERR resulting score is not a number (NaN)\r\n"},
+		{"TYPE board\r\n", "+zset\r\n"},
+		{"INCR counter\r\n", ":1\r\n"},
+		{"DECRBY counter 5\r\n", ":-4\r\n"},
+		{"INCRBY counter abc\r\n", "-ERR value is not an integer or out of range\r\n"},
+		{"INCR hash\r\n", "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"},
+		{"TYPE hash\r\n", "+hash\r\n"},
+		{"TYPE unknown\r\n", "+none\r\n"},
+		{"TTL counter\r\n", ":-1\r\n"},
+		{"PTTL unknown\r\n", ":-2\r\n"},
+		{"EXPIRE counter 100\r\n", ":1\r\n"},
+		{"TTL counter\r\n", ":100\r\n"},
+		{"PERSIST counter\r\n", ":1\r\n"},
+		{"PERSIST counter\r\n", ":0\r\n"},
+		{"TOUCH counter unknown hash\r\n", ":2\r\n"},
+		{"PEXPIRE counter 2400\r\n", ":1\r\n"},
+		{"TTL counter\r\n", ":2\r\n"},
+		{"PSETEX temp 100000 value\r\n", "+OK\r\n"},
+		{"TTL temp\r\n", ":100\r\n"},
+		{"EXPIREAT temp 1\r\n", ":1\r\n"},
+		{"GET temp\r\n", "$-1\r\n"},
+		{"PSETEX temp 0 value\r\n", "-ERR invalid expire time in 'psetex' command\r\n"},
+		{"SET temp value PX 100000\r\n", "+OK\r\n"},
+		{"PTTL temp\r\n", ":100000\r\n"},
+		{"KEYS h*\r\n", "*1\r\n$4\r\nhash\r\n"},
+		{"MSET m1 a m2 b\r\n", "+OK\r\n"},
+		{"MSET m1 a m2\r\n", "-ERR wrong number of arguments for 'mset' command\r\n"},
+		{"MGET m1 unknown m2\r\n", "*3\r\n$1\r\na\r\n$-1\r\n$1\r\nb\r\n"},
+		{"DEL key hash unknown\r\n", ":2\r\n"},
+		{"GET\r\n", "-ERR wrong number of arguments for 'get' command\r\n"},
+		{"UNKNOWN\r\n", "-ERR unknown command 'UNKNOWN'\r\n"},
+	} {
+		conn.inWriter.Write([]byte(t.request))
+		response := make([]byte, len(t.response))
+		_, err := io.ReadFull(reader, response)
+		c.Assert(err, IsNil)
+		c.Assert(string(response), Equals, t.response, Commentf("request %q", t.request))
+	}
+
+	conn.inWriter.Close()
+}
+
+func (s *RESPTestSuite) TestAuth(c *C) {
+	storage, _ := memory.NewStorage(100, time.Minute)
+	htpasswdFile, _ := htpasswd.NewHtpasswd(bytes.NewBufferString("user:{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g="))
+
+	conn := newTestConn()
+	go newRESPSession("test", conn, newRESPCommands(storage), htpasswdFile, log.New(&bytes.Buffer{}, "", 0)).start()
+
+	reader := bufio.NewReader(conn.outReader)
+	for _, t := range []struct {
+		request  string
+		response string
+	}{
+		{"GET key\r\n", "-NOAUTH Authentication required.\r\n"},
+		{"AUTH user wrong\r\n", "-WRONGPASS invalid username-password pair\r\n"},
+		{"AUTH user password\r\n", "+OK\r\n"},
+		{"GET key\r\n", "$-1\r\n"},
+	} {
+		conn.inWriter.Write([]byte(t.request))
+		response := make([]byte, len(t.response))
+		_, err := io.ReadFull(reader, response)
+		c.Assert(err, IsNil)
+		c.Assert(string(response), Equals, t.response, Commentf("request %q", t.request))
+	}
+
+	conn.inWriter.Close()
+}
@@ -3,6 +3,7 @@ package server
 import (
 	"log"
 	"net"
+	"net/http"
 
 	"github.com/Barberrrry/jcache/protocol"
 	"github.com/Barberrrry/jcache/server/htpasswd"
@@ -11,37 +12,101 @@ import (
 
 type server struct {
 	commands     map[string]command
+	respCommands map[string]respCommand
+	mcCommands   map[string]memcacheCommand
+	mcStats      *memcacheStats
 	storage      storage.Storage
+	pubSub       *pubSub
 	htpasswdFile *htpasswd.HtpasswdFile
 	logger       *log.Logger
 }
 
 func New(storage storage.Storage, htpasswdPath string, logger *log.Logger) *server {
+	ps := newPubSub(DefaultSubscriberQueueSize, SlowSubscriberDrop)
 	s := &server{
 		storage: storage,
+		pubSub:  ps,
 		commands: map[string]command{
-			protocol.NewKeysRequest().Command():          newKeysCommand(storage),
-			protocol.NewGetRequest().Command():           newGetCommand(storage),
-			protocol.NewSetRequest().Command():           newSetCommand(storage),
-			protocol.NewDelRequest().Command():           newDelCommand(storage),
-			protocol.NewUpdRequest().Command():           newUpdCommand(storage),
-			protocol.NewHashCreateRequest().Command():    newHashCreateCommand(storage),
-			protocol.NewHashGetAllRequest().Command():    newHashGetAllCommand(storage),
-			protocol.NewHashGetRequest().Command():       newHashGetCommand(storage),
-			protocol.NewHashSetRequest().Command():       newHashSetCommand(storage),
-			protocol.NewHashDelRequest().Command():       newHashDelCommand(storage),
-			protocol.NewHashLenRequest().Command():       newHashLenCommand(storage),
-			protocol.NewHashKeysRequest().Command():      newHashKeysCommand(storage),
-			protocol.NewListCreateRequest().Command():    newListCreateCommand(storage),
-			protocol.NewListLeftPopRequest().Command():   newListLeftPopCommand(storage),
-			protocol.NewListRightPopRequest().Command():  newListRightPopCommand(storage),
-			protocol.NewListLeftPushRequest().Command():  newListLeftPushCommand(storage),
-			protocol.NewListRightPushRequest().Command(): newListRightPushCommand(storage),
-			protocol.NewListLenRequest().Command():       newListLenCommand(storage),
-			protocol.NewListRangeRequest().Command():     newListRangeCommand(storage),
-			protocol.NewExpireRequest().Command():        newExpireCommand(storage),
+			protocol.NewKeysRequest().Command():                  newKeysCommand(),
+			protocol.NewScanRequest().Command():                  newScanCommand(),
+			protocol.NewGetRequest().Command():                   newGetCommand(),
+			protocol.NewGetsRequest().Command():                  newGetsCommand(),
+			protocol.NewSetRequest().Command():                   newSetCommand(),
+			protocol.NewPSetExRequest().Command():                newPSetExCommand(),
+			protocol.NewCasRequest().Command():                   newCasCommand(),
+			protocol.NewIncrRequest().Command():                  newIncrCommand(),
+			protocol.NewDecrRequest().Command():                  newDecrCommand(),
+			protocol.NewIncrByRequest().Command():                newIncrByCommand(),
+			protocol.NewDecrByRequest().Command():                newDecrByCommand(),
+			protocol.NewDelRequest().Command():                   newDelCommand(),
+			protocol.NewMGetRequest().Command():                  newMGetCommand(),
+			protocol.NewMSetRequest().Command():                  newMSetCommand(),
+			protocol.NewMDelRequest().Command():                  newMDelCommand(),
+			protocol.NewUpdRequest().Command():                   newUpdCommand(),
+			protocol.NewHashCreateRequest().Command():            newHashCreateCommand(),
+			protocol.NewHashGetAllRequest().Command():            newHashGetAllCommand(),
+			protocol.NewHashGetRequest().Command():               newHashGetCommand(),
+			protocol.NewHashSetRequest().Command():               newHashSetCommand(),
+			protocol.NewHashDelRequest().Command():               newHashDelCommand(),
+			protocol.NewHashLenRequest().Command():               newHashLenCommand(),
+			protocol.NewHashKeysRequest().Command():              newHashKeysCommand(),
+			protocol.NewHashGetMultiRequest().Command():          newHashGetMultiCommand(),
+			protocol.NewHashSetMultiRequest().Command():          newHashSetMultiCommand(),
+			protocol.NewHashIncrementByRequest().Command():       newHashIncrementByCommand(),
+			protocol.NewHashSetIfNotExistsRequest().Command():    newHashSetIfNotExistsCommand(),
+			protocol.NewHashExistsRequest().Command():            newHashExistsCommand(),
+			protocol.NewHashScanRequest().Command():              newHashScanCommand(),
+			protocol.NewHashExpireRequest().Command():            newHashExpireCommand(),
+			protocol.NewHashTTLRequest().Command():               newHashTTLCommand(),
+			protocol.NewHashPersistRequest().Command():           newHashPersistCommand(),
+			protocol.NewListCreateRequest().Command():            newListCreateCommand(),
+			protocol.NewListLeftPopRequest().Command():           newListLeftPopCommand(),
+			protocol.NewListRightPopRequest().Command():          newListRightPopCommand(),
+			protocol.NewListBlockingLeftPopRequest().Command():   newListBlockingLeftPopCommand(),
+			protocol.NewListBlockingRightPopRequest().Command():  newListBlockingRightPopCommand(),
+			protocol.NewListMoveRequest().Command():              newListMoveCommand(),
+			protocol.NewListBlockingMoveRequest().Command():      newListBlockingMoveCommand(),
+			protocol.NewListLeftPushRequest().Command():          newListLeftPushCommand(),
+			protocol.NewListRightPushRequest().Command():         newListRightPushCommand(),
+			protocol.NewListLenRequest().Command():               newListLenCommand(),
+			protocol.NewListRangeRequest().Command():             newListRangeCommand(),
+			protocol.NewListIndexRequest().Command():             newListIndexCommand(),
+			protocol.NewListSetRequest().Command():               newListSetCommand(),
+			protocol.NewListInsertRequest().Command():            newListInsertCommand(),
+			protocol.NewListRemoveRequest().Command():            newListRemoveCommand(),
+			protocol.NewListTrimRequest().Command():              newListTrimCommand(),
+			protocol.NewSetAddRequest().Command():                newSetAddCommand(),
+			protocol.NewSetRemoveRequest().Command():             newSetRemoveCommand(),
+			protocol.NewSetIsMemberRequest().Command():           newSetIsMemberCommand(),
+			protocol.NewSetMembersRequest().Command():            newSetMembersCommand(),
+			protocol.NewSetLenRequest().Command():                newSetLenCommand(),
+			protocol.NewSetIntersectRequest().Command():          newSetIntersectCommand(),
+			protocol.NewSetUnionRequest().Command():              newSetUnionCommand(),
+			protocol.NewSetDiffRequest().Command():               newSetDiffCommand(),
+			protocol.NewSortedSetAddRequest().Command():          newSortedSetAddCommand(),
+			protocol.NewSortedSetRemoveRequest().Command():       newSortedSetRemoveCommand(),
+			protocol.NewSortedSetScoreRequest().Command():        newSortedSetScoreCommand(),
+			protocol.NewSortedSetIncrementByRequest().Command():  newSortedSetIncrementByCommand(),
+			protocol.NewSortedSetRangeRequest().Command():        newSortedSetRangeCommand(false),
+			protocol.NewSortedSetReverseRangeRequest().Command(): newSortedSetRangeCommand(true),
+			protocol.NewSortedSetRangeByScoreRequest().Command(): newSortedSetRangeByScoreCommand(),
+			protocol.NewSortedSetRankRequest().Command():         newSortedSetRankCommand(),
+			protocol.NewSortedSetLenRequest().Command():          newSortedSetLenCommand(),
+			protocol.NewExpireRequest().Command():                newExpireCommand(),
+			protocol.NewPExpireRequest().Command():               newPExpireCommand(),
+			protocol.NewExpireAtRequest().Command():              newExpireAtCommand(),
+			protocol.NewPExpireAtRequest().Command():             newPExpireAtCommand(),
+			protocol.NewTouchRequest().Command():                 newTouchCommand(),
+			protocol.NewPersistRequest().Command():               newPersistCommand(),
+			protocol.NewTypeRequest().Command():                  newTypeCommand(),
+			protocol.NewTTLRequest().Command():                   newTTLCommand(),
+			protocol.NewPTTLRequest().Command():                  newPTTLCommand(),
+			protocol.NewPublishRequest().Command():               newPublishCommand(ps),
 		},
-		logger: logger,
+		respCommands: newRESPCommands(storage),
+		mcCommands:   newMemcacheCommands(storage),
+		mcStats:      newMemcacheStats(),
+		logger:       logger,
 	}
 
 	if htpasswdPath != "" {
@@ -56,9 +121,48 @@ func New(storage storage.Storage, htpasswdPath string, logger *log.Logger) *serv
 	return s
 }
 
+// SetSubscriberQueue sets number of messages which may wait for delivery to one subscriber
+// and what happens when queue of subscriber is full. It must be called before server starts listening.
+func (s *server) SetSubscriberQueue(size int, policy SlowSubscriberPolicy) {
+	s.pubSub.queueSize, s.pubSub.policy = size, policy
+}
+
+// ListenAndServe accepts connections which use jcache protocol
 func (s *server) ListenAndServe(addr string) {
+	s.serve(addr, func(conn net.Conn) {
+		newSession(conn.RemoteAddr().String(), conn, s.commands, s.storage, s.pubSub, s.htpasswdFile, s.logger).start()
+	})
+}
+
+// ListenAndServeRESP accepts connections which use Redis serialization protocol (RESP2)
+func (s *server) ListenAndServeRESP(addr string) {
+	s.serve(addr, func(conn net.Conn) {
+		newRESPSession(conn.RemoteAddr().String(), conn, s.respCommands, s.htpasswdFile, s.logger).start()
+	})
+}
+
+// ListenAndServeMemcache accepts connections which use memcached text protocol
+func (s *server) ListenAndServeMemcache(addr string) {
+	s.serve(addr, func(conn net.Conn) {
+		newMemcacheSession(conn.RemoteAddr().String(), conn, s.mcCommands, s.mcStats, s.htpasswdFile, s.logger).start()
+	})
+}
+
+// ListenAndServeHTTP accepts HTTP requests to REST gateway which uses JSON bodies
+func (s *server) ListenAndServeHTTP(addr string) {
+	s.logger.Printf("listen HTTP on %s", addr)
+	if err := http.ListenAndServe(addr, newHTTPHandler(s.storage, s.htpasswdFile, s.logger)); err != nil {
+		s.logger.Printf("error on listening %s: %s", addr, err)
+	}
+}
+
+func (s *server) serve(addr string, handle func(conn net.Conn)) {
 	s.logger.Printf("listen on %s", addr)
-	listener, _ := net.Listen("tcp", addr)
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		s.logger.Printf("error on listening %s: %s", addr, err)
+		return
+	}
 
 	for {
 		conn, err := listener.Accept()
@@ -67,6 +171,6 @@ func (s *server) ListenAndServe(addr string) {
 			continue
 		}
 
-		go newSession(conn.RemoteAddr().String(), conn, s.commands, s.htpasswdFile, s.logger).start()
+		go handle(conn)
 	}
 }
@@ -1,43 +1,79 @@
 package server
 
 import (
+	"bufio"
 	"errors"
 	"fmt"
 	"io"
 	"log"
+	"sync"
 
 	"github.com/Barberrrry/jcache/protocol"
 	"github.com/Barberrrry/jcache/server/htpasswd"
+	"github.com/Barberrrry/jcache/server/storage"
 )
 
 type session struct {
 	id              string
 	rwc             io.ReadWriteCloser
+	buf             *bufio.ReadWriter
+	rw              io.ReadWriter
 	serverCommands  map[string]command
 	sessionCommands map[string]command
+	storage         storage.Storage
 	isAuthRequired  bool
 	isAuthorized    bool
-	logger          *log.Logger
+	// queue contains actions of transaction started by MULTI, it is nil outside of transaction
+	queue       []action
+	isTxAborted bool
+	pubSub      *pubSub
+	// subscriberCommands are the only commands which are allowed in subscriber mode
+	subscriberCommands map[string]command
+	// subscriber is set in subscriber mode, its messages are written by deliver goroutine
+	subscriber *subscriber
+	// mu is held while command is handled and while message is delivered, so their writes don't interleave
+	mu     sync.Mutex
+	logger *log.Logger
 }
 
 var (
-	unknownCommandError = errors.New("Unknown command")
-	needAuthError       = errors.New("Need authentitication")
+	unknownCommandError      = errors.New("Unknown command")
+	needAuthError            = errors.New("Need authentitication")
+	nestedMultiError         = errors.New("MULTI calls can not be nested")
+	execWithoutMultiError    = errors.New("EXEC without MULTI")
+	discardWithoutMultiError = errors.New("DISCARD without MULTI")
+	txAbortedError           = errors.New("Transaction discarded because of previous errors")
+	subscriberModeError      = errors.New("Only SUBSCRIBE, PSUBSCRIBE, UNSUBSCRIBE and PUNSUBSCRIBE are allowed in subscriber mode")
+	subscribeInMultiError    = errors.New("SUBSCRIBE is not allowed inside of transaction")
 )
 
-func newSession(id string, rwc io.ReadWriteCloser, commands map[string]command, htpasswdFile *htpasswd.HtpasswdFile, logger *log.Logger) *session {
+func newSession(id string, rwc io.ReadWriteCloser, commands map[string]command, storage storage.Storage, pubSub *pubSub, htpasswdFile *htpasswd.HtpasswdFile, logger *log.Logger) *session {
 	s := &session{
 		id:             id,
 		rwc:            rwc,
+		buf:            bufio.NewReadWriter(bufio.NewReader(rwc), bufio.NewWriter(rwc)),
 		serverCommands: commands,
+		storage:        storage,
+		pubSub:         pubSub,
 		logger:         logger,
 	}
 
 	if htpasswdFile != nil {
 		s.isAuthRequired = true
 	}
+	s.rw = s.buf
 	s.sessionCommands = map[string]command{
-		protocol.NewAuthRequest().Command(): newAuthCommand(htpasswdFile, s),
+		protocol.NewAuthRequest().Command():    newAuthCommand(htpasswdFile, s),
+		protocol.NewModeRequest().Command():    newModeCommand(s),
+		protocol.NewMultiRequest().Command():   newMultiCommand(s),
+		protocol.NewExecRequest().Command():    newExecCommand(s),
+		protocol.NewDiscardRequest().Command(): newDiscardCommand(s),
+	}
+	s.subscriberCommands = map[string]command{
+		protocol.NewSubscribeRequest().Command():    newSubscribeCommand(s, false),
+		protocol.NewPSubscribeRequest().Command():   newSubscribeCommand(s, true),
+		protocol.NewUnsubscribeRequest().Command():  newUnsubscribeCommand(s, false),
+		protocol.NewPUnsubscribeRequest().Command(): newUnsubscribeCommand(s, true),
 	}
 
 	return s
@@ -48,34 +84,223 @@ func (s *session) start() {
 
 	s.log("open session")
 	defer s.log("close session")
+	defer s.stopSubscriber()
 
 	for {
-		commandName, err := protocol.ReadRequestCommand(s.rwc)
+		// Responses are flushed only when all pipelined requests are processed
+		if s.buf.Reader.Buffered() == 0 {
+			if err := s.flush(); err != nil {
+				s.log(fmt.Sprintf("write error: %s", err))
+				return
+			}
+		}
+
+		commandName, err := protocol.ReadRequestCommand(s.rw)
 		if err != nil {
 			s.log(fmt.Sprintf("read error: %s", err))
 			return
 		}
 
-		s.log(fmt.Sprintf("command: %s", commandName))
+		s.mu.Lock()
+		s.handle(commandName)
+		s.mu.Unlock()
+	}
+}
+
+// handle executes command which name is already read, lock of session must be held
+func (s *session) handle(commandName string) {
+	s.log(fmt.Sprintf("command: %s", commandName))
+
+	commandError := unknownCommandError
+	if command, found := s.subscriberCommands[commandName]; found {
+		s.execute(command, false)
+		return
+	}
+
+	if s.subscriber != nil {
+		commandError = subscriberModeError
+	} else if command, found := s.sessionCommands[commandName]; found {
+		s.execute(command, false)
+		return
+	} else if command, found := s.serverCommands[commandName]; found {
+		if !s.isAuthRequired || s.isAuthorized {
+			s.execute(command, s.queue != nil)
+			return
+		}
+		commandError = needAuthError
+	}
+
+	s.log(fmt.Sprintf("command error: %s", commandError))
+	s.isTxAborted = s.queue != nil
+	protocol.FlushRequest(s.rw)
+	writeError(s.rw, commandError)
+}
+
+func (s *session) flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.buf.Flush()
+}
+
+// execute decodes request and executes it or queues it for transaction
+func (s *session) execute(command command, queue bool) {
+	action, err := command(s.rw)
+	if err != nil {
+		s.isTxAborted = s.queue != nil
+		writeError(s.rw, err)
+		return
+	}
+
+	if queue {
+		s.queue = append(s.queue, action)
+		protocol.NewQueuedResponse().Encode(s.rw)
+		return
+	}
+
+	response, _ := action(s.storage)
+	if err := response.Encode(s.rw); err != nil {
+		writeError(s.rw, err)
+	}
+}
+
+// multi starts transaction, following server commands are queued until EXEC or DISCARD
+func (s *session) multi() error {
+	if s.queue != nil {
+		return nestedMultiError
+	}
+	s.queue = []action{}
+	return nil
+}
+
+// exec executes queued actions atomically and returns their responses.
+// Transaction is rolled back if any action fails.
+func (s *session) exec(st storage.Storage) ([]protocol.Encoder, error) {
+	queue, isAborted := s.queue, s.isTxAborted
+	s.queue, s.isTxAborted = nil, false
+
+	if queue == nil {
+		return nil, execWithoutMultiError
+	}
+	if isAborted {
+		return nil, txAbortedError
+	}
+	t, ok := st.(storage.Transactional)
+	if !ok {
+		return nil, storage.TxNotSupportedError
+	}
 
-		commandError := unknownCommandError
-		if command, found := s.sessionCommands[commandName]; found {
-			command(s.rwc)
-			continue
+	var responses []protocol.Encoder
+	err := t.Transaction(func(tx storage.Storage) error {
+		for i, action := range queue {
+			response, err := action(tx)
+			if err != nil {
+				return fmt.Errorf("Command %d failed: %s", i+1, err)
+			}
+			responses = append(responses, response)
 		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return responses, nil
+}
+
+// discard drops queued actions
+func (s *session) discard() error {
+	if s.queue == nil {
+		return discardWithoutMultiError
+	}
+	s.queue, s.isTxAborted = nil, false
+	return nil
+}
+
+// subscribe switches session into subscriber mode and adds channels or patterns to its subscriptions.
+// Number of subscriptions is returned.
+func (s *session) subscribe(channels []string, isPattern bool) (int, error) {
+	if s.isAuthRequired && !s.isAuthorized {
+		return 0, needAuthError
+	}
+	if s.queue != nil {
+		return 0, subscribeInMultiError
+	}
+	if s.subscriber == nil {
+		s.subscriber = s.pubSub.newSubscriber(func() {
+			s.log("disconnect slow subscriber")
+			s.rwc.Close()
+		})
+		go s.deliver(s.subscriber)
+		s.log("subscriber mode")
+	}
+	return s.pubSub.subscribe(s.subscriber, channels, isPattern), nil
+}
+
+// unsubscribe removes channels or patterns from subscriptions, all of them are removed if channels is empty.
+// Session leaves subscriber mode when no subscriptions remain. Number of subscriptions is returned.
+func (s *session) unsubscribe(channels []string, isPattern bool) int {
+	if s.subscriber == nil {
+		return 0
+	}
+	count := s.pubSub.unsubscribe(s.subscriber, channels, isPattern)
+	if count == 0 {
+		s.leaveSubscriberMode()
+	}
+	return count
+}
 
-		if command, found := s.serverCommands[commandName]; found {
-			if !s.isAuthRequired || s.isAuthorized {
-				command(s.rwc)
-				continue
+// leaveSubscriberMode removes all subscriptions and stops delivery, lock of session must be held.
+// Messages which are still queued are dropped.
+func (s *session) leaveSubscriberMode() {
+	if s.subscriber == nil {
+		return
+	}
+	s.pubSub.unsubscribe(s.subscriber, nil, false)
+	s.pubSub.unsubscribe(s.subscriber, nil, true)
+	close(s.subscriber.done)
+	s.subscriber = nil
+}
+
+func (s *session) stopSubscriber() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.leaveSubscriberMode()
+}
+
+// deliver writes queued messages of subscriber to connection until session leaves subscriber mode
+func (s *session) deliver(sub *subscriber) {
+	for {
+		select {
+		case <-sub.done:
+			return
+		case m := <-sub.messages:
+			if err := s.writeMessage(sub, m); err != nil {
+				s.log(fmt.Sprintf("write error: %s", err))
+				s.rwc.Close()
+				return
 			}
-			commandError = needAuthError
 		}
+	}
+}
+
+// writeMessage writes message unless session has left subscriber mode. Message which can't be encoded in mode
+// of session is skipped. Connection is flushed when queue is empty, so messages published at once are written together.
+func (s *session) writeMessage(sub *subscriber, m message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-		s.log(fmt.Sprintf("command error: %s", commandError))
-		protocol.FlushRequest(s.rwc)
-		writeError(s.rwc, commandError)
+	if s.subscriber != sub {
+		return nil
+	}
+	response := protocol.NewMessageResponse()
+	response.Pattern, response.Channel, response.Message = m.pattern, m.channel, m.payload
+	// Write errors are returned by flush
+	if err := response.Encode(s.rw); err != nil {
+		s.log(fmt.Sprintf("message error: %s", err))
+	}
+	if len(sub.messages) > 0 {
+		return nil
 	}
+	return s.buf.Flush()
 }
 
 func (s *session) authorize() {
@@ -83,6 +308,16 @@ func (s *session) authorize() {
 	s.log("successful authentication")
 }
 
+// setMode switches framing mode of the following requests and responses
+func (s *session) setMode(mode string) {
+	if mode == protocol.ModeFramed {
+		s.rw = protocol.NewFramedReadWriter(s.buf)
+	} else {
+		s.rw = s.buf
+	}
+	s.log(fmt.Sprintf("mode: %s", mode))
+}
+
 func (s *session) log(message string) {
 	s.logger.Printf("[%s] %s", s.id, message)
 }
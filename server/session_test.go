@@ -1,12 +1,16 @@
 package server
 
 import (
+	"bufio"
 	"bytes"
 	"io"
 	"log"
 	"testing"
+	"time"
 
 	"github.com/Barberrrry/jcache/protocol"
+	"github.com/Barberrrry/jcache/server/storage"
+	"github.com/Barberrrry/jcache/server/storage/memory"
 	. "gopkg.in/check.v1"
 )
 
@@ -20,19 +24,20 @@ var _ = Suite(&SessionTestSuite{})
 
 func (s *SessionTestSuite) TestCommand(c *C) {
 	commands := map[string]command{
-		protocol.NewGetRequest().Command(): func(rw io.ReadWriter) {
+		protocol.NewGetRequest().Command(): func(reader io.Reader) (action, error) {
 			request := protocol.NewGetRequest()
-			response := protocol.NewGetResponse()
-			run(rw, request, response, func() {
+			return decode(reader, request, func(storage.Storage) (protocol.Encoder, error) {
 				c.Assert(request.Key, Equals, "key")
+				response := protocol.NewGetResponse()
 				response.Value = "value"
+				return response, nil
 			})
 		},
 	}
 
 	conn := newTestConn()
 
-	go newSession("test", conn, commands, nil, log.New(&bytes.Buffer{}, "", 0)).start()
+	go newSession("test", conn, commands, nil, nil, nil, log.New(&bytes.Buffer{}, "", 0)).start()
 
 	request := protocol.NewGetRequest()
 	request.Key = "key"
@@ -46,6 +51,182 @@ func (s *SessionTestSuite) TestCommand(c *C) {
 	conn.inWriter.Close()
 }
 
+func (s *SessionTestSuite) TestPipelinedCommands(c *C) {
+	commands := map[string]command{
+		protocol.NewGetRequest().Command(): func(reader io.Reader) (action, error) {
+			request := protocol.NewGetRequest()
+			return decode(reader, request, func(storage.Storage) (protocol.Encoder, error) {
+				response := protocol.NewGetResponse()
+				response.Value = request.Key
+				return response, nil
+			})
+		},
+	}
+
+	conn := newTestConn()
+
+	go newSession("test", conn, commands, nil, nil, nil, log.New(&bytes.Buffer{}, "", 0)).start()
+
+	data := &bytes.Buffer{}
+	for _, key := range []string{"key1", "key2", "key3"} {
+		request := protocol.NewGetRequest()
+		request.Key = key
+		request.Encode(data)
+	}
+	conn.inWriter.Write(data.Bytes())
+
+	reader := bufio.NewReader(conn.outReader)
+	for _, key := range []string{"key1", "key2", "key3"} {
+		response := protocol.NewGetResponse()
+		err := response.Decode(reader)
+		c.Assert(err, IsNil)
+		c.Assert(response.Value, Equals, key)
+	}
+
+	conn.inWriter.Close()
+}
+
+func (s *SessionTestSuite) TestFramedMode(c *C) {
+	commands := map[string]command{
+		protocol.NewGetRequest().Command(): func(reader io.Reader) (action, error) {
+			request := protocol.NewGetRequest()
+			return decode(reader, request, func(storage.Storage) (protocol.Encoder, error) {
+				c.Assert(request.Key, Equals, "key with spaces")
+				response := protocol.NewGetResponse()
+				response.Value = "value"
+				return response, nil
+			})
+		},
+	}
+
+	conn := newTestConn()
+
+	go newSession("test", conn, commands, nil, nil, nil, log.New(&bytes.Buffer{}, "", 0)).start()
+
+	modeRequest := protocol.NewModeRequest()
+	modeRequest.Mode = protocol.ModeFramed
+	modeRequest.Encode(conn.inWriter)
+
+	modeResponse := protocol.NewModeResponse()
+	err := modeResponse.Decode(conn.outReader)
+	c.Assert(err, IsNil)
+	c.Assert(modeResponse.Error, IsNil)
+
+	framed := protocol.NewFramedReadWriter(struct {
+		io.Reader
+		io.Writer
+	}{conn.outReader, conn.inWriter})
+	request := protocol.NewGetRequest()
+	request.Key = "key with spaces"
+	err = request.Encode(framed)
+	c.Assert(err, IsNil)
+
+	response := protocol.NewGetResponse()
+	err = response.Decode(framed)
+	c.Assert(err, IsNil)
+	c.Assert(response.Value, Equals, "value")
+
+	conn.inWriter.Close()
+}
+
+func (s *SessionTestSuite) TestTransaction(c *C) {
+	st, _ := memory.NewStorage(100, time.Minute)
+	commands := map[string]command{
+		protocol.NewGetRequest().Command(): newGetCommand(),
+		protocol.NewSetRequest().Command(): newSetCommand(),
+	}
+
+	conn := newTestConn()
+
+	go newSession("test", conn, commands, st, nil, nil, log.New(&bytes.Buffer{}, "", 0)).start()
+
+	reader := bufio.NewReader(conn.outReader)
+	for _, t := range []struct {
+		request  string
+		response string
+	}{
+		{"EXEC\r\n", "ERROR EXEC without MULTI\r\n"},
+		{"MULTI\r\n", "OK\r\n"},
+		{"MULTI\r\n", "ERROR MULTI calls can not be nested\r\n"},
+		{"SET key 0 5\r\nvalue\r\n", "QUEUED\r\n"},
+		{"GET key\r\n", "QUEUED\r\n"},
+		{"EXEC\r\n", "COUNT 2\r\nOK\r\nVALUE 5\r\nvalue\r\n"},
+		{"MULTI\r\n", "OK\r\n"},
+		{"SET key2 0 6\r\nvalue2\r\n", "QUEUED\r\n"},
+		{"SET key 0 5\r\nvalue\r\n", "QUEUED\r\n"},
+		{"EXEC\r\n", "ERROR Command 2 failed: Key already exists\r\n"},
+		{"GET key2\r\n", "ERROR Key does not exist\r\n"},
+		{"MULTI\r\n", "OK\r\n"},
+		{"UNKNOWN\r\n", "ERROR Unknown command\r\n"},
+		{"EXEC\r\n", "ERROR Transaction discarded because of previous errors\r\n"},
+		{"MULTI\r\n", "OK\r\n"},
+		{"SET key2 0 6\r\nvalue2\r\n", "QUEUED\r\n"},
+		{"DISCARD\r\n", "OK\r\n"},
+		{"GET key2\r\n", "ERROR Key does not exist\r\n"},
+	} {
+		conn.inWriter.Write([]byte(t.request))
+		response := make([]byte, len(t.response))
+		_, err := io.ReadFull(reader, response)
+		c.Assert(err, IsNil)
+		c.Assert(string(response), Equals, t.response, Commentf("request %q", t.request))
+	}
+
+	conn.inWriter.Close()
+}
+
+func (s *SessionTestSuite) TestPubSub(c *C) {
+	st, _ := memory.NewStorage(100, time.Minute)
+	ps := newPubSub(10, SlowSubscriberDrop)
+	commands := map[string]command{
+		protocol.NewGetRequest().Command():     newGetCommand(),
+		protocol.NewPublishRequest().Command(): newPublishCommand(ps),
+	}
+
+	subscriberConn := newTestConn()
+	go newSession("subscriber", subscriberConn, commands, st, ps, nil, log.New(&bytes.Buffer{}, "", 0)).start()
+	publisherConn := newTestConn()
+	go newSession("publisher", publisherConn, commands, st, ps, nil, log.New(&bytes.Buffer{}, "", 0)).start()
+
+	readers := map[*testConn]*bufio.Reader{
+		subscriberConn: bufio.NewReader(subscriberConn.outReader),
+		publisherConn:  bufio.NewReader(publisherConn.outReader),
+	}
+	for _, t := range []struct {
+		conn     *testConn
+		request  string
+		response string
+	}{
+		{subscriberConn, "SUBSCRIBE\r\n", "ERROR Invalid request format\r\n"},
+		{subscriberConn, "MULTI\r\n", "OK\r\n"},
+		{subscriberConn, "SUBSCRIBE news\r\n", "ERROR SUBSCRIBE is not allowed inside of transaction\r\n"},
+		{subscriberConn, "DISCARD\r\n", "OK\r\n"},
+		{subscriberConn, "SUBSCRIBE news sport\r\n", "INT 2\r\n"},
+		{subscriberConn, "PSUBSCRIBE n*\r\n", "INT 3\r\n"},
+		{subscriberConn, "GET key\r\n", "ERROR Only SUBSCRIBE, PSUBSCRIBE, UNSUBSCRIBE and PUNSUBSCRIBE are allowed in subscriber mode\r\n"},
+		{publisherConn, "PUBLISH weather 5\r\nrainy\r\n", "INT 0\r\n"},
+		{publisherConn, "PUBLISH news 5\r\nhello\r\n", "INT 2\r\n"},
+		{subscriberConn, "", "MESSAGE news 5\r\nhello\r\nPMESSAGE n* news 5\r\nhello\r\n"},
+		{subscriberConn, "UNSUBSCRIBE news\r\n", "INT 2\r\n"},
+		{publisherConn, "PUBLISH news 3\r\nbye\r\n", "INT 1\r\n"},
+		{subscriberConn, "", "PMESSAGE n* news 3\r\nbye\r\n"},
+		{subscriberConn, "PUNSUBSCRIBE\r\n", "INT 1\r\n"},
+		{subscriberConn, "UNSUBSCRIBE\r\n", "INT 0\r\n"},
+		{publisherConn, "PUBLISH sport 4\r\ngoal\r\n", "INT 0\r\n"},
+		{subscriberConn, "GET key\r\n", "ERROR Key does not exist\r\n"},
+	} {
+		if t.request != "" {
+			t.conn.inWriter.Write([]byte(t.request))
+		}
+		response := make([]byte, len(t.response))
+		_, err := io.ReadFull(readers[t.conn], response)
+		c.Assert(err, IsNil)
+		c.Assert(string(response), Equals, t.response, Commentf("request %q", t.request))
+	}
+
+	subscriberConn.inWriter.Close()
+	publisherConn.inWriter.Close()
+}
+
 type testConn struct {
 	inReader  *io.PipeReader
 	inWriter  *io.PipeWriter
@@ -0,0 +1,460 @@
+package boltdb
+
+import (
+	"encoding/binary"
+
+	commonStorage "github.com/Barberrrry/jcache/server/storage"
+	"github.com/boltdb/bolt"
+)
+
+// boltList is a list of key opened inside of transaction. Item of key contains only list header,
+// values are stored in nested bucket of lists bucket with the same name as key. Keys of values are
+// big-endian positions from the header, so they are ordered and both ends are changed without moving other values.
+type boltList struct {
+	item   *commonStorage.Item
+	header *commonStorage.ListHeader
+	values *bolt.Bucket
+	// changed is set by methods which change list, so item is saved with new version
+	changed bool
+}
+
+// getList opens existing list of key. Error will occur if key doesn't exist or key type is not list.
+func (s *storage) getList(bucket *bolt.Bucket, key string) (*boltList, error) {
+	item, err := s.getItem(bucket, key)
+	if err != nil {
+		return nil, err
+	}
+	header, err := item.CastListHeader()
+	if err != nil {
+		return nil, err
+	}
+	values := bucket.Tx().Bucket(listsBucketName).Bucket([]byte(key))
+	if values == nil {
+		return nil, commonStorage.KeyNotExistsError
+	}
+	return &boltList{item: item, header: header, values: values}, nil
+}
+
+// newList creates empty list of key, values left by expired list of the same key are removed
+func newList(bucket *bolt.Bucket, key string, ttl uint64) (*boltList, error) {
+	if err := deleteListValues(bucket, key); err != nil {
+		return nil, err
+	}
+	values, err := bucket.Tx().Bucket(listsBucketName).CreateBucket([]byte(key))
+	if err != nil {
+		return nil, err
+	}
+	header := commonStorage.NewListHeader()
+	return &boltList{item: commonStorage.NewItem(header, ttl), header: header, values: values, changed: true}, nil
+}
+
+// getOrCreateList opens list of key or creates it with zero ttl if key doesn't exist
+func (s *storage) getOrCreateList(bucket *bolt.Bucket, key string) (*boltList, error) {
+	l, err := s.getList(bucket, key)
+	if err == commonStorage.KeyNotExistsError {
+		return newList(bucket, key, 0)
+	}
+	return l, err
+}
+
+// deleteListValues removes values of list of key if they exist
+func deleteListValues(bucket *bolt.Bucket, key string) error {
+	err := bucket.Tx().Bucket(listsBucketName).DeleteBucket([]byte(key))
+	if err == bolt.ErrBucketNotFound {
+		return nil
+	}
+	return err
+}
+
+// saveList saves list header with new version if list is changed or just extends its sliding expiration
+func (s *storage) saveList(bucket *bolt.Bucket, key string, l *boltList) error {
+	if l.changed {
+		return s.saveItem(bucket, key, l.item)
+	}
+	return s.touchItem(bucket, key, l.item)
+}
+
+// viewList calls fn with list of key inside of read-only transaction.
+// Expiration of sliding list is extended afterwards like by read.
+func (s *storage) viewList(key string, fn func(l *boltList) error) error {
+	sliding := false
+	err := s.view(func(bucket *bolt.Bucket) error {
+		l, err := s.getList(bucket, key)
+		if err != nil {
+			return err
+		}
+		sliding = l.item.SlidingTTL > 0
+		return fn(l)
+	})
+	if err == nil && sliding {
+		err = s.touch(key)
+	}
+	return err
+}
+
+// updateList calls fn with existing list of key inside of read-write transaction and saves the list afterwards
+func (s *storage) updateList(key string, fn func(l *boltList) error) error {
+	return s.update(func(bucket *bolt.Bucket) error {
+		l, err := s.getList(bucket, key)
+		if err != nil {
+			return err
+		}
+		if err := fn(l); err != nil {
+			return err
+		}
+		return s.saveList(bucket, key, l)
+	})
+}
+
+func listPosition(position uint64) []byte {
+	data := make([]byte, 8)
+	binary.BigEndian.PutUint64(data, position)
+	return data
+}
+
+func (l *boltList) Len() int {
+	return l.header.Len()
+}
+
+// get returns value by index from the list beginning, index must be in range
+func (l *boltList) get(index int) string {
+	return string(l.values.Get(listPosition(l.header.Head + uint64(index))))
+}
+
+// set replaces value by index from the list beginning, index must be in range
+func (l *boltList) set(index int, value string) error {
+	l.changed = true
+	return l.values.Put(listPosition(l.header.Head+uint64(index)), []byte(value))
+}
+
+func (l *boltList) push(value string, left bool) error {
+	l.changed = true
+	position := l.header.Tail
+	if left {
+		l.header.Head--
+		position = l.header.Head
+	} else {
+		l.header.Tail++
+	}
+	return l.values.Put(listPosition(position), []byte(value))
+}
+
+// pop removes value from the list beginning or ending. Error will occur if list is empty.
+func (l *boltList) pop(left bool) (string, error) {
+	if l.Len() == 0 {
+		return "", commonStorage.ListEmptyError
+	}
+	l.changed = true
+	var position uint64
+	if left {
+		position = l.header.Head
+		l.header.Head++
+	} else {
+		l.header.Tail--
+		position = l.header.Tail
+	}
+	key := listPosition(position)
+	value := string(l.values.Get(key))
+	return value, l.values.Delete(key)
+}
+
+// valuesRange returns values from start to stop index inclusive, indexes must be in range
+func (l *boltList) valuesRange(start, stop int) []string {
+	values := make([]string, 0, stop-start+1)
+	cursor := l.values.Cursor()
+	for key, value := cursor.Seek(listPosition(l.header.Head + uint64(start))); key != nil && len(values) <= stop-start; key, value = cursor.Next() {
+		values = append(values, string(value))
+	}
+	return values
+}
+
+// insert puts value at index, so following values are moved by one. Values of the shorter side are moved.
+func (l *boltList) insert(index int, value string) error {
+	length := l.Len()
+	if index < length-index {
+		l.header.Head--
+		for i := 0; i < index; i++ {
+			if err := l.set(i, l.get(i+1)); err != nil {
+				return err
+			}
+		}
+	} else {
+		l.header.Tail++
+		for i := length; i > index; i-- {
+			if err := l.set(i, l.get(i-1)); err != nil {
+				return err
+			}
+		}
+	}
+	return l.set(index, value)
+}
+
+// replace puts values in place of all list values
+func (l *boltList) replace(values []string) error {
+	length := l.Len()
+	for i, value := range values {
+		if err := l.set(i, value); err != nil {
+			return err
+		}
+	}
+	for i := len(values); i < length; i++ {
+		if err := l.values.Delete(listPosition(l.header.Head + uint64(i))); err != nil {
+			return err
+		}
+	}
+	l.header.Tail = l.header.Head + uint64(len(values))
+	l.changed = true
+	return nil
+}
+
+// trim removes values which are out of range from start to stop index inclusive, empty range removes all values
+func (l *boltList) trim(start, stop int, empty bool) error {
+	length := l.Len()
+	if empty {
+		start, stop = length, length-1
+	}
+	for i := 0; i < length; i++ {
+		if i >= start && i <= stop {
+			continue
+		}
+		if err := l.values.Delete(listPosition(l.header.Head + uint64(i))); err != nil {
+			return err
+		}
+	}
+	l.header.Tail = l.header.Head + uint64(stop+1)
+	l.header.Head += uint64(start)
+	l.changed = true
+	return nil
+}
+
+// ListCreate creates new list with specified key and ttl. Use zero duration if key should exist forever.
+func (s *storage) ListCreate(key string, ttl uint64) error {
+	return s.update(func(bucket *bolt.Bucket) error {
+		item, _ := s.getItem(bucket, key)
+		if item != nil {
+			return commonStorage.KeyAlreadyExistsError
+		}
+
+		l, err := newList(bucket, key, ttl)
+		if err != nil {
+			return err
+		}
+		return s.saveList(bucket, key, l)
+	})
+}
+
+// ListLeftPop pops value from the list beginning.
+// Error will occur if key doesn't exist, key type is not list or list is empty.
+func (s *storage) ListLeftPop(key string) (string, error) {
+	return s.listPop(key, true)
+}
+
+// ListRightPop pops value from the list ending.
+// Error will occur if key doesn't exist, key type is not list or list is empty.
+func (s *storage) ListRightPop(key string) (string, error) {
+	return s.listPop(key, false)
+}
+
+func (s *storage) listPop(key string, left bool) (value string, err error) {
+	err = s.updateList(key, func(l *boltList) (err error) {
+		value, err = l.pop(left)
+		return err
+	})
+	return
+}
+
+// ListLeftPush adds value to the list beginning. List is created if key doesn't exist.
+// Error will occur if key type is not list.
+func (s *storage) ListLeftPush(key, value string) error {
+	return s.listPush(key, value, true)
+}
+
+// ListRightPush adds value to the list ending. List is created if key doesn't exist.
+// Error will occur if key type is not list.
+func (s *storage) ListRightPush(key, value string) error {
+	return s.listPush(key, value, false)
+}
+
+func (s *storage) listPush(key, value string, left bool) error {
+	err := s.update(func(bucket *bolt.Bucket) error {
+		l, err := s.getOrCreateList(bucket, key)
+		if err != nil {
+			return err
+		}
+		if err := l.push(value, left); err != nil {
+			return err
+		}
+		return s.saveList(bucket, key, l)
+	})
+	if err == nil {
+		s.pushedKey(key)
+	}
+	return err
+}
+
+// ListMove atomically pops value from the source list and pushes it into the destination list.
+// Destination is created if it doesn't exist, source and destination may be the same list.
+// Error will occur if source doesn't exist, source is empty or type of any key is not list.
+func (s *storage) ListMove(source, destination string, fromLeft, toLeft bool) (value string, err error) {
+	err = s.update(func(bucket *bolt.Bucket) error {
+		from, err := s.getList(bucket, source)
+		if err != nil {
+			return err
+		}
+		value, err = s.moveListValue(bucket, source, from, fromLeft, destination, toLeft)
+		return err
+	})
+	if err == nil {
+		s.pushedKey(destination)
+	}
+	return
+}
+
+// moveListValue pops value from opened source list and pushes it into destination list, both lists are saved.
+// Destination is checked before pop, so nothing is changed on error.
+func (s *storage) moveListValue(bucket *bolt.Bucket, source string, from *boltList, fromLeft bool, destination string, toLeft bool) (string, error) {
+	to := from
+	if destination != source {
+		var err error
+		if to, err = s.getOrCreateList(bucket, destination); err != nil {
+			return "", err
+		}
+	}
+
+	value, err := from.pop(fromLeft)
+	if err != nil {
+		return "", err
+	}
+	if err := to.push(value, toLeft); err != nil {
+		return "", err
+	}
+	if err := s.saveList(bucket, source, from); err != nil {
+		return "", err
+	}
+	if to != from {
+		if err := s.saveList(bucket, destination, to); err != nil {
+			return "", err
+		}
+	}
+	return value, nil
+}
+
+// ListLen returns count of elements in the list. Error will occur if key doesn't exist or key type is not list.
+func (s *storage) ListLen(key string) (length int, err error) {
+	err = s.viewList(key, func(l *boltList) error {
+		length = l.Len()
+		return nil
+	})
+	return
+}
+
+// ListRange returns list of elements from the list from start to stop index inclusive.
+// Negative indexes are counted from the list ending. Error will occur if key doesn't exist or key type is not list.
+func (s *storage) ListRange(key string, start, stop int) (values []string, err error) {
+	err = s.viewList(key, func(l *boltList) error {
+		if start, stop, ok := commonStorage.ListRangeBounds(l.Len(), start, stop); ok {
+			values = l.valuesRange(start, stop)
+		}
+		return nil
+	})
+	return
+}
+
+// ListIndex returns element of the list by index, negative index is counted from the list ending.
+// Error will occur if key doesn't exist, key type is not list or index is out of range.
+func (s *storage) ListIndex(key string, index int) (value string, err error) {
+	err = s.viewList(key, func(l *boltList) error {
+		position, ok := commonStorage.ListIndexPosition(l.Len(), index)
+		if !ok {
+			return commonStorage.IndexOutOfRangeError
+		}
+		value = l.get(position)
+		return nil
+	})
+	return
+}
+
+// ListSet replaces element of the list by index, negative index is counted from the list ending.
+// Error will occur if key doesn't exist, key type is not list or index is out of range.
+func (s *storage) ListSet(key string, index int, value string) error {
+	return s.updateList(key, func(l *boltList) error {
+		position, ok := commonStorage.ListIndexPosition(l.Len(), index)
+		if !ok {
+			return commonStorage.IndexOutOfRangeError
+		}
+		return l.set(position, value)
+	})
+}
+
+// ListInsert inserts value before or after the first element equal to pivot and returns new length of the list.
+// Error will occur if key doesn't exist, key type is not list or pivot doesn't exist.
+func (s *storage) ListInsert(key, pivot, value string, before bool) (length int, err error) {
+	err = s.updateList(key, func(l *boltList) error {
+		index := 0
+		cursor := l.values.Cursor()
+		for position, current := cursor.First(); position != nil; position, current = cursor.Next() {
+			if string(current) != pivot {
+				index++
+				continue
+			}
+			if !before {
+				index++
+			}
+			if err := l.insert(index, value); err != nil {
+				return err
+			}
+			length = l.Len()
+			return nil
+		}
+		return commonStorage.PivotNotExistError
+	})
+	return
+}
+
+// ListRemove removes elements equal to value and returns number of removed elements.
+// Positive count removes up to count elements from the list beginning, negative count removes them
+// from the list ending and zero count removes all of them. Error will occur if key doesn't exist or key type is not list.
+func (s *storage) ListRemove(key string, count int, value string) (removed int, err error) {
+	err = s.updateList(key, func(l *boltList) error {
+		if l.Len() == 0 {
+			return nil
+		}
+		values := l.valuesRange(0, l.Len()-1)
+		keep := make([]bool, len(values))
+		fromEnd := count < 0
+		if fromEnd {
+			count = -count
+		}
+		for i := range values {
+			j := i
+			if fromEnd {
+				j = len(values) - 1 - i
+			}
+			keep[j] = values[j] != value || (count != 0 && removed == count)
+			if !keep[j] {
+				removed++
+			}
+		}
+		if removed == 0 {
+			return nil
+		}
+
+		kept := make([]string, 0, len(values)-removed)
+		for i, value := range values {
+			if keep[i] {
+				kept = append(kept, value)
+			}
+		}
+		return l.replace(kept)
+	})
+	return
+}
+
+// ListTrim removes all elements of the list which are out of range from start to stop index inclusive,
+// negative indexes are counted from the list ending. Error will occur if key doesn't exist or key type is not list.
+func (s *storage) ListTrim(key string, start, stop int) error {
+	return s.updateList(key, func(l *boltList) error {
+		start, stop, ok := commonStorage.ListRangeBounds(l.Len(), start, stop)
+		return l.trim(start, stop, !ok)
+	})
+}
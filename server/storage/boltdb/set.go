@@ -0,0 +1,125 @@
+package boltdb
+
+import (
+	commonStorage "github.com/Barberrrry/jcache/server/storage"
+	"github.com/boltdb/bolt"
+)
+
+// getSet returns set of key using get function of read
+func getSet(get func(string) (*commonStorage.Item, error), key string) (commonStorage.Set, error) {
+	item, err := get(key)
+	if err != nil {
+		return nil, err
+	}
+	return item.CastSet()
+}
+
+// SetAdd adds members to set and returns number of new members. Set is created if key doesn't exist.
+// Error will occur if key type is not set.
+func (s *storage) SetAdd(key string, members []string) (added int, err error) {
+	err = s.update(func(bucket *bolt.Bucket) error {
+		item, err := s.getItem(bucket, key)
+		isNew := err != nil
+		if isNew {
+			item = commonStorage.NewItem(make(commonStorage.Set), 0)
+		}
+		set, err := item.CastSet()
+		if err != nil {
+			return err
+		}
+		added = set.Add(members...)
+		if added == 0 && !isNew {
+			return s.touchItem(bucket, key, item)
+		}
+		return s.saveItem(bucket, key, item)
+	})
+	return
+}
+
+// SetRemove removes members from set and returns number of removed members.
+// Error will occur if key doesn't exist or key type is not set.
+func (s *storage) SetRemove(key string, members []string) (removed int, err error) {
+	err = s.update(func(bucket *bolt.Bucket) error {
+		item, err := s.getItem(bucket, key)
+		if err != nil {
+			return err
+		}
+		set, err := item.CastSet()
+		if err != nil {
+			return err
+		}
+		removed = set.Remove(members...)
+		if removed == 0 {
+			return s.touchItem(bucket, key, item)
+		}
+		return s.saveItem(bucket, key, item)
+	})
+	return
+}
+
+// SetIsMember reports whether member is in set. Error will occur if key doesn't exist or key type is not set.
+func (s *storage) SetIsMember(key, member string) (found bool, err error) {
+	err = s.read(func(get func(string) (*commonStorage.Item, error)) error {
+		set, err := getSet(get, key)
+		found = set[member]
+		return err
+	})
+	return
+}
+
+// SetMembers returns sorted members of set. Error will occur if key doesn't exist or key type is not set.
+func (s *storage) SetMembers(key string) (members []string, err error) {
+	err = s.read(func(get func(string) (*commonStorage.Item, error)) error {
+		set, err := getSet(get, key)
+		if err != nil {
+			return err
+		}
+		members = set.Members()
+		return nil
+	})
+	return
+}
+
+// SetLen returns number of set members. Error will occur if key doesn't exist or key type is not set.
+func (s *storage) SetLen(key string) (length int, err error) {
+	err = s.read(func(get func(string) (*commonStorage.Item, error)) error {
+		set, err := getSet(get, key)
+		length = len(set)
+		return err
+	})
+	return
+}
+
+// SetIntersect returns sorted members which are in all sets. Missing keys are empty sets.
+// Error will occur if type of any key is not set.
+func (s *storage) SetIntersect(keys []string) ([]string, error) {
+	return s.combineSets(keys, commonStorage.IntersectSets)
+}
+
+// SetUnion returns sorted members which are in any of sets. Missing keys are empty sets.
+// Error will occur if type of any key is not set.
+func (s *storage) SetUnion(keys []string) ([]string, error) {
+	return s.combineSets(keys, commonStorage.UnionSets)
+}
+
+// SetDiff returns sorted members of the first set which are not in other sets. Missing keys are empty sets.
+// Error will occur if type of any key is not set.
+func (s *storage) SetDiff(keys []string) ([]string, error) {
+	return s.combineSets(keys, commonStorage.DiffSets)
+}
+
+func (s *storage) combineSets(keys []string, combine func([]commonStorage.Set) []string) (members []string, err error) {
+	err = s.read(func(get func(string) (*commonStorage.Item, error)) error {
+		sets := make([]commonStorage.Set, len(keys))
+		for i, key := range keys {
+			set, err := getSet(get, key)
+			if err != nil && err != commonStorage.KeyNotExistsError {
+				return err
+			}
+			sets[i] = set
+		}
+		members = combine(sets)
+		return nil
+	})
+	return
+}
@@ -0,0 +1,155 @@
+package boltdb
+
+import (
+	commonStorage "github.com/Barberrrry/jcache/server/storage"
+	"github.com/boltdb/bolt"
+)
+
+// getSortedSet returns sorted set of key using get function of read
+func getSortedSet(get func(string) (*commonStorage.Item, error), key string) (*commonStorage.SortedSet, error) {
+	item, err := get(key)
+	if err != nil {
+		return nil, err
+	}
+	return item.CastSortedSet()
+}
+
+// SortedSetAdd adds members or updates their scores and returns number of new members.
+// Sorted set is created if key doesn't exist. Error will occur if key type is not sorted set.
+func (s *storage) SortedSetAdd(key string, members []commonStorage.ScoredMember) (added int, err error) {
+	err = s.update(func(bucket *bolt.Bucket) error {
+		item, err := s.getItem(bucket, key)
+		isNew := err != nil
+		if isNew {
+			item = commonStorage.NewItem(commonStorage.NewSortedSet(), 0)
+		}
+		set, err := item.CastSortedSet()
+		if err != nil {
+			return err
+		}
+		var updated int
+		added, updated = set.Add(members...)
+		if added+updated == 0 && !isNew {
+			return s.touchItem(bucket, key, item)
+		}
+		return s.saveItem(bucket, key, item)
+	})
+	return
+}
+
+// SortedSetRemove removes members from sorted set and returns number of removed members.
+// Error will occur if key doesn't exist or key type is not sorted set.
+func (s *storage) SortedSetRemove(key string, members []string) (removed int, err error) {
+	err = s.update(func(bucket *bolt.Bucket) error {
+		item, err := s.getItem(bucket, key)
+		if err != nil {
+			return err
+		}
+		set, err := item.CastSortedSet()
+		if err != nil {
+			return err
+		}
+		removed = set.Remove(members...)
+		if removed == 0 {
+			return s.touchItem(bucket, key, item)
+		}
+		return s.saveItem(bucket, key, item)
+	})
+	return
+}
+
+// SortedSetScore returns score of member. Error will occur if key or member doesn't exist or key type is not sorted set.
+func (s *storage) SortedSetScore(key, member string) (score float64, err error) {
+	err = s.read(func(get func(string) (*commonStorage.Item, error)) error {
+		set, err := getSortedSet(get, key)
+		if err != nil {
+			return err
+		}
+		var found bool
+		if score, found = set.Score(member); !found {
+			return commonStorage.MemberNotExistError
+		}
+		return nil
+	})
+	return
+}
+
+// SortedSetIncrementBy adds delta to score of member and returns new score.
+// Sorted set and member are created if they don't exist. Error will occur if key type is not sorted set.
+func (s *storage) SortedSetIncrementBy(key, member string, delta float64) (score float64, err error) {
+	err = s.update(func(bucket *bolt.Bucket) error {
+		item, err := s.getItem(bucket, key)
+		if err != nil {
+			item = commonStorage.NewItem(commonStorage.NewSortedSet(), 0)
+		}
+		set, err := item.CastSortedSet()
+		if err != nil {
+			return err
+		}
+		if score, err = set.IncrementBy(member, delta); err != nil {
+			return err
+		}
+		return s.saveItem(bucket, key, item)
+	})
+	return
+}
+
+// SortedSetRange returns members from start to stop rank, negative ranks are counted from the end.
+// Members are ordered by descending score if reverse is set.
+// Error will occur if key doesn't exist or key type is not sorted set.
+func (s *storage) SortedSetRange(key string, start, stop int, reverse bool) (members []commonStorage.ScoredMember, err error) {
+	err = s.read(func(get func(string) (*commonStorage.Item, error)) error {
+		set, err := getSortedSet(get, key)
+		if err != nil {
+			return err
+		}
+		members = set.Range(start, stop, reverse)
+		return nil
+	})
+	return
+}
+
+// SortedSetRangeByScore returns members with score between min and max inclusive.
+// First offset members are skipped, negative count means all following members.
+// Error will occur if key doesn't exist or key type is not sorted set.
+func (s *storage) SortedSetRangeByScore(key string, min, max float64, offset, count int) (members []commonStorage.ScoredMember, err error) {
+	err = s.read(func(get func(string) (*commonStorage.Item, error)) error {
+		set, err := getSortedSet(get, key)
+		if err != nil {
+			return err
+		}
+		members = set.RangeByScore(min, max, offset, count)
+		return nil
+	})
+	return
+}
+
+// SortedSetRank returns 0-based rank of member in ascending order.
+// Error will occur if key or member doesn't exist or key type is not sorted set.
+func (s *storage) SortedSetRank(key, member string) (rank int, err error) {
+	err = s.read(func(get func(string) (*commonStorage.Item, error)) error {
+		set, err := getSortedSet(get, key)
+		if err != nil {
+			return err
+		}
+		var found bool
+		if rank, found = set.Rank(member); !found {
+			return commonStorage.MemberNotExistError
+		}
+		return nil
+	})
+	return
+}
+
+// SortedSetLen returns number of members. Error will occur if key doesn't exist or key type is not sorted set.
+func (s *storage) SortedSetLen(key string) (length int, err error) {
+	err = s.read(func(get func(string) (*commonStorage.Item, error)) error {
+		set, err := getSortedSet(get, key)
+		if err != nil {
+			return err
+		}
+		length = set.Len()
+		return nil
+	})
+	return
+}
@@ -3,9 +3,10 @@ package boltdb
 import (
 	"bytes"
 	"encoding/gob"
-	"errors"
+	"encoding/hex"
 	"fmt"
 	"sort"
+	"sync"
 	"time"
 
 	commonStorage "github.com/Barberrrry/jcache/server/storage"
@@ -14,20 +15,32 @@ import (
 
 var (
 	defaultBucketName = []byte("default")
-	notSupportedError = errors.New("Operation is not supported by BoltDB storage")
+	// listsBucketName is a bucket of list values, it contains nested bucket per list key
+	listsBucketName = []byte("lists")
 )
 
 // Storage uses BoltDB as a persistent file-based storage.
 // encoding/gob is used to encode/decode data structures to put them into BoltDB.
-// Unfortunately container/list couldn't be used in a such way, so this storage doesn't support lists :(
-// It may be implemented by custom list solution or by using some different encoder/decoder.
+// Lists are not encoded as a whole, item keeps only list header and values are stored separately, see list.go.
 type storage struct {
 	db *bolt.DB
+	// tx is set for storage which is passed to transaction function
+	tx *bolt.Tx
+	// waiters are queues of blocked pops by list key, they are shared with transaction storage
+	waiters *listWaiters
+	// pushed contains keys pushed inside of transaction, their waiters are served after commit
+	pushed map[string]bool
+	// notifier receives keyspace events of GC
+	notifier   commonStorage.Notifier
+	notifierMu sync.Mutex
 }
 
 func init() {
 	gob.Register(commonStorage.Item{})
 	gob.Register(commonStorage.Hash{})
+	gob.Register(commonStorage.Set{})
+	gob.Register(&commonStorage.SortedSet{})
+	gob.Register(&commonStorage.ListHeader{})
 }
 
 func NewStorage(filePath string, gcInterval time.Duration) (*storage, error) {
@@ -36,22 +49,28 @@ func NewStorage(filePath string, gcInterval time.Duration) (*storage, error) {
 		return nil, fmt.Errorf("Cannot open Bolt file: %s", err)
 	}
 	err = db.Update(func(tx *bolt.Tx) error {
-		_, err := tx.CreateBucketIfNotExists(defaultBucketName)
-		return err
+		for _, name := range [][]byte{defaultBucketName, listsBucketName} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
 	})
 	if err != nil {
 		return nil, fmt.Errorf("Cannot create bucket: %s", err)
 	}
 
-	s := &storage{db: db}
+	s := &storage{db: db, waiters: newListWaiters()}
 	go s.gc(gcInterval)
 
 	return s, nil
 }
 
+// gc removes expired keys and expired fields of hashes
 func (s *storage) gc(interval time.Duration) {
 	for _ = range time.Tick(interval) {
 		deleteKeys := [][]byte{}
+		hashKeys := [][]byte{}
 		err := s.db.View(func(tx *bolt.Tx) error {
 			bucket := tx.Bucket(defaultBucketName)
 			cursor := bucket.Cursor()
@@ -63,45 +82,195 @@ func (s *storage) gc(interval time.Duration) {
 					return err
 				}
 
+				// Key is valid only inside of transaction, so it is copied
 				if !item.IsAlive() {
-					deleteKeys = append(deleteKeys, key)
+					deleteKeys = append(deleteKeys, append([]byte(nil), key...))
+				} else if item.HasExpiredFields() {
+					hashKeys = append(hashKeys, append([]byte(nil), key...))
 				}
 			}
 			return nil
 		})
-		if err == nil && len(deleteKeys) > 0 {
-			s.db.Update(func(tx *bolt.Tx) error {
+		if err == nil && len(deleteKeys)+len(hashKeys) > 0 {
+			var expiredKeys []string
+			err = s.db.Update(func(tx *bolt.Tx) error {
+				expiredKeys = nil
 				bucket := tx.Bucket(defaultBucketName)
 				for _, key := range deleteKeys {
-					bucket.Delete(key)
+					// Key could be overwritten or deleted since it was found
+					data := bucket.Get(key)
+					if data == nil {
+						continue
+					}
+					if item, err := decodeItem(data); err != nil || item.IsAlive() {
+						continue
+					}
+					if deleteItem(bucket, string(key)) == nil {
+						expiredKeys = append(expiredKeys, string(key))
+					}
+				}
+				for _, key := range hashKeys {
+					item, err := s.getItem(bucket, string(key))
+					if err == nil && item.RemoveExpiredFields() {
+						s.putItem(bucket, string(key), item)
+					}
 				}
 				return nil
 			})
+			if err == nil {
+				s.notify(commonStorage.EventExpired, expiredKeys...)
+			}
 		}
 	}
 }
 
+// SetNotifier sets function which receives keyspace events.
+// Only removal of expired keys by GC is reported by Bolt storage.
+func (s *storage) SetNotifier(notifier commonStorage.Notifier) {
+	s.notifierMu.Lock()
+	defer s.notifierMu.Unlock()
+	s.notifier = notifier
+}
+
+func (s *storage) notify(event string, keys ...string) {
+	s.notifierMu.Lock()
+	defer s.notifierMu.Unlock()
+	if s.notifier == nil {
+		return
+	}
+	for _, key := range keys {
+		s.notifier(event, key)
+	}
+}
+
+// Transaction calls fn inside of single read-write Bolt transaction which is rolled back if fn returns error.
+// Waiters of lists pushed inside of transaction are served after commit.
+func (s *storage) Transaction(fn func(commonStorage.Storage) error) error {
+	txStorage := &storage{db: s.db, waiters: s.waiters, pushed: make(map[string]bool)}
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		txStorage.tx = tx
+		return fn(txStorage)
+	})
+	if err != nil {
+		return err
+	}
+	for key := range txStorage.pushed {
+		s.serveWaiters(key)
+	}
+	return nil
+}
+
+// update calls fn with default bucket inside of new read-write transaction or inside of storage transaction
+func (s *storage) update(fn func(bucket *bolt.Bucket) error) error {
+	if s.tx != nil {
+		return fn(s.tx.Bucket(defaultBucketName))
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return fn(tx.Bucket(defaultBucketName))
+	})
+}
+
+// view calls fn with default bucket inside of new read-only transaction or inside of storage transaction
+func (s *storage) view(fn func(bucket *bolt.Bucket) error) error {
+	if s.tx != nil {
+		return fn(s.tx.Bucket(defaultBucketName))
+	}
+	return s.db.View(func(tx *bolt.Tx) error {
+		return fn(tx.Bucket(defaultBucketName))
+	})
+}
+
+// read calls fn inside of read-only transaction like view. Items returned by get are accessed,
+// so expiration of sliding ones is extended afterwards in read-write transaction if fn succeeds.
+func (s *storage) read(fn func(get func(key string) (*commonStorage.Item, error)) error) error {
+	var sliding []string
+	err := s.view(func(bucket *bolt.Bucket) error {
+		return fn(func(key string) (*commonStorage.Item, error) {
+			item, err := s.getItem(bucket, key)
+			if err == nil && item.SlidingTTL > 0 {
+				sliding = append(sliding, key)
+			}
+			return item, err
+		})
+	})
+	if err == nil && len(sliding) > 0 {
+		err = s.touch(sliding...)
+	}
+	return err
+}
+
+// touch extends expiration of sliding keys without changing their versions
+func (s *storage) touch(keys ...string) error {
+	return s.update(func(bucket *bolt.Bucket) error {
+		for _, key := range keys {
+			item, err := s.getItem(bucket, key)
+			if err != nil {
+				continue
+			}
+			if err := s.touchItem(bucket, key, item); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// touchItem extends expiration of sliding item which is accessed in read-write transaction without changes
+func (s *storage) touchItem(bucket *bolt.Bucket, key string, item *commonStorage.Item) error {
+	if item.SlidingTTL == 0 {
+		return nil
+	}
+	item.Touch()
+	return s.putItem(bucket, key, item)
+}
+
 func (s *storage) getItem(bucket *bolt.Bucket, key string) (*commonStorage.Item, error) {
 	data := bucket.Get([]byte(key))
 	if data == nil {
 		return nil, commonStorage.KeyNotExistsError
 	}
 
-	dec := gob.NewDecoder(bytes.NewBuffer(data))
-	var item commonStorage.Item
-	err := dec.Decode(&item)
+	item, err := decodeItem(data)
 	if err != nil {
 		return nil, err
 	}
 
 	if item.IsAlive() {
-		return &item, nil
+		return item, nil
 	} else {
 		return nil, commonStorage.KeyNotExistsError
 	}
 }
 
+func decodeItem(data []byte) (*commonStorage.Item, error) {
+	dec := gob.NewDecoder(bytes.NewBuffer(data))
+	item := &commonStorage.Item{}
+	if err := dec.Decode(item); err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+// saveItem sets new item version from bucket sequence and puts encoded item into bucket.
+// Item is changed, so its sliding expiration is extended too.
+// Values of list are removed if the list is overwritten by value of another type.
 func (s *storage) saveItem(bucket *bolt.Bucket, key string, item *commonStorage.Item) error {
+	if _, isList := item.Value.(*commonStorage.ListHeader); !isList {
+		if err := deleteListValues(bucket, key); err != nil {
+			return err
+		}
+	}
+	version, err := bucket.NextSequence()
+	if err != nil {
+		return err
+	}
+	item.Version = version
+	item.Touch()
+	return s.putItem(bucket, key, item)
+}
+
+// putItem puts encoded item into bucket as is
+func (s *storage) putItem(bucket *bolt.Bucket, key string, item *commonStorage.Item) error {
 	buf := &bytes.Buffer{}
 	enc := gob.NewEncoder(buf)
 	err := enc.Encode(item)
@@ -115,8 +284,17 @@ func (s *storage) saveItem(bucket *bolt.Bucket, key string, item *commonStorage.
 	return nil
 }
 
-func (s *storage) getHash(bucket *bolt.Bucket, key string) (commonStorage.Hash, error) {
-	item, err := s.getItem(bucket, key)
+// deleteItem removes item from bucket together with values of list
+func deleteItem(bucket *bolt.Bucket, key string) error {
+	if err := deleteListValues(bucket, key); err != nil {
+		return err
+	}
+	return bucket.Delete([]byte(key))
+}
+
+// getHash returns hash of key using get function of read
+func getHash(get func(string) (*commonStorage.Item, error), key string) (commonStorage.Hash, error) {
+	item, err := get(key)
 	if err != nil {
 		return nil, err
 	}
@@ -129,13 +307,10 @@ func (s *storage) getHash(bucket *bolt.Bucket, key string) (commonStorage.Hash,
 
 // Keys returns list of all keys
 func (s *storage) Keys() (keys []string) {
-	s.db.View(func(tx *bolt.Tx) error {
-		bucket := tx.Bucket(defaultBucketName)
+	s.view(func(bucket *bolt.Bucket) error {
 		cursor := bucket.Cursor()
 		for key, value := cursor.First(); key != nil; key, value = cursor.Next() {
-			dec := gob.NewDecoder(bytes.NewBuffer(value))
-			item := &commonStorage.Item{}
-			err := dec.Decode(item)
+			item, err := decodeItem(value)
 			if err != nil {
 				return err
 			}
@@ -150,10 +325,52 @@ func (s *storage) Keys() (keys []string) {
 	return
 }
 
+// Scan returns keys in bolt key order starting from cursor until options.Limit() keys are examined.
+// Cursor is a hex encoded key to start from. Returned cursor is ScanStart when all keys are examined.
+func (s *storage) Scan(cursor string, options commonStorage.ScanOptions) (next string, keys []string, err error) {
+	var start []byte
+	if cursor != commonStorage.ScanStart {
+		if start, err = hex.DecodeString(cursor); err != nil || len(start) == 0 {
+			return "", nil, commonStorage.InvalidCursorError
+		}
+	}
+
+	keys = []string{}
+	next = commonStorage.ScanStart
+	err = s.view(func(bucket *bolt.Bucket) error {
+		c := bucket.Cursor()
+		key, value := c.First()
+		if start != nil {
+			key, value = c.Seek(start)
+		}
+		for examined := 0; key != nil; key, value = c.Next() {
+			if examined == options.Limit() {
+				next = hex.EncodeToString(key)
+				return nil
+			}
+			examined++
+			if !options.MatchKey(string(key)) {
+				continue
+			}
+			item, err := decodeItem(value)
+			if err != nil {
+				return err
+			}
+			if options.MatchItem(item) {
+				keys = append(keys, string(key))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	return
+}
+
 // Expire sets new key ttl
 func (s *storage) Expire(key string, ttl uint64) error {
-	return s.db.Update(func(tx *bolt.Tx) error {
-		bucket := tx.Bucket(defaultBucketName)
+	return s.update(func(bucket *bolt.Bucket) error {
 		item, err := s.getItem(bucket, key)
 		if err != nil {
 			return err
@@ -164,25 +381,126 @@ func (s *storage) Expire(key string, ttl uint64) error {
 	})
 }
 
+// ExpireAt sets time when specified key expires. Zero time makes key exist forever.
+// Error will occur if key doesn't exist.
+func (s *storage) ExpireAt(key string, expireTime time.Time) error {
+	return s.update(func(bucket *bolt.Bucket) error {
+		item, err := s.getItem(bucket, key)
+		if err != nil {
+			return err
+		}
+
+		item.SetExpireTime(expireTime)
+		return s.saveItem(bucket, key, item)
+	})
+}
+
+// ExpireSliding makes specified key expire after ttl since the last access. Zero ttl makes key exist forever.
+// Error will occur if key doesn't exist.
+func (s *storage) ExpireSliding(key string, ttl time.Duration) error {
+	return s.update(func(bucket *bolt.Bucket) error {
+		item, err := s.getItem(bucket, key)
+		if err != nil {
+			return err
+		}
+
+		item.SetSlidingTTL(ttl)
+		return s.saveItem(bucket, key, item)
+	})
+}
+
+// Touch extends expiration of specified key if it is sliding. Error will occur if key doesn't exist.
+func (s *storage) Touch(key string) error {
+	return s.read(func(get func(string) (*commonStorage.Item, error)) error {
+		_, err := get(key)
+		return err
+	})
+}
+
+// Persist removes ttl of specified key, so key exists forever
+func (s *storage) Persist(key string) error {
+	return s.ExpireAt(key, time.Time{})
+}
+
+// Type returns type of specified key value. Error will occur if key doesn't exist.
+func (s *storage) Type(key string) (keyType string, err error) {
+	err = s.view(func(bucket *bolt.Bucket) error {
+		item, err := s.getItem(bucket, key)
+		if err != nil {
+			return err
+		}
+		keyType = item.Type()
+		return nil
+	})
+	return
+}
+
+// ExpireTime returns time when specified key expires, it is zero if key exists forever.
+// Error will occur if key doesn't exist.
+func (s *storage) ExpireTime(key string) (expireTime time.Time, err error) {
+	err = s.view(func(bucket *bolt.Bucket) error {
+		item, err := s.getItem(bucket, key)
+		if err != nil {
+			return err
+		}
+		expireTime = item.ExpireTime
+		return nil
+	})
+	return
+}
+
 // Get value of specified key. Error will occur if key doesn't exist or key type is not string.
 func (s *storage) Get(key string) (value string, err error) {
-	err = s.db.View(func(tx *bolt.Tx) error {
-		bucket := tx.Bucket(defaultBucketName)
-		item, err := s.getItem(bucket, key)
+	err = s.read(func(get func(string) (*commonStorage.Item, error)) error {
+		item, err := get(key)
+		if err != nil {
+			return err
+		}
+		value, err = item.CastString()
+		return err
+	})
+	return
+}
+
+// GetWithVersion returns value and version of specified key.
+// Error will occur if key doesn't exist or key type is not string.
+func (s *storage) GetWithVersion(key string) (value string, version uint64, err error) {
+	err = s.read(func(get func(string) (*commonStorage.Item, error)) error {
+		item, err := get(key)
 		if err != nil {
 			return err
 		}
 		value, err = item.CastString()
+		version = item.Version
 		return err
 	})
 	return
 }
 
+// CompareAndSwap updates value of specified key only if key version wasn't changed.
+// Error will occur if key doesn't exist, key type is not string or version doesn't match.
+func (s *storage) CompareAndSwap(key, value string, version uint64) error {
+	return s.update(func(bucket *bolt.Bucket) error {
+		item, err := s.getItem(bucket, key)
+		if err != nil {
+			return err
+		}
+		if _, err := item.CastString(); err != nil {
+			return err
+		}
+		if item.Version != version {
+			return commonStorage.VersionMismatchError
+		}
+
+		item.Value = value
+		return s.saveItem(bucket, key, item)
+	})
+}
+
 // Set value of specified key with ttl. Use zero ttl if key should exist forever.
 // Error will occur if key already exists.
 func (s *storage) Set(key, value string, ttl uint64) error {
-	return s.db.Update(func(tx *bolt.Tx) error {
-		bucket := tx.Bucket(defaultBucketName)
+	return s.update(func(bucket *bolt.Bucket) error {
 		item, _ := s.getItem(bucket, key)
 		if item != nil {
 			return commonStorage.KeyAlreadyExistsError
@@ -193,36 +511,131 @@ func (s *storage) Set(key, value string, ttl uint64) error {
 	})
 }
 
+// SetWithOptions sets value of specified key with ttl according to options.
+// Previous value is returned only if options.Get is set and key existed.
+// Error will occur if key existence doesn't match options.Mode or key type is not string while options.Get is set.
+func (s *storage) SetWithOptions(key, value string, ttl uint64, options commonStorage.SetOptions) (old string, existed bool, err error) {
+	err = s.update(func(bucket *bolt.Bucket) error {
+		current, _ := s.getItem(bucket, key)
+		item, prev, err := commonStorage.PrepareSet(current, value, ttl, options)
+		if err != nil {
+			return err
+		}
+		old, existed = prev, current != nil
+		return s.saveItem(bucket, key, item)
+	})
+	if err != nil {
+		return "", false, err
+	}
+	return
+}
+
 // Update value of specified key. Error will occur if key doesn't exist or key type is not string.
 func (s *storage) Update(key, value string) error {
-	return s.db.Update(func(tx *bolt.Tx) error {
-		bucket := tx.Bucket(defaultBucketName)
+	return s.update(func(bucket *bolt.Bucket) error {
 		item, err := s.getItem(bucket, key)
 		if err != nil {
 			return err
 		}
+		if _, err := item.CastString(); err != nil {
+			return err
+		}
 
 		item.Value = value
 		return s.saveItem(bucket, key, item)
 	})
 }
 
+// Increment adds delta to integer value of specified key and returns the new value.
+// Missing key is created with zero value and ttl before increment.
+// Error will occur if key type is not string, value is not an integer or result overflows.
+func (s *storage) Increment(key string, delta int64, ttl uint64) (value int64, err error) {
+	err = s.update(func(bucket *bolt.Bucket) error {
+		item, err := s.getItem(bucket, key)
+		if err == commonStorage.KeyNotExistsError {
+			item = commonStorage.NewItem("0", ttl)
+		} else if err != nil {
+			return err
+		}
+
+		value, err = item.Increment(delta)
+		if err != nil {
+			return err
+		}
+		return s.saveItem(bucket, key, item)
+	})
+	return
+}
+
 // Delete specified key. Error will occur if key doesn't exist. It works for any key type.
 func (s *storage) Delete(key string) error {
-	return s.db.Update(func(tx *bolt.Tx) error {
-		bucket := tx.Bucket(defaultBucketName)
+	return s.update(func(bucket *bolt.Bucket) error {
 		_, err := s.getItem(bucket, key)
 		if err != nil {
 			return err
 		}
-		return bucket.Delete([]byte(key))
+		return deleteItem(bucket, key)
 	})
 }
 
+// GetMulti returns values of specified keys within one transaction.
+// Error of every key is returned at the same position, it is nil if value is found.
+func (s *storage) GetMulti(keys []string) ([]string, []error) {
+	values := make([]string, len(keys))
+	errs := make([]error, len(keys))
+	err := s.read(func(get func(string) (*commonStorage.Item, error)) error {
+		for i, key := range keys {
+			item, err := get(key)
+			if err == nil {
+				values[i], err = item.CastString()
+			}
+			errs[i] = err
+		}
+		return nil
+	})
+	return values, fillErrors(errs, err)
+}
+
+// SetMulti sets values of specified keys with ttl within one transaction. Existing keys of any type are overwritten.
+func (s *storage) SetMulti(keys, values []string, ttl uint64) []error {
+	errs := make([]error, len(keys))
+	err := s.update(func(bucket *bolt.Bucket) error {
+		for i, key := range keys {
+			errs[i] = s.saveItem(bucket, key, commonStorage.NewItem(values[i], ttl))
+		}
+		return nil
+	})
+	return fillErrors(errs, err)
+}
+
+// DeleteMulti deletes specified keys within one transaction.
+// Error of every key is returned at the same position, it is nil if key is deleted.
+func (s *storage) DeleteMulti(keys []string) []error {
+	errs := make([]error, len(keys))
+	err := s.update(func(bucket *bolt.Bucket) error {
+		for i, key := range keys {
+			if _, errs[i] = s.getItem(bucket, key); errs[i] == nil {
+				errs[i] = deleteItem(bucket, key)
+			}
+		}
+		return nil
+	})
+	return fillErrors(errs, err)
+}
+
+// fillErrors sets error of every key to transaction error if transaction failed
+func fillErrors(errs []error, err error) []error {
+	if err != nil {
+		for i := range errs {
+			errs[i] = err
+		}
+	}
+	return errs
+}
+
 // HashCreate creates new hash with specified key and ttl. Use zero ttl if key should exist forever.
 func (s *storage) HashCreate(key string, ttl uint64) error {
-	return s.db.Update(func(tx *bolt.Tx) error {
-		bucket := tx.Bucket(defaultBucketName)
+	return s.update(func(bucket *bolt.Bucket) error {
 		item, _ := s.getItem(bucket, key)
 		if item != nil {
 			return commonStorage.KeyAlreadyExistsError
@@ -236,9 +649,8 @@ func (s *storage) HashCreate(key string, ttl uint64) error {
 // HashGet returns value of specified field of key.
 // Error will occur if key or field doesn't exist or key type is not hash.
 func (s *storage) HashGet(key, field string) (value string, err error) {
-	err = s.db.View(func(tx *bolt.Tx) error {
-		bucket := tx.Bucket(defaultBucketName)
-		hash, err := s.getHash(bucket, key)
+	err = s.read(func(get func(string) (*commonStorage.Item, error)) error {
+		hash, err := getHash(get, key)
 		if err != nil {
 			return err
 		}
@@ -250,9 +662,8 @@ func (s *storage) HashGet(key, field string) (value string, err error) {
 
 // HashGetAll returns all hash values of specified key. Error will occur if key doesn't exist or key type is not hash.
 func (s *storage) HashGetAll(key string) (hash map[string]string, err error) {
-	err = s.db.View(func(tx *bolt.Tx) (err error) {
-		bucket := tx.Bucket(defaultBucketName)
-		hash, err = s.getHash(bucket, key)
+	err = s.read(func(get func(string) (*commonStorage.Item, error)) (err error) {
+		hash, err = getHash(get, key)
 		return err
 	})
 	return
@@ -260,8 +671,7 @@ func (s *storage) HashGetAll(key string) (hash map[string]string, err error) {
 
 // HashSet sets field value of specified key. Error will occur if key doesn't exist or key type is not hash.
 func (s *storage) HashSet(key, field, value string) error {
-	return s.db.Update(func(tx *bolt.Tx) error {
-		bucket := tx.Bucket(defaultBucketName)
+	return s.update(func(bucket *bolt.Bucket) error {
 		item, err := s.getItem(bucket, key)
 		if err != nil {
 			item = commonStorage.NewItem(make(commonStorage.Hash), 0)
@@ -271,6 +681,7 @@ func (s *storage) HashSet(key, field, value string) error {
 			return err
 		}
 		hash[field] = value
+		item.PersistFields(field)
 
 		return s.saveItem(bucket, key, item)
 	})
@@ -278,8 +689,7 @@ func (s *storage) HashSet(key, field, value string) error {
 
 // HashDelete deletes field from hash. Error will occur if key doesn't exist or key type is not hash.
 func (s *storage) HashDelete(key, field string) error {
-	return s.db.Update(func(tx *bolt.Tx) error {
-		bucket := tx.Bucket(defaultBucketName)
+	return s.update(func(bucket *bolt.Bucket) error {
 		item, err := s.getItem(bucket, key)
 		if err != nil {
 			return err
@@ -293,15 +703,15 @@ func (s *storage) HashDelete(key, field string) error {
 			return err
 		}
 		delete(hash, field)
+		item.PersistFields(field)
 		return s.saveItem(bucket, key, item)
 	})
 }
 
 // HashLen returns count of hash fields. Error will occur if key doesn't exist or key type is not hash.
 func (s *storage) HashLen(key string) (length int, err error) {
-	err = s.db.View(func(tx *bolt.Tx) error {
-		bucket := tx.Bucket(defaultBucketName)
-		hash, err := s.getHash(bucket, key)
+	err = s.read(func(get func(string) (*commonStorage.Item, error)) error {
+		hash, err := getHash(get, key)
 		if err != nil {
 			return err
 		}
@@ -313,9 +723,8 @@ func (s *storage) HashLen(key string) (length int, err error) {
 
 // HashKeys returns list of all hash fields. Error will occur if key doesn't exist or key type is not hash.
 func (s *storage) HashKeys(key string) (keys []string, err error) {
-	err = s.db.View(func(tx *bolt.Tx) error {
-		bucket := tx.Bucket(defaultBucketName)
-		hash, err := s.getHash(bucket, key)
+	err = s.read(func(get func(string) (*commonStorage.Item, error)) error {
+		hash, err := getHash(get, key)
 		if err != nil {
 			return err
 		}
@@ -328,40 +737,143 @@ func (s *storage) HashKeys(key string) (keys []string, err error) {
 	return
 }
 
-// ListCreate creates new list with specified key and ttl. Use zero duration if key should exist forever.
-func (s *storage) ListCreate(key string, ttl uint64) error {
-	return notSupportedError
+// updateHash calls fn with hash of key inside of read-write transaction, hash is created if key doesn't exist.
+// Hash is saved with new version only if fn reports that it is changed.
+func (s *storage) updateHash(key string, fn func(item *commonStorage.Item, hash commonStorage.Hash) (bool, error)) error {
+	return s.update(func(bucket *bolt.Bucket) error {
+		item, err := s.getItem(bucket, key)
+		if err == commonStorage.KeyNotExistsError {
+			item = commonStorage.NewItem(make(commonStorage.Hash), 0)
+		} else if err != nil {
+			return err
+		}
+		hash, err := item.CastHash()
+		if err != nil {
+			return err
+		}
+		changed, err := fn(item, hash)
+		if err != nil {
+			return err
+		}
+		if !changed {
+			return s.touchItem(bucket, key, item)
+		}
+		return s.saveItem(bucket, key, item)
+	})
 }
 
-// ListLeftPop pops value from the list beginning.
-// Error will occur if key doesn't exist, key type is not list or list is empty.
-func (s *storage) ListLeftPop(key string) (value string, err error) {
-	return "", notSupportedError
+// HashGetMulti returns values of specified fields of key within one transaction.
+// Error of every field is returned at the same position, it is nil if value is found.
+func (s *storage) HashGetMulti(key string, fields []string) ([]string, []error) {
+	values := make([]string, len(fields))
+	errs := make([]error, len(fields))
+	err := s.read(func(get func(string) (*commonStorage.Item, error)) error {
+		hash, err := getHash(get, key)
+		if err != nil {
+			return err
+		}
+		values, errs = hash.GetValues(fields)
+		return nil
+	})
+	return values, fillErrors(errs, err)
 }
 
-// ListRightPop pops value from the list ending.
-// Error will occur if key doesn't exist, key type is not list or list is empty.
-func (s *storage) ListRightPop(key string) (value string, err error) {
-	return "", notSupportedError
+// HashSetMulti sets values of specified fields of key and returns number of new fields.
+// Hash is created if key doesn't exist. Error will occur if key type is not hash.
+func (s *storage) HashSetMulti(key string, fields, values []string) (added int, err error) {
+	err = s.updateHash(key, func(item *commonStorage.Item, hash commonStorage.Hash) (bool, error) {
+		added = hash.SetValues(fields, values)
+		item.PersistFields(fields...)
+		return true, nil
+	})
+	return
 }
 
-// ListLeftPush adds value to the list beginning. Error will occur if key doesn't exist or key type is not list.
-func (s *storage) ListLeftPush(key, value string) error {
-	return notSupportedError
+// HashIncrementBy adds delta to integer value of field and returns the new value.
+// Missing key and field are created with zero value before increment.
+// Error will occur if key type is not hash, value is not an integer or result overflows.
+func (s *storage) HashIncrementBy(key, field string, delta int64) (value int64, err error) {
+	err = s.updateHash(key, func(_ *commonStorage.Item, hash commonStorage.Hash) (bool, error) {
+		value, err = hash.Increment(field, delta)
+		return err == nil, err
+	})
+	return
 }
 
-// ListRightPush adds value to the list ending. Error will occur if key doesn't exist or key type is not list.
-func (s *storage) ListRightPush(key, value string) error {
-	return notSupportedError
+// HashSetIfNotExists sets field value only if field doesn't exist and reports whether it was set.
+// Hash is created if key doesn't exist. Error will occur if key type is not hash.
+func (s *storage) HashSetIfNotExists(key, field, value string) (set bool, err error) {
+	err = s.updateHash(key, func(_ *commonStorage.Item, hash commonStorage.Hash) (bool, error) {
+		if _, found := hash[field]; found {
+			return false, nil
+		}
+		hash[field], set = value, true
+		return true, nil
+	})
+	return
 }
 
-// ListLen returns count of elements in the list. Error will occur if key doesn't exist or key type is not list.
-func (s *storage) ListLen(key string) (length int, err error) {
-	return 0, notSupportedError
+// HashExists reports whether field exists in hash. Error will occur if key doesn't exist or key type is not hash.
+func (s *storage) HashExists(key, field string) (found bool, err error) {
+	err = s.read(func(get func(string) (*commonStorage.Item, error)) error {
+		hash, err := getHash(get, key)
+		if err != nil {
+			return err
+		}
+		_, found = hash[field]
+		return nil
+	})
+	return
 }
 
-// ListRange returns list of elements from the list from start to stop index.
-// Error will occur if key doesn't exist or key type is not list.
-func (s *storage) ListRange(key string, start, stop int) (values []string, err error) {
-	return nil, notSupportedError
+// HashScan returns fields of hash starting from cursor until options.Limit() fields are examined, see Hash.Scan.
+// Error will occur if key doesn't exist, key type is not hash or cursor is not valid.
+func (s *storage) HashScan(key, cursor string, options commonStorage.ScanOptions) (next string, fields map[string]string, err error) {
+	err = s.read(func(get func(string) (*commonStorage.Item, error)) error {
+		hash, err := getHash(get, key)
+		if err != nil {
+			return err
+		}
+		next, fields, err = hash.Scan(cursor, options)
+		return err
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	return
+}
+
+// HashExpireAt sets time when hash field expires. Zero time makes field exist forever.
+// Error will occur if key or field doesn't exist or key type is not hash.
+func (s *storage) HashExpireAt(key, field string, expireTime time.Time) error {
+	return s.update(func(bucket *bolt.Bucket) error {
+		item, err := s.getItem(bucket, key)
+		if err != nil {
+			return err
+		}
+		if err := item.SetFieldExpireTime(field, expireTime); err != nil {
+			return err
+		}
+		return s.saveItem(bucket, key, item)
+	})
+}
+
+// HashPersist removes expiration of hash field.
+// Error will occur if key or field doesn't exist or key type is not hash.
+func (s *storage) HashPersist(key, field string) error {
+	return s.HashExpireAt(key, field, time.Time{})
+}
+
+// HashExpireTime returns time when hash field expires, it is zero if field exists forever.
+// Error will occur if key or field doesn't exist or key type is not hash.
+func (s *storage) HashExpireTime(key, field string) (expireTime time.Time, err error) {
+	err = s.read(func(get func(string) (*commonStorage.Item, error)) error {
+		item, err := get(key)
+		if err != nil {
+			return err
+		}
+		expireTime, err = item.FieldExpireTime(field)
+		return err
+	})
+	return
 }
@@ -0,0 +1,324 @@
+package boltdb
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	commonStorage "github.com/Barberrrry/jcache/server/storage"
+	"github.com/boltdb/bolt"
+	. "gopkg.in/check.v1"
+)
+
+type StorageTestSuite struct{}
+
+var _ = Suite(&StorageTestSuite{})
+
+func Test(t *testing.T) {
+	TestingT(t)
+}
+
+func newTestStorage(c *C) *storage {
+	storage, err := NewStorage(filepath.Join(c.MkDir(), "test.db"), time.Minute)
+	c.Assert(err, IsNil)
+	return storage
+}
+
+// storedValues returns values of list as they are stored in nested bucket, nil is returned if bucket doesn't exist
+func (s *storage) storedValues(key string) (values []string) {
+	s.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(listsBucketName).Bucket([]byte(key))
+		if bucket == nil {
+			return nil
+		}
+		values = []string{}
+		return bucket.ForEach(func(_, value []byte) error {
+			values = append(values, string(value))
+			return nil
+		})
+	})
+	return
+}
+
+func (s *storage) waitersCount(key string) int {
+	s.waiters.mu.Lock()
+	defer s.waiters.mu.Unlock()
+	return len(s.waiters.queues[key])
+}
+
+// assertList checks values of list and that no value is left outside of the list
+func assertList(c *C, storage *storage, key string, expected []string) {
+	values, err := storage.ListRange(key, 0, -1)
+	c.Assert(err, IsNil)
+	c.Assert(append([]string{}, values...), DeepEquals, expected)
+	c.Assert(storage.storedValues(key), DeepEquals, expected)
+	length, _ := storage.ListLen(key)
+	c.Assert(length, Equals, len(expected))
+}
+
+func (s *StorageTestSuite) TestListPushAndPop(c *C) {
+	storage := newTestStorage(c)
+
+	c.Assert(storage.ListRightPush("key", "2"), IsNil)
+	c.Assert(storage.ListLeftPush("key", "1"), IsNil)
+	c.Assert(storage.ListRightPush("key", "3"), IsNil)
+	c.Assert(storage.ListLeftPush("key", "0"), IsNil)
+	assertList(c, storage, "key", []string{"0", "1", "2", "3"})
+	value, _ := storage.ListIndex("key", 0)
+	c.Assert(value, Equals, "0")
+	value, _ = storage.ListIndex("key", -1)
+	c.Assert(value, Equals, "3")
+
+	value, err := storage.ListLeftPop("key")
+	c.Assert(err, IsNil)
+	c.Assert(value, Equals, "0")
+	value, err = storage.ListRightPop("key")
+	c.Assert(err, IsNil)
+	c.Assert(value, Equals, "3")
+	assertList(c, storage, "key", []string{"1", "2"})
+
+	// Both ends may pass the middle position of empty list
+	storage.ListLeftPop("key")
+	storage.ListLeftPop("key")
+	_, err = storage.ListLeftPop("key")
+	c.Assert(err, Equals, commonStorage.ListEmptyError)
+	_, err = storage.ListRightPop("key")
+	c.Assert(err, Equals, commonStorage.ListEmptyError)
+	storage.ListLeftPush("key", "a")
+	storage.ListRightPush("key", "b")
+	value, _ = storage.ListRightPop("key")
+	c.Assert(value, Equals, "b")
+	value, _ = storage.ListRightPop("key")
+	c.Assert(value, Equals, "a")
+	storage.ListRightPush("key", "c")
+	assertList(c, storage, "key", []string{"c"})
+
+	storage.Set("string", "value", 0)
+	c.Assert(storage.ListLeftPush("string", "value"), Equals, commonStorage.KeyListTypeError)
+	_, err = storage.ListRightPop("string")
+	c.Assert(err, Equals, commonStorage.KeyListTypeError)
+	_, err = storage.ListLeftPop("missing")
+	c.Assert(err, Equals, commonStorage.KeyNotExistsError)
+}
+
+func (s *StorageTestSuite) TestListInsert(c *C) {
+	storage := newTestStorage(c)
+	for _, value := range []string{"a", "b", "c", "d", "e", "f"} {
+		storage.ListRightPush("key", value)
+	}
+
+	// Values before pivot near the head are moved towards the head
+	length, err := storage.ListInsert("key", "b", "x", true)
+	c.Assert(err, IsNil)
+	c.Assert(length, Equals, 7)
+	assertList(c, storage, "key", []string{"a", "x", "b", "c", "d", "e", "f"})
+
+	// Values after pivot near the tail are moved towards the tail
+	length, err = storage.ListInsert("key", "e", "y", false)
+	c.Assert(err, IsNil)
+	c.Assert(length, Equals, 8)
+	assertList(c, storage, "key", []string{"a", "x", "b", "c", "d", "e", "y", "f"})
+
+	// Both ends
+	storage.ListInsert("key", "a", "first", true)
+	storage.ListInsert("key", "f", "last", false)
+	assertList(c, storage, "key", []string{"first", "a", "x", "b", "c", "d", "e", "y", "f", "last"})
+
+	// Pivot is found by value after the head is moved
+	storage.ListLeftPush("key", "head")
+	length, _ = storage.ListInsert("key", "first", "z", false)
+	c.Assert(length, Equals, 12)
+	assertList(c, storage, "key", []string{"head", "first", "z", "a", "x", "b", "c", "d", "e", "y", "f", "last"})
+
+	_, err = storage.ListInsert("key", "missing", "value", true)
+	c.Assert(err, Equals, commonStorage.PivotNotExistError)
+	_, err = storage.ListInsert("missing", "a", "value", true)
+	c.Assert(err, Equals, commonStorage.KeyNotExistsError)
+}
+
+func (s *StorageTestSuite) TestListSet(c *C) {
+	storage := newTestStorage(c)
+	storage.ListRightPush("key", "b")
+	storage.ListLeftPush("key", "a")
+	storage.ListRightPush("key", "c")
+
+	c.Assert(storage.ListSet("key", 0, "A"), IsNil)
+	c.Assert(storage.ListSet("key", -1, "C"), IsNil)
+	c.Assert(storage.ListSet("key", 3, "D"), Equals, commonStorage.IndexOutOfRangeError)
+	assertList(c, storage, "key", []string{"A", "b", "C"})
+}
+
+func (s *StorageTestSuite) TestListRemove(c *C) {
+	storage := newTestStorage(c)
+	for _, value := range []string{"x", "a", "x", "b", "x", "c", "x"} {
+		storage.ListRightPush("key", value)
+	}
+
+	removed, err := storage.ListRemove("key", 2, "x")
+	c.Assert(err, IsNil)
+	c.Assert(removed, Equals, 2)
+	assertList(c, storage, "key", []string{"a", "b", "x", "c", "x"})
+
+	removed, err = storage.ListRemove("key", -1, "x")
+	c.Assert(err, IsNil)
+	c.Assert(removed, Equals, 1)
+	assertList(c, storage, "key", []string{"a", "b", "x", "c"})
+
+	storage.ListLeftPush("key", "x")
+	removed, _ = storage.ListRemove("key", 0, "x")
+	c.Assert(removed, Equals, 2)
+	assertList(c, storage, "key", []string{"a", "b", "c"})
+
+	removed, _ = storage.ListRemove("key", 0, "missing")
+	c.Assert(removed, Equals, 0)
+	removed, _ = storage.ListRemove("key", -10, "b")
+	c.Assert(removed, Equals, 1)
+	assertList(c, storage, "key", []string{"a", "c"})
+
+	storage.ListRemove("key", 0, "a")
+	storage.ListRemove("key", 0, "c")
+	assertList(c, storage, "key", []string{})
+
+	_, err = storage.ListRemove("missing", 0, "x")
+	c.Assert(err, Equals, commonStorage.KeyNotExistsError)
+}
+
+func (s *StorageTestSuite) TestListTrim(c *C) {
+	storage := newTestStorage(c)
+	for i := 0; i < 5; i++ {
+		storage.ListLeftPush("key", fmt.Sprint(i))
+	}
+
+	c.Assert(storage.ListTrim("key", 1, -2), IsNil)
+	assertList(c, storage, "key", []string{"3", "2", "1"})
+	c.Assert(storage.ListTrim("key", -2, 100), IsNil)
+	assertList(c, storage, "key", []string{"2", "1"})
+
+	// Empty range removes all values, list stays usable
+	c.Assert(storage.ListTrim("key", 2, 1), IsNil)
+	assertList(c, storage, "key", []string{})
+	storage.ListLeftPush("key", "a")
+	storage.ListRightPush("key", "b")
+	assertList(c, storage, "key", []string{"a", "b"})
+	c.Assert(storage.ListTrim("key", 5, 10), IsNil)
+	assertList(c, storage, "key", []string{})
+
+	c.Assert(storage.ListTrim("missing", 0, 1), Equals, commonStorage.KeyNotExistsError)
+}
+
+func (s *StorageTestSuite) TestListMove(c *C) {
+	storage := newTestStorage(c)
+	for _, value := range []string{"a", "b", "c"} {
+		storage.ListRightPush("list", value)
+	}
+	storage.Set("string", "value", 0)
+
+	// Source and destination may be the same list
+	value, err := storage.ListMove("list", "list", false, true)
+	c.Assert(err, IsNil)
+	c.Assert(value, Equals, "c")
+	assertList(c, storage, "list", []string{"c", "a", "b"})
+	value, _ = storage.ListMove("list", "list", true, false)
+	c.Assert(value, Equals, "c")
+	assertList(c, storage, "list", []string{"a", "b", "c"})
+	value, _ = storage.ListMove("list", "list", true, true)
+	c.Assert(value, Equals, "a")
+	assertList(c, storage, "list", []string{"a", "b", "c"})
+
+	value, err = storage.ListMove("list", "other", true, false)
+	c.Assert(err, IsNil)
+	c.Assert(value, Equals, "a")
+	assertList(c, storage, "list", []string{"b", "c"})
+	assertList(c, storage, "other", []string{"a"})
+
+	// Value is not popped if destination is not a list
+	_, err = storage.ListMove("list", "string", true, true)
+	c.Assert(err, Equals, commonStorage.KeyListTypeError)
+	assertList(c, storage, "list", []string{"b", "c"})
+
+	_, err = storage.ListMove("missing", "list", true, true)
+	c.Assert(err, Equals, commonStorage.KeyNotExistsError)
+}
+
+func (s *StorageTestSuite) TestListOverwrite(c *C) {
+	storage := newTestStorage(c)
+	storage.ListRightPush("key", "a")
+	storage.ListRightPush("key", "b")
+
+	// Values of list are removed together with list
+	options := commonStorage.SetOptions{Mode: commonStorage.SetAlways}
+	_, _, err := storage.SetWithOptions("key", "value", 0, options)
+	c.Assert(err, IsNil)
+	c.Assert(storage.storedValues("key"), IsNil)
+	value, _ := storage.Get("key")
+	c.Assert(value, Equals, "value")
+
+	// New list of the same key doesn't get old values
+	storage.Delete("key")
+	storage.ListRightPush("key", "c")
+	assertList(c, storage, "key", []string{"c"})
+
+	c.Assert(storage.Delete("key"), IsNil)
+	c.Assert(storage.storedValues("key"), IsNil)
+
+	// Values left by expired list are removed when list is created again
+	storage.ListCreate("expired", 1)
+	storage.ListRightPush("expired", "old")
+	time.Sleep(1100 * time.Millisecond)
+	c.Assert(storage.ListCreate("expired", 0), IsNil)
+	assertList(c, storage, "expired", []string{})
+}
+
+func (s *StorageTestSuite) TestListBlockingPop(c *C) {
+	storage := newTestStorage(c)
+	storage.ListRightPush("list2", "a")
+	storage.ListRightPush("list2", "b")
+
+	key, value, err := storage.ListBlockingRightPop([]string{"list1", "list2"}, time.Second)
+	c.Assert(err, IsNil)
+	c.Assert(key+" "+value, Equals, "list2 b")
+
+	_, _, err = storage.ListBlockingLeftPop([]string{"list1"}, 10*time.Millisecond)
+	c.Assert(err, Equals, commonStorage.ListEmptyError)
+	c.Assert(storage.waitersCount("list1"), Equals, 0)
+
+	// Waiters are served in order of arrival
+	results := make([]chan string, 2)
+	for i := range results {
+		results[i] = make(chan string, 1)
+		go func(result chan string) {
+			key, value, err := storage.ListBlockingLeftPop([]string{"list1"}, 0)
+			result <- fmt.Sprintf("%s %s %v", key, value, err)
+		}(results[i])
+		for storage.waitersCount("list1") != i+1 {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	storage.ListRightPush("list1", "c")
+	c.Assert(<-results[0], Equals, "list1 c <nil>")
+	storage.ListRightPush("list1", "d")
+	c.Assert(<-results[1], Equals, "list1 d <nil>")
+	assertList(c, storage, "list1", []string{})
+}
+
+func (s *StorageTestSuite) TestListBlockingMove(c *C) {
+	storage := newTestStorage(c)
+
+	result := make(chan string, 1)
+	go func() {
+		value, err := storage.ListBlockingMove("pending", "done", false, true, 0)
+		result <- fmt.Sprintf("%s %v", value, err)
+	}()
+	for storage.waitersCount("pending") != 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	storage.ListRightPush("pending", "a")
+	c.Assert(<-result, Equals, "a <nil>")
+	assertList(c, storage, "pending", []string{})
+	assertList(c, storage, "done", []string{"a"})
+
+	_, err := storage.ListBlockingMove("pending", "done", true, true, 10*time.Millisecond)
+	c.Assert(err, Equals, commonStorage.ListEmptyError)
+}
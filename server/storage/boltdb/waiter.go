@@ -0,0 +1,244 @@
+package boltdb
+
+import (
+	"sync"
+	"time"
+
+	commonStorage "github.com/Barberrrry/jcache/server/storage"
+	"github.com/boltdb/bolt"
+)
+
+// listWaiters are queues of blocked pops by list key. Waiters are queued and served inside of read-write
+// transactions which are serialized by Bolt, so push is never missed between check of list and queueing.
+type listWaiters struct {
+	mu     sync.Mutex
+	queues map[string][]*commonStorage.ListWaiter
+}
+
+func newListWaiters() *listWaiters {
+	return &listWaiters{queues: make(map[string][]*commonStorage.ListWaiter)}
+}
+
+func (q *listWaiters) add(keys []string, w *commonStorage.ListWaiter) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, key := range keys {
+		q.queues[key] = append(q.queues[key], w)
+	}
+}
+
+func (q *listWaiters) remove(keys []string, w *commonStorage.ListWaiter) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, key := range keys {
+		queue := q.queues[key]
+		for i, queued := range queue {
+			if queued == w {
+				q.dequeue(key, i)
+				break
+			}
+		}
+	}
+}
+
+// shift removes the first waiter of key from its queue and returns it, nil is returned if queue is empty
+func (q *listWaiters) shift(key string) *commonStorage.ListWaiter {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.queues[key]) == 0 {
+		return nil
+	}
+	w := q.queues[key][0]
+	q.dequeue(key, 0)
+	return w
+}
+
+func (q *listWaiters) has(key string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.queues[key]) > 0
+}
+
+func (q *listWaiters) dequeue(key string, i int) {
+	queue := q.queues[key]
+	if len(queue) == 1 {
+		delete(q.queues, key)
+		return
+	}
+	q.queues[key] = append(queue[:i:i], queue[i+1:]...)
+}
+
+// ListBlockingLeftPop pops value from the beginning of the first non-empty list of keys.
+// If all lists are empty, it waits until value is pushed or timeout expires. Zero timeout means waiting forever.
+// Error will occur if key type is not list or nothing is pushed before timeout.
+func (s *storage) ListBlockingLeftPop(keys []string, timeout time.Duration) (string, string, error) {
+	return commonStorage.NewListWaiter(true).Wait(keys, timeout, s.waitable)
+}
+
+// ListBlockingRightPop pops value from the ending of the first non-empty list of keys.
+// If all lists are empty, it waits until value is pushed or timeout expires. Zero timeout means waiting forever.
+// Error will occur if key type is not list or nothing is pushed before timeout.
+func (s *storage) ListBlockingRightPop(keys []string, timeout time.Duration) (string, string, error) {
+	return commonStorage.NewListWaiter(false).Wait(keys, timeout, s.waitable)
+}
+
+// ListBlockingMove is ListMove which waits until value is pushed into the source list or timeout expires.
+// Zero timeout means waiting forever. Value is popped and pushed atomically even after waiting.
+func (s *storage) ListBlockingMove(source, destination string, fromLeft, toLeft bool, timeout time.Duration) (string, error) {
+	_, value, err := commonStorage.NewListMoveWaiter(fromLeft, destination, toLeft).Wait([]string{source}, timeout, s.waitable)
+	return value, err
+}
+
+func (s *storage) waitable(key string) commonStorage.ListWaitable {
+	return s
+}
+
+// ListPopOrWait pops value for waiter from the first non-empty list of keys or queues waiter for every key.
+// Storage of transaction never queues waiter because pushes of other clients are blocked until commit.
+func (s *storage) ListPopOrWait(keys []string, w *commonStorage.ListWaiter) (key, value string, popped bool, err error) {
+	err = s.update(func(bucket *bolt.Bucket) error {
+		for _, current := range keys {
+			l, err := s.getList(bucket, current)
+			if err == commonStorage.KeyNotExistsError {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			if l.Len() == 0 {
+				continue
+			}
+			if err := s.checkListDestination(bucket, w.Destination); err != nil {
+				return err
+			}
+			if !w.Claim() {
+				return nil
+			}
+			key, popped = current, true
+			value, err = s.popForWaiter(bucket, current, l, w)
+			return err
+		}
+
+		if s.tx != nil {
+			return commonStorage.ListEmptyError
+		}
+		s.waiters.add(keys, w)
+		return nil
+	})
+	if err != nil {
+		// Waiter is claimed already, so it gets the error instead of value
+		if popped {
+			w.Fail(err)
+		}
+		return "", "", false, err
+	}
+	if popped && w.Destination != "" {
+		s.pushedKey(w.Destination)
+	}
+	return
+}
+
+// ListCancelWait removes waiter from queues of keys
+func (s *storage) ListCancelWait(keys []string, w *commonStorage.ListWaiter) {
+	s.waiters.remove(keys, w)
+}
+
+// pushedKey serves waiters of list after push. Inside of transaction waiters are served after commit,
+// so they never get values which are rolled back.
+func (s *storage) pushedKey(key string) {
+	if s.tx != nil {
+		s.pushed[key] = true
+		return
+	}
+	s.serveWaiters(key)
+}
+
+// waiterResult is a value or error passed to waiter after commit of transaction which popped the value
+type waiterResult struct {
+	waiter     *commonStorage.ListWaiter
+	key, value string
+	err        error
+}
+
+// serveWaiters pops values of lists for waiters of keys in order of their arrival.
+// Waiters which are already served by another key or storage are dropped.
+// Waiter fails without pop if its destination is not a list anymore.
+// Values are passed to waiters only after commit, waiters fail if commit fails.
+func (s *storage) serveWaiters(keys ...string) {
+	for _, key := range keys {
+		if !s.waiters.has(key) {
+			continue
+		}
+
+		var results []waiterResult
+		var destinations []string
+		err := s.db.Update(func(tx *bolt.Tx) error {
+			bucket := tx.Bucket(defaultBucketName)
+			for {
+				l, err := s.getList(bucket, key)
+				if err != nil || l.Len() == 0 {
+					return nil
+				}
+				w := s.waiters.shift(key)
+				if w == nil {
+					return nil
+				}
+				if err := s.checkListDestination(bucket, w.Destination); err != nil {
+					if w.Claim() {
+						w.Fail(err)
+					}
+					continue
+				}
+				if !w.Claim() {
+					continue
+				}
+				value, err := s.popForWaiter(bucket, key, l, w)
+				results = append(results, waiterResult{waiter: w, key: key, value: value})
+				if err != nil {
+					return err
+				}
+				if w.Destination != "" {
+					destinations = append(destinations, w.Destination)
+				}
+			}
+		})
+
+		for _, result := range results {
+			if err != nil {
+				result.waiter.Fail(err)
+			} else {
+				result.waiter.Serve(result.key, result.value)
+			}
+		}
+		if err == nil {
+			s.serveWaiters(destinations...)
+		}
+	}
+}
+
+// popForWaiter pops value of claimed waiter and moves it into destination of waiter if it is set.
+// Value is left in the list for notify waiter, so the following waiters are served too.
+func (s *storage) popForWaiter(bucket *bolt.Bucket, key string, l *boltList, w *commonStorage.ListWaiter) (string, error) {
+	if w.Notify {
+		return "", nil
+	}
+	if w.Destination != "" {
+		return s.moveListValue(bucket, key, l, w.Left, w.Destination, w.DestinationLeft)
+	}
+	value, err := l.pop(w.Left)
+	if err != nil {
+		return "", err
+	}
+	return value, s.saveList(bucket, key, l)
+}
+
+// checkListDestination returns error if destination exists and its type is not list, empty destination is valid
+func (s *storage) checkListDestination(bucket *bolt.Bucket, key string) error {
+	if key == "" {
+		return nil
+	}
+	if _, err := s.getList(bucket, key); err != nil && err != commonStorage.KeyNotExistsError {
+		return err
+	}
+	return nil
+}
@@ -1,5 +1,11 @@
 package storage
 
+import (
+	"encoding/hex"
+	"sort"
+	"strconv"
+)
+
 type Hash map[string]string
 
 func (h Hash) GetValue(field string) (string, error) {
@@ -9,3 +15,85 @@ func (h Hash) GetValue(field string) (string, error) {
 		return "", FieldNotExistError
 	}
 }
+
+// Copy returns copy of hash, so it may be used after storage lock is released
+func (h Hash) Copy() map[string]string {
+	copied := make(map[string]string, len(h))
+	for field, value := range h {
+		copied[field] = value
+	}
+	return copied
+}
+
+// GetValues returns values of fields, error of every field is returned at the same position
+func (h Hash) GetValues(fields []string) ([]string, []error) {
+	values := make([]string, len(fields))
+	errs := make([]error, len(fields))
+	for i, field := range fields {
+		values[i], errs[i] = h.GetValue(field)
+	}
+	return values, errs
+}
+
+// SetValues sets values of fields in order, so the last value of repeated field wins.
+// Number of fields which didn't exist before is returned.
+func (h Hash) SetValues(fields, values []string) int {
+	added := 0
+	for i, field := range fields {
+		if _, found := h[field]; !found {
+			added++
+		}
+		h[field] = values[i]
+	}
+	return added
+}
+
+// Increment adds delta to integer value of field and returns the new value. Missing field is incremented from zero.
+// Error will occur if value is not an integer or result overflows.
+func (h Hash) Increment(field string, delta int64) (int64, error) {
+	value, found := h[field]
+	if !found {
+		value = "0"
+	}
+	current, err := incrementInteger(value, delta)
+	if err != nil {
+		return 0, err
+	}
+	h[field] = strconv.FormatInt(current, 10)
+	return current, nil
+}
+
+// Scan returns fields in sorted order starting from cursor until options.Limit() fields are examined.
+// Cursor is a hex encoded field to start from, so every field which exists during the whole iteration is returned.
+// Returned cursor is ScanStart when all fields are examined. Only options.Pattern and options.Count are applied.
+func (h Hash) Scan(cursor string, options ScanOptions) (string, map[string]string, error) {
+	var start string
+	if cursor != ScanStart {
+		decoded, err := hex.DecodeString(cursor)
+		if err != nil || len(decoded) == 0 {
+			return "", nil, InvalidCursorError
+		}
+		start = string(decoded)
+	}
+
+	fields := make([]string, 0, len(h))
+	for field := range h {
+		if field >= start {
+			fields = append(fields, field)
+		}
+	}
+	sort.Strings(fields)
+
+	next := ScanStart
+	if len(fields) > options.Limit() {
+		next = hex.EncodeToString([]byte(fields[options.Limit()]))
+		fields = fields[:options.Limit()]
+	}
+	page := make(map[string]string)
+	for _, field := range fields {
+		if options.MatchKey(field) {
+			page[field] = h[field]
+		}
+	}
+	return next, page, nil
+}
@@ -0,0 +1,53 @@
+package storage
+
+import (
+	. "gopkg.in/check.v1"
+)
+
+type HashTestSuite struct{}
+
+var _ = Suite(&HashTestSuite{})
+
+func (s *HashTestSuite) TestSetAndGetValues(c *C) {
+	hash := Hash{"a": "1"}
+	c.Assert(hash.SetValues([]string{"a", "b", "c", "b"}, []string{"2", "3", "4", "5"}), Equals, 2)
+	c.Assert(hash, DeepEquals, Hash{"a": "2", "b": "5", "c": "4"})
+
+	values, errs := hash.GetValues([]string{"c", "d"})
+	c.Assert(values, DeepEquals, []string{"4", ""})
+	c.Assert(errs, DeepEquals, []error{nil, FieldNotExistError})
+}
+
+func (s *HashTestSuite) TestIncrement(c *C) {
+	hash := Hash{"name": "bob"}
+	value, err := hash.Increment("count", 3)
+	c.Assert(err, IsNil)
+	c.Assert(value, Equals, int64(3))
+	c.Assert(hash["count"], Equals, "3")
+
+	_, err = hash.Increment("name", 1)
+	c.Assert(err, Equals, NotIntegerError)
+	c.Assert(hash["name"], Equals, "bob")
+}
+
+func (s *HashTestSuite) TestScan(c *C) {
+	hash := Hash{"a": "1", "b": "2", "c": "3", "d": "4", "e": "5"}
+
+	next, fields, err := hash.Scan(ScanStart, ScanOptions{Count: 2})
+	c.Assert(err, IsNil)
+	c.Assert(fields, DeepEquals, map[string]string{"a": "1", "b": "2"})
+	c.Assert(next, Equals, "63")
+
+	// Pattern is applied to examined fields, so page may be empty
+	next, fields, err = hash.Scan(next, ScanOptions{Count: 2, Pattern: "e"})
+	c.Assert(err, IsNil)
+	c.Assert(fields, HasLen, 0)
+
+	next, fields, err = hash.Scan(next, ScanOptions{Count: 2})
+	c.Assert(err, IsNil)
+	c.Assert(fields, DeepEquals, map[string]string{"e": "5"})
+	c.Assert(next, Equals, ScanStart)
+
+	_, _, err = hash.Scan("6", ScanOptions{})
+	c.Assert(err, Equals, InvalidCursorError)
+}
@@ -2,12 +2,20 @@ package storage
 
 import (
 	"container/list"
+	"math"
+	"strconv"
 	"time"
 )
 
 type Item struct {
 	Value      interface{}
 	ExpireTime time.Time
+	// Version is changed by storage on every item change. It is unique within storage.
+	Version uint64
+	// SlidingTTL is not zero for sliding expiration: ExpireTime is moved forward by it on every access of item
+	SlidingTTL time.Duration
+	// FieldExpireTimes contains expiration time of hash fields which have TTL, it is nil if no field expires
+	FieldExpireTimes map[string]time.Time
 }
 
 func NewItem(value interface{}, ttl uint64) *Item {
@@ -25,14 +33,132 @@ func (i *Item) CastString() (string, error) {
 	}
 }
 
+// Type returns name of item value type
+func (i *Item) Type() string {
+	switch i.Value.(type) {
+	case Hash:
+		return TypeHash
+	case *list.List, *ListHeader:
+		return TypeList
+	case Set:
+		return TypeSet
+	case *SortedSet:
+		return TypeSortedSet
+	}
+	return TypeString
+}
+
+// ChangeEvent returns keyspace event which is reported when item is written.
+// It is empty for types which changes are not reported.
+func (i *Item) ChangeEvent() string {
+	switch i.Type() {
+	case TypeString:
+		return EventSet
+	case TypeHash:
+		return EventHash
+	case TypeList:
+		return EventList
+	}
+	return ""
+}
+
+// CastHash returns hash value. Expired fields are removed before, so they are never visible.
 func (i *Item) CastHash() (Hash, error) {
 	if hash, ok := i.Value.(Hash); ok {
+		i.RemoveExpiredFields()
 		return hash, nil
 	} else {
 		return nil, KeyHashTypeError
 	}
 }
 
+// FieldExpireTime returns time when hash field expires, it is zero if field exists forever.
+// Error will occur if item is not hash or field doesn't exist.
+func (i *Item) FieldExpireTime(field string) (time.Time, error) {
+	hash, err := i.CastHash()
+	if err != nil {
+		return time.Time{}, err
+	}
+	if _, found := hash[field]; !found {
+		return time.Time{}, FieldNotExistError
+	}
+	return i.FieldExpireTimes[field], nil
+}
+
+// SetFieldExpireTime sets time when hash field expires. Zero time makes field exist forever.
+// Error will occur if item is not hash or field doesn't exist.
+func (i *Item) SetFieldExpireTime(field string, expireTime time.Time) error {
+	hash, err := i.CastHash()
+	if err != nil {
+		return err
+	}
+	if _, found := hash[field]; !found {
+		return FieldNotExistError
+	}
+	if expireTime.IsZero() {
+		i.PersistFields(field)
+		return nil
+	}
+	if i.FieldExpireTimes == nil {
+		i.FieldExpireTimes = make(map[string]time.Time)
+	}
+	i.FieldExpireTimes[field] = expireTime
+	return nil
+}
+
+// PersistFields removes expiration of hash fields, it is called when fields are overwritten or deleted
+func (i *Item) PersistFields(fields ...string) {
+	if i.FieldExpireTimes == nil {
+		return
+	}
+	for _, field := range fields {
+		delete(i.FieldExpireTimes, field)
+	}
+	if len(i.FieldExpireTimes) == 0 {
+		i.FieldExpireTimes = nil
+	}
+}
+
+// HasExpiredFields reports whether item is hash which contains expired fields
+func (i *Item) HasExpiredFields() bool {
+	now := time.Now()
+	for _, expireTime := range i.FieldExpireTimes {
+		if !expireTime.After(now) {
+			return true
+		}
+	}
+	return false
+}
+
+// ExpiredFields returns fields of hash which are expired but not removed yet
+func (i *Item) ExpiredFields() []string {
+	var fields []string
+	now := time.Now()
+	for field, expireTime := range i.FieldExpireTimes {
+		if !expireTime.After(now) {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+// RemoveExpiredFields removes expired fields of hash and reports whether any field is removed.
+// Version of item isn't changed because expired fields are already invisible.
+func (i *Item) RemoveExpiredFields() bool {
+	hash, ok := i.Value.(Hash)
+	if !ok || !i.HasExpiredFields() {
+		return false
+	}
+	now := time.Now()
+	for field, expireTime := range i.FieldExpireTimes {
+		if !expireTime.After(now) {
+			delete(hash, field)
+			i.PersistFields(field)
+		}
+	}
+	return true
+}
+
 func (i *Item) CastList() (*list.List, error) {
 	if list, ok := i.Value.(*list.List); ok {
 		return list, nil
@@ -41,12 +167,116 @@ func (i *Item) CastList() (*list.List, error) {
 	}
 }
 
+// CastListHeader returns header of list which values are kept outside of item by persistent storage
+func (i *Item) CastListHeader() (*ListHeader, error) {
+	if header, ok := i.Value.(*ListHeader); ok {
+		return header, nil
+	} else {
+		return nil, KeyListTypeError
+	}
+}
+
+func (i *Item) CastSet() (Set, error) {
+	if set, ok := i.Value.(Set); ok {
+		return set, nil
+	} else {
+		return nil, KeySetTypeError
+	}
+}
+
+func (i *Item) CastSortedSet() (*SortedSet, error) {
+	if set, ok := i.Value.(*SortedSet); ok {
+		return set, nil
+	} else {
+		return nil, KeySortedSetTypeError
+	}
+}
+
+// Increment parses string value as int64, adds delta and stores the result back as string.
+// Error will occur if value is not a string, not an integer or result overflows int64.
+func (i *Item) Increment(delta int64) (int64, error) {
+	value, err := i.CastString()
+	if err != nil {
+		return 0, err
+	}
+	current, err := incrementInteger(value, delta)
+	if err != nil {
+		return 0, err
+	}
+	i.Value = strconv.FormatInt(current, 10)
+	return current, nil
+}
+
+// incrementInteger parses value as integer and adds delta to it.
+// Error will occur if value is not an integer or result overflows.
+func incrementInteger(value string, delta int64) (int64, error) {
+	current, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, NotIntegerError
+	}
+	if (delta > 0 && current > math.MaxInt64-delta) || (delta < 0 && current < math.MinInt64-delta) {
+		return 0, OverflowError
+	}
+	return current + delta, nil
+}
+
+// PrepareSet checks whether current item may be replaced by SET with options and returns new item.
+// Current item is nil if key doesn't exist. Previous value is returned only if options.Get is set.
+func PrepareSet(current *Item, value string, ttl uint64, options SetOptions) (item *Item, old string, err error) {
+	if current == nil && options.Mode == SetIfExists {
+		return nil, "", KeyNotExistsError
+	}
+	if current != nil && options.Mode == SetIfNotExists {
+		return nil, "", KeyAlreadyExistsError
+	}
+
+	item = NewItem(value, ttl)
+	if !options.ExpireTime.IsZero() {
+		item.ExpireTime = options.ExpireTime
+	}
+	if options.SlidingTTL > 0 {
+		item.SetSlidingTTL(options.SlidingTTL)
+	}
+	if current == nil {
+		return item, "", nil
+	}
+	if options.Get {
+		if old, err = current.CastString(); err != nil {
+			return nil, "", err
+		}
+	}
+	if options.KeepTTL {
+		item.ExpireTime, item.SlidingTTL = current.ExpireTime, current.SlidingTTL
+	}
+	return item, old, nil
+}
+
 func (i *Item) IsAlive() bool {
 	return i.ExpireTime.IsZero() || i.ExpireTime.After(time.Now())
 }
 
+// SetTTL sets fixed expiration after ttl seconds, sliding expiration is turned off
 func (i *Item) SetTTL(ttl uint64) {
-	i.ExpireTime = getExpireTime(ttl)
+	i.SetExpireTime(getExpireTime(ttl))
+}
+
+// SetExpireTime sets fixed expiration time, sliding expiration is turned off. Zero time means no expiration.
+func (i *Item) SetExpireTime(expireTime time.Time) {
+	i.ExpireTime, i.SlidingTTL = expireTime, 0
+}
+
+// SetSlidingTTL makes item expire after ttl since the last access. Zero ttl means no expiration.
+func (i *Item) SetSlidingTTL(ttl time.Duration) {
+	i.SlidingTTL = ttl
+	i.ExpireTime = time.Time{}
+	i.Touch()
+}
+
+// Touch extends expiration of sliding item, it is called on every access of item
+func (i *Item) Touch() {
+	if i.SlidingTTL > 0 {
+		i.ExpireTime = time.Now().Add(i.SlidingTTL)
+	}
 }
 
 func getExpireTime(ttl uint64) (expireTime time.Time) {
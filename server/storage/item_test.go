@@ -31,6 +31,22 @@ func (s *ItemTestSuite) TestStringWithTTL(c *C) {
 	c.Assert(err, NotNil)
 }
 
+func (s *ItemTestSuite) TestSlidingTTL(c *C) {
+	item := NewItem("value", 0)
+	item.SetSlidingTTL(100 * time.Millisecond)
+
+	time.Sleep(60 * time.Millisecond)
+	item.Touch()
+	time.Sleep(60 * time.Millisecond)
+	c.Assert(item.IsAlive(), Equals, true)
+
+	item.SetTTL(10)
+	c.Assert(item.SlidingTTL, Equals, time.Duration(0))
+	expireTime := item.ExpireTime
+	item.Touch()
+	c.Assert(item.ExpireTime, Equals, expireTime)
+}
+
 func (s *ItemTestSuite) TestExpired(c *C) {
 	item := NewItem("value", 1)
 
@@ -69,3 +85,107 @@ func (s *ItemTestSuite) TestList(c *C) {
 	_, err = item.CastHash()
 	c.Assert(err, NotNil)
 }
+
+func (s *ItemTestSuite) TestSet(c *C) {
+	item := NewItem(Set{"member": true}, 0)
+
+	set, err := item.CastSet()
+	c.Assert(err, IsNil)
+	c.Assert(set, DeepEquals, Set{"member": true})
+	c.Assert(item.Type(), Equals, TypeSet)
+
+	_, err = item.CastString()
+	c.Assert(err, NotNil)
+	_, err = item.CastHash()
+	c.Assert(err, NotNil)
+	_, err = item.CastList()
+	c.Assert(err, NotNil)
+}
+
+func (s *ItemTestSuite) TestSortedSet(c *C) {
+	item := NewItem(NewSortedSet(), 0)
+
+	_, err := item.CastSortedSet()
+	c.Assert(err, IsNil)
+	c.Assert(item.Type(), Equals, TypeSortedSet)
+
+	_, err = item.CastSet()
+	c.Assert(err, NotNil)
+	_, err = NewItem(Set{}, 0).CastSortedSet()
+	c.Assert(err, Equals, KeySortedSetTypeError)
+}
+
+func (s *ItemTestSuite) TestListHeader(c *C) {
+	item := NewItem(NewListHeader(), 0)
+	header, err := item.CastListHeader()
+	c.Assert(err, IsNil)
+	c.Assert(header.Len(), Equals, 0)
+	c.Assert(item.Type(), Equals, TypeList)
+
+	header.Head--
+	header.Tail++
+	c.Assert(header.Len(), Equals, 2)
+	_, err = NewItem(Set{}, 0).CastListHeader()
+	c.Assert(err, Equals, KeyListTypeError)
+}
+
+func (s *ItemTestSuite) TestIncrement(c *C) {
+	item := NewItem("10", 0)
+
+	value, err := item.Increment(5)
+	c.Assert(err, IsNil)
+	c.Assert(value, Equals, int64(15))
+	c.Assert(item.Value, Equals, "15")
+
+	value, err = item.Increment(-20)
+	c.Assert(err, IsNil)
+	c.Assert(value, Equals, int64(-5))
+
+	item = NewItem("9223372036854775807", 0)
+	_, err = item.Increment(1)
+	c.Assert(err, Equals, OverflowError)
+	c.Assert(item.Value, Equals, "9223372036854775807")
+
+	item = NewItem("-9223372036854775808", 0)
+	_, err = item.Increment(-1)
+	c.Assert(err, Equals, OverflowError)
+
+	item = NewItem("abc", 0)
+	_, err = item.Increment(1)
+	c.Assert(err, Equals, NotIntegerError)
+
+	item = NewItem(Hash{}, 0)
+	_, err = item.Increment(1)
+	c.Assert(err, Equals, KeyStringTypeError)
+}
+
+func (s *ItemTestSuite) TestFieldExpireTime(c *C) {
+	item := NewItem(Hash{"a": "1", "b": "2"}, 0)
+
+	c.Assert(item.SetFieldExpireTime("a", time.Now().Add(50*time.Millisecond)), IsNil)
+	c.Assert(item.SetFieldExpireTime("c", time.Now()), Equals, FieldNotExistError)
+	expireTime, err := item.FieldExpireTime("a")
+	c.Assert(err, IsNil)
+	c.Assert(expireTime.IsZero(), Equals, false)
+	expireTime, err = item.FieldExpireTime("b")
+	c.Assert(err, IsNil)
+	c.Assert(expireTime.IsZero(), Equals, true)
+	c.Assert(item.HasExpiredFields(), Equals, false)
+	c.Assert(item.ExpiredFields(), HasLen, 0)
+
+	time.Sleep(60 * time.Millisecond)
+	c.Assert(item.HasExpiredFields(), Equals, true)
+	c.Assert(item.ExpiredFields(), DeepEquals, []string{"a"})
+	hash, err := item.CastHash()
+	c.Assert(err, IsNil)
+	c.Assert(hash, DeepEquals, Hash{"b": "2"})
+	c.Assert(item.FieldExpireTimes, IsNil)
+	c.Assert(item.RemoveExpiredFields(), Equals, false)
+
+	c.Assert(item.SetFieldExpireTime("b", time.Now().Add(time.Minute)), IsNil)
+	c.Assert(item.SetFieldExpireTime("b", time.Time{}), IsNil)
+	c.Assert(item.FieldExpireTimes, IsNil)
+
+	_, err = NewItem("value", 0).FieldExpireTime("a")
+	c.Assert(err, Equals, KeyHashTypeError)
+}
@@ -0,0 +1,48 @@
+package storage
+
+// ListHeader is a value of list item in persistent storages which keep list values outside of item.
+// Values have consecutive positions from Head inclusive to Tail exclusive. Empty list starts in the middle
+// of position range, so values are pushed to both ends without moving other values.
+type ListHeader struct {
+	Head uint64
+	Tail uint64
+}
+
+// NewListHeader creates header of empty list
+func NewListHeader() *ListHeader {
+	middle := uint64(1) << 63
+	return &ListHeader{Head: middle, Tail: middle}
+}
+
+// Len returns number of list values
+func (h *ListHeader) Len() int {
+	return int(h.Tail - h.Head)
+}
+
+// ListIndexPosition converts index of list element into position from the list beginning.
+// Negative index is counted from the list ending, -1 is the last element. False is returned if index is out of range.
+func ListIndexPosition(length, index int) (int, bool) {
+	if index < 0 {
+		index += length
+	}
+	return index, index >= 0 && index < length
+}
+
+// ListRangeBounds converts start and stop indexes of inclusive range into positions from the list beginning.
+// Negative indexes are counted from the list ending, range is clipped to the list bounds.
+// False is returned if range is empty.
+func ListRangeBounds(length, start, stop int) (int, int, bool) {
+	if start < 0 {
+		start += length
+	}
+	if stop < 0 {
+		stop += length
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= length {
+		stop = length - 1
+	}
+	return start, stop, start <= stop
+}
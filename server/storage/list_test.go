@@ -0,0 +1,52 @@
+package storage
+
+import (
+	. "gopkg.in/check.v1"
+)
+
+type ListTestSuite struct{}
+
+var _ = Suite(&ListTestSuite{})
+
+func (s *ListTestSuite) TestIndexPosition(c *C) {
+	for _, t := range []struct {
+		index, position int
+		ok              bool
+	}{
+		{0, 0, true},
+		{2, 2, true},
+		{3, 3, false},
+		{-1, 2, true},
+		{-3, 0, true},
+		{-4, -1, false},
+	} {
+		position, ok := ListIndexPosition(3, t.index)
+		c.Assert(ok, Equals, t.ok, Commentf("index %d", t.index))
+		if ok {
+			c.Assert(position, Equals, t.position, Commentf("index %d", t.index))
+		}
+	}
+}
+
+func (s *ListTestSuite) TestRangeBounds(c *C) {
+	for _, t := range []struct {
+		start, stop, first, last int
+		ok                       bool
+	}{
+		{0, -1, 0, 4, true},
+		{1, 2, 1, 2, true},
+		{-2, -1, 3, 4, true},
+		{-10, 10, 0, 4, true},
+		{3, 1, 0, 0, false},
+		{5, 10, 0, 0, false},
+		{0, -6, 0, 0, false},
+	} {
+		first, last, ok := ListRangeBounds(5, t.start, t.stop)
+		c.Assert(ok, Equals, t.ok, Commentf("range %d %d", t.start, t.stop))
+		if ok {
+			c.Assert([]int{first, last}, DeepEquals, []int{t.first, t.last}, Commentf("range %d %d", t.start, t.stop))
+		}
+	}
+	_, _, ok := ListRangeBounds(0, 0, -1)
+	c.Assert(ok, Equals, false)
+}
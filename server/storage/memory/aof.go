@@ -0,0 +1,924 @@
+package memory
+
+import (
+	"bufio"
+	"container/list"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	commonStorage "github.com/Barberrrry/jcache/server/storage"
+)
+
+// Fsync policies of append-only file
+const (
+	// FsyncAlways syncs file after every change, so change is never lost after it is applied
+	FsyncAlways = "always"
+	// FsyncEverySecond syncs file once per second, changes of the last second may be lost on crash of system
+	FsyncEverySecond = "everysec"
+	// FsyncNever leaves syncing to operating system
+	FsyncNever = "never"
+)
+
+// DefaultAOFRewriteMinSize is a size which append-only file must reach before it is rewritten automatically
+const DefaultAOFRewriteMinSize = 64 << 20
+
+// FsyncPolicy defines how often append-only file is synced to disk
+type FsyncPolicy string
+
+func (p *FsyncPolicy) String() string {
+	return string(*p)
+}
+
+func (p *FsyncPolicy) Set(value string) error {
+	switch value {
+	case FsyncAlways, FsyncEverySecond, FsyncNever:
+		*p = FsyncPolicy(value)
+	default:
+		return fmt.Errorf("Unknown fsync policy: %s", value)
+	}
+	return nil
+}
+
+// AOFOptions configure append-only file (AOF) of memory storage
+type AOFOptions struct {
+	// Path to file, it is created if it doesn't exist
+	Path string
+	// Fsync is FsyncEverySecond if it is empty
+	Fsync FsyncPolicy
+	// RewriteMinSize is DefaultAOFRewriteMinSize if it is zero. File is rewritten when it reaches this size
+	// and has doubled since the last rewrite.
+	RewriteMinSize int64
+	// Logger receives errors of background writes and reports of recovered files, nil logger discards them
+	Logger *log.Logger
+}
+
+var (
+	AOFDisabledError          = errors.New("Append-only file is disabled")
+	AOFRewriteInProgressError = errors.New("Append-only file is already being rewritten")
+)
+
+// Operations of AOF entries. Entry is a list of strings: operation, key and arguments.
+// Expire time is written as Unix time in nanoseconds, sliding TTL as number of nanoseconds, zero means no expiration.
+// Entries never depend on time of replay: removal of expired key or field is written when it affects following changes.
+const (
+	// aofMulti contains encoded entries which are replayed all or nothing
+	aofMulti = "multi"
+	// aofSet replaces key by string: key, value, expire time, sliding TTL
+	aofSet = "set"
+	// aofCreate replaces key by empty value of type: key, type, expire time, sliding TTL
+	aofCreate = "create"
+	// aofExpire changes expiration of key: key, expire time, sliding TTL
+	aofExpire          = "expire"
+	aofDelete          = "del"
+	aofHashSet         = "hset"    // key, field, value, [field, value...]; expiration of fields is removed
+	aofHashDelete      = "hdel"    // key, field, [field...]
+	aofHashIncrement   = "hincrby" // key, field, delta
+	aofHashExpire      = "hexpire" // key, field, expire time
+	aofListLeftPush    = "lpush"   // key, value
+	aofListRightPush   = "rpush"   // key, value, [value...]
+	aofListLeftPop     = "lpop"
+	aofListRightPop    = "rpop"
+	aofListSet         = "lset"    // key, position, value
+	aofListInsert      = "linsert" // key, pivot, value, before
+	aofListRemove      = "lrem"    // key, count, value
+	aofListTrim        = "ltrim"   // key, start, stop
+	aofSetAdd          = "sadd"    // key, member, [member...]
+	aofSetRemove       = "srem"    // key, member, [member...]
+	aofSortedSetAdd    = "zadd"    // key, score, member, [score, member...]
+	aofSortedSetRemove = "zrem"    // key, member, [member...]
+)
+
+const (
+	// aofHeaderSize is a size of entry header: length of payload and its CRC-32 checksum, both are uint32.
+	// Payload is a sequence of entry arguments, every argument is prefixed by its length as uvarint.
+	aofHeaderSize = 8
+	// aofBatchSize is a max number of values in one entry which is written by rewrite
+	aofBatchSize = 1000
+)
+
+var aofCorruptedError = errors.New("Entry is corrupted")
+
+// appendOnlyFile writes entries of changes of storage
+type appendOnlyFile struct {
+	mu     sync.Mutex
+	path   string
+	file   *os.File
+	fsync  FsyncPolicy
+	logger *log.Logger
+	// size is a current size of file, rewriteSize is a size of file after the last load or rewrite
+	size, rewriteSize, rewriteMinSize int64
+	// dirty is set when file is written after the last sync
+	dirty bool
+	// rewriting is set while file is rewritten, entries written after snapshot of storage are collected into rewriteBuf
+	rewriting  bool
+	capturing  bool
+	rewriteBuf []byte
+	// err is the first error of write, nothing is written to file after it until file is rewritten.
+	// Rewrite is started by the next tick of maintainAOF and is repeated until it succeeds.
+	err  error
+	done chan struct{}
+	// wg waits for background goroutines
+	wg sync.WaitGroup
+}
+
+// NewStorageWithAOF creates memory storage which writes every change into append-only file.
+// Changes from existing file are replayed before storage is returned.
+func NewStorageWithAOF(size int, gcInterval time.Duration, options AOFOptions) (*storage, error) {
+	s, err := newStorage(size)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(options.Path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot open AOF: %s", err)
+	}
+	a := &appendOnlyFile{
+		path:           options.Path,
+		file:           file,
+		fsync:          options.Fsync,
+		logger:         options.Logger,
+		rewriteMinSize: options.RewriteMinSize,
+		done:           make(chan struct{}),
+	}
+	if a.fsync == "" {
+		a.fsync = FsyncEverySecond
+	}
+	if a.rewriteMinSize == 0 {
+		a.rewriteMinSize = DefaultAOFRewriteMinSize
+	}
+	if a.logger == nil {
+		a.logger = log.New(ioutil.Discard, "", 0)
+	}
+	if err := s.load(a); err != nil {
+		file.Close()
+		return nil, err
+	}
+	s.aof = a
+
+	a.wg.Add(1)
+	go s.maintainAOF()
+	go s.gc(gcInterval)
+
+	return s, nil
+}
+
+// load replays entries of file. Incomplete entry at the end of file is left by interrupted write,
+// so it is cut off and new entries are appended after the last complete one.
+func (s *storage) load(a *appendOnlyFile) error {
+	info, err := a.file.Stat()
+	if err != nil {
+		return fmt.Errorf("Cannot read AOF: %s", err)
+	}
+	size := info.Size()
+	r := bufio.NewReader(io.NewSectionReader(a.file, 0, size))
+	var offset int64
+	for offset < size {
+		args, n, err := readEntry(r, size-offset)
+		if err == io.ErrUnexpectedEOF {
+			if err := a.file.Truncate(offset); err != nil {
+				return fmt.Errorf("Cannot truncate AOF: %s", err)
+			}
+			a.logger.Printf("AOF %s ends with incomplete entry at offset %d, %d bytes are removed", a.path, offset, size-offset)
+			size = offset
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("Cannot read AOF entry at offset %d: %s", offset, err)
+		}
+		if err := s.apply(args); err != nil {
+			return fmt.Errorf("Cannot replay AOF entry at offset %d: %s", offset, err)
+		}
+		offset += n
+	}
+	a.size, a.rewriteSize = size, size
+
+	// Access time of sliding keys isn't written, so their TTL starts again
+	for _, key := range s.lru.Keys() {
+		raw, _ := s.lru.Peek(key)
+		item := raw.(*commonStorage.Item)
+		item.Touch()
+		if !item.IsAlive() {
+			s.lru.Remove(key)
+		}
+	}
+	return nil
+}
+
+// unlock writes entries of the finished operation into AOF and unlocks storage.
+// Storage of transaction keeps entries until commit.
+func (s *storage) unlock() {
+	if s.pushed == nil && len(s.entries) > 0 {
+		s.aof.write(s.entries)
+		s.entries = nil
+	}
+	s.mu.Unlock()
+}
+
+// record adds entry of change to the current operation if AOF is enabled
+func (s *storage) record(operation, key string, args ...string) {
+	if s.aof == nil {
+		return
+	}
+	s.entries = append(s.entries, append([]string{operation, key}, args...))
+}
+
+// recordItem adds entries which replace key by item
+func (s *storage) recordItem(key string, item *commonStorage.Item) {
+	if s.aof == nil {
+		return
+	}
+	s.entries = append(s.entries, itemEntries(key, item)...)
+}
+
+func (s *storage) recordExpire(key string, item *commonStorage.Item) {
+	s.record(aofExpire, key, formatTime(item.ExpireTime), formatDuration(item.SlidingTTL))
+}
+
+func (s *storage) recordPush(key, value string, left bool) {
+	if left {
+		s.record(aofListLeftPush, key, value)
+	} else {
+		s.record(aofListRightPush, key, value)
+	}
+}
+
+func (s *storage) recordPop(key string, left bool) {
+	if left {
+		s.record(aofListLeftPop, key)
+	} else {
+		s.record(aofListRightPop, key)
+	}
+}
+
+// itemEntries returns entries which replace key by item. Expired hash fields are skipped.
+func itemEntries(key string, item *commonStorage.Item) [][]string {
+	expireTime, slidingTTL := formatTime(item.ExpireTime), formatDuration(item.SlidingTTL)
+	if value, ok := item.Value.(string); ok {
+		return [][]string{{aofSet, key, value, expireTime, slidingTTL}}
+	}
+
+	entries := [][]string{{aofCreate, key, item.Type(), expireTime, slidingTTL}}
+	var operation string
+	var args []string
+	switch value := item.Value.(type) {
+	case commonStorage.Hash:
+		operation = aofHashSet
+		expired := make(map[string]bool)
+		for _, field := range item.ExpiredFields() {
+			expired[field] = true
+		}
+		for field, v := range value {
+			if !expired[field] {
+				args = append(args, field, v)
+			}
+		}
+		entries = appendBatches(entries, operation, key, args, 2)
+		for field, fieldExpireTime := range item.FieldExpireTimes {
+			if !expired[field] {
+				entries = append(entries, []string{aofHashExpire, key, field, formatTime(fieldExpireTime)})
+			}
+		}
+		return entries
+	case *list.List:
+		operation = aofListRightPush
+		for e := value.Front(); e != nil; e = e.Next() {
+			args = append(args, e.Value.(string))
+		}
+	case commonStorage.Set:
+		operation = aofSetAdd
+		args = value.Members()
+	case *commonStorage.SortedSet:
+		operation = aofSortedSetAdd
+		args = scoredMemberArgs(value.Range(0, -1, false))
+		return appendBatches(entries, operation, key, args, 2)
+	}
+	return appendBatches(entries, operation, key, args, 1)
+}
+
+// appendBatches splits args into entries of aofBatchSize values, value consists of size arguments
+func appendBatches(entries [][]string, operation, key string, args []string, size int) [][]string {
+	for len(args) > 0 {
+		n := aofBatchSize * size
+		if n > len(args) {
+			n = len(args)
+		}
+		entries = append(entries, append([]string{operation, key}, args[:n]...))
+		args = args[n:]
+	}
+	return entries
+}
+
+func scoredMemberArgs(members []commonStorage.ScoredMember) []string {
+	args := make([]string, 0, 2*len(members))
+	for _, m := range members {
+		args = append(args, formatScore(m.Score), m.Member)
+	}
+	return args
+}
+
+// apply replays entry. Items are changed regardless of their expiration because entries don't depend on time.
+func (s *storage) apply(args []string) error {
+	if len(args) == 0 {
+		return aofCorruptedError
+	}
+	if args[0] == aofMulti {
+		for _, payload := range args[1:] {
+			entry, err := decodeEntry([]byte(payload))
+			if err != nil {
+				return err
+			}
+			if err := s.apply(entry); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if len(args) < 2 {
+		return aofCorruptedError
+	}
+	operation, key, args := args[0], args[1], args[2:]
+
+	switch operation {
+	case aofSet, aofCreate, aofExpire:
+		return s.applyItem(operation, key, args)
+	case aofDelete:
+		s.lru.Remove(key)
+		return nil
+	}
+
+	item, err := s.replayItem(key, operation)
+	if err != nil {
+		return err
+	}
+	s.changed(item)
+	switch value := item.Value.(type) {
+	case commonStorage.Hash:
+		return applyHash(item, value, operation, args)
+	case *list.List:
+		return applyList(value, operation, args)
+	case commonStorage.Set:
+		return applySet(value, operation, args)
+	case *commonStorage.SortedSet:
+		return applySortedSet(value, operation, args)
+	}
+	return aofCorruptedError
+}
+
+// applyItem replays entries which replace key or change its expiration
+func (s *storage) applyItem(operation, key string, args []string) error {
+	var item *commonStorage.Item
+	switch operation {
+	case aofSet, aofCreate:
+		if len(args) != 3 {
+			return aofCorruptedError
+		}
+		value, err := interface{}(args[0]), error(nil)
+		if operation == aofCreate {
+			if value, err = newValue(args[0]); err != nil {
+				return err
+			}
+		}
+		item = commonStorage.NewItem(value, 0)
+		args = args[1:]
+	case aofExpire:
+		if len(args) != 2 {
+			return aofCorruptedError
+		}
+		raw, exists := s.lru.Peek(key)
+		if !exists {
+			return nil
+		}
+		item = raw.(*commonStorage.Item)
+	}
+	expireTime, err := parseTime(args[0])
+	if err != nil {
+		return err
+	}
+	slidingTTL, err := parseDuration(args[1])
+	if err != nil {
+		return err
+	}
+	item.ExpireTime, item.SlidingTTL = expireTime, slidingTTL
+	s.changed(item)
+	s.lru.Add(key, item)
+	s.index.add(key)
+	return nil
+}
+
+// replayItem returns item changed by operation. Missing item is created like by operation of storage.
+func (s *storage) replayItem(key, operation string) (*commonStorage.Item, error) {
+	if raw, exists := s.lru.Peek(key); exists {
+		return raw.(*commonStorage.Item), nil
+	}
+	var valueType string
+	switch operation {
+	case aofHashSet, aofHashDelete, aofHashIncrement, aofHashExpire:
+		valueType = commonStorage.TypeHash
+	case aofListLeftPush, aofListRightPush, aofListLeftPop, aofListRightPop, aofListSet, aofListInsert, aofListRemove, aofListTrim:
+		valueType = commonStorage.TypeList
+	case aofSetAdd, aofSetRemove:
+		valueType = commonStorage.TypeSet
+	case aofSortedSetAdd, aofSortedSetRemove:
+		valueType = commonStorage.TypeSortedSet
+	default:
+		return nil, fmt.Errorf("Unknown operation: %s", operation)
+	}
+	value, _ := newValue(valueType)
+	item := commonStorage.NewItem(value, 0)
+	s.lru.Add(key, item)
+	s.index.add(key)
+	return item, nil
+}
+
+func newValue(valueType string) (interface{}, error) {
+	switch valueType {
+	case commonStorage.TypeHash:
+		return make(commonStorage.Hash), nil
+	case commonStorage.TypeList:
+		return list.New(), nil
+	case commonStorage.TypeSet:
+		return make(commonStorage.Set), nil
+	case commonStorage.TypeSortedSet:
+		return commonStorage.NewSortedSet(), nil
+	}
+	return nil, fmt.Errorf("Unknown type: %s", valueType)
+}
+
+func applyHash(item *commonStorage.Item, hash commonStorage.Hash, operation string, args []string) error {
+	switch operation {
+	case aofHashSet:
+		if len(args)%2 != 0 {
+			return aofCorruptedError
+		}
+		for i := 0; i < len(args); i += 2 {
+			hash[args[i]] = args[i+1]
+			item.PersistFields(args[i])
+		}
+	case aofHashDelete:
+		for _, field := range args {
+			delete(hash, field)
+		}
+		item.PersistFields(args...)
+	case aofHashIncrement:
+		if len(args) != 2 {
+			return aofCorruptedError
+		}
+		delta, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return err
+		}
+		_, err = hash.Increment(args[0], delta)
+		return err
+	case aofHashExpire:
+		if len(args) != 2 {
+			return aofCorruptedError
+		}
+		expireTime, err := parseTime(args[1])
+		if err != nil {
+			return err
+		}
+		// Item.SetFieldExpireTime isn't used because it removes fields which are expired at the moment of replay
+		if _, found := hash[args[0]]; !found {
+			return commonStorage.FieldNotExistError
+		}
+		item.PersistFields(args[0])
+		if !expireTime.IsZero() {
+			if item.FieldExpireTimes == nil {
+				item.FieldExpireTimes = make(map[string]time.Time)
+			}
+			item.FieldExpireTimes[args[0]] = expireTime
+		}
+	default:
+		return commonStorage.KeyHashTypeError
+	}
+	return nil
+}
+
+func applyList(values *list.List, operation string, args []string) error {
+	switch operation {
+	case aofListLeftPush:
+		for _, value := range args {
+			values.PushFront(value)
+		}
+	case aofListRightPush:
+		for _, value := range args {
+			values.PushBack(value)
+		}
+	case aofListLeftPop, aofListRightPop:
+		if values.Len() == 0 {
+			return commonStorage.ListEmptyError
+		}
+		popListValue(values, operation == aofListLeftPop)
+	case aofListSet:
+		if len(args) != 2 {
+			return aofCorruptedError
+		}
+		position, err := strconv.Atoi(args[0])
+		if err != nil {
+			return err
+		}
+		if position < 0 || position >= values.Len() {
+			return commonStorage.IndexOutOfRangeError
+		}
+		listElement(values, position).Value = args[1]
+	case aofListInsert:
+		if len(args) != 3 {
+			return aofCorruptedError
+		}
+		before, err := strconv.ParseBool(args[2])
+		if err != nil {
+			return err
+		}
+		if !insertListValue(values, args[0], args[1], before) {
+			return commonStorage.PivotNotExistError
+		}
+	case aofListRemove:
+		if len(args) != 2 {
+			return aofCorruptedError
+		}
+		count, err := strconv.Atoi(args[0])
+		if err != nil {
+			return err
+		}
+		removeListValues(values, count, args[1])
+	case aofListTrim:
+		if len(args) != 2 {
+			return aofCorruptedError
+		}
+		start, err := strconv.Atoi(args[0])
+		if err != nil {
+			return err
+		}
+		stop, err := strconv.Atoi(args[1])
+		if err != nil {
+			return err
+		}
+		trimList(values, start, stop)
+	default:
+		return commonStorage.KeyListTypeError
+	}
+	return nil
+}
+
+func applySet(set commonStorage.Set, operation string, args []string) error {
+	switch operation {
+	case aofSetAdd:
+		set.Add(args...)
+	case aofSetRemove:
+		set.Remove(args...)
+	default:
+		return commonStorage.KeySetTypeError
+	}
+	return nil
+}
+
+func applySortedSet(set *commonStorage.SortedSet, operation string, args []string) error {
+	switch operation {
+	case aofSortedSetAdd:
+		if len(args)%2 != 0 {
+			return aofCorruptedError
+		}
+		members := make([]commonStorage.ScoredMember, 0, len(args)/2)
+		for i := 0; i < len(args); i += 2 {
+			score, err := strconv.ParseFloat(args[i], 64)
+			if err != nil {
+				return err
+			}
+			members = append(members, commonStorage.ScoredMember{Member: args[i+1], Score: score})
+		}
+		set.Add(members...)
+	case aofSortedSetRemove:
+		set.Remove(args...)
+	default:
+		return commonStorage.KeySortedSetTypeError
+	}
+	return nil
+}
+
+// maintainAOF syncs file every second if it is required by fsync policy and starts rewrite of file when it grows
+// or when writing of it has failed
+func (s *storage) maintainAOF() {
+	defer s.aof.wg.Done()
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.aof.done:
+			return
+		case <-ticker.C:
+		}
+		if s.aof.fsync == FsyncEverySecond {
+			s.aof.sync()
+		}
+		if s.aof.shouldRewrite() {
+			s.aof.wg.Add(1)
+			go func() {
+				defer s.aof.wg.Done()
+				if err := s.RewriteAOF(); err != nil && err != AOFRewriteInProgressError {
+					s.aof.logger.Println(err)
+				}
+			}()
+		}
+	}
+}
+
+// RewriteAOF replaces append-only file by compact file which contains only entries of current keys.
+// Storage is locked only while its snapshot is taken, changes made while new file is written are appended to both files.
+func (s *storage) RewriteAOF() error {
+	a := s.aof
+	if a == nil {
+		return AOFDisabledError
+	}
+	if !a.startRewrite() {
+		return AOFRewriteInProgressError
+	}
+
+	s.mu.Lock()
+	var keys []string
+	var items []*commonStorage.Item
+	// Keys are written from the oldest one, so LRU order is kept after replay
+	for _, key := range s.lru.Keys() {
+		raw, _ := s.lru.Peek(key)
+		if item := raw.(*commonStorage.Item); item.IsAlive() {
+			keys = append(keys, key.(string))
+			items = append(items, copyItem(item))
+		}
+	}
+	a.startCapture()
+	s.unlock()
+
+	return a.rewrite(keys, items)
+}
+
+// Close stops background work of append-only file, syncs and closes it. Storage must not be changed after Close.
+func (s *storage) Close() error {
+	if s.aof == nil {
+		return nil
+	}
+	close(s.aof.done)
+	s.aof.wg.Wait()
+	return s.aof.close()
+}
+
+// write appends entries of one operation to file. Several entries are wrapped into one, so they are replayed all or nothing.
+func (a *appendOnlyFile) write(entries [][]string) {
+	var data []byte
+	if len(entries) == 1 {
+		data = appendEntry(nil, entries[0])
+	} else {
+		args := make([]string, 0, len(entries)+1)
+		args = append(args, aofMulti)
+		for _, entry := range entries {
+			args = append(args, string(encodePayload(nil, entry)))
+		}
+		data = appendEntry(nil, args)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	// Entries are collected even after error because rewritten file doesn't depend on the current one
+	if a.capturing {
+		a.rewriteBuf = append(a.rewriteBuf, data...)
+	}
+	if a.err != nil {
+		return
+	}
+	if _, err := a.file.Write(data); err != nil {
+		a.fail(err)
+		return
+	}
+	a.size += int64(len(data))
+	if a.fsync == FsyncAlways {
+		if err := a.file.Sync(); err != nil {
+			a.fail(err)
+		}
+		return
+	}
+	a.dirty = true
+}
+
+func (a *appendOnlyFile) sync() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if !a.dirty || a.err != nil {
+		return
+	}
+	if err := a.file.Sync(); err != nil {
+		a.fail(err)
+		return
+	}
+	a.dirty = false
+}
+
+func (a *appendOnlyFile) fail(err error) {
+	a.err = err
+	a.logger.Printf("Cannot write AOF %s, writing is stopped until file is rewritten: %s", a.path, err)
+}
+
+// shouldRewrite reports whether file has grown twice since the last rewrite or it can't be written anymore
+func (a *appendOnlyFile) shouldRewrite() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.rewriting {
+		return false
+	}
+	return a.err != nil || (a.size >= a.rewriteMinSize && a.size >= 2*a.rewriteSize)
+}
+
+func (a *appendOnlyFile) startRewrite() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.rewriting {
+		return false
+	}
+	a.rewriting = true
+	return true
+}
+
+// startCapture starts collecting of entries for new file, lock of storage must be held
+func (a *appendOnlyFile) startCapture() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.capturing, a.rewriteBuf = true, nil
+}
+
+// rewrite writes entries of items into temporary file, appends entries collected meanwhile and replaces current file by it
+func (a *appendOnlyFile) rewrite(keys []string, items []*commonStorage.Item) error {
+	path := a.path + ".rewrite"
+	file, size, err := writeSnapshot(path, keys, items)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	defer func() {
+		a.rewriting, a.capturing, a.rewriteBuf = false, false, nil
+	}()
+	if err == nil {
+		err = a.replace(file, size)
+	}
+	if err != nil {
+		if file != nil {
+			file.Close()
+		}
+		os.Remove(path)
+		return fmt.Errorf("Cannot rewrite AOF: %s", err)
+	}
+	return nil
+}
+
+// replace appends collected entries to new file and moves it to path of current file, lock must be held
+func (a *appendOnlyFile) replace(file *os.File, size int64) error {
+	if _, err := file.Write(a.rewriteBuf); err != nil {
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		return err
+	}
+	if err := os.Rename(file.Name(), a.path); err != nil {
+		return err
+	}
+	if dir, err := os.Open(filepath.Dir(a.path)); err == nil {
+		dir.Sync()
+		dir.Close()
+	}
+	a.file.Close()
+	a.file = file
+	a.size = size + int64(len(a.rewriteBuf))
+	a.rewriteSize = a.size
+	a.dirty, a.err = false, nil
+	return nil
+}
+
+func (a *appendOnlyFile) close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	err := a.err
+	if err == nil {
+		err = a.file.Sync()
+	}
+	if closeErr := a.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// writeSnapshot writes entries of items into new synced file and returns it together with its size
+func writeSnapshot(path string, keys []string, items []*commonStorage.Item) (*os.File, int64, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return nil, 0, err
+	}
+	w := bufio.NewWriter(file)
+	var size int64
+	var data []byte
+	for i, key := range keys {
+		for _, entry := range itemEntries(key, items[i]) {
+			data = appendEntry(data[:0], entry)
+			if _, err := w.Write(data); err != nil {
+				return file, 0, err
+			}
+			size += int64(len(data))
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return file, 0, err
+	}
+	return file, size, file.Sync()
+}
+
+// appendEntry appends header and payload of entry to data
+func appendEntry(data []byte, args []string) []byte {
+	payload := encodePayload(nil, args)
+	var header [aofHeaderSize]byte
+	binary.LittleEndian.PutUint32(header[:4], uint32(len(payload)))
+	binary.LittleEndian.PutUint32(header[4:], crc32.ChecksumIEEE(payload))
+	return append(append(data, header[:]...), payload...)
+}
+
+func encodePayload(payload []byte, args []string) []byte {
+	var length [binary.MaxVarintLen64]byte
+	for _, arg := range args {
+		n := binary.PutUvarint(length[:], uint64(len(arg)))
+		payload = append(append(payload, length[:n]...), arg...)
+	}
+	return payload
+}
+
+func decodeEntry(payload []byte) ([]string, error) {
+	var args []string
+	for len(payload) > 0 {
+		length, n := binary.Uvarint(payload)
+		if n <= 0 || length > uint64(len(payload)-n) {
+			return nil, aofCorruptedError
+		}
+		args = append(args, string(payload[n:n+int(length)]))
+		payload = payload[n+int(length):]
+	}
+	return args, nil
+}
+
+// readEntry reads entry from r which has remaining bytes until the end of file and returns entry size.
+// io.ErrUnexpectedEOF is returned if entry is incomplete: it doesn't fit into the rest of file
+// or its checksum doesn't match while it is the last entry, which is the case of interrupted write.
+func readEntry(r *bufio.Reader, remaining int64) ([]string, int64, error) {
+	if remaining < aofHeaderSize {
+		return nil, 0, io.ErrUnexpectedEOF
+	}
+	var header [aofHeaderSize]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, 0, err
+	}
+	size := aofHeaderSize + int64(binary.LittleEndian.Uint32(header[:4]))
+	if size > remaining {
+		return nil, 0, io.ErrUnexpectedEOF
+	}
+	payload := make([]byte, size-aofHeaderSize)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, 0, err
+	}
+	if crc32.ChecksumIEEE(payload) != binary.LittleEndian.Uint32(header[4:]) {
+		if size == remaining {
+			return nil, 0, io.ErrUnexpectedEOF
+		}
+		return nil, 0, aofCorruptedError
+	}
+	args, err := decodeEntry(payload)
+	return args, size, err
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "0"
+	}
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+func parseTime(value string) (time.Time, error) {
+	nanoseconds, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || nanoseconds == 0 {
+		return time.Time{}, err
+	}
+	return time.Unix(0, nanoseconds), nil
+}
+
+func formatDuration(d time.Duration) string {
+	return strconv.FormatInt(int64(d), 10)
+}
+
+func parseDuration(value string) (time.Duration, error) {
+	nanoseconds, err := strconv.ParseInt(value, 10, 64)
+	return time.Duration(nanoseconds), err
+}
+
+func formatScore(score float64) string {
+	return strconv.FormatFloat(score, 'g', -1, 64)
+}
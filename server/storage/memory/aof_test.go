@@ -0,0 +1,277 @@
+package memory
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	commonStorage "github.com/Barberrrry/jcache/server/storage"
+	. "gopkg.in/check.v1"
+)
+
+func openAOF(c *C, path string) *storage {
+	storage, err := NewStorageWithAOF(100, time.Minute, AOFOptions{Path: path, Fsync: FsyncAlways})
+	c.Assert(err, IsNil)
+	return storage
+}
+
+func (s *StorageTestSuite) TestAOFReplay(c *C) {
+	path := filepath.Join(c.MkDir(), "test.aof")
+	storage := openAOF(c, path)
+	storage.Set("string", "value", 0)
+	storage.Increment("counter", 5, 0)
+	storage.Increment("counter", -2, 0)
+	storage.Set("ttl", "value", 100)
+	storage.Set("deleted", "value", 0)
+	storage.Delete("deleted")
+	storage.HashSetMulti("hash", []string{"a", "b", "c"}, []string{"1", "2", "3"})
+	storage.HashDelete("hash", "b")
+	storage.HashIncrementBy("hash", "a", 10)
+	storage.HashExpireAt("hash", "c", time.Now().Add(time.Hour))
+	storage.ListRightPush("list", "b")
+	storage.ListLeftPush("list", "a")
+	storage.ListRightPush("list", "c")
+	storage.ListRightPush("list", "d")
+	storage.ListLeftPop("list")
+	storage.ListInsert("list", "c", "x", true)
+	storage.ListSet("list", -1, "z")
+	storage.ListMove("list", "other", true, false)
+	storage.SetAdd("set", []string{"a", "b", "c"})
+	storage.SetRemove("set", []string{"b"})
+	storage.SortedSetAdd("zset", []commonStorage.ScoredMember{{Member: "a", Score: 1.5}, {Member: "b", Score: 2}})
+	storage.SortedSetIncrementBy("zset", "a", 1)
+	storage.Transaction(func(tx commonStorage.Storage) error {
+		tx.Set("committed", "value", 0)
+		return nil
+	})
+	storage.Transaction(func(tx commonStorage.Storage) error {
+		tx.Set("rolled_back", "value", 0)
+		tx.Delete("string")
+		return errors.New("rollback")
+	})
+	ttl, _ := storage.ExpireTime("ttl")
+	c.Assert(storage.Close(), IsNil)
+
+	storage = openAOF(c, path)
+	c.Assert(storage.Keys(), DeepEquals, []string{"committed", "counter", "hash", "list", "other", "set", "string", "ttl", "zset"})
+	value, _ := storage.Get("string")
+	c.Assert(value, Equals, "value")
+	value, _ = storage.Get("counter")
+	c.Assert(value, Equals, "3")
+	expireTime, _ := storage.ExpireTime("ttl")
+	c.Assert(expireTime.Equal(ttl), Equals, true)
+	hash, _ := storage.HashGetAll("hash")
+	c.Assert(hash, DeepEquals, map[string]string{"a": "11", "c": "3"})
+	fieldExpireTime, _ := storage.HashExpireTime("hash", "c")
+	c.Assert(fieldExpireTime.IsZero(), Equals, false)
+	values, _ := storage.ListRange("list", 0, -1)
+	c.Assert(values, DeepEquals, []string{"x", "c", "z"})
+	values, _ = storage.ListRange("other", 0, -1)
+	c.Assert(values, DeepEquals, []string{"b"})
+	members, _ := storage.SetMembers("set")
+	c.Assert(members, DeepEquals, []string{"a", "c"})
+	scored, _ := storage.SortedSetRange("zset", 0, -1, false)
+	c.Assert(scored, DeepEquals, []commonStorage.ScoredMember{{Member: "b", Score: 2}, {Member: "a", Score: 2.5}})
+
+	// New changes are appended to replayed file
+	storage.ListRightPop("list")
+	storage.Close()
+	storage = openAOF(c, path)
+	values, _ = storage.ListRange("list", 0, -1)
+	c.Assert(values, DeepEquals, []string{"x", "c"})
+	storage.Close()
+}
+
+func (s *StorageTestSuite) TestAOFReplayOfExpired(c *C) {
+	path := filepath.Join(c.MkDir(), "test.aof")
+	storage := openAOF(c, path)
+	storage.ListRightPush("list", "old")
+	storage.Expire("list", 1)
+	storage.HashSet("hash", "field", "5")
+	storage.HashExpireAt("hash", "field", time.Now().Add(500*time.Millisecond))
+	storage.Set("expired", "value", 1)
+	time.Sleep(time.Second)
+	// Replay must not push into expired list or increment expired field
+	storage.ListRightPush("list", "new")
+	storage.HashIncrementBy("hash", "field", 1)
+	c.Assert(storage.Close(), IsNil)
+
+	storage = openAOF(c, path)
+	defer storage.Close()
+	c.Assert(storage.Keys(), DeepEquals, []string{"hash", "list"})
+	values, _ := storage.ListRange("list", 0, -1)
+	c.Assert(values, DeepEquals, []string{"new"})
+	expireTime, _ := storage.ExpireTime("list")
+	c.Assert(expireTime.IsZero(), Equals, true)
+	value, _ := storage.HashGet("hash", "field")
+	c.Assert(value, Equals, "1")
+	fieldExpireTime, _ := storage.HashExpireTime("hash", "field")
+	c.Assert(fieldExpireTime.IsZero(), Equals, true)
+}
+
+func (s *StorageTestSuite) TestAOFReplayOfEvicted(c *C) {
+	path := filepath.Join(c.MkDir(), "test.aof")
+	storage, _ := NewStorageWithAOF(2, time.Minute, AOFOptions{Path: path})
+	storage.Set("key1", "value1", 0)
+	storage.Set("key2", "value2", 0)
+	storage.Get("key1")
+	storage.Set("key3", "value3", 0)
+	c.Assert(storage.Keys(), DeepEquals, []string{"key1", "key3"})
+	storage.Close()
+
+	storage, _ = NewStorageWithAOF(2, time.Minute, AOFOptions{Path: path})
+	defer storage.Close()
+	c.Assert(storage.Keys(), DeepEquals, []string{"key1", "key3"})
+}
+
+func (s *StorageTestSuite) TestAOFReplayOfRemovedByGC(c *C) {
+	path := filepath.Join(c.MkDir(), "test.aof")
+	storage, _ := NewStorageWithAOF(2, time.Minute, AOFOptions{Path: path})
+	storage.Set("b", "value", 0)
+	options := commonStorage.SetOptions{ExpireTime: time.Now().Add(20 * time.Millisecond)}
+	storage.SetWithOptions("a", "value", 0, options)
+	time.Sleep(30 * time.Millisecond)
+	storage.removeExpired()
+	// Key is added to free place, so nothing is evicted
+	storage.Set("c", "value", 0)
+	c.Assert(storage.Keys(), DeepEquals, []string{"b", "c"})
+	storage.Close()
+
+	storage, _ = NewStorageWithAOF(2, time.Minute, AOFOptions{Path: path})
+	defer storage.Close()
+	c.Assert(storage.Keys(), DeepEquals, []string{"b", "c"})
+}
+
+func (s *StorageTestSuite) TestAOFTruncated(c *C) {
+	path := filepath.Join(c.MkDir(), "test.aof")
+	storage := openAOF(c, path)
+	storage.Set("key1", "value1", 0)
+	storage.Set("key2", "value2", 0)
+	storage.Close()
+
+	info, _ := os.Stat(path)
+	c.Assert(os.Truncate(path, info.Size()-3), IsNil)
+
+	storage = openAOF(c, path)
+	c.Assert(storage.Keys(), DeepEquals, []string{"key1"})
+	storage.Set("key3", "value3", 0)
+	storage.Close()
+
+	storage = openAOF(c, path)
+	defer storage.Close()
+	c.Assert(storage.Keys(), DeepEquals, []string{"key1", "key3"})
+}
+
+func (s *StorageTestSuite) TestAOFCorrupted(c *C) {
+	path := filepath.Join(c.MkDir(), "test.aof")
+	storage := openAOF(c, path)
+	storage.Set("key1", "value1", 0)
+	storage.Set("key2", "value2", 0)
+	storage.Close()
+
+	file, _ := os.OpenFile(path, os.O_WRONLY, 0644)
+	file.WriteAt([]byte("X"), aofHeaderSize+2)
+	file.Close()
+
+	_, err := NewStorageWithAOF(100, time.Minute, AOFOptions{Path: path})
+	c.Assert(err, ErrorMatches, "Cannot read AOF entry at offset 0: Entry is corrupted")
+}
+
+func (s *StorageTestSuite) TestAOFRewrite(c *C) {
+	path := filepath.Join(c.MkDir(), "test.aof")
+	storage := openAOF(c, path)
+	for i := 0; i < 100; i++ {
+		storage.SetWithOptions("key", fmt.Sprint(i), 0, commonStorage.SetOptions{Mode: commonStorage.SetAlways})
+		storage.ListRightPush("list", fmt.Sprint(i))
+		storage.ListLeftPop("list")
+	}
+	storage.ListRightPush("list", "value")
+	storage.HashSet("hash", "field", "value")
+	storage.HashExpireAt("hash", "field", time.Now().Add(time.Hour))
+	storage.SortedSetAdd("zset", []commonStorage.ScoredMember{{Member: "a", Score: 1}})
+	storage.SetAdd("set", []string{"a"})
+	storage.Set("sliding", "value", 0)
+	storage.ExpireSliding("sliding", time.Hour)
+	before, _ := os.Stat(path)
+
+	c.Assert(storage.RewriteAOF(), IsNil)
+	after, _ := os.Stat(path)
+	c.Assert(after.Size() < before.Size()/10, Equals, true)
+	storage.Set("new", "value", 0)
+	storage.Close()
+
+	storage = openAOF(c, path)
+	defer storage.Close()
+	c.Assert(storage.Keys(), DeepEquals, []string{"hash", "key", "list", "new", "set", "sliding", "zset"})
+	value, _ := storage.Get("key")
+	c.Assert(value, Equals, "99")
+	values, _ := storage.ListRange("list", 0, -1)
+	c.Assert(values, DeepEquals, []string{"value"})
+	fieldExpireTime, _ := storage.HashExpireTime("hash", "field")
+	c.Assert(fieldExpireTime.IsZero(), Equals, false)
+	expireTime, _ := storage.ExpireTime("sliding")
+	c.Assert(expireTime.IsZero(), Equals, false)
+
+	withoutAOF, _ := NewStorage(100, time.Minute)
+	c.Assert(withoutAOF.RewriteAOF(), Equals, AOFDisabledError)
+}
+
+func (s *StorageTestSuite) TestAOFRewriteDuringChanges(c *C) {
+	path := filepath.Join(c.MkDir(), "test.aof")
+	storage, _ := NewStorageWithAOF(1000, time.Minute, AOFOptions{Path: path, Fsync: FsyncNever})
+	done := make(chan bool)
+	go func() {
+		for i := 0; i < 500; i++ {
+			storage.ListRightPush("list", fmt.Sprint(i))
+		}
+		done <- true
+	}()
+	for i := 0; i < 5; i++ {
+		c.Assert(storage.RewriteAOF(), IsNil)
+	}
+	<-done
+	storage.Close()
+
+	storage, _ = NewStorageWithAOF(1000, time.Minute, AOFOptions{Path: path})
+	defer storage.Close()
+	length, _ := storage.ListLen("list")
+	c.Assert(length, Equals, 500)
+}
+
+func (s *StorageTestSuite) TestAOFRewriteAfterWriteError(c *C) {
+	path := filepath.Join(c.MkDir(), "test.aof")
+	storage := openAOF(c, path)
+	storage.Set("key1", "value1", 0)
+
+	// File opened for reading only fails every write
+	file, _ := os.Open(path)
+	storage.aof.mu.Lock()
+	storage.aof.file.Close()
+	storage.aof.file = file
+	storage.aof.mu.Unlock()
+	storage.Set("key2", "value2", 0)
+	storage.aof.mu.Lock()
+	c.Assert(storage.aof.err, NotNil)
+	storage.aof.mu.Unlock()
+
+	// File is rewritten in background, so entries are written again
+	for i := 0; i < 30 && storage.aof.shouldRewrite(); i++ {
+		time.Sleep(100 * time.Millisecond)
+	}
+	c.Assert(storage.aof.shouldRewrite(), Equals, false)
+	storage.Set("key3", "value3", 0)
+	c.Assert(storage.Close(), IsNil)
+
+	storage = openAOF(c, path)
+	defer storage.Close()
+	c.Assert(storage.Keys(), DeepEquals, []string{"key1", "key2", "key3"})
+}
+
+func (s *StorageTestSuite) TestFsyncPolicy(c *C) {
+	var policy FsyncPolicy
+	c.Assert(policy.Set(FsyncAlways), IsNil)
+	c.Assert(policy.String(), Equals, FsyncAlways)
+	c.Assert(policy.Set("sometimes"), ErrorMatches, "Unknown fsync policy: sometimes")
+}
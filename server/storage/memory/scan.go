@@ -0,0 +1,66 @@
+package memory
+
+import (
+	"hash/fnv"
+	"strconv"
+
+	commonStorage "github.com/Barberrrry/jcache/server/storage"
+)
+
+// scanShards is a number of key index shards. Scan cursor is a number of the next shard to examine.
+const scanShards = 1024
+
+// keyIndex splits keys into shards by key hash. Key always stays in the same shard,
+// so every key which exists during the whole iteration is returned by Scan.
+type keyIndex []map[string]struct{}
+
+func newKeyIndex() keyIndex {
+	index := make(keyIndex, scanShards)
+	for i := range index {
+		index[i] = make(map[string]struct{})
+	}
+	return index
+}
+
+func (i keyIndex) add(key string) {
+	i[shard(key)][key] = struct{}{}
+}
+
+func (i keyIndex) remove(key string) {
+	delete(i[shard(key)], key)
+}
+
+func shard(key string) int {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % scanShards)
+}
+
+// Scan returns keys of the next shards starting from cursor until options.Limit() keys are examined.
+// Whole shard is always examined, so page size is not exact. Returned cursor is ScanStart when all shards are examined.
+func (s *storage) Scan(cursor string, options commonStorage.ScanOptions) (string, []string, error) {
+	n, err := strconv.Atoi(cursor)
+	if err != nil || n < 0 || n >= scanShards {
+		return "", nil, commonStorage.InvalidCursorError
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	keys := []string{}
+	for examined := 0; n < scanShards && examined < options.Limit(); n++ {
+		for key := range s.index[n] {
+			examined++
+			if !options.MatchKey(key) {
+				continue
+			}
+			if raw, exists := s.lru.Peek(key); exists && options.MatchItem(raw.(*commonStorage.Item)) {
+				keys = append(keys, key)
+			}
+		}
+	}
+	if n == scanShards {
+		return commonStorage.ScanStart, keys, nil
+	}
+	return strconv.Itoa(n), keys, nil
+}
@@ -0,0 +1,133 @@
+package memory
+
+import (
+	commonStorage "github.com/Barberrrry/jcache/server/storage"
+)
+
+func (s *storage) getSet(key string, createIfNotExist bool) (commonStorage.Set, error) {
+	item, err := s.getItem(key)
+	if err != nil {
+		if !createIfNotExist {
+			return nil, err
+		}
+		item = commonStorage.NewItem(make(commonStorage.Set), 0)
+		s.insertItem(key, item)
+	}
+	return item.CastSet()
+}
+
+// getSets returns sets of specified keys, missing key is returned as nil set
+func (s *storage) getSets(keys []string) ([]commonStorage.Set, error) {
+	sets := make([]commonStorage.Set, len(keys))
+	for i, key := range keys {
+		set, err := s.getSet(key, false)
+		if err != nil && err != commonStorage.KeyNotExistsError {
+			return nil, err
+		}
+		sets[i] = set
+	}
+	return sets, nil
+}
+
+// SetAdd adds members to set and returns number of new members. Set is created if key doesn't exist.
+// Error will occur if key type is not set.
+func (s *storage) SetAdd(key string, members []string) (int, error) {
+	s.mu.Lock()
+	defer s.unlock()
+	s.backup(key)
+
+	set, err := s.getSet(key, true)
+	if err != nil {
+		return 0, err
+	}
+	added := set.Add(members...)
+	if added > 0 {
+		s.changedKey(key)
+		s.record(aofSetAdd, key, members...)
+	}
+	return added, nil
+}
+
+// SetRemove removes members from set and returns number of removed members.
+// Error will occur if key doesn't exist or key type is not set.
+func (s *storage) SetRemove(key string, members []string) (int, error) {
+	s.mu.Lock()
+	defer s.unlock()
+	s.backup(key)
+
+	set, err := s.getSet(key, false)
+	if err != nil {
+		return 0, err
+	}
+	removed := set.Remove(members...)
+	if removed > 0 {
+		s.changedKey(key)
+		s.record(aofSetRemove, key, members...)
+	}
+	return removed, nil
+}
+
+// SetIsMember reports whether member is in set. Error will occur if key doesn't exist or key type is not set.
+func (s *storage) SetIsMember(key, member string) (bool, error) {
+	s.mu.Lock()
+	defer s.unlock()
+
+	set, err := s.getSet(key, false)
+	if err != nil {
+		return false, err
+	}
+	return set[member], nil
+}
+
+// SetMembers returns sorted members of set. Error will occur if key doesn't exist or key type is not set.
+func (s *storage) SetMembers(key string) ([]string, error) {
+	s.mu.Lock()
+	defer s.unlock()
+
+	set, err := s.getSet(key, false)
+	if err != nil {
+		return nil, err
+	}
+	return set.Members(), nil
+}
+
+// SetLen returns number of set members. Error will occur if key doesn't exist or key type is not set.
+func (s *storage) SetLen(key string) (int, error) {
+	s.mu.Lock()
+	defer s.unlock()
+
+	set, err := s.getSet(key, false)
+	if err != nil {
+		return 0, err
+	}
+	return len(set), nil
+}
+
+// SetIntersect returns sorted members which are in all sets. Missing keys are empty sets.
+// Error will occur if type of any key is not set.
+func (s *storage) SetIntersect(keys []string) ([]string, error) {
+	return s.combineSets(keys, commonStorage.IntersectSets)
+}
+
+// SetUnion returns sorted members which are in any of sets. Missing keys are empty sets.
+// Error will occur if type of any key is not set.
+func (s *storage) SetUnion(keys []string) ([]string, error) {
+	return s.combineSets(keys, commonStorage.UnionSets)
+}
+
+// SetDiff returns sorted members of the first set which are not in other sets. Missing keys are empty sets.
+// Error will occur if type of any key is not set.
+func (s *storage) SetDiff(keys []string) ([]string, error) {
+	return s.combineSets(keys, commonStorage.DiffSets)
+}
+
+func (s *storage) combineSets(keys []string, combine func([]commonStorage.Set) []string) ([]string, error) {
+	s.mu.Lock()
+	defer s.unlock()
+
+	sets, err := s.getSets(keys)
+	if err != nil {
+		return nil, err
+	}
+	return combine(sets), nil
+}
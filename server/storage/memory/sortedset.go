@@ -0,0 +1,148 @@
+package memory
+
+import (
+	commonStorage "github.com/Barberrrry/jcache/server/storage"
+)
+
+func (s *storage) getSortedSet(key string, createIfNotExist bool) (*commonStorage.SortedSet, error) {
+	item, err := s.getItem(key)
+	if err != nil {
+		if !createIfNotExist {
+			return nil, err
+		}
+		item = commonStorage.NewItem(commonStorage.NewSortedSet(), 0)
+		s.insertItem(key, item)
+	}
+	return item.CastSortedSet()
+}
+
+// SortedSetAdd adds members or updates their scores and returns number of new members.
+// Sorted set is created if key doesn't exist. Error will occur if key type is not sorted set.
+func (s *storage) SortedSetAdd(key string, members []commonStorage.ScoredMember) (int, error) {
+	s.mu.Lock()
+	defer s.unlock()
+	s.backup(key)
+
+	set, err := s.getSortedSet(key, true)
+	if err != nil {
+		return 0, err
+	}
+	added, updated := set.Add(members...)
+	if added+updated > 0 {
+		s.changedKey(key)
+		s.record(aofSortedSetAdd, key, scoredMemberArgs(members)...)
+	}
+	return added, nil
+}
+
+// SortedSetRemove removes members from sorted set and returns number of removed members.
+// Error will occur if key doesn't exist or key type is not sorted set.
+func (s *storage) SortedSetRemove(key string, members []string) (int, error) {
+	s.mu.Lock()
+	defer s.unlock()
+	s.backup(key)
+
+	set, err := s.getSortedSet(key, false)
+	if err != nil {
+		return 0, err
+	}
+	removed := set.Remove(members...)
+	if removed > 0 {
+		s.changedKey(key)
+		s.record(aofSortedSetRemove, key, members...)
+	}
+	return removed, nil
+}
+
+// SortedSetScore returns score of member. Error will occur if key or member doesn't exist or key type is not sorted set.
+func (s *storage) SortedSetScore(key, member string) (float64, error) {
+	s.mu.Lock()
+	defer s.unlock()
+
+	set, err := s.getSortedSet(key, false)
+	if err != nil {
+		return 0, err
+	}
+	score, found := set.Score(member)
+	if !found {
+		return 0, commonStorage.MemberNotExistError
+	}
+	return score, nil
+}
+
+// SortedSetIncrementBy adds delta to score of member and returns new score.
+// Sorted set and member are created if they don't exist. Error will occur if key type is not sorted set.
+func (s *storage) SortedSetIncrementBy(key, member string, delta float64) (float64, error) {
+	s.mu.Lock()
+	defer s.unlock()
+	s.backup(key)
+
+	set, err := s.getSortedSet(key, true)
+	if err != nil {
+		return 0, err
+	}
+	score, err := set.IncrementBy(member, delta)
+	if err != nil {
+		return 0, err
+	}
+	s.changedKey(key)
+	s.record(aofSortedSetAdd, key, formatScore(score), member)
+	return score, nil
+}
+
+// SortedSetRange returns members from start to stop rank, negative ranks are counted from the end.
+// Members are ordered by descending score if reverse is set.
+// Error will occur if key doesn't exist or key type is not sorted set.
+func (s *storage) SortedSetRange(key string, start, stop int, reverse bool) ([]commonStorage.ScoredMember, error) {
+	s.mu.Lock()
+	defer s.unlock()
+
+	set, err := s.getSortedSet(key, false)
+	if err != nil {
+		return nil, err
+	}
+	return set.Range(start, stop, reverse), nil
+}
+
+// SortedSetRangeByScore returns members with score between min and max inclusive.
+// First offset members are skipped, negative count means all following members.
+// Error will occur if key doesn't exist or key type is not sorted set.
+func (s *storage) SortedSetRangeByScore(key string, min, max float64, offset, count int) ([]commonStorage.ScoredMember, error) {
+	s.mu.Lock()
+	defer s.unlock()
+
+	set, err := s.getSortedSet(key, false)
+	if err != nil {
+		return nil, err
+	}
+	return set.RangeByScore(min, max, offset, count), nil
+}
+
+// SortedSetRank returns 0-based rank of member in ascending order.
+// Error will occur if key or member doesn't exist or key type is not sorted set.
+func (s *storage) SortedSetRank(key, member string) (int, error) {
+	s.mu.Lock()
+	defer s.unlock()
+
+	set, err := s.getSortedSet(key, false)
+	if err != nil {
+		return 0, err
+	}
+	rank, found := set.Rank(member)
+	if !found {
+		return 0, commonStorage.MemberNotExistError
+	}
+	return rank, nil
+}
+
+// SortedSetLen returns number of members. Error will occur if key doesn't exist or key type is not sorted set.
+func (s *storage) SortedSetLen(key string) (int, error) {
+	s.mu.Lock()
+	defer s.unlock()
+
+	set, err := s.getSortedSet(key, false)
+	if err != nil {
+		return 0, err
+	}
+	return set.Len(), nil
+}
@@ -3,6 +3,7 @@ package memory
 import (
 	"container/list"
 	"sort"
+	"strconv"
 	"sync"
 	"time"
 
@@ -12,51 +13,109 @@ import (
 
 type storage struct {
 	lru *simplelru.LRU
-	mu  sync.RWMutex
+	// mu is locked exclusively on every item access because reads change LRU order and sliding expiration
+	mu      sync.RWMutex
+	journal map[string]*commonStorage.Item
+	// version is the last item version, it is shared with transaction storage
+	version *uint64
+	// index contains all keys of LRU, it is used by Scan and shared with transaction storage
+	index keyIndex
+	// waiters are queues of blocked pops by list key, they are shared with transaction storage
+	waiters map[string][]*commonStorage.ListWaiter
+	// pushed contains keys pushed inside of transaction, their waiters are served after commit
+	pushed map[string]bool
+	// notifier receives keyspace events, it is shared with transaction storage
+	notifier commonStorage.Notifier
+	// events are reported inside of transaction, they are sent to notifier after commit
+	events []keyEvent
+	// aof receives entries of changes, it is nil if persistence is disabled. It is shared with transaction storage.
+	aof *appendOnlyFile
+	// entries are changes of the current operation, they are written into aof on unlock or after commit of transaction
+	entries [][]string
+}
+
+// keyEvent is a keyspace event which waits for commit of transaction
+type keyEvent struct {
+	event string
+	key   string
 }
 
 // NewStorage creates new memory storage
 func NewStorage(size int, gcInterval time.Duration) (*storage, error) {
-	lru, err := simplelru.NewLRU(size, nil)
+	s, err := newStorage(size)
 	if err != nil {
 		return nil, err
 	}
 
-	s := &storage{lru: lru}
-
 	go s.gc(gcInterval)
 
 	return s, nil
 }
 
+func newStorage(size int) (*storage, error) {
+	s := &storage{version: new(uint64), index: newKeyIndex(), waiters: make(map[string][]*commonStorage.ListWaiter)}
+	lru, err := simplelru.NewLRU(size, s.onEvict)
+	if err != nil {
+		return nil, err
+	}
+	s.lru = lru
+	return s, nil
+}
+
 func (s *storage) gc(interval time.Duration) {
 	for _ = range time.Tick(interval) {
 		s.removeExpired()
 	}
 }
 
+// removeExpired removes expired keys and expired fields of hashes
 func (s *storage) removeExpired() {
-	var deleteKeys []interface{}
+	var deleteKeys, hashKeys []interface{}
 	s.mu.RLock()
 	for _, key := range s.lru.Keys() {
 		if raw, exists := s.lru.Peek(key); exists {
 			if item, castOk := raw.(*commonStorage.Item); castOk && !item.IsAlive() {
 				deleteKeys = append(deleteKeys, key)
+			} else if castOk && item.HasExpiredFields() {
+				hashKeys = append(hashKeys, key)
 			}
 		}
 	}
 	s.mu.RUnlock()
-	if len(deleteKeys) > 0 {
-		for _, key := range deleteKeys {
-			s.mu.Lock()
+	for _, key := range deleteKeys {
+		s.mu.Lock()
+		// Key could be overwritten since it was found.
+		// Removal is recorded because expired key takes place in LRU until it is removed.
+		if raw, exists := s.lru.Peek(key); exists && !raw.(*commonStorage.Item).IsAlive() {
 			s.lru.Remove(key)
-			s.mu.Unlock()
+			s.notify(commonStorage.EventExpired, key.(string))
+			s.record(aofDelete, key.(string))
 		}
+		s.unlock()
+	}
+	for _, key := range hashKeys {
+		s.mu.Lock()
+		if raw, exists := s.lru.Peek(key); exists {
+			s.removeExpiredFields(key.(string), raw.(*commonStorage.Item))
+		}
+		s.unlock()
 	}
 }
 
+// getItem returns alive item and extends its expiration if it is sliding, so exclusive lock must be held
 func (s *storage) getItem(key string) (*commonStorage.Item, error) {
 	if raw, exists := s.lru.Get(key); exists {
+		if item, castOk := raw.(*commonStorage.Item); castOk && item.IsAlive() {
+			item.Touch()
+			return item, nil
+		}
+	}
+	return nil, commonStorage.KeyNotExistsError
+}
+
+// peekItem returns alive item without counting it as access
+func (s *storage) peekItem(key string) (*commonStorage.Item, error) {
+	if raw, exists := s.lru.Peek(key); exists {
 		if item, castOk := raw.(*commonStorage.Item); castOk && item.IsAlive() {
 			return item, nil
 		}
@@ -64,28 +123,106 @@ func (s *storage) getItem(key string) (*commonStorage.Item, error) {
 	return nil, commonStorage.KeyNotExistsError
 }
 
+// addItem adds or replaces item of key and reports its change
 func (s *storage) addItem(key string, item *commonStorage.Item) {
-	s.lru.Add(key, item)
+	s.insertItem(key, item)
+	s.notify(item.ChangeEvent(), key)
+}
+
+// insertItem adds or replaces item of key without reporting change.
+// It is used for empty values which are created to be changed right away.
+func (s *storage) insertItem(key string, item *commonStorage.Item) {
+	s.changed(item)
+	// LRU evicts the oldest key if it is full and key is new
+	oldest, _, _ := s.lru.GetOldest()
+	if s.lru.Add(key, item) {
+		s.notify(commonStorage.EventEvicted, oldest.(string))
+		s.record(aofDelete, oldest.(string))
+	}
+	s.index.add(key)
+	s.recordItem(key, item)
+}
+
+// changed sets new version of changed item
+func (s *storage) changed(item *commonStorage.Item) {
+	*s.version++
+	item.Version = *s.version
+}
+
+// changedKey sets new version of item which value was changed in place
+func (s *storage) changedKey(key string) {
+	if raw, exists := s.lru.Peek(key); exists {
+		s.changedValue(key, raw.(*commonStorage.Item))
+	}
+}
+
+// changedValue sets new version of item which value was changed and reports its change.
+// Changes of expiration only are not reported.
+func (s *storage) changedValue(key string, item *commonStorage.Item) {
+	s.changed(item)
+	s.notify(item.ChangeEvent(), key)
 }
 
 func (s *storage) removeItem(key string) {
 	s.lru.Remove(key)
+	s.notify(commonStorage.EventDel, key)
+	s.record(aofDelete, key)
+}
+
+// removeExpiredFields removes expired fields of hash item. Removal is recorded, so replay of AOF doesn't depend on time.
+func (s *storage) removeExpiredFields(key string, item *commonStorage.Item) {
+	fields := item.ExpiredFields()
+	if len(fields) == 0 {
+		return
+	}
+	s.backup(key)
+	hash := item.Value.(commonStorage.Hash)
+	for _, field := range fields {
+		delete(hash, field)
+	}
+	item.PersistFields(fields...)
+	s.record(aofHashDelete, key, fields...)
+}
+
+// SetNotifier sets function which receives keyspace events
+func (s *storage) SetNotifier(notifier commonStorage.Notifier) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.notifier = notifier
+}
+
+// notify reports keyspace event to notifier, events of transaction are reported after commit
+func (s *storage) notify(event, key string) {
+	switch {
+	case s.notifier == nil || event == "":
+	case s.pushed != nil:
+		s.events = append(s.events, keyEvent{event: event, key: key})
+	default:
+		s.notifier(event, key)
+	}
 }
 
 func (s *storage) getHash(key string, createIfNotExist bool) (commonStorage.Hash, error) {
+	_, hash, err := s.getHashItem(key, createIfNotExist)
+	return hash, err
+}
+
+// getHashItem returns hash together with its item, which keeps expiration of hash fields
+func (s *storage) getHashItem(key string, createIfNotExist bool) (*commonStorage.Item, commonStorage.Hash, error) {
 	item, err := s.getItem(key)
 	if err != nil {
 		if !createIfNotExist {
-			return nil, err
+			return nil, nil, err
 		}
 		item = commonStorage.NewItem(make(commonStorage.Hash), 0)
-		s.addItem(key, item)
+		s.insertItem(key, item)
 	}
+	s.removeExpiredFields(key, item)
 	hash, err := item.CastHash()
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-	return hash, nil
+	return item, hash, nil
 }
 
 func (s *storage) getList(key string, createIfNotExist bool) (*list.List, error) {
@@ -95,7 +232,7 @@ func (s *storage) getList(key string, createIfNotExist bool) (*list.List, error)
 			return nil, err
 		}
 		item = commonStorage.NewItem(list.New(), 0)
-		s.addItem(key, item)
+		s.insertItem(key, item)
 	}
 	list, err := item.CastList()
 	if err != nil {
@@ -111,7 +248,7 @@ func (s *storage) Keys() []string {
 
 	keys := make([]string, 0, s.lru.Len())
 	for _, key := range s.lru.Keys() {
-		if item, err := s.getItem(key.(string)); err == nil && item.IsAlive() {
+		if _, err := s.peekItem(key.(string)); err == nil {
 			keys = append(keys, key.(string))
 		}
 	}
@@ -122,7 +259,8 @@ func (s *storage) Keys() []string {
 // Expire sets new key ttl
 func (s *storage) Expire(key string, ttl uint64) error {
 	s.mu.Lock()
-	defer s.mu.Unlock()
+	defer s.unlock()
+	s.backup(key)
 
 	item, err := s.getItem(key)
 	if err != nil {
@@ -130,14 +268,92 @@ func (s *storage) Expire(key string, ttl uint64) error {
 	}
 
 	item.SetTTL(ttl)
+	s.changed(item)
+	s.recordExpire(key, item)
 	return nil
 }
 
-// Get value of specified key. Error will occur if key doesn't exist or key type is not string.
-func (s *storage) Get(key string) (string, error) {
+// ExpireAt sets time when specified key expires. Zero time makes key exist forever.
+// Error will occur if key doesn't exist.
+func (s *storage) ExpireAt(key string, expireTime time.Time) error {
+	s.mu.Lock()
+	defer s.unlock()
+	s.backup(key)
+
+	item, err := s.getItem(key)
+	if err != nil {
+		return err
+	}
+
+	item.SetExpireTime(expireTime)
+	s.changed(item)
+	s.recordExpire(key, item)
+	return nil
+}
+
+// ExpireSliding makes specified key expire after ttl since the last access. Zero ttl makes key exist forever.
+// Error will occur if key doesn't exist.
+func (s *storage) ExpireSliding(key string, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.unlock()
+	s.backup(key)
+
+	item, err := s.getItem(key)
+	if err != nil {
+		return err
+	}
+
+	item.SetSlidingTTL(ttl)
+	s.changed(item)
+	s.recordExpire(key, item)
+	return nil
+}
+
+// Touch extends expiration of specified key if it is sliding. Error will occur if key doesn't exist.
+func (s *storage) Touch(key string) error {
+	s.mu.Lock()
+	defer s.unlock()
+	s.backup(key)
+
+	_, err := s.getItem(key)
+	return err
+}
+
+// Persist removes ttl of specified key, so key exists forever
+func (s *storage) Persist(key string) error {
+	return s.ExpireAt(key, time.Time{})
+}
+
+// Type returns type of specified key value. Error will occur if key doesn't exist.
+func (s *storage) Type(key string) (string, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
+	item, err := s.peekItem(key)
+	if err != nil {
+		return "", err
+	}
+	return item.Type(), nil
+}
+
+// ExpireTime returns time when specified key expires, it is zero if key exists forever.
+// Error will occur if key doesn't exist.
+func (s *storage) ExpireTime(key string) (time.Time, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	item, err := s.peekItem(key)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return item.ExpireTime, nil
+}
+
+// Get value of specified key. Error will occur if key doesn't exist or key type is not string.
+func (s *storage) Get(key string) (string, error) {
+	s.mu.Lock()
+	defer s.unlock()
+
 	item, err := s.getItem(key)
 	if err != nil {
 		return "", err
@@ -145,11 +361,50 @@ func (s *storage) Get(key string) (string, error) {
 	return item.CastString()
 }
 
+// GetWithVersion returns value and version of specified key.
+// Error will occur if key doesn't exist or key type is not string.
+func (s *storage) GetWithVersion(key string) (string, uint64, error) {
+	s.mu.Lock()
+	defer s.unlock()
+
+	item, err := s.getItem(key)
+	if err != nil {
+		return "", 0, err
+	}
+	value, err := item.CastString()
+	return value, item.Version, err
+}
+
+// CompareAndSwap updates value of specified key only if key version wasn't changed.
+// Error will occur if key doesn't exist, key type is not string or version doesn't match.
+func (s *storage) CompareAndSwap(key, value string, version uint64) error {
+	s.mu.Lock()
+	defer s.unlock()
+	s.backup(key)
+
+	item, err := s.getItem(key)
+	if err != nil {
+		return err
+	}
+	if _, err := item.CastString(); err != nil {
+		return err
+	}
+	if item.Version != version {
+		return commonStorage.VersionMismatchError
+	}
+
+	item.Value = value
+	s.changedValue(key, item)
+	s.recordItem(key, item)
+	return nil
+}
+
 // Set value of specified key with ttl. Use zero ttl if key should exist forever.
 // Error will occur if key already exists.
 func (s *storage) Set(key, value string, ttl uint64) error {
 	s.mu.Lock()
-	defer s.mu.Unlock()
+	defer s.unlock()
+	s.backup(key)
 
 	item, _ := s.getItem(key)
 	if item != nil {
@@ -160,24 +415,75 @@ func (s *storage) Set(key, value string, ttl uint64) error {
 	return nil
 }
 
+// SetWithOptions sets value of specified key with ttl according to options.
+// Previous value is returned only if options.Get is set and key existed.
+// Error will occur if key existence doesn't match options.Mode or key type is not string while options.Get is set.
+func (s *storage) SetWithOptions(key, value string, ttl uint64, options commonStorage.SetOptions) (old string, existed bool, err error) {
+	s.mu.Lock()
+	defer s.unlock()
+	s.backup(key)
+
+	current, _ := s.getItem(key)
+	newItem, old, err := commonStorage.PrepareSet(current, value, ttl, options)
+	if err != nil {
+		return "", false, err
+	}
+	s.addItem(key, newItem)
+	return old, current != nil, nil
+}
+
 // Update value of specified key. Error will occur if key doesn't exist or key type is not string.
 func (s *storage) Update(key, value string) error {
 	s.mu.Lock()
-	defer s.mu.Unlock()
+	defer s.unlock()
+	s.backup(key)
 
 	item, err := s.getItem(key)
 	if err != nil {
 		return err
 	}
+	if _, err := item.CastString(); err != nil {
+		return err
+	}
 
 	item.Value = value
+	s.changedValue(key, item)
+	s.recordItem(key, item)
 	return nil
 }
 
+// Increment adds delta to integer value of specified key and returns the new value.
+// Missing key is created with zero value and ttl before increment.
+// Error will occur if key type is not string, value is not an integer or result overflows.
+func (s *storage) Increment(key string, delta int64, ttl uint64) (int64, error) {
+	s.mu.Lock()
+	defer s.unlock()
+	s.backup(key)
+
+	item, err := s.getItem(key)
+	isNew := err != nil
+	if isNew {
+		item = commonStorage.NewItem("0", ttl)
+	}
+
+	value, err := item.Increment(delta)
+	if err != nil {
+		return 0, err
+	}
+	if isNew {
+		s.addItem(key, item)
+	} else {
+		s.changedValue(key, item)
+		s.recordItem(key, item)
+	}
+	return value, nil
+}
+
 // Delete specified key. Error will occur if key doesn't exist. It works for any key type.
 func (s *storage) Delete(key string) error {
 	s.mu.Lock()
-	defer s.mu.Unlock()
+	defer s.unlock()
+	s.backup(key)
 
 	_, err := s.getItem(key)
 	if err != nil {
@@ -187,10 +493,57 @@ func (s *storage) Delete(key string) error {
 	return nil
 }
 
+// GetMulti returns values of specified keys under one lock.
+// Error of every key is returned at the same position, it is nil if value is found.
+func (s *storage) GetMulti(keys []string) ([]string, []error) {
+	s.mu.Lock()
+	defer s.unlock()
+
+	values := make([]string, len(keys))
+	errs := make([]error, len(keys))
+	for i, key := range keys {
+		item, err := s.getItem(key)
+		if err == nil {
+			values[i], err = item.CastString()
+		}
+		errs[i] = err
+	}
+	return values, errs
+}
+
+// SetMulti sets values of specified keys with ttl under one lock. Existing keys of any type are overwritten.
+func (s *storage) SetMulti(keys, values []string, ttl uint64) []error {
+	s.mu.Lock()
+	defer s.unlock()
+
+	for i, key := range keys {
+		s.backup(key)
+		s.addItem(key, commonStorage.NewItem(values[i], ttl))
+	}
+	return make([]error, len(keys))
+}
+
+// DeleteMulti deletes specified keys under one lock.
+// Error of every key is returned at the same position, it is nil if key is deleted.
+func (s *storage) DeleteMulti(keys []string) []error {
+	s.mu.Lock()
+	defer s.unlock()
+
+	errs := make([]error, len(keys))
+	for i, key := range keys {
+		s.backup(key)
+		if _, errs[i] = s.getItem(key); errs[i] == nil {
+			s.removeItem(key)
+		}
+	}
+	return errs
+}
+
 // HashCreate creates new hash with specified key and ttl. Use zero ttl if key should exist forever.
 func (s *storage) HashCreate(key string, ttl uint64) error {
 	s.mu.Lock()
-	defer s.mu.Unlock()
+	defer s.unlock()
+	s.backup(key)
 
 	item, _ := s.getItem(key)
 	if item != nil {
@@ -203,8 +556,8 @@ func (s *storage) HashCreate(key string, ttl uint64) error {
 // HashGet returns value of specified field of key.
 // Error will occur if key or field doesn't exist or key type is not hash.
 func (s *storage) HashGet(key, field string) (string, error) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+	s.mu.Lock()
+	defer s.unlock()
 
 	hash, err := s.getHash(key, false)
 	if err != nil {
@@ -215,31 +568,40 @@ func (s *storage) HashGet(key, field string) (string, error) {
 
 // HashGetAll returns all hash values of specified key. Error will occur if key doesn't exist or key type is not hash.
 func (s *storage) HashGetAll(key string) (map[string]string, error) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+	s.mu.Lock()
+	defer s.unlock()
 
-	return s.getHash(key, false)
+	hash, err := s.getHash(key, false)
+	if err != nil {
+		return nil, err
+	}
+	return hash.Copy(), nil
 }
 
 // HashSet sets field value of specified key. Error will occur if key doesn't exist or key type is not hash.
 func (s *storage) HashSet(key, field, value string) error {
 	s.mu.Lock()
-	defer s.mu.Unlock()
+	defer s.unlock()
+	s.backup(key)
 
-	hash, err := s.getHash(key, true)
+	item, hash, err := s.getHashItem(key, true)
 	if err != nil {
 		return err
 	}
 	hash[field] = value
+	item.PersistFields(field)
+	s.changedKey(key)
+	s.record(aofHashSet, key, field, value)
 	return nil
 }
 
 // HashDelete deletes field from hash. Error will occur if key doesn't exist or key type is not hash.
 func (s *storage) HashDelete(key, field string) error {
 	s.mu.Lock()
-	defer s.mu.Unlock()
+	defer s.unlock()
+	s.backup(key)
 
-	hash, err := s.getHash(key, false)
+	item, hash, err := s.getHashItem(key, false)
 	if err != nil {
 		return err
 	}
@@ -248,13 +610,16 @@ func (s *storage) HashDelete(key, field string) error {
 		return err
 	}
 	delete(hash, field)
+	item.PersistFields(field)
+	s.changedKey(key)
+	s.record(aofHashDelete, key, field)
 	return nil
 }
 
 // HashLen returns count of hash fields. Error will occur if key doesn't exist or key type is not hash.
 func (s *storage) HashLen(key string) (int, error) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+	s.mu.Lock()
+	defer s.unlock()
 
 	hash, err := s.getHash(key, false)
 	if err != nil {
@@ -265,8 +630,8 @@ func (s *storage) HashLen(key string) (int, error) {
 
 // HashKeys returns list of all hash fields. Error will occur if key doesn't exist or key type is not hash.
 func (s *storage) HashKeys(key string) ([]string, error) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+	s.mu.Lock()
+	defer s.unlock()
 
 	hash, err := s.getHash(key, false)
 	if err != nil {
@@ -281,10 +646,155 @@ func (s *storage) HashKeys(key string) ([]string, error) {
 	return keys, nil
 }
 
+// HashGetMulti returns values of specified fields of key under one lock.
+// Error of every field is returned at the same position, it is nil if value is found.
+func (s *storage) HashGetMulti(key string, fields []string) ([]string, []error) {
+	s.mu.Lock()
+	defer s.unlock()
+
+	hash, err := s.getHash(key, false)
+	if err != nil {
+		errs := make([]error, len(fields))
+		for i := range errs {
+			errs[i] = err
+		}
+		return make([]string, len(fields)), errs
+	}
+	return hash.GetValues(fields)
+}
+
+// HashSetMulti sets values of specified fields of key and returns number of new fields.
+// Hash is created if key doesn't exist. Error will occur if key type is not hash.
+func (s *storage) HashSetMulti(key string, fields, values []string) (int, error) {
+	s.mu.Lock()
+	defer s.unlock()
+	s.backup(key)
+
+	item, hash, err := s.getHashItem(key, true)
+	if err != nil {
+		return 0, err
+	}
+	added := hash.SetValues(fields, values)
+	item.PersistFields(fields...)
+	s.changedKey(key)
+	args := make([]string, 0, 2*len(fields))
+	for i, field := range fields {
+		args = append(args, field, values[i])
+	}
+	s.record(aofHashSet, key, args...)
+	return added, nil
+}
+
+// HashIncrementBy adds delta to integer value of field and returns the new value.
+// Missing key and field are created with zero value before increment.
+// Error will occur if key type is not hash, value is not an integer or result overflows.
+func (s *storage) HashIncrementBy(key, field string, delta int64) (int64, error) {
+	s.mu.Lock()
+	defer s.unlock()
+	s.backup(key)
+
+	hash, err := s.getHash(key, true)
+	if err != nil {
+		return 0, err
+	}
+	value, err := hash.Increment(field, delta)
+	if err != nil {
+		return 0, err
+	}
+	s.changedKey(key)
+	s.record(aofHashIncrement, key, field, strconv.FormatInt(delta, 10))
+	return value, nil
+}
+
+// HashSetIfNotExists sets field value only if field doesn't exist and reports whether it was set.
+// Hash is created if key doesn't exist. Error will occur if key type is not hash.
+func (s *storage) HashSetIfNotExists(key, field, value string) (bool, error) {
+	s.mu.Lock()
+	defer s.unlock()
+	s.backup(key)
+
+	hash, err := s.getHash(key, true)
+	if err != nil {
+		return false, err
+	}
+	if _, found := hash[field]; found {
+		return false, nil
+	}
+	hash[field] = value
+	s.changedKey(key)
+	s.record(aofHashSet, key, field, value)
+	return true, nil
+}
+
+// HashExists reports whether field exists in hash. Error will occur if key doesn't exist or key type is not hash.
+func (s *storage) HashExists(key, field string) (bool, error) {
+	s.mu.Lock()
+	defer s.unlock()
+
+	hash, err := s.getHash(key, false)
+	if err != nil {
+		return false, err
+	}
+	_, found := hash[field]
+	return found, nil
+}
+
+// HashScan returns fields of hash starting from cursor until options.Limit() fields are examined, see Hash.Scan.
+// Error will occur if key doesn't exist, key type is not hash or cursor is not valid.
+func (s *storage) HashScan(key, cursor string, options commonStorage.ScanOptions) (string, map[string]string, error) {
+	s.mu.Lock()
+	defer s.unlock()
+
+	hash, err := s.getHash(key, false)
+	if err != nil {
+		return "", nil, err
+	}
+	return hash.Scan(cursor, options)
+}
+
+// HashExpireAt sets time when hash field expires. Zero time makes field exist forever.
+// Error will occur if key or field doesn't exist or key type is not hash.
+func (s *storage) HashExpireAt(key, field string, expireTime time.Time) error {
+	s.mu.Lock()
+	defer s.unlock()
+	s.backup(key)
+
+	item, _, err := s.getHashItem(key, false)
+	if err != nil {
+		return err
+	}
+	if err := item.SetFieldExpireTime(field, expireTime); err != nil {
+		return err
+	}
+	s.changed(item)
+	s.record(aofHashExpire, key, field, formatTime(expireTime))
+	return nil
+}
+
+// HashPersist removes expiration of hash field.
+// Error will occur if key or field doesn't exist or key type is not hash.
+func (s *storage) HashPersist(key, field string) error {
+	return s.HashExpireAt(key, field, time.Time{})
+}
+
+// HashExpireTime returns time when hash field expires, it is zero if field exists forever.
+// Error will occur if key or field doesn't exist or key type is not hash.
+func (s *storage) HashExpireTime(key, field string) (time.Time, error) {
+	s.mu.Lock()
+	defer s.unlock()
+
+	item, _, err := s.getHashItem(key, false)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return item.FieldExpireTime(field)
+}
+
 // ListCreate creates new list with specified key and ttl. Use zero ttl if key should exist forever.
 func (s *storage) ListCreate(key string, ttl uint64) error {
 	s.mu.Lock()
-	defer s.mu.Unlock()
+	defer s.unlock()
+	s.backup(key)
 
 	item, _ := s.getItem(key)
 	if item != nil {
@@ -298,7 +808,8 @@ func (s *storage) ListCreate(key string, ttl uint64) error {
 // Error will occur if key doesn't exist, key type is not list or list is empty.
 func (s *storage) ListLeftPop(key string) (string, error) {
 	s.mu.Lock()
-	defer s.mu.Unlock()
+	defer s.unlock()
+	s.backup(key)
 
 	list, err := s.getList(key, false)
 	if err != nil {
@@ -307,6 +818,8 @@ func (s *storage) ListLeftPop(key string) (string, error) {
 
 	if e := list.Front(); e != nil {
 		list.Remove(e)
+		s.changedKey(key)
+		s.recordPop(key, true)
 		return e.Value.(string), nil
 	}
 	return "", commonStorage.ListEmptyError
@@ -316,7 +829,8 @@ func (s *storage) ListLeftPop(key string) (string, error) {
 // Error will occur if key doesn't exist, key type is not list or list is empty.
 func (s *storage) ListRightPop(key string) (string, error) {
 	s.mu.Lock()
-	defer s.mu.Unlock()
+	defer s.unlock()
+	s.backup(key)
 
 	list, err := s.getList(key, false)
 	if err != nil {
@@ -325,6 +839,8 @@ func (s *storage) ListRightPop(key string) (string, error) {
 
 	if e := list.Back(); e != nil {
 		list.Remove(e)
+		s.changedKey(key)
+		s.recordPop(key, false)
 		return e.Value.(string), nil
 	}
 	return "", commonStorage.ListEmptyError
@@ -333,7 +849,8 @@ func (s *storage) ListRightPop(key string) (string, error) {
 // ListLeftPush adds value to the list beginning. Error will occur if key doesn't exist or key type is not list.
 func (s *storage) ListLeftPush(key, value string) error {
 	s.mu.Lock()
-	defer s.mu.Unlock()
+	defer s.unlock()
+	s.backup(key)
 
 	list, err := s.getList(key, true)
 	if err != nil {
@@ -341,13 +858,17 @@ func (s *storage) ListLeftPush(key, value string) error {
 	}
 
 	list.PushFront(value)
+	s.changedKey(key)
+	s.recordPush(key, value, true)
+	s.pushedKey(key)
 	return nil
 }
 
 // ListRightPush adds value to the list ending. Error will occur if key doesn't exist or key type is not list.
 func (s *storage) ListRightPush(key, value string) error {
 	s.mu.Lock()
-	defer s.mu.Unlock()
+	defer s.unlock()
+	s.backup(key)
 
 	list, err := s.getList(key, true)
 	if err != nil {
@@ -355,13 +876,16 @@ func (s *storage) ListRightPush(key, value string) error {
 	}
 
 	list.PushBack(value)
+	s.changedKey(key)
+	s.recordPush(key, value, false)
+	s.pushedKey(key)
 	return nil
 }
 
 // ListLen returns count of elements in the list. Error will occur if key doesn't exist or key type is not list.
 func (s *storage) ListLen(key string) (int, error) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+	s.mu.Lock()
+	defer s.unlock()
 
 	list, err := s.getList(key, false)
 	if err != nil {
@@ -371,30 +895,197 @@ func (s *storage) ListLen(key string) (int, error) {
 	return list.Len(), nil
 }
 
-// ListRange returns list of elements from the list from start to stop index.
-// Error will occur if key doesn't exist or key type is not list.
+// ListRange returns list of elements from the list from start to stop index inclusive.
+// Negative indexes are counted from the list ending. Error will occur if key doesn't exist or key type is not list.
 func (s *storage) ListRange(key string, start, stop int) ([]string, error) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+	s.mu.Lock()
+	defer s.unlock()
 
 	list, err := s.getList(key, false)
 	if err != nil {
 		return nil, err
 	}
 
-	var values []string
-	e := list.Front()
-	i := 0
-	for {
-		if e == nil || i > stop {
-			break
+	start, stop, ok := commonStorage.ListRangeBounds(list.Len(), start, stop)
+	if !ok {
+		return nil, nil
+	}
+	values := make([]string, 0, stop-start+1)
+	for e := listElement(list, start); len(values) <= stop-start; e = e.Next() {
+		values = append(values, e.Value.(string))
+	}
+
+	return values, nil
+}
+
+// ListIndex returns element of the list by index, negative index is counted from the list ending.
+// Error will occur if key doesn't exist, key type is not list or index is out of range.
+func (s *storage) ListIndex(key string, index int) (string, error) {
+	s.mu.Lock()
+	defer s.unlock()
+
+	list, err := s.getList(key, false)
+	if err != nil {
+		return "", err
+	}
+
+	position, ok := commonStorage.ListIndexPosition(list.Len(), index)
+	if !ok {
+		return "", commonStorage.IndexOutOfRangeError
+	}
+	return listElement(list, position).Value.(string), nil
+}
+
+// ListSet replaces element of the list by index, negative index is counted from the list ending.
+// Error will occur if key doesn't exist, key type is not list or index is out of range.
+func (s *storage) ListSet(key string, index int, value string) error {
+	s.mu.Lock()
+	defer s.unlock()
+	s.backup(key)
+
+	list, err := s.getList(key, false)
+	if err != nil {
+		return err
+	}
+
+	position, ok := commonStorage.ListIndexPosition(list.Len(), index)
+	if !ok {
+		return commonStorage.IndexOutOfRangeError
+	}
+	listElement(list, position).Value = value
+	s.changedKey(key)
+	s.record(aofListSet, key, strconv.Itoa(position), value)
+	return nil
+}
+
+// ListInsert inserts value before or after the first element equal to pivot and returns new length of the list.
+// Error will occur if key doesn't exist, key type is not list or pivot doesn't exist.
+func (s *storage) ListInsert(key, pivot, value string, before bool) (int, error) {
+	s.mu.Lock()
+	defer s.unlock()
+	s.backup(key)
+
+	list, err := s.getList(key, false)
+	if err != nil {
+		return 0, err
+	}
+
+	if !insertListValue(list, pivot, value, before) {
+		return 0, commonStorage.PivotNotExistError
+	}
+	s.changedKey(key)
+	s.record(aofListInsert, key, pivot, value, strconv.FormatBool(before))
+	return list.Len(), nil
+}
+
+// ListRemove removes elements equal to value and returns number of removed elements.
+// Positive count removes up to count elements from the list beginning, negative count removes them
+// from the list ending and zero count removes all of them. Error will occur if key doesn't exist or key type is not list.
+func (s *storage) ListRemove(key string, count int, value string) (int, error) {
+	s.mu.Lock()
+	defer s.unlock()
+	s.backup(key)
+
+	list, err := s.getList(key, false)
+	if err != nil {
+		return 0, err
+	}
+
+	removed := removeListValues(list, count, value)
+	if removed > 0 {
+		s.changedKey(key)
+		s.record(aofListRemove, key, strconv.Itoa(count), value)
+	}
+	return removed, nil
+}
+
+// ListTrim removes all elements of the list which are out of range from start to stop index inclusive,
+// negative indexes are counted from the list ending. Error will occur if key doesn't exist or key type is not list.
+func (s *storage) ListTrim(key string, start, stop int) error {
+	s.mu.Lock()
+	defer s.unlock()
+	s.backup(key)
+
+	list, err := s.getList(key, false)
+	if err != nil {
+		return err
+	}
+
+	trimList(list, start, stop)
+	s.changedKey(key)
+	s.record(aofListTrim, key, strconv.Itoa(start), strconv.Itoa(stop))
+	return nil
+}
+
+// insertListValue inserts value before or after the first element equal to pivot and reports whether pivot is found
+func insertListValue(values *list.List, pivot, value string, before bool) bool {
+	for e := values.Front(); e != nil; e = e.Next() {
+		if e.Value.(string) != pivot {
+			continue
 		}
-		if i >= start {
-			values = append(values, e.Value.(string))
+		if before {
+			values.InsertBefore(value, e)
+		} else {
+			values.InsertAfter(value, e)
 		}
-		e = e.Next()
-		i++
+		return true
 	}
+	return false
+}
 
-	return values, nil
+// removeListValues removes elements equal to value like ListRemove and returns number of removed elements
+func removeListValues(values *list.List, count int, value string) int {
+	fromEnd := count < 0
+	if fromEnd {
+		count = -count
+	}
+	removed := 0
+	e := values.Front()
+	if fromEnd {
+		e = values.Back()
+	}
+	for e != nil && (count == 0 || removed < count) {
+		current := e
+		if fromEnd {
+			e = e.Prev()
+		} else {
+			e = e.Next()
+		}
+		if current.Value.(string) == value {
+			values.Remove(current)
+			removed++
+		}
+	}
+	return removed
+}
+
+// trimList removes elements which are out of range from start to stop index inclusive like ListTrim
+func trimList(values *list.List, start, stop int) {
+	start, stop, ok := commonStorage.ListRangeBounds(values.Len(), start, stop)
+	if !ok {
+		values.Init()
+		return
+	}
+	for i := values.Len() - 1; i > stop; i-- {
+		values.Remove(values.Back())
+	}
+	for i := 0; i < start; i++ {
+		values.Remove(values.Front())
+	}
+}
+
+// listElement returns element of the list by position, list is walked from the nearest end
+func listElement(values *list.List, position int) *list.Element {
+	if position < values.Len()/2 {
+		e := values.Front()
+		for i := 0; i < position; i++ {
+			e = e.Next()
+		}
+		return e
+	}
+	e := values.Back()
+	for i := values.Len() - 1; i > position; i-- {
+		e = e.Prev()
+	}
+	return e
 }
@@ -1,9 +1,13 @@
 package memory
 
 import (
+	"errors"
+	"fmt"
+	"sort"
 	"testing"
 	"time"
 
+	commonStorage "github.com/Barberrrry/jcache/server/storage"
 	. "gopkg.in/check.v1"
 )
 
@@ -44,6 +48,81 @@ func (s *StorageTestSuite) TestKeys(c *C) {
 	c.Assert(storage.Keys(), DeepEquals, []string{"key1", "key2"})
 }
 
+func (s *StorageTestSuite) TestScan(c *C) {
+	storage, _ := NewStorage(1000, time.Minute)
+	for i := 0; i < 500; i++ {
+		storage.Set(fmt.Sprintf("key%d", i), "value", 0)
+	}
+	storage.HashCreate("hash", 0)
+	storage.Set("expired", "value", 1)
+	storage.Delete("key0")
+	time.Sleep(time.Second)
+
+	scan := func(options commonStorage.ScanOptions) []string {
+		var keys []string
+		cursor := commonStorage.ScanStart
+		for pages := 0; ; pages++ {
+			c.Assert(pages < 1000, Equals, true)
+			next, page, err := storage.Scan(cursor, options)
+			c.Assert(err, IsNil)
+			keys = append(keys, page...)
+			if next == commonStorage.ScanStart {
+				break
+			}
+			cursor = next
+		}
+		sort.Strings(keys)
+		return keys
+	}
+
+	keys := scan(commonStorage.ScanOptions{})
+	c.Assert(keys, HasLen, 500)
+	c.Assert(keys, DeepEquals, storage.Keys())
+
+	c.Assert(scan(commonStorage.ScanOptions{Pattern: "key1?", Count: 100}), DeepEquals, []string{"key10", "key11", "key12", "key13", "key14", "key15", "key16", "key17", "key18", "key19"})
+	c.Assert(scan(commonStorage.ScanOptions{Type: commonStorage.TypeHash}), DeepEquals, []string{"hash"})
+
+	// Page size is bounded by count
+	_, page, _ := storage.Scan(commonStorage.ScanStart, commonStorage.ScanOptions{Count: 5})
+	c.Assert(len(page) < 50, Equals, true)
+
+	_, _, err := storage.Scan("abc", commonStorage.ScanOptions{})
+	c.Assert(err, ErrorMatches, "Cursor is not valid")
+}
+
+func (s *StorageTestSuite) TestScanIndex(c *C) {
+	storage, _ := NewStorage(2, time.Minute)
+	storage.Set("key1", "value", 0)
+	storage.Set("key2", "value", 0)
+
+	// Evicted key is removed from index, key created in rolled back transaction too
+	storage.Set("key3", "value", 0)
+	storage.Transaction(func(tx commonStorage.Storage) error {
+		tx.Delete("key2")
+		tx.Set("key4", "value", 0)
+		return errors.New("rollback")
+	})
+
+	var keys []string
+	cursor := commonStorage.ScanStart
+	for {
+		next, page, err := storage.Scan(cursor, commonStorage.ScanOptions{Count: 100})
+		c.Assert(err, IsNil)
+		keys = append(keys, page...)
+		if next == commonStorage.ScanStart {
+			break
+		}
+		cursor = next
+	}
+	sort.Strings(keys)
+	c.Assert(keys, DeepEquals, []string{"key2", "key3"})
+	for _, shard := range storage.index {
+		for key := range shard {
+			c.Assert(key == "key2" || key == "key3", Equals, true, Commentf("key %s", key))
+		}
+	}
+}
+
 func (s *StorageTestSuite) TestSetAndGet(c *C) {
 	storage, _ := NewStorage(100, time.Minute)
 
@@ -70,6 +149,42 @@ func (s *StorageTestSuite) TestSetAndGet(c *C) {
 	c.Assert(err5, ErrorMatches, "Key already exists")
 }
 
+func (s *StorageTestSuite) TestSetWithOptions(c *C) {
+	storage, _ := NewStorage(100, time.Minute)
+
+	_, _, err := storage.SetWithOptions("key", "value", 0, commonStorage.SetOptions{Mode: commonStorage.SetIfExists})
+	c.Assert(err, ErrorMatches, "Key does not exist")
+
+	old, existed, err := storage.SetWithOptions("key", "value", 1, commonStorage.SetOptions{Mode: commonStorage.SetAlways, Get: true})
+	c.Assert(err, IsNil)
+	c.Assert(existed, Equals, false)
+	c.Assert(old, Equals, "")
+
+	_, _, err = storage.SetWithOptions("key", "value", 0, commonStorage.SetOptions{})
+	c.Assert(err, ErrorMatches, "Key already exists")
+
+	// Keep ttl of existing key, so it expires despite zero ttl
+	old, existed, err = storage.SetWithOptions("key", "value2", 0, commonStorage.SetOptions{Mode: commonStorage.SetIfExists, KeepTTL: true, Get: true})
+	c.Assert(err, IsNil)
+	c.Assert(existed, Equals, true)
+	c.Assert(old, Equals, "value")
+	value, _ := storage.Get("key")
+	c.Assert(value, Equals, "value2")
+	time.Sleep(time.Second)
+	_, err = storage.Get("key")
+	c.Assert(err, ErrorMatches, "Key does not exist")
+
+	// Any key type is overwritten, but previous value may be returned only for string
+	storage.HashCreate("hash", 0)
+	_, _, err = storage.SetWithOptions("hash", "value", 0, commonStorage.SetOptions{Mode: commonStorage.SetAlways, Get: true})
+	c.Assert(err, ErrorMatches, "Key type is not string")
+	_, existed, err = storage.SetWithOptions("hash", "value", 0, commonStorage.SetOptions{Mode: commonStorage.SetAlways})
+	c.Assert(err, IsNil)
+	c.Assert(existed, Equals, true)
+	value, _ = storage.Get("hash")
+	c.Assert(value, Equals, "value")
+}
+
 func (s *StorageTestSuite) TestUpdate(c *C) {
 	storage, _ := NewStorage(100, time.Minute)
 
@@ -111,6 +226,28 @@ func (s *StorageTestSuite) TestDelete(c *C) {
 	c.Assert(err4, NotNil)
 }
 
+func (s *StorageTestSuite) TestMulti(c *C) {
+	storage, _ := NewStorage(100, time.Minute)
+	storage.HashCreate("hash", 0)
+
+	errs := storage.SetMulti([]string{"key1", "key2"}, []string{"value1", "value2"}, 0)
+	c.Assert(errs, DeepEquals, []error{nil, nil})
+
+	values, errs := storage.GetMulti([]string{"key1", "unknown", "hash", "key2"})
+	c.Assert(values, DeepEquals, []string{"value1", "", "", "value2"})
+	c.Assert(errs, DeepEquals, []error{nil, commonStorage.KeyNotExistsError, commonStorage.KeyStringTypeError, nil})
+
+	// Existing key of any type is overwritten
+	errs = storage.SetMulti([]string{"key1", "hash"}, []string{"new value", "value"}, 0)
+	c.Assert(errs, DeepEquals, []error{nil, nil})
+	value, _ := storage.Get("hash")
+	c.Assert(value, Equals, "value")
+
+	errs = storage.DeleteMulti([]string{"key1", "unknown", "hash"})
+	c.Assert(errs, DeepEquals, []error{nil, commonStorage.KeyNotExistsError, nil})
+	c.Assert(storage.Keys(), DeepEquals, []string{"key2"})
+}
+
 func (s *StorageTestSuite) TestHashCreate(c *C) {
 	storage, _ := NewStorage(100, time.Minute)
 
@@ -172,6 +309,14 @@ func (s *StorageTestSuite) TestHashGetAll(c *C) {
 
 	_, err2 := storage.HashGetAll("key2")
 	c.Assert(err2, ErrorMatches, "Key does not exist")
+
+	// Returned hash is not changed by following changes of transaction
+	storage.Transaction(func(tx commonStorage.Storage) error {
+		hash, _ = tx.HashGetAll("key")
+		tx.HashSet("key", "field2", "value2")
+		return nil
+	})
+	c.Assert(hash, DeepEquals, map[string]string{"field": "value"})
 }
 
 func (s *StorageTestSuite) TestHashDelete(c *C) {
@@ -232,6 +377,125 @@ func (s *StorageTestSuite) TestHashLenAndKeys(c *C) {
 	c.Assert(err6, ErrorMatches, "Key type is not hash")
 }
 
+func (s *StorageTestSuite) TestHashSetAndGetMulti(c *C) {
+	storage, _ := NewStorage(100, time.Minute)
+
+	// Set fields of non-existing hash, repeated field gets the last value
+	added, err := storage.HashSetMulti("key", []string{"name", "age", "name"}, []string{"bob", "30", "alice"})
+	c.Assert(err, IsNil)
+	c.Assert(added, Equals, 2)
+	added, err = storage.HashSetMulti("key", []string{"age", "city"}, []string{"31", "paris"})
+	c.Assert(err, IsNil)
+	c.Assert(added, Equals, 1)
+
+	values, errs := storage.HashGetMulti("key", []string{"name", "unknown", "age"})
+	c.Assert(values, DeepEquals, []string{"alice", "", "31"})
+	c.Assert(errs, DeepEquals, []error{nil, commonStorage.FieldNotExistError, nil})
+
+	// Every field gets key error
+	_, errs = storage.HashGetMulti("key2", []string{"name", "age"})
+	c.Assert(errs, DeepEquals, []error{commonStorage.KeyNotExistsError, commonStorage.KeyNotExistsError})
+	storage.Set("string", "value", 0)
+	_, errs = storage.HashGetMulti("string", []string{"name"})
+	c.Assert(errs, DeepEquals, []error{commonStorage.KeyHashTypeError})
+	_, err = storage.HashSetMulti("string", []string{"name"}, []string{"bob"})
+	c.Assert(err, Equals, commonStorage.KeyHashTypeError)
+}
+
+func (s *StorageTestSuite) TestHashIncrementBy(c *C) {
+	storage, _ := NewStorage(100, time.Minute)
+
+	// Missing key and field are incremented from zero
+	value, err := storage.HashIncrementBy("key", "visits", 5)
+	c.Assert(err, IsNil)
+	c.Assert(value, Equals, int64(5))
+	value, err = storage.HashIncrementBy("key", "visits", -7)
+	c.Assert(err, IsNil)
+	c.Assert(value, Equals, int64(-2))
+	field, _ := storage.HashGet("key", "visits")
+	c.Assert(field, Equals, "-2")
+
+	storage.HashSet("key", "name", "bob")
+	_, err = storage.HashIncrementBy("key", "name", 1)
+	c.Assert(err, Equals, commonStorage.NotIntegerError)
+	field, _ = storage.HashGet("key", "name")
+	c.Assert(field, Equals, "bob")
+
+	storage.HashSet("key", "max", "9223372036854775807")
+	_, err = storage.HashIncrementBy("key", "max", 1)
+	c.Assert(err, Equals, commonStorage.OverflowError)
+
+	storage.Set("string", "1", 0)
+	_, err = storage.HashIncrementBy("string", "visits", 1)
+	c.Assert(err, Equals, commonStorage.KeyHashTypeError)
+}
+
+func (s *StorageTestSuite) TestHashSetIfNotExistsAndExists(c *C) {
+	storage, _ := NewStorage(100, time.Minute)
+
+	_, err := storage.HashExists("key", "field")
+	c.Assert(err, Equals, commonStorage.KeyNotExistsError)
+
+	set, err := storage.HashSetIfNotExists("key", "field", "value1")
+	c.Assert(err, IsNil)
+	c.Assert(set, Equals, true)
+	set, err = storage.HashSetIfNotExists("key", "field", "value2")
+	c.Assert(err, IsNil)
+	c.Assert(set, Equals, false)
+	value, _ := storage.HashGet("key", "field")
+	c.Assert(value, Equals, "value1")
+
+	found, err := storage.HashExists("key", "field")
+	c.Assert(err, IsNil)
+	c.Assert(found, Equals, true)
+	found, err = storage.HashExists("key", "unknown")
+	c.Assert(err, IsNil)
+	c.Assert(found, Equals, false)
+
+	storage.Set("string", "value", 0)
+	_, err = storage.HashSetIfNotExists("string", "field", "value")
+	c.Assert(err, Equals, commonStorage.KeyHashTypeError)
+	_, err = storage.HashExists("string", "field")
+	c.Assert(err, Equals, commonStorage.KeyHashTypeError)
+}
+
+func (s *StorageTestSuite) TestHashScan(c *C) {
+	storage, _ := NewStorage(100, time.Minute)
+
+	for i := 0; i < 25; i++ {
+		storage.HashSet("key", fmt.Sprintf("field%02d", i), fmt.Sprint(i))
+	}
+
+	// Field added during iteration may be returned, fields removed during iteration are not returned
+	fields := map[string]string{}
+	cursor := commonStorage.ScanStart
+	for pages := 0; pages == 0 || cursor != commonStorage.ScanStart; pages++ {
+		c.Assert(pages < 3, Equals, true)
+		next, page, err := storage.HashScan("key", cursor, commonStorage.ScanOptions{Count: 10})
+		c.Assert(err, IsNil)
+		for field, value := range page {
+			fields[field] = value
+		}
+		cursor = next
+		if pages == 0 {
+			storage.HashDelete("key", "field24")
+			storage.HashSet("key", "field99", "99")
+		}
+	}
+	c.Assert(fields, HasLen, 25)
+	c.Assert(fields["field00"], Equals, "0")
+	c.Assert(fields["field99"], Equals, "99")
+
+	_, page, err := storage.HashScan("key", commonStorage.ScanStart, commonStorage.ScanOptions{Pattern: "field1*", Count: 100})
+	c.Assert(err, IsNil)
+	c.Assert(page, HasLen, 10)
+
+	_, _, err = storage.HashScan("key", "xyz", commonStorage.ScanOptions{})
+	c.Assert(err, Equals, commonStorage.InvalidCursorError)
+	_, _, err = storage.HashScan("key2", commonStorage.ScanStart, commonStorage.ScanOptions{})
+	c.Assert(err, Equals, commonStorage.KeyNotExistsError)
+}
+
 func (s *StorageTestSuite) TestListCreate(c *C) {
 	storage, _ := NewStorage(100, time.Minute)
 
@@ -346,8 +610,13 @@ func (s *StorageTestSuite) TestListRange(c *C) {
 	c.Assert(err2, IsNil)
 	c.Assert(values2, DeepEquals, []string{"1", "2"})
 
-	values3, err3 := storage.ListRange("key", -1, 1)
+	// Negative indexes are counted from the list ending
+	values3, err3 := storage.ListRange("key", -2, -1)
 	c.Assert(err3, IsNil)
+	c.Assert(values3, DeepEquals, []string{"3", "4"})
+	values3, _ = storage.ListRange("key", -1, 1)
+	c.Assert(values3, HasLen, 0)
+	values3, _ = storage.ListRange("key", -100, 1)
 	c.Assert(values3, DeepEquals, []string{"0", "1"})
 
 	values4, err4 := storage.ListRange("key", 3, 100)
@@ -363,6 +632,706 @@ func (s *StorageTestSuite) TestListRange(c *C) {
 	c.Assert(err, ErrorMatches, "Key does not exist")
 }
 
+func (s *StorageTestSuite) TestListIndexAndSet(c *C) {
+	storage, _ := NewStorage(100, time.Minute)
+	for _, value := range []string{"a", "b", "c", "d", "e"} {
+		storage.ListRightPush("key", value)
+	}
+
+	value, err := storage.ListIndex("key", 1)
+	c.Assert(err, IsNil)
+	c.Assert(value, Equals, "b")
+	value, _ = storage.ListIndex("key", -2)
+	c.Assert(value, Equals, "d")
+	_, err = storage.ListIndex("key", 5)
+	c.Assert(err, Equals, commonStorage.IndexOutOfRangeError)
+	_, err = storage.ListIndex("key", -6)
+	c.Assert(err, Equals, commonStorage.IndexOutOfRangeError)
+
+	c.Assert(storage.ListSet("key", 0, "A"), IsNil)
+	c.Assert(storage.ListSet("key", -1, "E"), IsNil)
+	c.Assert(storage.ListSet("key", 5, "F"), Equals, commonStorage.IndexOutOfRangeError)
+	values, _ := storage.ListRange("key", 0, -1)
+	c.Assert(values, DeepEquals, []string{"A", "b", "c", "d", "E"})
+
+	storage.Set("string", "value", 0)
+	_, err = storage.ListIndex("string", 0)
+	c.Assert(err, Equals, commonStorage.KeyListTypeError)
+	c.Assert(storage.ListSet("missing", 0, "value"), Equals, commonStorage.KeyNotExistsError)
+}
+
+func (s *StorageTestSuite) TestListInsertAndRemove(c *C) {
+	storage, _ := NewStorage(100, time.Minute)
+	for _, value := range []string{"a", "x", "b", "x", "c", "x"} {
+		storage.ListRightPush("key", value)
+	}
+
+	length, err := storage.ListInsert("key", "b", "before", true)
+	c.Assert(err, IsNil)
+	c.Assert(length, Equals, 7)
+	length, _ = storage.ListInsert("key", "c", "after", false)
+	c.Assert(length, Equals, 8)
+	_, err = storage.ListInsert("key", "missing", "value", true)
+	c.Assert(err, Equals, commonStorage.PivotNotExistError)
+	values, _ := storage.ListRange("key", 0, -1)
+	c.Assert(values, DeepEquals, []string{"a", "x", "before", "b", "x", "c", "after", "x"})
+
+	removed, err := storage.ListRemove("key", -2, "x")
+	c.Assert(err, IsNil)
+	c.Assert(removed, Equals, 2)
+	values, _ = storage.ListRange("key", 0, -1)
+	c.Assert(values, DeepEquals, []string{"a", "x", "before", "b", "c", "after"})
+
+	storage.ListRightPush("key", "a")
+	removed, _ = storage.ListRemove("key", 1, "a")
+	c.Assert(removed, Equals, 1)
+	removed, _ = storage.ListRemove("key", 0, "x")
+	c.Assert(removed, Equals, 1)
+	removed, _ = storage.ListRemove("key", 0, "missing")
+	c.Assert(removed, Equals, 0)
+	values, _ = storage.ListRange("key", 0, -1)
+	c.Assert(values, DeepEquals, []string{"before", "b", "c", "after", "a"})
+
+	_, err = storage.ListRemove("missing", 0, "x")
+	c.Assert(err, Equals, commonStorage.KeyNotExistsError)
+}
+
+func (s *StorageTestSuite) TestListTrim(c *C) {
+	storage, _ := NewStorage(100, time.Minute)
+
+	// Capped log keeps only the last three values
+	for i := 0; i < 5; i++ {
+		storage.ListRightPush("log", fmt.Sprint(i))
+		c.Assert(storage.ListTrim("log", -3, -1), IsNil)
+	}
+	values, _ := storage.ListRange("log", 0, -1)
+	c.Assert(values, DeepEquals, []string{"2", "3", "4"})
+
+	c.Assert(storage.ListTrim("log", 1, 100), IsNil)
+	values, _ = storage.ListRange("log", 0, -1)
+	c.Assert(values, DeepEquals, []string{"3", "4"})
+
+	c.Assert(storage.ListTrim("log", 2, 1), IsNil)
+	length, err := storage.ListLen("log")
+	c.Assert(err, IsNil)
+	c.Assert(length, Equals, 0)
+
+	c.Assert(storage.ListTrim("missing", 0, 1), Equals, commonStorage.KeyNotExistsError)
+}
+
+func (s *StorageTestSuite) TestListTrimTransactionRollback(c *C) {
+	storage, _ := NewStorage(100, time.Minute)
+	storage.ListRightPush("log", "a")
+	storage.ListRightPush("log", "b")
+
+	err := storage.Transaction(func(tx commonStorage.Storage) error {
+		tx.ListTrim("log", -1, -1)
+		tx.ListSet("log", 0, "c")
+		return tx.ListSet("log", 1, "d")
+	})
+	c.Assert(err, Equals, commonStorage.IndexOutOfRangeError)
+	values, _ := storage.ListRange("log", 0, -1)
+	c.Assert(values, DeepEquals, []string{"a", "b"})
+}
+
+func (s *StorageTestSuite) TestSet(c *C) {
+	storage, _ := NewStorage(100, time.Minute)
+
+	added, err := storage.SetAdd("key", []string{"b", "a", "b"})
+	c.Assert(err, IsNil)
+	c.Assert(added, Equals, 2)
+	added, _ = storage.SetAdd("key", []string{"a", "c"})
+	c.Assert(added, Equals, 1)
+
+	members, err := storage.SetMembers("key")
+	c.Assert(err, IsNil)
+	c.Assert(members, DeepEquals, []string{"a", "b", "c"})
+
+	found, err := storage.SetIsMember("key", "a")
+	c.Assert(err, IsNil)
+	c.Assert(found, Equals, true)
+
+	removed, err := storage.SetRemove("key", []string{"a", "d"})
+	c.Assert(err, IsNil)
+	c.Assert(removed, Equals, 1)
+	found, _ = storage.SetIsMember("key", "a")
+	c.Assert(found, Equals, false)
+
+	length, err := storage.SetLen("key")
+	c.Assert(err, IsNil)
+	c.Assert(length, Equals, 2)
+
+	keyType, _ := storage.Type("key")
+	c.Assert(keyType, Equals, commonStorage.TypeSet)
+
+	// Non-existing and non-set keys
+	storage.Set("string", "value", 0)
+	_, err = storage.SetAdd("string", []string{"a"})
+	c.Assert(err, ErrorMatches, "Key type is not set")
+	_, err = storage.SetMembers("unknown")
+	c.Assert(err, ErrorMatches, "Key does not exist")
+	_, err = storage.SetRemove("unknown", []string{"a"})
+	c.Assert(err, ErrorMatches, "Key does not exist")
+}
+
+func (s *StorageTestSuite) TestSetCombine(c *C) {
+	storage, _ := NewStorage(100, time.Minute)
+
+	storage.SetAdd("key1", []string{"a", "b", "c"})
+	storage.SetAdd("key2", []string{"b", "c", "d"})
+
+	members, err := storage.SetIntersect([]string{"key1", "key2"})
+	c.Assert(err, IsNil)
+	c.Assert(members, DeepEquals, []string{"b", "c"})
+
+	members, err = storage.SetUnion([]string{"key1", "key2", "unknown"})
+	c.Assert(err, IsNil)
+	c.Assert(members, DeepEquals, []string{"a", "b", "c", "d"})
+
+	members, err = storage.SetDiff([]string{"key1", "key2"})
+	c.Assert(err, IsNil)
+	c.Assert(members, DeepEquals, []string{"a"})
+
+	members, err = storage.SetIntersect([]string{"key1", "unknown"})
+	c.Assert(err, IsNil)
+	c.Assert(members, DeepEquals, []string{})
+
+	storage.Set("string", "value", 0)
+	_, err = storage.SetUnion([]string{"key1", "string"})
+	c.Assert(err, ErrorMatches, "Key type is not set")
+}
+
+func (s *StorageTestSuite) TestSortedSet(c *C) {
+	storage, _ := NewStorage(100, time.Minute)
+
+	added, err := storage.SortedSetAdd("key", []commonStorage.ScoredMember{{Member: "a", Score: 3}, {Member: "b", Score: 1}, {Member: "c", Score: 2}})
+	c.Assert(err, IsNil)
+	c.Assert(added, Equals, 3)
+	added, _ = storage.SortedSetAdd("key", []commonStorage.ScoredMember{{Member: "a", Score: 0}, {Member: "d", Score: 4}})
+	c.Assert(added, Equals, 1)
+
+	members, err := storage.SortedSetRange("key", 0, -1, false)
+	c.Assert(err, IsNil)
+	c.Assert(members, DeepEquals, []commonStorage.ScoredMember{{Member: "a", Score: 0}, {Member: "b", Score: 1}, {Member: "c", Score: 2}, {Member: "d", Score: 4}})
+	members, _ = storage.SortedSetRange("key", 0, 1, true)
+	c.Assert(members, DeepEquals, []commonStorage.ScoredMember{{Member: "d", Score: 4}, {Member: "c", Score: 2}})
+	members, _ = storage.SortedSetRangeByScore("key", 1, 4, 1, 1)
+	c.Assert(members, DeepEquals, []commonStorage.ScoredMember{{Member: "c", Score: 2}})
+
+	score, err := storage.SortedSetIncrementBy("key", "b", 10)
+	c.Assert(err, IsNil)
+	c.Assert(score, Equals, 11.0)
+	score, _ = storage.SortedSetScore("key", "b")
+	c.Assert(score, Equals, 11.0)
+	rank, err := storage.SortedSetRank("key", "b")
+	c.Assert(err, IsNil)
+	c.Assert(rank, Equals, 3)
+
+	removed, err := storage.SortedSetRemove("key", []string{"a", "x"})
+	c.Assert(err, IsNil)
+	c.Assert(removed, Equals, 1)
+	length, _ := storage.SortedSetLen("key")
+	c.Assert(length, Equals, 3)
+
+	keyType, _ := storage.Type("key")
+	c.Assert(keyType, Equals, commonStorage.TypeSortedSet)
+
+	// Non-existing members, keys and non-sorted-set keys
+	_, err = storage.SortedSetScore("key", "a")
+	c.Assert(err, ErrorMatches, "Member does not exist")
+	_, err = storage.SortedSetRank("key", "a")
+	c.Assert(err, ErrorMatches, "Member does not exist")
+	_, err = storage.SortedSetRange("unknown", 0, -1, false)
+	c.Assert(err, ErrorMatches, "Key does not exist")
+	storage.Set("string", "value", 0)
+	_, err = storage.SortedSetIncrementBy("string", "a", 1)
+	c.Assert(err, ErrorMatches, "Key type is not sorted set")
+}
+
+func (s *StorageTestSuite) TestSortedSetTransactionRollback(c *C) {
+	storage, _ := NewStorage(100, time.Minute)
+	storage.SortedSetAdd("key", []commonStorage.ScoredMember{{Member: "a", Score: 1}})
+
+	err := storage.Transaction(func(tx commonStorage.Storage) error {
+		tx.SortedSetAdd("key", []commonStorage.ScoredMember{{Member: "a", Score: 5}, {Member: "b", Score: 2}})
+		return errors.New("rollback")
+	})
+	c.Assert(err, ErrorMatches, "rollback")
+
+	members, _ := storage.SortedSetRange("key", 0, -1, false)
+	c.Assert(members, DeepEquals, []commonStorage.ScoredMember{{Member: "a", Score: 1}})
+}
+
+func (s *StorageTestSuite) TestCompareAndSwap(c *C) {
+	storage, _ := NewStorage(100, time.Minute)
+
+	err := storage.CompareAndSwap("key", "value", 0)
+	c.Assert(err, ErrorMatches, "Key does not exist")
+
+	storage.Set("key", "value", 0)
+	value, version, err := storage.GetWithVersion("key")
+	c.Assert(err, IsNil)
+	c.Assert(value, Equals, "value")
+
+	storage.Update("key", "value2")
+	err = storage.CompareAndSwap("key", "value3", version)
+	c.Assert(err, ErrorMatches, "Key version does not match")
+
+	_, version2, _ := storage.GetWithVersion("key")
+	c.Assert(version2 > version, Equals, true)
+	err = storage.CompareAndSwap("key", "value3", version2)
+	c.Assert(err, IsNil)
+
+	value, version3, _ := storage.GetWithVersion("key")
+	c.Assert(value, Equals, "value3")
+	c.Assert(version3 > version2, Equals, true)
+
+	storage.HashCreate("hash", 0)
+	err = storage.CompareAndSwap("hash", "value", 0)
+	c.Assert(err, ErrorMatches, "Key type is not string")
+}
+
+func (s *StorageTestSuite) TestIncrement(c *C) {
+	storage, _ := NewStorage(100, time.Minute)
+
+	value, err := storage.Increment("key", 5, 0)
+	c.Assert(err, IsNil)
+	c.Assert(value, Equals, int64(5))
+
+	value, err = storage.Increment("key", -7, 0)
+	c.Assert(err, IsNil)
+	c.Assert(value, Equals, int64(-2))
+
+	stored, _ := storage.Get("key")
+	c.Assert(stored, Equals, "-2")
+
+	storage.Set("string", "abc", 0)
+	_, err = storage.Increment("string", 1, 0)
+	c.Assert(err, ErrorMatches, "Value is not an integer")
+
+	storage.HashCreate("hash", 0)
+	_, err = storage.Increment("hash", 1, 0)
+	c.Assert(err, ErrorMatches, "Key type is not string")
+	err = storage.Update("hash", "value")
+	c.Assert(err, ErrorMatches, "Key type is not string")
+
+	// Created key gets ttl
+	storage.Increment("ttl", 1, 1)
+	time.Sleep(time.Second)
+	_, err = storage.Get("ttl")
+	c.Assert(err, ErrorMatches, "Key does not exist")
+}
+
+func (s *StorageTestSuite) TestTypeAndExpireTime(c *C) {
+	storage, _ := NewStorage(100, time.Minute)
+
+	storage.Set("key", "value", 100)
+	storage.HashCreate("hash", 0)
+
+	keyType, err := storage.Type("hash")
+	c.Assert(err, IsNil)
+	c.Assert(keyType, Equals, commonStorage.TypeHash)
+
+	_, err = storage.Type("unknown")
+	c.Assert(err, ErrorMatches, "Key does not exist")
+
+	expireTime, err := storage.ExpireTime("key")
+	c.Assert(err, IsNil)
+	c.Assert(time.Until(expireTime) > 99*time.Second, Equals, true)
+
+	c.Assert(storage.Persist("key"), IsNil)
+	expireTime, err = storage.ExpireTime("key")
+	c.Assert(err, IsNil)
+	c.Assert(expireTime.IsZero(), Equals, true)
+
+	c.Assert(storage.Persist("unknown"), ErrorMatches, "Key does not exist")
+}
+
+func (s *StorageTestSuite) TestHashFieldExpiration(c *C) {
+	storage, _ := NewStorage(100, time.Minute)
+
+	storage.HashSetMulti("key", []string{"a", "b", "c"}, []string{"1", "2", "3"})
+	c.Assert(storage.HashExpireAt("key", "a", time.Now().Add(50*time.Millisecond)), IsNil)
+	c.Assert(storage.HashExpireAt("key", "b", time.Now().Add(50*time.Millisecond)), IsNil)
+	c.Assert(storage.HashExpireAt("key", "c", time.Now().Add(time.Minute)), IsNil)
+	c.Assert(storage.HashExpireAt("key", "unknown", time.Now()), Equals, commonStorage.FieldNotExistError)
+	c.Assert(storage.HashExpireAt("unknown", "a", time.Now()), Equals, commonStorage.KeyNotExistsError)
+	c.Assert(storage.HashPersist("key", "c"), IsNil)
+	expireTime, err := storage.HashExpireTime("key", "c")
+	c.Assert(err, IsNil)
+	c.Assert(expireTime.IsZero(), Equals, true)
+
+	// Overwritten field loses its TTL
+	storage.HashSet("key", "b", "new")
+	time.Sleep(60 * time.Millisecond)
+
+	_, err = storage.HashGet("key", "a")
+	c.Assert(err, Equals, commonStorage.FieldNotExistError)
+	_, err = storage.HashExpireTime("key", "a")
+	c.Assert(err, Equals, commonStorage.FieldNotExistError)
+	all, _ := storage.HashGetAll("key")
+	c.Assert(all, DeepEquals, map[string]string{"b": "new", "c": "3"})
+	keys, _ := storage.HashKeys("key")
+	c.Assert(keys, DeepEquals, []string{"b", "c"})
+	length, _ := storage.HashLen("key")
+	c.Assert(length, Equals, 2)
+}
+
+func (s *StorageTestSuite) TestHashFieldExpirationGC(c *C) {
+	storage, _ := NewStorage(100, time.Minute)
+
+	storage.HashSetMulti("key", []string{"a", "b"}, []string{"1", "2"})
+	storage.HashExpireAt("key", "a", time.Now().Add(10*time.Millisecond))
+	time.Sleep(20 * time.Millisecond)
+
+	storage.removeExpired()
+	raw, _ := storage.lru.Peek("key")
+	item := raw.(*commonStorage.Item)
+	c.Assert(item.Value, DeepEquals, commonStorage.Hash{"b": "2"})
+	c.Assert(item.FieldExpireTimes, IsNil)
+}
+
+func (s *StorageTestSuite) TestHashFieldExpirationTransactionRollback(c *C) {
+	storage, _ := NewStorage(100, time.Minute)
+	storage.HashSet("key", "a", "1")
+
+	err := storage.Transaction(func(tx commonStorage.Storage) error {
+		tx.HashExpireAt("key", "a", time.Now().Add(time.Minute))
+		return errors.New("rollback")
+	})
+	c.Assert(err, ErrorMatches, "rollback")
+	expireTime, err := storage.HashExpireTime("key", "a")
+	c.Assert(err, IsNil)
+	c.Assert(expireTime.IsZero(), Equals, true)
+}
+
+func (s *StorageTestSuite) TestExpireAt(c *C) {
+	storage, _ := NewStorage(100, time.Minute)
+
+	storage.Set("key", "value", 0)
+	c.Assert(storage.ExpireAt("key", time.Now().Add(50*time.Millisecond)), IsNil)
+	_, err := storage.Get("key")
+	c.Assert(err, IsNil)
+	time.Sleep(60 * time.Millisecond)
+	_, err = storage.Get("key")
+	c.Assert(err, ErrorMatches, "Key does not exist")
+
+	c.Assert(storage.ExpireAt("unknown", time.Now()), ErrorMatches, "Key does not exist")
+
+	expireTime := time.Now().Add(1500 * time.Millisecond)
+	_, _, err = storage.SetWithOptions("key", "value", 10, commonStorage.SetOptions{ExpireTime: expireTime})
+	c.Assert(err, IsNil)
+	actual, _ := storage.ExpireTime("key")
+	c.Assert(actual.Equal(expireTime), Equals, true)
+}
+
+func (s *StorageTestSuite) TestSlidingExpiration(c *C) {
+	storage, _ := NewStorage(100, time.Minute)
+
+	options := commonStorage.SetOptions{SlidingTTL: 100 * time.Millisecond}
+	_, _, err := storage.SetWithOptions("key", "value", 0, options)
+	c.Assert(err, IsNil)
+	_, version, _ := storage.GetWithVersion("key")
+
+	for i := 0; i < 3; i++ {
+		time.Sleep(60 * time.Millisecond)
+		_, err = storage.Get("key")
+		c.Assert(err, IsNil)
+	}
+	time.Sleep(60 * time.Millisecond)
+	c.Assert(storage.Touch("key"), IsNil)
+	_, actual, _ := storage.GetWithVersion("key")
+	c.Assert(actual, Equals, version)
+
+	time.Sleep(120 * time.Millisecond)
+	c.Assert(storage.Touch("key"), ErrorMatches, "Key does not exist")
+
+	storage.HashCreate("hash", 0)
+	c.Assert(storage.ExpireSliding("hash", 100*time.Millisecond), IsNil)
+	time.Sleep(60 * time.Millisecond)
+	c.Assert(storage.HashSet("hash", "field", "value"), IsNil)
+	time.Sleep(60 * time.Millisecond)
+	_, err = storage.HashGet("hash", "field")
+	c.Assert(err, IsNil)
+
+	c.Assert(storage.Expire("hash", 10), IsNil)
+	expireTime, _ := storage.ExpireTime("hash")
+	storage.HashGet("hash", "field")
+	actualTime, _ := storage.ExpireTime("hash")
+	c.Assert(actualTime, Equals, expireTime)
+
+	// Listing of keys is not an access
+	storage.SetWithOptions("listed", "value", 0, options)
+	expireTime, _ = storage.ExpireTime("listed")
+	time.Sleep(10 * time.Millisecond)
+	c.Assert(storage.Keys(), DeepEquals, []string{"hash", "listed"})
+	actualTime, _ = storage.ExpireTime("listed")
+	c.Assert(actualTime, Equals, expireTime)
+}
+
+func (s *StorageTestSuite) TestListBlockingPop(c *C) {
+	storage, _ := NewStorage(100, time.Minute)
+	storage.ListRightPush("list2", "a")
+	storage.ListRightPush("list2", "b")
+	storage.Set("string", "value", 0)
+
+	key, value, err := storage.ListBlockingLeftPop([]string{"list1", "list2"}, time.Second)
+	c.Assert(err, IsNil)
+	c.Assert(key, Equals, "list2")
+	c.Assert(value, Equals, "a")
+
+	key, value, err = storage.ListBlockingRightPop([]string{"list1", "list2"}, time.Second)
+	c.Assert(err, IsNil)
+	c.Assert(key, Equals, "list2")
+	c.Assert(value, Equals, "b")
+
+	_, _, err = storage.ListBlockingLeftPop([]string{"list1", "string"}, time.Second)
+	c.Assert(err, Equals, commonStorage.KeyListTypeError)
+
+	_, _, err = storage.ListBlockingLeftPop([]string{"list1", "list2"}, 10*time.Millisecond)
+	c.Assert(err, Equals, commonStorage.ListEmptyError)
+	c.Assert(storage.waitersCount("list1"), Equals, 0)
+	c.Assert(storage.waitersCount("list2"), Equals, 0)
+}
+
+func (s *StorageTestSuite) TestListBlockingPopWakeup(c *C) {
+	storage, _ := NewStorage(100, time.Minute)
+
+	// Waiters are started one by one, so they are queued in known order
+	results := make([]chan string, 3)
+	for i := range results {
+		results[i] = make(chan string, 1)
+		go func(result chan string) {
+			key, value, err := storage.ListBlockingLeftPop([]string{"list1", "list2"}, 0)
+			result <- fmt.Sprintf("%s %s %v", key, value, err)
+		}(results[i])
+		for storage.waitersCount("list2") != i+1 {
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	storage.ListRightPush("list2", "a")
+	storage.ListLeftPush("list1", "b")
+	c.Assert(<-results[0], Equals, "list2 a <nil>")
+	c.Assert(<-results[1], Equals, "list1 b <nil>")
+
+	storage.ListRightPush("list1", "c")
+	storage.ListRightPush("list1", "d")
+	c.Assert(<-results[2], Equals, "list1 c <nil>")
+
+	values, _ := storage.ListRange("list1", 0, 10)
+	c.Assert(values, DeepEquals, []string{"d"})
+	c.Assert(storage.waitersCount("list1"), Equals, 0)
+	c.Assert(storage.waitersCount("list2"), Equals, 0)
+}
+
+func (s *StorageTestSuite) TestListBlockingPopTransaction(c *C) {
+	storage, _ := NewStorage(100, time.Minute)
+
+	result := make(chan string, 1)
+	go func() {
+		key, value, err := storage.ListBlockingRightPop([]string{"list"}, 0)
+		result <- fmt.Sprintf("%s %s %v", key, value, err)
+	}()
+	for storage.waitersCount("list") != 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// Value which is rolled back is never served
+	err := storage.Transaction(func(tx commonStorage.Storage) error {
+		tx.ListRightPush("list", "a")
+		return errors.New("rollback")
+	})
+	c.Assert(err, ErrorMatches, "rollback")
+	c.Assert(storage.waitersCount("list"), Equals, 1)
+
+	err = storage.Transaction(func(tx commonStorage.Storage) error {
+		// Transaction can't wait because storage is locked
+		_, _, err := tx.ListBlockingLeftPop([]string{"list"}, 0)
+		c.Assert(err, Equals, commonStorage.ListEmptyError)
+		tx.ListRightPush("list", "a")
+		return tx.ListRightPush("list", "b")
+	})
+	c.Assert(err, IsNil)
+	c.Assert(<-result, Equals, "list b <nil>")
+
+	values, _ := storage.ListRange("list", 0, 10)
+	c.Assert(values, DeepEquals, []string{"a"})
+}
+
+func (s *StorageTestSuite) TestListMove(c *C) {
+	storage, _ := NewStorage(100, time.Minute)
+	storage.ListRightPush("pending", "a")
+	storage.ListRightPush("pending", "b")
+	storage.Set("string", "value", 0)
+
+	value, err := storage.ListMove("pending", "progress", true, false)
+	c.Assert(err, IsNil)
+	c.Assert(value, Equals, "a")
+
+	// Source and destination may be the same list
+	value, err = storage.ListMove("pending", "pending", false, true)
+	c.Assert(err, IsNil)
+	c.Assert(value, Equals, "b")
+
+	// Value is not popped if destination is not a list
+	_, err = storage.ListMove("pending", "string", true, true)
+	c.Assert(err, Equals, commonStorage.KeyListTypeError)
+	values, _ := storage.ListRange("pending", 0, 10)
+	c.Assert(values, DeepEquals, []string{"b"})
+	values, _ = storage.ListRange("progress", 0, 10)
+	c.Assert(values, DeepEquals, []string{"a"})
+
+	_, err = storage.ListMove("unknown", "progress", true, true)
+	c.Assert(err, Equals, commonStorage.KeyNotExistsError)
+	storage.ListLeftPop("pending")
+	_, err = storage.ListMove("pending", "progress", true, true)
+	c.Assert(err, Equals, commonStorage.ListEmptyError)
+}
+
+func (s *StorageTestSuite) TestListBlockingMove(c *C) {
+	storage, _ := NewStorage(100, time.Minute)
+
+	// The second waiter waits for value moved by the first one
+	results := make([]chan string, 2)
+	for i, lists := range [][]string{{"pending", "progress"}, {"progress", "done"}} {
+		results[i] = make(chan string, 1)
+		go func(result chan string, source, destination string) {
+			value, err := storage.ListBlockingMove(source, destination, false, true, 0)
+			result <- fmt.Sprintf("%s %v", value, err)
+		}(results[i], lists[0], lists[1])
+		for storage.waitersCount(lists[0]) != 1 {
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	storage.ListRightPush("pending", "a")
+	c.Assert(<-results[0], Equals, "a <nil>")
+	c.Assert(<-results[1], Equals, "a <nil>")
+	values, _ := storage.ListRange("done", 0, 10)
+	c.Assert(values, DeepEquals, []string{"a"})
+	length, _ := storage.ListLen("progress")
+	c.Assert(length, Equals, 0)
+
+	// Waiter fails if destination is not a list when value is pushed, value stays in source
+	result := make(chan string, 1)
+	go func() {
+		_, err := storage.ListBlockingMove("pending", "string", true, true, 0)
+		result <- fmt.Sprint(err)
+	}()
+	for storage.waitersCount("pending") != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	storage.Set("string", "value", 0)
+	storage.ListRightPush("pending", "b")
+	c.Assert(<-result, Equals, commonStorage.KeyListTypeError.Error())
+	values, _ = storage.ListRange("pending", 0, 10)
+	c.Assert(values, DeepEquals, []string{"b"})
+
+	value, err := storage.ListBlockingMove("pending", "done", true, false, time.Second)
+	c.Assert(err, IsNil)
+	c.Assert(value, Equals, "b")
+	_, err = storage.ListBlockingMove("pending", "done", true, false, 10*time.Millisecond)
+	c.Assert(err, Equals, commonStorage.ListEmptyError)
+}
+
+// waitersCount returns number of waiters queued for key
+func (s *storage) waitersCount(key string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.waiters[key])
+}
+
+func (s *StorageTestSuite) TestTransaction(c *C) {
+	storage, _ := NewStorage(100, time.Minute)
+	storage.Set("key", "value", 0)
+
+	err := storage.Transaction(func(tx commonStorage.Storage) error {
+		c.Assert(tx.Update("key", "new value"), IsNil)
+		return tx.Set("key2", "value2", 0)
+	})
+	c.Assert(err, IsNil)
+
+	value, _ := storage.Get("key")
+	c.Assert(value, Equals, "new value")
+	c.Assert(storage.Keys(), DeepEquals, []string{"key", "key2"})
+}
+
+func (s *StorageTestSuite) TestTransactionRollback(c *C) {
+	storage, _ := NewStorage(3, time.Minute)
+	storage.Set("key", "value", 0)
+	storage.HashSet("hash", "field", "value")
+	storage.ListRightPush("list", "value")
+
+	err := storage.Transaction(func(tx commonStorage.Storage) error {
+		tx.Update("key", "new value")
+		tx.HashSet("hash", "field", "new value")
+		tx.ListLeftPop("list")
+		tx.Delete("key")
+		// Key is evicted by LRU
+		tx.Set("key2", "value2", 0)
+		return tx.Set("key2", "value2", 0)
+	})
+	c.Assert(err, Equals, commonStorage.KeyAlreadyExistsError)
+
+	c.Assert(storage.Keys(), DeepEquals, []string{"hash", "key", "list"})
+	value, _ := storage.Get("key")
+	c.Assert(value, Equals, "value")
+	value, _ = storage.HashGet("hash", "field")
+	c.Assert(value, Equals, "value")
+	values, _ := storage.ListRange("list", 0, 10)
+	c.Assert(values, DeepEquals, []string{"value"})
+}
+
+func (s *StorageTestSuite) TestNotifications(c *C) {
+	storage, _ := NewStorage(4, time.Minute)
+	var events []string
+	storage.SetNotifier(func(event, key string) {
+		events = append(events, event+" "+key)
+	})
+
+	storage.Set("key", "value", 0)
+	storage.Expire("key", 100)
+	storage.Increment("counter", 1, 0)
+	storage.HashSet("hash", "field", "value")
+	storage.ListRightPush("list", "value")
+	storage.Delete("key")
+	storage.Set("expired", "value", 0)
+	storage.ExpireAt("expired", time.Now().Add(-time.Second))
+	storage.removeExpired()
+	storage.SetAdd("set", []string{"member"})
+	storage.Set("key", "value", 0)
+	c.Assert(events, DeepEquals, []string{
+		"set key",
+		"set counter",
+		"hash hash",
+		"list list",
+		"del key",
+		"set expired",
+		"expired expired",
+		"evicted counter",
+		"set key",
+	})
+
+	events = nil
+	storage.Transaction(func(tx commonStorage.Storage) error {
+		tx.Update("key", "value2")
+		return errors.New("rollback")
+	})
+	c.Assert(events, HasLen, 0)
+	storage.Transaction(func(tx commonStorage.Storage) error {
+		tx.Update("key", "value2")
+		c.Assert(events, HasLen, 0)
+		return nil
+	})
+	c.Assert(events, DeepEquals, []string{"set key"})
+
+	events = nil
+	storage.SetNotifier(nil)
+	storage.Update("key", "value3")
+	c.Assert(events, HasLen, 0)
+}
+
 func (s *StorageTestSuite) TestGC(c *C) {
 	storage, _ := NewStorage(100, time.Millisecond)
 	storage.Set("key", "value", 1)
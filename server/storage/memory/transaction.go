@@ -0,0 +1,123 @@
+package memory
+
+import (
+	"container/list"
+	"time"
+
+	commonStorage "github.com/Barberrrry/jcache/server/storage"
+)
+
+// Transaction calls fn under exclusive lock of the whole storage.
+// Storage passed to fn shares LRU with s, its own mutex is never contended because lock of s is held.
+// Every key is backed up before the first change inside of transaction and restored on rollback.
+// Transaction started by storage of transaction is a part of the outer one, it is rolled back only together with it.
+// Changes of committed transaction are written into AOF as one entry, so they are replayed all or nothing.
+func (s *storage) Transaction(fn func(commonStorage.Storage) error) error {
+	if s.pushed != nil {
+		return fn(s)
+	}
+	s.mu.Lock()
+	defer s.unlock()
+
+	tx := &storage{
+		lru:      s.lru,
+		journal:  make(map[string]*commonStorage.Item),
+		version:  s.version,
+		index:    s.index,
+		waiters:  s.waiters,
+		pushed:   make(map[string]bool),
+		notifier: s.notifier,
+		aof:      s.aof,
+	}
+	// Evicted keys are backed up by s.onEvict
+	s.journal = tx.journal
+
+	err := fn(tx)
+	s.journal = nil
+	if err != nil {
+		s.rollback(tx.journal)
+		return err
+	}
+	s.entries = append(s.entries, tx.entries...)
+	for key := range tx.pushed {
+		s.serveWaiters(key)
+	}
+	for _, e := range tx.events {
+		s.notify(e.event, e.key)
+	}
+	return nil
+}
+
+// backup saves copy of key item into transaction journal unless key is already saved.
+// Missing key is saved as nil to be removed on rollback.
+func (s *storage) backup(key string) {
+	if s.journal == nil {
+		return
+	}
+	if _, saved := s.journal[key]; saved {
+		return
+	}
+	var item *commonStorage.Item
+	if raw, exists := s.lru.Peek(key); exists {
+		item = copyItem(raw.(*commonStorage.Item))
+	}
+	s.journal[key] = item
+}
+
+// onEvict is called by LRU when key is removed or evicted
+func (s *storage) onEvict(key, value interface{}) {
+	s.index.remove(key.(string))
+	if s.journal == nil {
+		return
+	}
+	if _, saved := s.journal[key.(string)]; !saved {
+		s.journal[key.(string)] = value.(*commonStorage.Item)
+	}
+}
+
+// rollback restores keys from journal. Keys which were created in transaction are removed first,
+// so restored keys don't cause eviction.
+func (s *storage) rollback(journal map[string]*commonStorage.Item) {
+	for key, item := range journal {
+		if item == nil {
+			s.lru.Remove(key)
+		}
+	}
+	for key, item := range journal {
+		if item != nil {
+			s.lru.Add(key, item)
+			s.index.add(key)
+		}
+	}
+}
+
+func copyItem(item *commonStorage.Item) *commonStorage.Item {
+	c := *item
+	switch value := item.Value.(type) {
+	case commonStorage.Hash:
+		hash := make(commonStorage.Hash, len(value))
+		for field, v := range value {
+			hash[field] = v
+		}
+		c.Value = hash
+		if item.FieldExpireTimes != nil {
+			c.FieldExpireTimes = make(map[string]time.Time, len(item.FieldExpireTimes))
+			for field, expireTime := range item.FieldExpireTimes {
+				c.FieldExpireTimes[field] = expireTime
+			}
+		}
+	case *list.List:
+		values := list.New()
+		values.PushBackList(value)
+		c.Value = values
+	case commonStorage.Set:
+		set := make(commonStorage.Set, len(value))
+		for member := range value {
+			set[member] = true
+		}
+		c.Value = set
+	case *commonStorage.SortedSet:
+		c.Value = value.Copy()
+	}
+	return &c
+}
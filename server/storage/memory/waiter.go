@@ -0,0 +1,204 @@
+package memory
+
+import (
+	"container/list"
+	"time"
+
+	commonStorage "github.com/Barberrrry/jcache/server/storage"
+)
+
+// ListBlockingLeftPop pops value from the beginning of the first non-empty list of keys.
+// If all lists are empty, it waits until value is pushed or timeout expires. Zero timeout means waiting forever.
+// Error will occur if key type is not list or nothing is pushed before timeout.
+func (s *storage) ListBlockingLeftPop(keys []string, timeout time.Duration) (string, string, error) {
+	return commonStorage.NewListWaiter(true).Wait(keys, timeout, s.waitable)
+}
+
+// ListBlockingRightPop pops value from the ending of the first non-empty list of keys.
+// If all lists are empty, it waits until value is pushed or timeout expires. Zero timeout means waiting forever.
+// Error will occur if key type is not list or nothing is pushed before timeout.
+func (s *storage) ListBlockingRightPop(keys []string, timeout time.Duration) (string, string, error) {
+	return commonStorage.NewListWaiter(false).Wait(keys, timeout, s.waitable)
+}
+
+// ListMove atomically pops value from the source list and pushes it into the destination list.
+// Destination is created if it doesn't exist, source and destination may be the same list.
+// Error will occur if source doesn't exist, source is empty or type of any key is not list.
+func (s *storage) ListMove(source, destination string, fromLeft, toLeft bool) (string, error) {
+	s.mu.Lock()
+	defer s.unlock()
+	s.backup(source)
+
+	values, err := s.getList(source, false)
+	if err != nil {
+		return "", err
+	}
+	if values.Len() == 0 {
+		return "", commonStorage.ListEmptyError
+	}
+	// Destination is checked before pop, so value is never lost
+	if err := s.checkListDestination(destination); err != nil {
+		return "", err
+	}
+
+	value := popListValue(values, fromLeft)
+	s.changedKey(source)
+	s.recordPop(source, fromLeft)
+	s.pushListValue(destination, value, toLeft)
+	return value, nil
+}
+
+// ListBlockingMove is ListMove which waits until value is pushed into the source list or timeout expires.
+// Zero timeout means waiting forever. Value is popped and pushed atomically even after waiting.
+func (s *storage) ListBlockingMove(source, destination string, fromLeft, toLeft bool, timeout time.Duration) (string, error) {
+	_, value, err := commonStorage.NewListMoveWaiter(fromLeft, destination, toLeft).Wait([]string{source}, timeout, s.waitable)
+	return value, err
+}
+
+func (s *storage) waitable(key string) commonStorage.ListWaitable {
+	return s
+}
+
+// ListPopOrWait pops value for waiter from the first non-empty list of keys or queues waiter for every key.
+// Storage of transaction never queues waiter because lock is held until commit.
+func (s *storage) ListPopOrWait(keys []string, w *commonStorage.ListWaiter) (string, string, bool, error) {
+	s.mu.Lock()
+	defer s.unlock()
+
+	for _, key := range keys {
+		values, err := s.getList(key, false)
+		if err == commonStorage.KeyNotExistsError {
+			continue
+		}
+		if err != nil {
+			return "", "", false, err
+		}
+		if values.Len() == 0 {
+			continue
+		}
+		if err := s.checkListDestination(w.Destination); err != nil {
+			return "", "", false, err
+		}
+		if !w.Claim() {
+			return "", "", false, nil
+		}
+		return key, s.popForWaiter(key, values, w), true, nil
+	}
+
+	if s.pushed != nil {
+		return "", "", false, commonStorage.ListEmptyError
+	}
+	for _, key := range keys {
+		s.waiters[key] = append(s.waiters[key], w)
+	}
+	return "", "", false, nil
+}
+
+// ListCancelWait removes waiter from queues of keys
+func (s *storage) ListCancelWait(keys []string, w *commonStorage.ListWaiter) {
+	s.mu.Lock()
+	defer s.unlock()
+
+	for _, key := range keys {
+		queue := s.waiters[key]
+		for i, queued := range queue {
+			if queued == w {
+				s.dequeueWaiter(key, i)
+				break
+			}
+		}
+	}
+}
+
+// pushedKey serves waiters of list after push. Inside of transaction waiters are served after commit,
+// so they never get values which are rolled back.
+func (s *storage) pushedKey(key string) {
+	if s.pushed != nil {
+		s.pushed[key] = true
+		return
+	}
+	s.serveWaiters(key)
+}
+
+// serveWaiters pops values of list for waiters of key in order of their arrival.
+// Waiters which are already served by another key or storage are dropped.
+// Waiter fails without pop if its destination is not a list anymore.
+func (s *storage) serveWaiters(key string) {
+	for len(s.waiters[key]) > 0 {
+		values, err := s.getList(key, false)
+		if err != nil || values.Len() == 0 {
+			return
+		}
+		w := s.waiters[key][0]
+		s.dequeueWaiter(key, 0)
+		if err := s.checkListDestination(w.Destination); err != nil {
+			if w.Claim() {
+				w.Fail(err)
+			}
+			continue
+		}
+		if !w.Claim() {
+			continue
+		}
+		w.Serve(key, s.popForWaiter(key, values, w))
+	}
+}
+
+// popForWaiter pops value of claimed waiter and moves it into destination of waiter if it is set.
+// Value is left in the list for notify waiter, so the following waiters are served too.
+func (s *storage) popForWaiter(key string, values *list.List, w *commonStorage.ListWaiter) string {
+	if w.Notify {
+		return ""
+	}
+	s.backup(key)
+	value := popListValue(values, w.Left)
+	s.changedKey(key)
+	s.recordPop(key, w.Left)
+	if w.Destination != "" {
+		s.pushListValue(w.Destination, value, w.DestinationLeft)
+	}
+	return value
+}
+
+// checkListDestination returns error if destination exists and its type is not list, empty destination is valid
+func (s *storage) checkListDestination(key string) error {
+	if key == "" {
+		return nil
+	}
+	if _, err := s.getList(key, false); err != nil && err != commonStorage.KeyNotExistsError {
+		return err
+	}
+	return nil
+}
+
+// pushListValue pushes value into list which is created if it doesn't exist, list type must be checked before
+func (s *storage) pushListValue(key, value string, left bool) {
+	s.backup(key)
+	values, _ := s.getList(key, true)
+	if left {
+		values.PushFront(value)
+	} else {
+		values.PushBack(value)
+	}
+	s.changedKey(key)
+	s.recordPush(key, value, left)
+	s.pushedKey(key)
+}
+
+func (s *storage) dequeueWaiter(key string, i int) {
+	queue := s.waiters[key]
+	if len(queue) == 1 {
+		delete(s.waiters, key)
+		return
+	}
+	s.waiters[key] = append(queue[:i:i], queue[i+1:]...)
+}
+
+func popListValue(values *list.List, left bool) string {
+	e := values.Back()
+	if left {
+		e = values.Front()
+	}
+	values.Remove(e)
+	return e.Value.(string)
+}
@@ -1,8 +1,12 @@
 package multi
 
 import (
+	"fmt"
 	"hash/fnv"
 	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	commonStorage "github.com/Barberrrry/jcache/server/storage"
 )
@@ -23,10 +27,61 @@ func (s *storage) AddStorage(storage commonStorage.Storage) {
 }
 
 func (s *storage) getStorage(key string) commonStorage.Storage {
+	return s.storages[s.getStorageIndex(key)]
+}
+
+func (s *storage) getStorageIndex(key string) int {
 	h := fnv.New32a()
 	h.Write([]byte(key))
-	n := int(h.Sum32()) % len(s.storages)
-	return s.storages[n]
+	return int(h.Sum32()) % len(s.storages)
+}
+
+// groupKeys returns positions of keys grouped by index of storage which keeps the key
+func (s *storage) groupKeys(keys []string) map[int][]int {
+	groups := make(map[int][]int)
+	for i, key := range keys {
+		n := s.getStorageIndex(key)
+		groups[n] = append(groups[n], i)
+	}
+	return groups
+}
+
+// pick returns values at specified positions
+func pick(values []string, positions []int) []string {
+	picked := make([]string, len(positions))
+	for i, position := range positions {
+		picked[i] = values[position]
+	}
+	return picked
+}
+
+// Transaction calls fn atomically if all inner storages support transactions.
+// Transactions of inner storages are nested, so they are committed or rolled back together.
+func (s *storage) Transaction(fn func(commonStorage.Storage) error) error {
+	return s.transaction(nil, fn)
+}
+
+// transaction opens transaction of the next inner storage until all of them are opened
+func (s *storage) transaction(txs []commonStorage.Storage, fn func(commonStorage.Storage) error) error {
+	if len(txs) == len(s.storages) {
+		return fn(NewStorage(txs...))
+	}
+	t, ok := s.storages[len(txs)].(commonStorage.Transactional)
+	if !ok {
+		return commonStorage.TxNotSupportedError
+	}
+	return t.Transaction(func(tx commonStorage.Storage) error {
+		return s.transaction(append(txs, tx), fn)
+	})
+}
+
+// SetNotifier sets function which receives keyspace events of all inner storages which report them
+func (s *storage) SetNotifier(notifier commonStorage.Notifier) {
+	for _, storage := range s.storages {
+		if n, ok := storage.(commonStorage.Notifying); ok {
+			n.SetNotifier(notifier)
+		}
+	}
 }
 
 // Keys returns list of all keys
@@ -39,32 +94,156 @@ func (s *storage) Keys() []string {
 	return keys
 }
 
+// Scan returns the next page of keys of one inner storage.
+// Cursor is "<storage index>.<inner storage cursor>", inner storages are scanned one by one.
+func (s *storage) Scan(cursor string, options commonStorage.ScanOptions) (string, []string, error) {
+	if len(s.storages) == 0 {
+		return commonStorage.ScanStart, []string{}, nil
+	}
+	n, inner := 0, commonStorage.ScanStart
+	if cursor != commonStorage.ScanStart {
+		parts := strings.SplitN(cursor, ".", 2)
+		if len(parts) != 2 {
+			return "", nil, commonStorage.InvalidCursorError
+		}
+		var err error
+		n, err = strconv.Atoi(parts[0])
+		if err != nil || n < 0 || n >= len(s.storages) {
+			return "", nil, commonStorage.InvalidCursorError
+		}
+		inner = parts[1]
+	}
+
+	next, keys, err := s.storages[n].Scan(inner, options)
+	if err != nil {
+		return "", nil, err
+	}
+	if next == commonStorage.ScanStart {
+		n, next = n+1, commonStorage.ScanStart
+		if n == len(s.storages) {
+			return commonStorage.ScanStart, keys, nil
+		}
+	}
+	return fmt.Sprintf("%d.%s", n, next), keys, nil
+}
+
 // Expire sets new key ttl
 func (s *storage) Expire(key string, ttl uint64) error {
 	return s.getStorage(key).Expire(key, ttl)
 }
 
+// ExpireAt sets time when specified key expires. Zero time makes key exist forever.
+func (s *storage) ExpireAt(key string, expireTime time.Time) error {
+	return s.getStorage(key).ExpireAt(key, expireTime)
+}
+
+// ExpireSliding makes specified key expire after ttl since the last access. Zero ttl makes key exist forever.
+func (s *storage) ExpireSliding(key string, ttl time.Duration) error {
+	return s.getStorage(key).ExpireSliding(key, ttl)
+}
+
+// Touch extends expiration of specified key if it is sliding
+func (s *storage) Touch(key string) error {
+	return s.getStorage(key).Touch(key)
+}
+
+// Persist removes ttl of specified key, so key exists forever
+func (s *storage) Persist(key string) error {
+	return s.getStorage(key).Persist(key)
+}
+
+// Type returns type of specified key value. Error will occur if key doesn't exist.
+func (s *storage) Type(key string) (string, error) {
+	return s.getStorage(key).Type(key)
+}
+
+// ExpireTime returns time when specified key expires, it is zero if key exists forever.
+func (s *storage) ExpireTime(key string) (time.Time, error) {
+	return s.getStorage(key).ExpireTime(key)
+}
+
 // Get value of specified key. Error will occur if key doesn't exist or key type is not string.
 func (s *storage) Get(key string) (string, error) {
 	return s.getStorage(key).Get(key)
 }
 
+// GetWithVersion returns value and version of specified key.
+// Error will occur if key doesn't exist or key type is not string.
+func (s *storage) GetWithVersion(key string) (string, uint64, error) {
+	return s.getStorage(key).GetWithVersion(key)
+}
+
+// CompareAndSwap updates value of specified key only if key version wasn't changed.
+// Error will occur if key doesn't exist, key type is not string or version doesn't match.
+func (s *storage) CompareAndSwap(key, value string, version uint64) error {
+	return s.getStorage(key).CompareAndSwap(key, value, version)
+}
+
 // Set value of specified key with ttl. Use zero duration if key should exist forever.
 // Error will occur if key already exists.
 func (s *storage) Set(key, value string, ttl uint64) error {
 	return s.getStorage(key).Set(key, value, ttl)
 }
 
+// SetWithOptions sets value of specified key with ttl according to options.
+// Previous value is returned only if options.Get is set and key existed.
+func (s *storage) SetWithOptions(key, value string, ttl uint64, options commonStorage.SetOptions) (string, bool, error) {
+	return s.getStorage(key).SetWithOptions(key, value, ttl, options)
+}
+
 // Update value of specified key. Error will occur if key doesn't exist or key type is not string.
 func (s *storage) Update(key, value string) error {
 	return s.getStorage(key).Update(key, value)
 }
 
+// Increment adds delta to integer value of specified key and returns the new value.
+// Missing key is created with zero value and ttl before increment.
+func (s *storage) Increment(key string, delta int64, ttl uint64) (int64, error) {
+	return s.getStorage(key).Increment(key, delta, ttl)
+}
+
 // Delete specified key. Error will occur if key doesn't exist. It works for any key type.
 func (s *storage) Delete(key string) error {
 	return s.getStorage(key).Delete(key)
 }
 
+// GetMulti returns values of specified keys. Keys are grouped by storages, so every storage is called once.
+func (s *storage) GetMulti(keys []string) ([]string, []error) {
+	values := make([]string, len(keys))
+	errs := make([]error, len(keys))
+	for n, positions := range s.groupKeys(keys) {
+		groupValues, groupErrs := s.storages[n].GetMulti(pick(keys, positions))
+		for i, position := range positions {
+			values[position], errs[position] = groupValues[i], groupErrs[i]
+		}
+	}
+	return values, errs
+}
+
+// SetMulti sets values of specified keys with ttl. Keys are grouped by storages, so every storage is called once.
+func (s *storage) SetMulti(keys, values []string, ttl uint64) []error {
+	errs := make([]error, len(keys))
+	for n, positions := range s.groupKeys(keys) {
+		groupErrs := s.storages[n].SetMulti(pick(keys, positions), pick(values, positions), ttl)
+		for i, position := range positions {
+			errs[position] = groupErrs[i]
+		}
+	}
+	return errs
+}
+
+// DeleteMulti deletes specified keys. Keys are grouped by storages, so every storage is called once.
+func (s *storage) DeleteMulti(keys []string) []error {
+	errs := make([]error, len(keys))
+	for n, positions := range s.groupKeys(keys) {
+		groupErrs := s.storages[n].DeleteMulti(pick(keys, positions))
+		for i, position := range positions {
+			errs[position] = groupErrs[i]
+		}
+	}
+	return errs
+}
+
 // HashCreate creates new hash with specified key and ttl. Use zero duration if key should exist forever.
 func (s *storage) HashCreate(key string, ttl uint64) error {
 	return s.getStorage(key).HashCreate(key, ttl)
@@ -101,6 +280,55 @@ func (s *storage) HashKeys(key string) ([]string, error) {
 	return s.getStorage(key).HashKeys(key)
 }
 
+// HashGetMulti returns values of specified fields of key.
+// Error of every field is returned at the same position, it is nil if value is found.
+func (s *storage) HashGetMulti(key string, fields []string) ([]string, []error) {
+	return s.getStorage(key).HashGetMulti(key, fields)
+}
+
+// HashSetMulti sets values of specified fields of key and returns number of new fields.
+// Error will occur if key type is not hash.
+func (s *storage) HashSetMulti(key string, fields, values []string) (int, error) {
+	return s.getStorage(key).HashSetMulti(key, fields, values)
+}
+
+// HashIncrementBy adds delta to integer value of field and returns the new value.
+// Error will occur if key type is not hash, value is not an integer or result overflows.
+func (s *storage) HashIncrementBy(key, field string, delta int64) (int64, error) {
+	return s.getStorage(key).HashIncrementBy(key, field, delta)
+}
+
+// HashSetIfNotExists sets field value only if field doesn't exist and reports whether it was set.
+// Error will occur if key type is not hash.
+func (s *storage) HashSetIfNotExists(key, field, value string) (bool, error) {
+	return s.getStorage(key).HashSetIfNotExists(key, field, value)
+}
+
+// HashExists reports whether field exists in hash. Error will occur if key doesn't exist or key type is not hash.
+func (s *storage) HashExists(key, field string) (bool, error) {
+	return s.getStorage(key).HashExists(key, field)
+}
+
+// HashScan returns fields of hash starting from cursor. Error will occur if key doesn't exist or key type is not hash.
+func (s *storage) HashScan(key, cursor string, options commonStorage.ScanOptions) (string, map[string]string, error) {
+	return s.getStorage(key).HashScan(key, cursor, options)
+}
+
+// HashExpireAt sets time when hash field expires. Zero time makes field exist forever.
+func (s *storage) HashExpireAt(key, field string, expireTime time.Time) error {
+	return s.getStorage(key).HashExpireAt(key, field, expireTime)
+}
+
+// HashPersist removes expiration of hash field. Error will occur if key or field doesn't exist.
+func (s *storage) HashPersist(key, field string) error {
+	return s.getStorage(key).HashPersist(key, field)
+}
+
+// HashExpireTime returns time when hash field expires, it is zero if field exists forever.
+func (s *storage) HashExpireTime(key, field string) (time.Time, error) {
+	return s.getStorage(key).HashExpireTime(key, field)
+}
+
 // ListCreate creates new list with specified key and ttl. Use zero duration if key should exist forever.
 func (s *storage) ListCreate(key string, ttl uint64) error {
 	return s.getStorage(key).ListCreate(key, ttl)
@@ -128,13 +356,276 @@ func (s *storage) ListRightPush(key, value string) error {
 	return s.getStorage(key).ListRightPush(key, value)
 }
 
+// ListBlockingLeftPop pops value from the beginning of the first non-empty list of keys or waits until value is pushed
+func (s *storage) ListBlockingLeftPop(keys []string, timeout time.Duration) (string, string, error) {
+	if len(s.groupKeys(keys)) == 1 {
+		return s.getStorage(keys[0]).ListBlockingLeftPop(keys, timeout)
+	}
+	return s.listBlockingPop(keys, true, timeout)
+}
+
+// ListBlockingRightPop pops value from the ending of the first non-empty list of keys or waits until value is pushed
+func (s *storage) ListBlockingRightPop(keys []string, timeout time.Duration) (string, string, error) {
+	if len(s.groupKeys(keys)) == 1 {
+		return s.getStorage(keys[0]).ListBlockingRightPop(keys, timeout)
+	}
+	return s.listBlockingPop(keys, false, timeout)
+}
+
+// listBlockingPop waits for keys of different storages, so all of them must be able to queue waiters
+func (s *storage) listBlockingPop(keys []string, left bool, timeout time.Duration) (string, string, error) {
+	for _, key := range keys {
+		if _, ok := s.getStorage(key).(commonStorage.ListWaitable); !ok {
+			return "", "", commonStorage.WaitNotSupportedError
+		}
+	}
+	return commonStorage.NewListWaiter(left).Wait(keys, timeout, s.waitable)
+}
+
+func (s *storage) waitable(key string) commonStorage.ListWaitable {
+	return s.getStorage(key).(commonStorage.ListWaitable)
+}
+
+// ListMove atomically pops value from the source list and pushes it into the destination list.
+// Lists of different storages are moved within transaction of both storages.
+func (s *storage) ListMove(source, destination string, fromLeft, toLeft bool) (string, error) {
+	from, to := s.getStorageIndex(source), s.getStorageIndex(destination)
+	if from == to {
+		return s.storages[from].ListMove(source, destination, fromLeft, toLeft)
+	}
+
+	var value string
+	err := s.transactionOf([]int{from, to}, func(txs []commonStorage.Storage) (err error) {
+		if value, err = listPop(txs[0], source, fromLeft); err != nil {
+			return err
+		}
+		return listPush(txs[1], destination, value, toLeft)
+	})
+	return value, err
+}
+
+// ListBlockingMove is ListMove which waits until value is pushed into the source list.
+// If lists are in different storages, waiter is only woken by pushed value, which is then moved within
+// transaction of both storages like by ListMove. Waiting is repeated if value is taken by another client first.
+func (s *storage) ListBlockingMove(source, destination string, fromLeft, toLeft bool, timeout time.Duration) (string, error) {
+	from, to := s.getStorageIndex(source), s.getStorageIndex(destination)
+	if from == to {
+		return s.storages[from].ListBlockingMove(source, destination, fromLeft, toLeft, timeout)
+	}
+	if _, ok := s.storages[from].(commonStorage.ListWaitable); !ok {
+		return "", commonStorage.WaitNotSupportedError
+	}
+
+	var deadline time.Time
+	if timeout > 0 {
+		deadline = time.Now().Add(timeout)
+	}
+	for {
+		value, err := s.ListMove(source, destination, fromLeft, toLeft)
+		if err != commonStorage.ListEmptyError && err != commonStorage.KeyNotExistsError {
+			return value, err
+		}
+		wait := time.Duration(0)
+		if timeout > 0 {
+			if wait = time.Until(deadline); wait <= 0 {
+				return "", commonStorage.ListEmptyError
+			}
+		}
+		if _, _, err := commonStorage.NewListNotifyWaiter().Wait([]string{source}, wait, s.waitable); err != nil {
+			return "", err
+		}
+	}
+}
+
+// transactionOf calls fn with transaction storages of storages with indexes in the same order.
+// Storages are locked in ascending order of index like by Transaction, so concurrent transactions don't deadlock.
+func (s *storage) transactionOf(indexes []int, fn func(txs []commonStorage.Storage) error) error {
+	order := append([]int(nil), indexes...)
+	sort.Ints(order)
+	txs := make(map[int]commonStorage.Storage, len(order))
+
+	var open func(n int) error
+	open = func(n int) error {
+		if n == len(order) {
+			ordered := make([]commonStorage.Storage, len(indexes))
+			for i, index := range indexes {
+				ordered[i] = txs[index]
+			}
+			return fn(ordered)
+		}
+		t, ok := s.storages[order[n]].(commonStorage.Transactional)
+		if !ok {
+			return commonStorage.TxNotSupportedError
+		}
+		return t.Transaction(func(tx commonStorage.Storage) error {
+			txs[order[n]] = tx
+			return open(n + 1)
+		})
+	}
+	return open(0)
+}
+
+func listPop(s commonStorage.Storage, key string, left bool) (string, error) {
+	if left {
+		return s.ListLeftPop(key)
+	}
+	return s.ListRightPop(key)
+}
+
+func listPush(s commonStorage.Storage, key, value string, left bool) error {
+	if left {
+		return s.ListLeftPush(key, value)
+	}
+	return s.ListRightPush(key, value)
+}
+
 // ListLen returns count of elements in the list. Error will occur if key doesn't exist or key type is not list.
 func (s *storage) ListLen(key string) (int, error) {
 	return s.getStorage(key).ListLen(key)
 }
 
-// ListRange returns list of elements from the list from start to stop index.
-// Error will occur if key doesn't exist or key type is not list.
+// ListRange returns list of elements from the list from start to stop index inclusive.
+// Negative indexes are counted from the list ending. Error will occur if key doesn't exist or key type is not list.
 func (s *storage) ListRange(key string, start, stop int) ([]string, error) {
 	return s.getStorage(key).ListRange(key, start, stop)
 }
+
+// ListIndex returns element of the list by index, negative index is counted from the list ending.
+// Error will occur if key doesn't exist, key type is not list or index is out of range.
+func (s *storage) ListIndex(key string, index int) (string, error) {
+	return s.getStorage(key).ListIndex(key, index)
+}
+
+// ListSet replaces element of the list by index, negative index is counted from the list ending.
+// Error will occur if key doesn't exist, key type is not list or index is out of range.
+func (s *storage) ListSet(key string, index int, value string) error {
+	return s.getStorage(key).ListSet(key, index, value)
+}
+
+// ListInsert inserts value before or after the first element equal to pivot and returns new length of the list.
+// Error will occur if key doesn't exist, key type is not list or pivot doesn't exist.
+func (s *storage) ListInsert(key, pivot, value string, before bool) (int, error) {
+	return s.getStorage(key).ListInsert(key, pivot, value, before)
+}
+
+// ListRemove removes up to count elements equal to value and returns number of removed elements.
+// Negative count removes them from the list ending, zero count removes all of them.
+// Error will occur if key doesn't exist or key type is not list.
+func (s *storage) ListRemove(key string, count int, value string) (int, error) {
+	return s.getStorage(key).ListRemove(key, count, value)
+}
+
+// ListTrim removes all elements of the list which are out of range from start to stop index inclusive.
+// Error will occur if key doesn't exist or key type is not list.
+func (s *storage) ListTrim(key string, start, stop int) error {
+	return s.getStorage(key).ListTrim(key, start, stop)
+}
+
+// SetAdd adds members to set and returns number of new members. Set is created if key doesn't exist.
+func (s *storage) SetAdd(key string, members []string) (int, error) {
+	return s.getStorage(key).SetAdd(key, members)
+}
+
+// SetRemove removes members from set and returns number of removed members.
+func (s *storage) SetRemove(key string, members []string) (int, error) {
+	return s.getStorage(key).SetRemove(key, members)
+}
+
+// SetIsMember reports whether member is in set. Error will occur if key doesn't exist or key type is not set.
+func (s *storage) SetIsMember(key, member string) (bool, error) {
+	return s.getStorage(key).SetIsMember(key, member)
+}
+
+// SetMembers returns sorted members of set. Error will occur if key doesn't exist or key type is not set.
+func (s *storage) SetMembers(key string) ([]string, error) {
+	return s.getStorage(key).SetMembers(key)
+}
+
+// SetLen returns number of set members. Error will occur if key doesn't exist or key type is not set.
+func (s *storage) SetLen(key string) (int, error) {
+	return s.getStorage(key).SetLen(key)
+}
+
+// SetIntersect returns sorted members which are in all sets. Missing keys are empty sets.
+func (s *storage) SetIntersect(keys []string) ([]string, error) {
+	return s.combineSets(keys, commonStorage.Storage.SetIntersect, commonStorage.IntersectSets)
+}
+
+// SetUnion returns sorted members which are in any of sets. Missing keys are empty sets.
+func (s *storage) SetUnion(keys []string) ([]string, error) {
+	return s.combineSets(keys, commonStorage.Storage.SetUnion, commonStorage.UnionSets)
+}
+
+// SetDiff returns sorted members of the first set which are not in other sets. Missing keys are empty sets.
+func (s *storage) SetDiff(keys []string) ([]string, error) {
+	return s.combineSets(keys, commonStorage.Storage.SetDiff, commonStorage.DiffSets)
+}
+
+// combineSets calls operation of inner storage if all keys belong to it.
+// Otherwise members of every key are read from its storage separately and sets are combined here.
+func (s *storage) combineSets(
+	keys []string,
+	operation func(commonStorage.Storage, []string) ([]string, error),
+	combine func([]commonStorage.Set) []string,
+) ([]string, error) {
+	groups := s.groupKeys(keys)
+	if len(groups) == 1 {
+		for n := range groups {
+			return operation(s.storages[n], keys)
+		}
+	}
+
+	sets := make([]commonStorage.Set, len(keys))
+	for i, key := range keys {
+		members, err := s.getStorage(key).SetMembers(key)
+		if err == commonStorage.KeyNotExistsError {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		sets[i] = make(commonStorage.Set, len(members))
+		sets[i].Add(members...)
+	}
+	return combine(sets), nil
+}
+
+// SortedSetAdd adds members or updates their scores and returns number of new members.
+func (s *storage) SortedSetAdd(key string, members []commonStorage.ScoredMember) (int, error) {
+	return s.getStorage(key).SortedSetAdd(key, members)
+}
+
+// SortedSetRemove removes members from sorted set and returns number of removed members.
+func (s *storage) SortedSetRemove(key string, members []string) (int, error) {
+	return s.getStorage(key).SortedSetRemove(key, members)
+}
+
+// SortedSetScore returns score of member. Error will occur if key or member doesn't exist.
+func (s *storage) SortedSetScore(key, member string) (float64, error) {
+	return s.getStorage(key).SortedSetScore(key, member)
+}
+
+// SortedSetIncrementBy adds delta to score of member and returns new score.
+func (s *storage) SortedSetIncrementBy(key, member string, delta float64) (float64, error) {
+	return s.getStorage(key).SortedSetIncrementBy(key, member, delta)
+}
+
+// SortedSetRange returns members from start to stop rank, negative ranks are counted from the end.
+func (s *storage) SortedSetRange(key string, start, stop int, reverse bool) ([]commonStorage.ScoredMember, error) {
+	return s.getStorage(key).SortedSetRange(key, start, stop, reverse)
+}
+
+// SortedSetRangeByScore returns members with score between min and max inclusive.
+func (s *storage) SortedSetRangeByScore(key string, min, max float64, offset, count int) ([]commonStorage.ScoredMember, error) {
+	return s.getStorage(key).SortedSetRangeByScore(key, min, max, offset, count)
+}
+
+// SortedSetRank returns 0-based rank of member in ascending order.
+func (s *storage) SortedSetRank(key, member string) (int, error) {
+	return s.getStorage(key).SortedSetRank(key, member)
+}
+
+// SortedSetLen returns number of members. Error will occur if key doesn't exist or key type is not sorted set.
+func (s *storage) SortedSetLen(key string) (int, error) {
+	return s.getStorage(key).SortedSetLen(key)
+}
@@ -1,8 +1,10 @@
 package multi
 
 import (
+	"testing"
 	"time"
 
+	commonStorage "github.com/Barberrrry/jcache/server/storage"
 	"github.com/Barberrrry/jcache/server/storage/memory"
 	. "gopkg.in/check.v1"
 )
@@ -11,6 +13,10 @@ type MultiStorageTestSuite struct{}
 
 var _ = Suite(&MultiStorageTestSuite{})
 
+func Test(t *testing.T) {
+	TestingT(t)
+}
+
 func (s *MultiStorageTestSuite) TestKeys(c *C) {
 	storage := NewStorage()
 	ms, _ := memory.NewStorage(100, time.Minute)
@@ -48,7 +54,7 @@ func (s *MultiStorageTestSuite) TestSetAndGet(c *C) {
 
 	// Get non-existing key value and get error
 	value1, err1 := storage.Get("key")
-	c.Assert(err1, ErrorMatches, `Key "key" does not exist`)
+	c.Assert(err1, ErrorMatches, "Key does not exist")
 	c.Assert(value1, Equals, "")
 
 	// Set key value
@@ -66,5 +72,124 @@ func (s *MultiStorageTestSuite) TestSetAndGet(c *C) {
 
 	// Try to set existing key value
 	err5 := storage.Set("key", "value", 0)
-	c.Assert(err5, ErrorMatches, `Key "key" already exists`)
+	c.Assert(err5, ErrorMatches, "Key already exists")
+}
+
+func (s *MultiStorageTestSuite) TestSetCombine(c *C) {
+	storage := NewStorage()
+	for i := 0; i < 4; i++ {
+		ms, _ := memory.NewStorage(100, time.Minute)
+		storage.AddStorage(ms)
+	}
+
+	// Keys are spread over different storages
+	storage.SetAdd("key0", []string{"a", "b", "c"})
+	storage.SetAdd("key1", []string{"b", "c", "d"})
+	storage.SetAdd("key2", []string{"c", "e"})
+	keys := []string{"key0", "key1", "key2"}
+
+	members, err := storage.SetIntersect(keys)
+	c.Assert(err, IsNil)
+	c.Assert(members, DeepEquals, []string{"c"})
+
+	members, err = storage.SetUnion(keys)
+	c.Assert(err, IsNil)
+	c.Assert(members, DeepEquals, []string{"a", "b", "c", "d", "e"})
+
+	members, err = storage.SetDiff(append(keys, "unknown"))
+	c.Assert(err, IsNil)
+	c.Assert(members, DeepEquals, []string{"a"})
+}
+
+func (s *MultiStorageTestSuite) TestListBlockingPop(c *C) {
+	storage := NewStorage()
+	for i := 0; i < 4; i++ {
+		ms, _ := memory.NewStorage(100, time.Minute)
+		storage.AddStorage(ms)
+	}
+
+	// Keys are spread over different storages
+	c.Assert(storage.getStorageIndex("key0"), Not(Equals), storage.getStorageIndex("key1"))
+	c.Assert(storage.getStorageIndex("key1"), Not(Equals), storage.getStorageIndex("key2"))
+	c.Assert(storage.getStorageIndex("key0"), Not(Equals), storage.getStorageIndex("key2"))
+	storage.ListRightPush("key2", "a")
+	key, value, err := storage.ListBlockingLeftPop([]string{"key0", "key1", "key2"}, time.Second)
+	c.Assert(err, IsNil)
+	c.Assert(key+" "+value, Equals, "key2 a")
+
+	result := make(chan string, 1)
+	go func() {
+		key, value, err := storage.ListBlockingRightPop([]string{"key0", "key1"}, 0)
+		c.Check(err, IsNil)
+		result <- key + " " + value
+	}()
+	storage.ListRightPush("key1", "b")
+	c.Assert(<-result, Equals, "key1 b")
+
+	// Waiter which is served by one storage is not served by another one
+	storage.ListRightPush("key0", "c")
+	length, _ := storage.ListLen("key0")
+	c.Assert(length, Equals, 1)
+
+	_, _, err = storage.ListBlockingRightPop([]string{"key1", "key2"}, 10*time.Millisecond)
+	c.Assert(err, Equals, commonStorage.ListEmptyError)
+
+	err = storage.Transaction(func(tx commonStorage.Storage) error {
+		_, _, err := tx.ListBlockingLeftPop([]string{"key1", "key2"}, 0)
+		return err
+	})
+	c.Assert(err, Equals, commonStorage.ListEmptyError)
+}
+
+func (s *MultiStorageTestSuite) TestListMove(c *C) {
+	storage := NewStorage()
+	for i := 0; i < 4; i++ {
+		ms, _ := memory.NewStorage(100, time.Minute)
+		storage.AddStorage(ms)
+	}
+
+	// Lists are in different storages
+	c.Assert(storage.getStorageIndex("pending"), Not(Equals), storage.getStorageIndex("progress"))
+	c.Assert(storage.getStorageIndex("done"), Not(Equals), storage.getStorageIndex("progress"))
+	storage.ListRightPush("pending", "a")
+	storage.ListRightPush("pending", "b")
+	value, err := storage.ListMove("pending", "progress", true, true)
+	c.Assert(err, IsNil)
+	c.Assert(value, Equals, "a")
+	values, _ := storage.ListRange("progress", 0, 10)
+	c.Assert(values, DeepEquals, []string{"a"})
+
+	// Pop is rolled back if destination is not a list
+	storage.Set("key1", "value", 0)
+	_, err = storage.ListMove("pending", "key1", true, true)
+	c.Assert(err, Equals, commonStorage.KeyListTypeError)
+	values, _ = storage.ListRange("pending", 0, 10)
+	c.Assert(values, DeepEquals, []string{"b"})
+
+	result := make(chan string, 1)
+	go func() {
+		value, err := storage.ListBlockingMove("done", "progress", false, false, 0)
+		c.Check(err, IsNil)
+		result <- value
+	}()
+	storage.ListRightPush("done", "c")
+	c.Assert(<-result, Equals, "c")
+	values, _ = storage.ListRange("progress", 0, 10)
+	c.Assert(values, DeepEquals, []string{"a", "c"})
+
+	_, err = storage.ListBlockingMove("done", "progress", true, true, 10*time.Millisecond)
+	c.Assert(err, Equals, commonStorage.ListEmptyError)
+
+	// Value pushed while waiting stays in the source if destination is not a list
+	c.Assert(storage.getStorageIndex("done"), Not(Equals), storage.getStorageIndex("key1"))
+	failed := make(chan error, 1)
+	go func() {
+		_, err := storage.ListBlockingMove("done", "key1", true, true, 0)
+		failed <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	storage.ListRightPush("done", "d")
+	c.Assert(<-failed, Equals, commonStorage.KeyListTypeError)
+	values, _ = storage.ListRange("done", 0, 10)
+	c.Assert(values, DeepEquals, []string{"d"})
 }
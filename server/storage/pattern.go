@@ -0,0 +1,95 @@
+package storage
+
+// MatchPattern reports whether key matches glob-style pattern.
+// Pattern may contain "*" to match any sequence of bytes, "?" to match any single byte,
+// "[abc]" to match any byte from the set (ranges like "[a-z]" and negation like "[^a]" are allowed)
+// and "\x" to match x literally.
+func MatchPattern(pattern, key string) bool {
+	// Only the last "*" is retried on mismatch by matching one more byte of key with it,
+	// so matching takes O(len(pattern) * len(key)) time.
+	star := false
+	var starPattern, starKey string
+	for {
+		if len(pattern) == 0 {
+			if len(key) == 0 {
+				return true
+			}
+		} else if pattern[0] == '*' {
+			for len(pattern) > 0 && pattern[0] == '*' {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 0 {
+				return true
+			}
+			star, starPattern, starKey = true, pattern, key
+			continue
+		} else if matched, rest := matchByte(pattern, key); matched {
+			pattern, key = rest, key[1:]
+			continue
+		}
+
+		if !star || len(starKey) == 0 {
+			return false
+		}
+		starKey = starKey[1:]
+		pattern, key = starPattern, starKey
+	}
+}
+
+// matchByte matches the first byte of key against the first element of pattern which is not "*".
+// It returns match result and the rest of pattern after the element.
+func matchByte(pattern, key string) (bool, string) {
+	if len(key) == 0 {
+		return false, ""
+	}
+	switch pattern[0] {
+	case '?':
+		return true, pattern[1:]
+	case '[':
+		return matchClass(pattern[1:], key[0])
+	}
+	if pattern[0] == '\\' && len(pattern) > 1 {
+		pattern = pattern[1:]
+	}
+	return pattern[0] == key[0], pattern[1:]
+}
+
+// matchClass checks byte b against character class which starts right after '['.
+// It returns match result and the rest of pattern after closing ']'.
+func matchClass(pattern string, b byte) (bool, string) {
+	negate := false
+	if len(pattern) > 0 && pattern[0] == '^' {
+		negate = true
+		pattern = pattern[1:]
+	}
+
+	matched := false
+	for len(pattern) > 0 && pattern[0] != ']' {
+		switch {
+		case pattern[0] == '\\' && len(pattern) > 1:
+			if pattern[1] == b {
+				matched = true
+			}
+			pattern = pattern[2:]
+		case len(pattern) > 2 && pattern[1] == '-' && pattern[2] != ']':
+			start, end := pattern[0], pattern[2]
+			if start > end {
+				start, end = end, start
+			}
+			if b >= start && b <= end {
+				matched = true
+			}
+			pattern = pattern[3:]
+		default:
+			if pattern[0] == b {
+				matched = true
+			}
+			pattern = pattern[1:]
+		}
+	}
+	if len(pattern) > 0 {
+		pattern = pattern[1:]
+	}
+
+	return matched != negate, pattern
+}
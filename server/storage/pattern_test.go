@@ -0,0 +1,46 @@
+package storage
+
+import (
+	"strings"
+
+	. "gopkg.in/check.v1"
+)
+
+type PatternTestSuite struct{}
+
+var _ = Suite(&PatternTestSuite{})
+
+func (s *PatternTestSuite) TestMatchPattern(c *C) {
+	for _, t := range []struct {
+		pattern string
+		key     string
+		match   bool
+	}{
+		{"*", "", true},
+		{"*", "any/key", true},
+		{"key", "key", true},
+		{"key", "key1", false},
+		{"key*", "key1", true},
+		{"*:1", "user:1", true},
+		{"*:1", "user:12", false},
+		{"k?y", "key", true},
+		{"k?y", "ky", false},
+		{"h[ae]llo", "hello", true},
+		{"h[ae]llo", "hillo", false},
+		{"h[^e]llo", "hallo", true},
+		{"h[^e]llo", "hello", false},
+		{"key[0-9]", "key5", true},
+		{"key[0-9]", "keyx", false},
+		{"a\\*b", "a*b", true},
+		{"a\\*b", "axb", false},
+		{"a**b", "a/x/b", true},
+		{"*a*b", "xaxxb", true},
+		{"*a*b", "xaxxbx", false},
+		{"a*b*", "ab", true},
+		{"*[0-9]", "key12", true},
+		{"*?", "", false},
+		{strings.Repeat("*a", 20) + "*b", strings.Repeat("a", 100), false},
+	} {
+		c.Check(MatchPattern(t.pattern, t.key), Equals, t.match, Commentf("pattern %q, key %q", t.pattern, t.key))
+	}
+}
@@ -0,0 +1,95 @@
+package storage
+
+import (
+	"sort"
+)
+
+// Set is a set of unique members. Bool values are used instead of empty structs because gob can't encode them.
+type Set map[string]bool
+
+// Add adds members to set and returns number of members which weren't in set before
+func (s Set) Add(members ...string) int {
+	added := 0
+	for _, member := range members {
+		if !s[member] {
+			s[member] = true
+			added++
+		}
+	}
+	return added
+}
+
+// Remove removes members from set and returns number of members which were in set
+func (s Set) Remove(members ...string) int {
+	removed := 0
+	for _, member := range members {
+		if s[member] {
+			delete(s, member)
+			removed++
+		}
+	}
+	return removed
+}
+
+// Members returns sorted list of set members
+func (s Set) Members() []string {
+	members := make([]string, 0, len(s))
+	for member := range s {
+		members = append(members, member)
+	}
+	sort.Strings(members)
+	return members
+}
+
+// IntersectSets returns members which are in all sets. Nil set is empty.
+func IntersectSets(sets []Set) []string {
+	members := []string{}
+	if len(sets) == 0 {
+		return members
+	}
+	for _, member := range sets[0].Members() {
+		found := true
+		for _, set := range sets[1:] {
+			if !set[member] {
+				found = false
+				break
+			}
+		}
+		if found {
+			members = append(members, member)
+		}
+	}
+	return members
+}
+
+// UnionSets returns members which are in any of sets. Nil set is empty.
+func UnionSets(sets []Set) []string {
+	union := make(Set)
+	for _, set := range sets {
+		for member := range set {
+			union[member] = true
+		}
+	}
+	return union.Members()
+}
+
+// DiffSets returns members of the first set which are not in other sets. Nil set is empty.
+func DiffSets(sets []Set) []string {
+	members := []string{}
+	if len(sets) == 0 {
+		return members
+	}
+	for _, member := range sets[0].Members() {
+		found := false
+		for _, set := range sets[1:] {
+			if set[member] {
+				found = true
+				break
+			}
+		}
+		if !found {
+			members = append(members, member)
+		}
+	}
+	return members
+}
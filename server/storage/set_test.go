@@ -0,0 +1,37 @@
+package storage
+
+import (
+	. "gopkg.in/check.v1"
+)
+
+type SetTestSuite struct{}
+
+var _ = Suite(&SetTestSuite{})
+
+func (s *SetTestSuite) TestAddRemove(c *C) {
+	set := make(Set)
+	c.Assert(set.Add("b", "a", "b"), Equals, 2)
+	c.Assert(set.Add("a", "c"), Equals, 1)
+	c.Assert(set.Members(), DeepEquals, []string{"a", "b", "c"})
+
+	c.Assert(set.Remove("a", "d"), Equals, 1)
+	c.Assert(set.Members(), DeepEquals, []string{"b", "c"})
+}
+
+func (s *SetTestSuite) TestCombine(c *C) {
+	sets := []Set{
+		{"a": true, "b": true, "c": true},
+		{"b": true, "c": true, "d": true},
+		{"c": true, "e": true},
+	}
+	c.Assert(IntersectSets(sets), DeepEquals, []string{"c"})
+	c.Assert(UnionSets(sets), DeepEquals, []string{"a", "b", "c", "d", "e"})
+	c.Assert(DiffSets(sets), DeepEquals, []string{"a"})
+
+	// Nil set is empty
+	sets = []Set{{"a": true}, nil}
+	c.Assert(IntersectSets(sets), DeepEquals, []string{})
+	c.Assert(UnionSets(sets), DeepEquals, []string{"a"})
+	c.Assert(DiffSets(sets), DeepEquals, []string{"a"})
+	c.Assert(DiffSets([]Set{nil, {"a": true}}), DeepEquals, []string{})
+}
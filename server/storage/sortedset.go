@@ -0,0 +1,311 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/gob"
+	"math"
+	"math/rand"
+)
+
+const (
+	skiplistMaxLevel = 32
+	// skiplistP is a probability of node to be promoted to the next level
+	skiplistP = 0.25
+)
+
+// ScoredMember is a member of sorted set with its score
+type ScoredMember struct {
+	Member string
+	Score  float64
+}
+
+// SortedSet is a set of unique members ordered by score, members with equal scores are ordered lexicographically.
+// Members are kept in skiplist which allows to add, remove and find rank of member in O(log N).
+// Every link of skiplist stores its span, so range by rank doesn't need to walk from the beginning.
+type SortedSet struct {
+	scores map[string]float64
+	head   *skiplistNode
+	level  int
+	// length is a number of skiplist nodes, it differs from number of scores while score of member is updated
+	length int
+}
+
+type skiplistNode struct {
+	ScoredMember
+	backward *skiplistNode
+	levels   []skiplistLink
+}
+
+type skiplistLink struct {
+	forward *skiplistNode
+	// span is a number of nodes between current node and forward one, forward node is counted
+	span int
+}
+
+// NewSortedSet creates empty sorted set
+func NewSortedSet() *SortedSet {
+	return &SortedSet{
+		scores: make(map[string]float64),
+		head:   &skiplistNode{levels: make([]skiplistLink, skiplistMaxLevel)},
+		level:  1,
+	}
+}
+
+// Len returns number of members
+func (s *SortedSet) Len() int {
+	return s.length
+}
+
+// Score returns score of member and reports whether member is in set
+func (s *SortedSet) Score(member string) (float64, bool) {
+	score, found := s.scores[member]
+	return score, found
+}
+
+// Add adds members or updates scores of existing members.
+// It returns number of new members and number of existing members which score was changed.
+func (s *SortedSet) Add(members ...ScoredMember) (added, updated int) {
+	for _, m := range members {
+		current, found := s.scores[m.Member]
+		if found && current == m.Score {
+			continue
+		}
+		if found {
+			s.delete(ScoredMember{Member: m.Member, Score: current})
+			updated++
+		} else {
+			added++
+		}
+		s.insert(m)
+		s.scores[m.Member] = m.Score
+	}
+	return
+}
+
+// IncrementBy adds delta to score of member and returns new score. Missing member is added with score equal to delta.
+// Error will occur if new score is not a number, e.g. if infinities of different signs are added.
+func (s *SortedSet) IncrementBy(member string, delta float64) (float64, error) {
+	score := s.scores[member] + delta
+	if math.IsNaN(score) {
+		return 0, ScoreNaNError
+	}
+	s.Add(ScoredMember{Member: member, Score: score})
+	return score, nil
+}
+
+// Remove removes members and returns number of members which were in set
+func (s *SortedSet) Remove(members ...string) int {
+	removed := 0
+	for _, member := range members {
+		score, found := s.scores[member]
+		if !found {
+			continue
+		}
+		s.delete(ScoredMember{Member: member, Score: score})
+		delete(s.scores, member)
+		removed++
+	}
+	return removed
+}
+
+// Rank returns 0-based position of member in ascending order and reports whether member is in set
+func (s *SortedSet) Rank(member string) (int, bool) {
+	score, found := s.scores[member]
+	if !found {
+		return 0, false
+	}
+	target := ScoredMember{Member: member, Score: score}
+	rank := 0
+	node := s.head
+	for i := s.level - 1; i >= 0; i-- {
+		for next := node.levels[i].forward; next != nil && !less(target, next.ScoredMember); next = node.levels[i].forward {
+			rank += node.levels[i].span
+			node = next
+		}
+		if node != s.head && node.Member == member {
+			return rank - 1, true
+		}
+	}
+	return 0, false
+}
+
+// Range returns members from start to stop rank inclusive. Negative ranks are counted from the end of set,
+// -1 is the last member. Members are ordered by descending score if reverse is set.
+func (s *SortedSet) Range(start, stop int, reverse bool) []ScoredMember {
+	length := s.Len()
+	members := []ScoredMember{}
+	start, stop, ok := ListRangeBounds(length, start, stop)
+	if !ok {
+		return members
+	}
+
+	var node *skiplistNode
+	if reverse {
+		node = s.byRank(length - start)
+	} else {
+		node = s.byRank(start + 1)
+	}
+	for i := start; i <= stop; i++ {
+		members = append(members, node.ScoredMember)
+		if reverse {
+			node = node.backward
+		} else {
+			node = node.levels[0].forward
+		}
+	}
+	return members
+}
+
+// RangeByScore returns members with min <= score <= max in ascending order.
+// First offset members are skipped, negative count means all following members.
+func (s *SortedSet) RangeByScore(min, max float64, offset, count int) []ScoredMember {
+	members := []ScoredMember{}
+	if offset < 0 {
+		return members
+	}
+	node := s.head
+	for i := s.level - 1; i >= 0; i-- {
+		for next := node.levels[i].forward; next != nil && next.Score < min; next = node.levels[i].forward {
+			node = next
+		}
+	}
+	for node = node.levels[0].forward; node != nil && node.Score <= max; node = node.levels[0].forward {
+		if count >= 0 && len(members) == count {
+			break
+		}
+		if offset > 0 {
+			offset--
+			continue
+		}
+		members = append(members, node.ScoredMember)
+	}
+	return members
+}
+
+// Copy returns independent copy of sorted set
+func (s *SortedSet) Copy() *SortedSet {
+	c := NewSortedSet()
+	c.Add(s.Range(0, -1, false)...)
+	return c
+}
+
+// GobEncode encodes members in ascending order, skiplist is rebuilt by GobDecode
+func (s *SortedSet) GobEncode() ([]byte, error) {
+	buf := &bytes.Buffer{}
+	err := gob.NewEncoder(buf).Encode(s.Range(0, -1, false))
+	return buf.Bytes(), err
+}
+
+func (s *SortedSet) GobDecode(data []byte) error {
+	var members []ScoredMember
+	if err := gob.NewDecoder(bytes.NewBuffer(data)).Decode(&members); err != nil {
+		return err
+	}
+	*s = *NewSortedSet()
+	s.Add(members...)
+	return nil
+}
+
+// byRank returns node of 1-based rank
+func (s *SortedSet) byRank(rank int) *skiplistNode {
+	traversed := 0
+	node := s.head
+	for i := s.level - 1; i >= 0; i-- {
+		for node.levels[i].forward != nil && traversed+node.levels[i].span <= rank {
+			traversed += node.levels[i].span
+			node = node.levels[i].forward
+		}
+		if traversed == rank {
+			return node
+		}
+	}
+	return nil
+}
+
+func (s *SortedSet) insert(m ScoredMember) {
+	var update [skiplistMaxLevel]*skiplistNode
+	var rank [skiplistMaxLevel]int
+	node := s.head
+	for i := s.level - 1; i >= 0; i-- {
+		if i < s.level-1 {
+			rank[i] = rank[i+1]
+		}
+		for next := node.levels[i].forward; next != nil && less(next.ScoredMember, m); next = node.levels[i].forward {
+			rank[i] += node.levels[i].span
+			node = next
+		}
+		update[i] = node
+	}
+
+	level := randomLevel()
+	if level > s.level {
+		for i := s.level; i < level; i++ {
+			update[i] = s.head
+			s.head.levels[i].span = s.length
+		}
+		s.level = level
+	}
+
+	node = &skiplistNode{ScoredMember: m, levels: make([]skiplistLink, level)}
+	for i := 0; i < level; i++ {
+		node.levels[i].forward = update[i].levels[i].forward
+		update[i].levels[i].forward = node
+		node.levels[i].span = update[i].levels[i].span - (rank[0] - rank[i])
+		update[i].levels[i].span = rank[0] - rank[i] + 1
+	}
+	for i := level; i < s.level; i++ {
+		update[i].levels[i].span++
+	}
+
+	if update[0] != s.head {
+		node.backward = update[0]
+	}
+	if node.levels[0].forward != nil {
+		node.levels[0].forward.backward = node
+	}
+	s.length++
+}
+
+func (s *SortedSet) delete(m ScoredMember) {
+	var update [skiplistMaxLevel]*skiplistNode
+	node := s.head
+	for i := s.level - 1; i >= 0; i-- {
+		for next := node.levels[i].forward; next != nil && less(next.ScoredMember, m); next = node.levels[i].forward {
+			node = next
+		}
+		update[i] = node
+	}
+	node = node.levels[0].forward
+	if node == nil || node.ScoredMember != m {
+		return
+	}
+
+	for i := 0; i < s.level; i++ {
+		if update[i].levels[i].forward == node {
+			update[i].levels[i].span += node.levels[i].span - 1
+			update[i].levels[i].forward = node.levels[i].forward
+		} else {
+			update[i].levels[i].span--
+		}
+	}
+	if node.levels[0].forward != nil {
+		node.levels[0].forward.backward = node.backward
+	}
+	for s.level > 1 && s.head.levels[s.level-1].forward == nil {
+		s.level--
+	}
+	s.length--
+}
+
+// less reports whether a is ordered before b: by score and then by member
+func less(a, b ScoredMember) bool {
+	return a.Score < b.Score || (a.Score == b.Score && a.Member < b.Member)
+}
+
+func randomLevel() int {
+	level := 1
+	for level < skiplistMaxLevel && rand.Float64() < skiplistP {
+		level++
+	}
+	return level
+}
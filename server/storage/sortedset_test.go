@@ -0,0 +1,113 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+
+	. "gopkg.in/check.v1"
+)
+
+type SortedSetTestSuite struct{}
+
+var _ = Suite(&SortedSetTestSuite{})
+
+func (s *SortedSetTestSuite) TestAddRemove(c *C) {
+	set := NewSortedSet()
+	added, updated := set.Add(ScoredMember{"b", 2}, ScoredMember{"a", 1}, ScoredMember{"c", 2})
+	c.Assert(added, Equals, 3)
+	c.Assert(updated, Equals, 0)
+
+	added, updated = set.Add(ScoredMember{"a", 3}, ScoredMember{"b", 2})
+	c.Assert(added, Equals, 0)
+	c.Assert(updated, Equals, 1)
+	c.Assert(set.Range(0, -1, false), DeepEquals, []ScoredMember{{"b", 2}, {"c", 2}, {"a", 3}})
+
+	score, found := set.Score("a")
+	c.Assert(found, Equals, true)
+	c.Assert(score, Equals, 3.0)
+
+	c.Assert(set.Remove("b", "d"), Equals, 1)
+	c.Assert(set.Len(), Equals, 2)
+	_, found = set.Score("b")
+	c.Assert(found, Equals, false)
+}
+
+func (s *SortedSetTestSuite) TestIncrementBy(c *C) {
+	set := NewSortedSet()
+	score, err := set.IncrementBy("a", 1.5)
+	c.Assert(err, IsNil)
+	c.Assert(score, Equals, 1.5)
+	score, err = set.IncrementBy("a", -2)
+	c.Assert(err, IsNil)
+	c.Assert(score, Equals, -0.5)
+
+	set.Add(ScoredMember{"inf", math.Inf(1)})
+	_, err = set.IncrementBy("inf", math.Inf(-1))
+	c.Assert(err, Equals, ScoreNaNError)
+}
+
+func (s *SortedSetTestSuite) TestRange(c *C) {
+	set := NewSortedSet()
+	set.Add(ScoredMember{"a", 1}, ScoredMember{"b", 2}, ScoredMember{"c", 3}, ScoredMember{"d", 4})
+
+	c.Assert(set.Range(1, 2, false), DeepEquals, []ScoredMember{{"b", 2}, {"c", 3}})
+	c.Assert(set.Range(-2, -1, false), DeepEquals, []ScoredMember{{"c", 3}, {"d", 4}})
+	c.Assert(set.Range(0, 1, true), DeepEquals, []ScoredMember{{"d", 4}, {"c", 3}})
+	c.Assert(set.Range(-10, 10, true), HasLen, 4)
+	c.Assert(set.Range(3, 1, false), DeepEquals, []ScoredMember{})
+
+	c.Assert(set.RangeByScore(2, 3, 0, -1), DeepEquals, []ScoredMember{{"b", 2}, {"c", 3}})
+	c.Assert(set.RangeByScore(math.Inf(-1), math.Inf(1), 1, 2), DeepEquals, []ScoredMember{{"b", 2}, {"c", 3}})
+	c.Assert(set.RangeByScore(5, 10, 0, -1), DeepEquals, []ScoredMember{})
+	c.Assert(set.RangeByScore(1, 4, 0, 0), DeepEquals, []ScoredMember{})
+}
+
+// TestRandom compares skiplist with sorted slice after random changes
+func (s *SortedSetTestSuite) TestRandom(c *C) {
+	set := NewSortedSet()
+	scores := make(map[string]float64)
+	for i := 0; i < 2000; i++ {
+		member := fmt.Sprint("m", rand.Intn(200))
+		if rand.Intn(3) == 0 {
+			set.Remove(member)
+			delete(scores, member)
+			continue
+		}
+		score := float64(rand.Intn(50))
+		set.Add(ScoredMember{member, score})
+		scores[member] = score
+	}
+
+	var expected []ScoredMember
+	for member, score := range scores {
+		expected = append(expected, ScoredMember{member, score})
+	}
+	sort.Slice(expected, func(i, j int) bool { return less(expected[i], expected[j]) })
+
+	c.Assert(set.Len(), Equals, len(expected))
+	c.Assert(set.Range(0, -1, false), DeepEquals, expected)
+	for i, m := range expected {
+		rank, found := set.Rank(m.Member)
+		c.Assert(found, Equals, true)
+		c.Assert(rank, Equals, i)
+		c.Assert(set.Range(i, i, false), DeepEquals, []ScoredMember{m})
+		c.Assert(set.Range(i, i, true), DeepEquals, []ScoredMember{expected[len(expected)-1-i]})
+	}
+}
+
+func (s *SortedSetTestSuite) TestGob(c *C) {
+	set := NewSortedSet()
+	set.Add(ScoredMember{"a", 1}, ScoredMember{"b", math.Inf(-1)})
+
+	buf := &bytes.Buffer{}
+	c.Assert(gob.NewEncoder(buf).Encode(set), IsNil)
+	decoded := &SortedSet{}
+	c.Assert(gob.NewDecoder(buf).Decode(decoded), IsNil)
+	c.Assert(decoded.Range(0, -1, false), DeepEquals, set.Range(0, -1, false))
+	rank, _ := decoded.Rank("a")
+	c.Assert(rank, Equals, 1)
+}
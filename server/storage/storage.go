@@ -2,15 +2,30 @@ package storage
 
 import (
 	"errors"
+	"time"
 )
 
 type Storage interface {
 	Keys() []string
+	Scan(cursor string, options ScanOptions) (next string, keys []string, err error)
 	Expire(key string, ttl uint64) error
+	ExpireAt(key string, expireTime time.Time) error
+	ExpireSliding(key string, ttl time.Duration) error
+	Touch(key string) error
+	Persist(key string) error
+	Type(key string) (string, error)
+	ExpireTime(key string) (time.Time, error)
 	Get(key string) (string, error)
+	GetWithVersion(key string) (string, uint64, error)
+	CompareAndSwap(key, value string, version uint64) error
 	Set(key, value string, ttl uint64) error
+	SetWithOptions(key, value string, ttl uint64, options SetOptions) (old string, existed bool, err error)
 	Update(key, value string) error
+	Increment(key string, delta int64, ttl uint64) (int64, error)
 	Delete(key string) error
+	GetMulti(keys []string) ([]string, []error)
+	SetMulti(keys, values []string, ttl uint64) []error
+	DeleteMulti(keys []string) []error
 	HashCreate(key string, ttl uint64) error
 	HashGet(key, field string) (string, error)
 	HashGetAll(key string) (map[string]string, error)
@@ -18,21 +33,173 @@ type Storage interface {
 	HashDelete(key, field string) error
 	HashLen(key string) (int, error)
 	HashKeys(key string) ([]string, error)
+	HashGetMulti(key string, fields []string) ([]string, []error)
+	HashSetMulti(key string, fields, values []string) (int, error)
+	HashIncrementBy(key, field string, delta int64) (int64, error)
+	HashSetIfNotExists(key, field, value string) (bool, error)
+	HashExists(key, field string) (bool, error)
+	// HashScan iterates over hash fields like Scan iterates over keys
+	HashScan(key, cursor string, options ScanOptions) (next string, fields map[string]string, err error)
+	// HashExpireAt, HashPersist and HashExpireTime manage expiration of single hash field, expired fields are invisible
+	HashExpireAt(key, field string, expireTime time.Time) error
+	HashPersist(key, field string) error
+	HashExpireTime(key, field string) (time.Time, error)
 	ListCreate(key string, ttl uint64) error
 	ListLeftPop(key string) (string, error)
 	ListRightPop(key string) (string, error)
 	ListLeftPush(key, value string) error
 	ListRightPush(key, value string) error
+	// ListBlockingLeftPop and ListBlockingRightPop wait for value if all lists are empty, zero timeout means forever
+	ListBlockingLeftPop(keys []string, timeout time.Duration) (key, value string, err error)
+	ListBlockingRightPop(keys []string, timeout time.Duration) (key, value string, err error)
+	ListMove(source, destination string, fromLeft, toLeft bool) (string, error)
+	ListBlockingMove(source, destination string, fromLeft, toLeft bool, timeout time.Duration) (string, error)
 	ListLen(key string) (int, error)
+	// ListRange, ListIndex, ListSet and ListTrim count negative indexes from the list ending, see ListRangeBounds
 	ListRange(key string, start, stop int) ([]string, error)
+	ListIndex(key string, index int) (string, error)
+	ListSet(key string, index int, value string) error
+	ListInsert(key, pivot, value string, before bool) (int, error)
+	ListRemove(key string, count int, value string) (int, error)
+	ListTrim(key string, start, stop int) error
+	SetAdd(key string, members []string) (int, error)
+	SetRemove(key string, members []string) (int, error)
+	SetIsMember(key, member string) (bool, error)
+	SetMembers(key string) ([]string, error)
+	SetLen(key string) (int, error)
+	SetIntersect(keys []string) ([]string, error)
+	SetUnion(keys []string) ([]string, error)
+	SetDiff(keys []string) ([]string, error)
+	SortedSetAdd(key string, members []ScoredMember) (int, error)
+	SortedSetRemove(key string, members []string) (int, error)
+	SortedSetScore(key, member string) (float64, error)
+	SortedSetIncrementBy(key, member string, delta float64) (float64, error)
+	SortedSetRange(key string, start, stop int, reverse bool) ([]ScoredMember, error)
+	SortedSetRangeByScore(key string, min, max float64, offset, count int) ([]ScoredMember, error)
+	SortedSetRank(key, member string) (int, error)
+	SortedSetLen(key string) (int, error)
+}
+
+const (
+	// ScanStart is a cursor which starts iteration of Scan. It is returned by Scan when iteration is finished.
+	ScanStart = "0"
+	// DefaultScanCount is a number of keys examined by Scan if count is not specified
+	DefaultScanCount = 10
+)
+
+// Key types
+const (
+	TypeString = "string"
+	TypeHash   = "hash"
+	TypeList   = "list"
+	TypeSet    = "set"
+	// TypeSortedSet is named as in Redis
+	TypeSortedSet = "zset"
+)
+
+// ScanOptions filter keys returned by Scan
+type ScanOptions struct {
+	// Pattern is glob-style pattern of keys, see MatchPattern. Empty pattern matches all keys.
+	Pattern string
+	// Count is a hint of how many keys are examined per call, page may contain more or less keys
+	Count int
+	// Type is a type of returned keys, empty type matches all keys
+	Type string
+}
+
+// Limit returns number of keys which should be examined per call
+func (o ScanOptions) Limit() int {
+	if o.Count > 0 {
+		return o.Count
+	}
+	return DefaultScanCount
+}
+
+// MatchKey reports whether key matches pattern
+func (o ScanOptions) MatchKey(key string) bool {
+	return o.Pattern == "" || MatchPattern(o.Pattern, key)
+}
+
+// MatchItem reports whether item is alive and matches type
+func (o ScanOptions) MatchItem(item *Item) bool {
+	return item.IsAlive() && (o.Type == "" || o.Type == item.Type())
+}
+
+// SetMode defines whether SetWithOptions requires key to exist
+type SetMode int
+
+const (
+	// SetIfNotExists sets only new key, it is behaviour of Set
+	SetIfNotExists SetMode = iota
+	// SetIfExists overwrites only existing key
+	SetIfExists
+	// SetAlways creates new key or overwrites existing key of any type
+	SetAlways
+)
+
+// SetOptions changes behaviour of SetWithOptions
+type SetOptions struct {
+	Mode SetMode
+	// KeepTTL keeps expire time of overwritten key, ttl is used only for new key
+	KeepTTL bool
+	// Get requires overwritten key to be string and makes its previous value returned
+	Get bool
+	// ExpireTime is used instead of ttl if it is not zero, it allows sub-second and absolute expiration
+	ExpireTime time.Time
+	// SlidingTTL is used instead of ttl and ExpireTime if it is not zero, key expires after SlidingTTL since the last access
+	SlidingTTL time.Duration
+}
+
+// Transactional is implemented by storages which can execute several operations atomically
+type Transactional interface {
+	// Transaction calls fn with storage which operations are applied atomically.
+	// All changes are rolled back if fn returns error. Storage passed to fn must not be used after fn returns.
+	Transaction(fn func(s Storage) error) error
+}
+
+// Keyspace events which are reported by Notifying storage
+const (
+	// EventSet is reported when string value is written
+	EventSet = "set"
+	// EventDel is reported when key is deleted
+	EventDel = "del"
+	// EventExpired is reported when expired key is removed
+	EventExpired = "expired"
+	// EventEvicted is reported when key is evicted to free space for another key
+	EventEvicted = "evicted"
+	// EventHash is reported when hash is created or changed
+	EventHash = "hash"
+	// EventList is reported when list is created or changed
+	EventList = "list"
+)
+
+// Notifier receives keyspace events. It is called under lock of storage, so it must not block or use storage.
+type Notifier func(event, key string)
+
+// Notifying is implemented by storages which report keyspace events
+type Notifying interface {
+	// SetNotifier sets function which receives events, nil notifier turns events off
+	SetNotifier(notifier Notifier)
 }
 
 var (
 	KeyNotExistsError     = errors.New("Key does not exist")
 	KeyAlreadyExistsError = errors.New("Key already exists")
 	ListEmptyError        = errors.New("List is empty")
+	IndexOutOfRangeError  = errors.New("Index is out of range")
+	PivotNotExistError    = errors.New("Pivot does not exist")
 	FieldNotExistError    = errors.New("Field does not exist")
 	KeyStringTypeError    = errors.New("Key type is not string")
 	KeyHashTypeError      = errors.New("Key type is not hash")
 	KeyListTypeError      = errors.New("Key type is not list")
+	KeySetTypeError       = errors.New("Key type is not set")
+	KeySortedSetTypeError = errors.New("Key type is not sorted set")
+	MemberNotExistError   = errors.New("Member does not exist")
+	ScoreNaNError         = errors.New("Score is not a number")
+	TxNotSupportedError   = errors.New("Transactions are not supported by storage")
+	WaitNotSupportedError = errors.New("Blocking operations are not supported by storage")
+	VersionMismatchError  = errors.New("Key version does not match")
+	InvalidCursorError    = errors.New("Cursor is not valid")
+	NotIntegerError       = errors.New("Value is not an integer")
+	OverflowError         = errors.New("Increment or decrement would overflow")
 )
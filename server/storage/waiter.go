@@ -0,0 +1,126 @@
+package storage
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// ListWaitable is implemented by storages which can park list pop until value is pushed
+type ListWaitable interface {
+	// ListPopOrWait pops value for waiter from the first non-empty list of keys if waiter is not claimed yet.
+	// If all lists are empty, waiter is queued for every key and the following push serves it.
+	// ListEmptyError is returned instead of queueing if storage can't wait, e.g. inside of transaction.
+	ListPopOrWait(keys []string, w *ListWaiter) (key, value string, popped bool, err error)
+	// ListCancelWait removes waiter from queues of keys
+	ListCancelWait(keys []string, w *ListWaiter)
+}
+
+// ListWaiter is a pop which waits for value of several lists. It may be queued by several storages,
+// but value is popped only by the first storage which claims waiter.
+type ListWaiter struct {
+	// Left is set if value is popped from the list beginning
+	Left bool
+	// Destination is a list which popped value is pushed into by the same storage, it is empty for plain pops
+	Destination string
+	// DestinationLeft is set if value is pushed into the destination beginning
+	DestinationLeft bool
+	// Notify is set if waiter is only woken by pushed value, value is left in the list and popped by caller itself
+	Notify  bool
+	claimed int32
+	result  chan listPopResult
+}
+
+type listPopResult struct {
+	key, value string
+	err        error
+}
+
+// NewListWaiter creates waiter for values popped from the list beginning or ending
+func NewListWaiter(left bool) *ListWaiter {
+	return &ListWaiter{Left: left, result: make(chan listPopResult, 1)}
+}
+
+// NewListMoveWaiter creates waiter which value is atomically moved into destination list
+func NewListMoveWaiter(left bool, destination string, destinationLeft bool) *ListWaiter {
+	w := NewListWaiter(left)
+	w.Destination, w.DestinationLeft = destination, destinationLeft
+	return w
+}
+
+// NewListNotifyWaiter creates waiter which is woken when value is pushed, but doesn't pop it
+func NewListNotifyWaiter() *ListWaiter {
+	w := NewListWaiter(true)
+	w.Notify = true
+	return w
+}
+
+// Claim reports whether caller got exclusive right to pop value for waiter
+func (w *ListWaiter) Claim() bool {
+	return atomic.CompareAndSwapInt32(&w.claimed, 0, 1)
+}
+
+// Serve passes popped value to waiter, it must be called only after successful Claim
+func (w *ListWaiter) Serve(key, value string) {
+	w.result <- listPopResult{key: key, value: value}
+}
+
+// Fail passes error to waiter instead of value, it must be called only after successful Claim
+func (w *ListWaiter) Fail(err error) {
+	w.result <- listPopResult{err: err}
+}
+
+// stop claims waiter, so nobody serves it anymore. If waiter is already claimed, result served to it is returned.
+func (w *ListWaiter) stop() (listPopResult, bool) {
+	if w.Claim() {
+		return listPopResult{}, false
+	}
+	return <-w.result, true
+}
+
+// Wait pops value from the first non-empty list of keys or waits until value is pushed into any of them.
+// Storage of every key is returned by storageOf, waiters are served by storages in order of arrival.
+// Zero timeout means waiting forever. ListEmptyError is returned if nothing is pushed before timeout.
+func (w *ListWaiter) Wait(keys []string, timeout time.Duration, storageOf func(key string) ListWaitable) (string, string, error) {
+	defer func() {
+		for _, key := range keys {
+			storageOf(key).ListCancelWait([]string{key}, w)
+		}
+	}()
+
+	// Keys are checked one by one, so value is popped from the first non-empty list even if keys are in different storages.
+	// Waiter is queued for checked keys already, claim guarantees that only one value is popped.
+	canWait := true
+	for _, key := range keys {
+		key, value, popped, err := storageOf(key).ListPopOrWait([]string{key}, w)
+		if popped {
+			return key, value, nil
+		}
+		if err == ListEmptyError {
+			canWait = false
+		} else if err != nil {
+			if result, served := w.stop(); served {
+				return result.key, result.value, result.err
+			}
+			return "", "", err
+		}
+	}
+
+	if canWait {
+		var expired <-chan time.Time
+		if timeout > 0 {
+			timer := time.NewTimer(timeout)
+			defer timer.Stop()
+			expired = timer.C
+		}
+		select {
+		case result := <-w.result:
+			return result.key, result.value, result.err
+		case <-expired:
+		}
+	}
+
+	if result, served := w.stop(); served {
+		return result.key, result.value, result.err
+	}
+	return "", "", ListEmptyError
+}